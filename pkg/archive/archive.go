@@ -0,0 +1,361 @@
+// Package archive keeps motion clips and snapshots after they are delivered,
+// so "what tripped the back door at 3am?" can be answered later. Each camera
+// has a directory of clips; every clip is a video and/or snapshot plus a JSON
+// file of metadata. Clips are pruned per camera by age and total size.
+package archive
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention defaults.
+const (
+	DefaultMaxAge   = 7 * 24 * time.Hour
+	DefaultMaxBytes = 1 << 30 // per camera
+)
+
+const (
+	dirMode   = 0o750
+	fileMode  = 0o600
+	metaExt   = ".json"
+	videoExt  = ".mp4"
+	imageExt  = ".jpg"
+	stampForm = "20060102-150405"
+)
+
+// ErrNotFound is returned for a clip or file the archive does not have.
+var ErrNotFound = errors.New("not in the archive")
+
+// Clip is one archived motion capture.
+type Clip struct {
+	// ID is "{camera dir}/{name}", unique and safe in URLs and button data.
+	ID      string    `json:"id"`
+	Camera  string    `json:"camera"`
+	Time    time.Time `json:"time"`
+	Classes []string  `json:"classes,omitempty"`
+	// Video and Snapshot are file names in the camera's directory, when kept.
+	Video    string `json:"video,omitempty"`
+	Snapshot string `json:"snapshot,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// Archive is the clip archive. A nil Archive keeps nothing.
+type Archive struct {
+	dir      string
+	maxAge   time.Duration
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// New opens (creating) the archive at dir and prunes it. maxAge and maxBytes
+// (per camera) bound what is kept; 0 takes the defaults.
+func New(dir string, maxAge time.Duration, maxBytes int64) (*Archive, error) {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("creating archive dir: %w", err)
+	}
+
+	archive := &Archive{dir: dir, maxAge: maxAge, maxBytes: maxBytes}
+	archive.mu.Lock()
+	archive.prune(time.Now())
+	archive.mu.Unlock()
+
+	return archive, nil
+}
+
+// Keep archives a capture. video and snapshot are copied (either may be empty)
+// and stay the caller's. unique tells apart captures in the same second.
+func (a *Archive) Keep(unique string, clip Clip, video, snapshot string) (*Clip, error) {
+	if a == nil {
+		return nil, nil //nolint:nilnil // a nil archive keeps nothing and that is fine.
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if clip.Time.IsZero() {
+		clip.Time = time.Now()
+	}
+
+	dirName := safeName(clip.Camera)
+	name := clip.Time.Format(stampForm) + "-" + safeName(unique)
+	clip.ID = dirName + "/" + name
+	dir := filepath.Join(a.dir, dirName)
+
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("creating archive dir: %w", err)
+	}
+
+	for _, file := range []struct {
+		src  string
+		ext  string
+		dest *string
+	}{{video, videoExt, &clip.Video}, {snapshot, imageExt, &clip.Snapshot}} {
+		if file.src == "" {
+			continue
+		}
+
+		size, err := linkOrCopy(file.src, filepath.Join(dir, name+file.ext))
+		if err != nil {
+			a.remove(&clip)
+			return nil, err
+		}
+
+		*file.dest = name + file.ext
+		clip.Size += size
+	}
+
+	// The metadata goes last: listings skip clips without it.
+	err = writeMeta(filepath.Join(dir, name+metaExt), &clip)
+	if err != nil {
+		a.remove(&clip)
+		return nil, err
+	}
+
+	a.prune(time.Now())
+
+	return &clip, nil
+}
+
+// List returns archived clips newest first: one camera's, or every camera's
+// when camera is empty. limit 0 returns them all.
+func (a *Archive) List(camera string, limit int) []Clip {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clips := a.list()
+	if camera != "" {
+		clips = slices.DeleteFunc(clips, func(clip Clip) bool { return !strings.EqualFold(clip.Camera, camera) })
+	}
+
+	if limit > 0 && len(clips) > limit {
+		clips = clips[:limit]
+	}
+
+	return clips
+}
+
+// Cameras lists the cameras with archived clips, sorted.
+func (a *Archive) Cameras() []string {
+	cameras := []string{}
+
+	for _, clip := range a.List("", 0) {
+		if !slices.Contains(cameras, clip.Camera) {
+			cameras = append(cameras, clip.Camera)
+		}
+	}
+
+	slices.Sort(cameras)
+
+	return cameras
+}
+
+// Get returns one clip by ID.
+func (a *Archive) Get(id string) (*Clip, error) {
+	if a == nil {
+		return nil, ErrNotFound
+	}
+
+	dirName, name, ok := strings.Cut(id, "/")
+	if !ok || !safePart(dirName) || !safePart(name) {
+		return nil, ErrNotFound
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clip, err := readMeta(filepath.Join(a.dir, dirName, name+metaExt))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	return clip, nil
+}
+
+// Path returns the full path of a file in an archived clip: its Video or Snapshot.
+func (a *Archive) Path(clip *Clip, file string) (string, error) {
+	dirName, _, _ := strings.Cut(clip.ID, "/")
+	if file == "" || (file != clip.Video && file != clip.Snapshot) || !safePart(dirName) || !safePart(file) {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(a.dir, dirName, file), nil
+}
+
+// CopyTo copies a file of an archived clip into dir, for senders that delete
+// what they send. It returns the copy's path.
+func (a *Archive) CopyTo(clip *Clip, file, dir, prefix string) (string, error) {
+	src, err := a.Path(clip, file)
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(dir, prefix+file)
+	if _, err := linkOrCopy(src, dst); err != nil {
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// list reads every clip's metadata, newest first. Hold mu.
+func (a *Archive) list() []Clip {
+	metas, _ := filepath.Glob(filepath.Join(a.dir, "*", "*"+metaExt))
+	clips := make([]Clip, 0, len(metas))
+
+	for _, path := range metas {
+		if clip, err := readMeta(path); err == nil {
+			clips = append(clips, *clip)
+		}
+	}
+
+	slices.SortFunc(clips, func(a, b Clip) int { return cmp.Or(b.Time.Compare(a.Time), strings.Compare(b.ID, a.ID)) })
+
+	return clips
+}
+
+// prune removes clips past the age limit, then each camera's oldest clips
+// until it fits the size limit. Hold mu.
+func (a *Archive) prune(now time.Time) {
+	sizes := make(map[string]int64)
+	cutoff := now.Add(-a.maxAge)
+
+	for _, clip := range a.list() { // newest first
+		sizes[clip.Camera] += clip.Size
+		if clip.Time.Before(cutoff) || sizes[clip.Camera] > a.maxBytes {
+			a.remove(&clip)
+		}
+	}
+}
+
+// remove deletes a clip's files. Hold mu.
+func (a *Archive) remove(clip *Clip) {
+	dirName, name, _ := strings.Cut(clip.ID, "/")
+	dir := filepath.Join(a.dir, dirName)
+
+	_ = os.Remove(filepath.Join(dir, name+metaExt))
+
+	for _, file := range []string{clip.Video, clip.Snapshot, name + videoExt, name + imageExt} {
+		if file != "" {
+			_ = os.Remove(filepath.Join(dir, file))
+		}
+	}
+
+	_ = os.Remove(dir) // only succeeds once it is empty.
+}
+
+func readMeta(path string) (*Clip, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading clip: %w", err)
+	}
+
+	clip := &Clip{}
+	if err := json.Unmarshal(buf, clip); err != nil {
+		return nil, fmt.Errorf("decoding clip: %w", err)
+	}
+
+	return clip, nil
+}
+
+// writeMeta writes a clip's metadata through a temp file, so a listing never
+// sees half of it.
+func writeMeta(path string, clip *Clip) error {
+	buf, err := json.Marshal(clip)
+	if err != nil {
+		return fmt.Errorf("encoding clip: %w", err)
+	}
+
+	err = os.WriteFile(path+".tmp", buf, fileMode)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return fmt.Errorf("writing clip: %w", err)
+	}
+
+	return nil
+}
+
+// linkOrCopy hard links src to dst, or copies it across file systems. It
+// returns the size.
+func linkOrCopy(src, dst string) (int64, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, fmt.Errorf("archiving %s: %w", filepath.Base(src), err)
+	}
+
+	if os.Link(src, dst) == nil {
+		return info.Size(), nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("archiving %s: %w", filepath.Base(src), err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode)
+	if err != nil {
+		return 0, fmt.Errorf("archiving %s: %w", filepath.Base(src), err)
+	}
+
+	size, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(dst)
+		return 0, fmt.Errorf("archiving %s: %w", filepath.Base(src), err)
+	}
+
+	return size, nil
+}
+
+// safeName keeps letters, digits, dashes and dots of a name for a path part.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	if strings.Trim(name, ".") == "" {
+		return "_" + name
+	}
+
+	return name
+}
+
+// safePart reports whether a path part from a request stays inside its directory.
+func safePart(part string) bool {
+	return part != "" && part == safeName(part) && strings.Trim(part, ".") != ""
+}
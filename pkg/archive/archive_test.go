@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTemp(t *testing.T, name string, size int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), fileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestKeepAndList(t *testing.T) {
+	t.Parallel()
+
+	archive, err := New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	video, snap := writeTemp(t, "clip.mp4", 100), writeTemp(t, "snap.jpg", 10)
+
+	kept, err := archive.Keep("abc", Clip{Camera: "Back Door", Time: now, Classes: []string{"human"}}, video, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kept.Size != 110 || kept.Video == "" || !strings.HasPrefix(kept.ID, "Back_Door/") {
+		t.Fatalf("kept: %+v", kept)
+	}
+
+	// The caller still owns its files; the archive keeps its own.
+	_ = os.Remove(video)
+
+	_, _ = archive.Keep("def", Clip{Camera: "Porch", Time: now.Add(time.Second)}, "", snap)
+
+	if got := archive.Cameras(); len(got) != 2 || got[0] != "Back Door" {
+		t.Fatalf("cameras: %v", got)
+	}
+
+	if got := archive.List("back door", 0); len(got) != 1 || got[0].ID != kept.ID {
+		t.Fatalf("list back door: %+v", got)
+	}
+
+	if got := archive.List("", 1); len(got) != 1 || got[0].Camera != "Porch" {
+		t.Fatalf("newest first: %+v", got)
+	}
+
+	clip, err := archive.Get(kept.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := archive.CopyTo(clip, clip.Video, t.TempDir(), "resend_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(copied); err != nil || info.Size() != 100 {
+		t.Fatalf("copy: %v %v", info, err)
+	}
+
+	for _, bad := range []string{"../" + kept.ID, "Back_Door/../x", "Back_Door", "..\\x/y"} {
+		if _, err := archive.Get(bad); err == nil {
+			t.Errorf("Get(%q) should fail", bad)
+		}
+	}
+
+	if _, err := archive.Path(clip, "../../etc/passwd"); err == nil {
+		t.Error("Path outside the clip should fail")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	archive, err := New(t.TempDir(), time.Hour, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	video := writeTemp(t, "clip.mp4", 100)
+
+	_, _ = archive.Keep("old", Clip{Camera: "Porch", Time: now.Add(-2 * time.Hour)}, video, "")
+
+	for i, unique := range []string{"a", "b", "c"} {
+		_, _ = archive.Keep(unique, Clip{Camera: "Porch", Time: now.Add(time.Duration(i) * time.Second)}, video, "")
+	}
+
+	_, _ = archive.Keep("d", Clip{Camera: "Garage", Time: now}, video, "")
+
+	porch := archive.List("Porch", 0)
+	if len(porch) != 2 || !strings.HasSuffix(porch[0].ID, "-c") || !strings.HasSuffix(porch[1].ID, "-b") {
+		t.Fatalf("porch after prune: %+v", porch)
+	}
+
+	if got := archive.List("Garage", 0); len(got) != 1 {
+		t.Fatalf("garage has its own budget: %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+// Alert acknowledgement. A catalog event, or a camera through its __cam:
+// settings entry, with an ack window sends its alerts to the lowest tier of
+// subscribers first, with an Acknowledge button. Each window that passes
+// without anyone pressing it brings in the next tier. A subscription's tier
+// is a rule on that subscription; no rule is tier 0.
+const (
+	ruleAck  = "ack"
+	ruleTier = "tier"
+
+	// MaxAckWindow is the longest wait for an acknowledgement.
+	MaxAckWindow = 24 * time.Hour
+	// MaxAckTier is the highest escalation tier a subscription can be put in.
+	MaxAckTier = 2
+)
+
+// ackWindowMinutes are the /camset acknowledgement presets; 0 is off.
+var ackWindowMinutes = []int{0, 2, 5, 10, 15, 30}
+
+// ErrBadAckWindow is returned by ParseAckWindow for values it cannot use.
+var ErrBadAckWindow = errors.New("ack must be off, minutes, or a duration like 5m up to 24h")
+
+// AckWindow returns how long an alert about name (a catalog event or a camera)
+// waits for acknowledgement before escalating. Zero means it needs none.
+func AckWindow(data *subscribe.Subscribe, name string) time.Duration {
+	if data == nil || data.Events == nil || name == "" {
+		return 0
+	}
+
+	for _, key := range []string{name, CamSettingsKey(name)} {
+		if window, ok := data.Events.RuleGetD(key, ruleAck); ok && window > 0 {
+			return window
+		}
+	}
+
+	return 0
+}
+
+// SetAckWindow sets the acknowledgement window of a catalog event, or of a
+// camera when key is CamSettingsKey(camera). Zero turns it off.
+func SetAckWindow(events *subscribe.Events, key string, window time.Duration) {
+	if events == nil {
+		return
+	}
+
+	events.RuleSetD(key, ruleAck, min(max(window, 0), MaxAckWindow))
+}
+
+// ParseAckWindow reads an ack window from the HTTP API: "off" or "0", whole
+// minutes ("10"), or a Go duration ("90s", "15m").
+func ParseAckWindow(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "off" || value == "0" {
+		return 0, nil
+	}
+
+	if mins, err := strconv.Atoi(value); err == nil {
+		value = strconv.Itoa(mins) + "m"
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 || window > MaxAckWindow {
+		return 0, fmt.Errorf("%w: %q", ErrBadAckWindow, value)
+	}
+
+	return window, nil
+}
+
+// SubTier returns the escalation tier of a subscriber's alerts about an event
+// (a camera name or catalog event). Class subscriptions are checked before a
+// legacy bare-camera one, like SubTopic.
+func SubTier(sub *subscribe.Subscriber, name string, classes []string) int {
+	if sub == nil || sub.Events == nil || name == "" {
+		return 0
+	}
+
+	keys := make([]string, 0, len(classes)+1)
+	for _, class := range classes {
+		keys = append(keys, CameraSubKey(name, class))
+	}
+
+	for _, key := range append(keys, name) {
+		if sub.Events.Exists(key) {
+			tier, _ := sub.Events.RuleGetI(key, ruleTier)
+			return min(max(tier, 0), MaxAckTier)
+		}
+	}
+
+	return 0
+}
+
+// SetSubTier puts one of a subscriber's subscriptions in an escalation tier.
+func SetSubTier(sub *subscribe.Subscriber, key string, tier int) {
+	if sub == nil || sub.Events == nil {
+		return
+	}
+
+	sub.Events.RuleSetI(key, ruleTier, min(max(tier, 0), MaxAckTier))
+}
+
+// subTierLabel is the tier of a subscription for the admin menus: "" for tier 0.
+func subTierLabel(events *subscribe.Events, key string) string {
+	if tier, _ := events.RuleGetI(key, ruleTier); tier > 0 {
+		return fmt.Sprintf("tier %d", tier)
+	}
+
+	return ""
+}
+
+// formatAckWindow shows an ack window in the /camset menus.
+func formatAckWindow(window time.Duration) string {
+	if window <= 0 {
+		return "off"
+	}
+
+	return formatDuration(window)
+}
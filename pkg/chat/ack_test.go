@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+func TestAckWindow(t *testing.T) {
+	t.Parallel()
+
+	data, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = data.Events.New("garage_opened", &subscribe.Rules{})
+	EnsureCameraSettings(data, "Porch")
+
+	if got := AckWindow(data, "garage_opened"); got != 0 {
+		t.Fatalf("unset: got %v", got)
+	}
+
+	SetAckWindow(data.Events, "garage_opened", 5*time.Minute)
+	SetAckWindow(data.Events, CamSettingsKey("Porch"), 48*time.Hour)
+
+	if got := AckWindow(data, "garage_opened"); got != 5*time.Minute {
+		t.Fatalf("event: got %v", got)
+	}
+
+	if got := AckWindow(data, "Porch"); got != MaxAckWindow {
+		t.Fatalf("camera: got %v want the %v cap", got, MaxAckWindow)
+	}
+
+	for value, want := range map[string]time.Duration{"off": 0, "0": 0, "10": 10 * time.Minute, "90s": 90 * time.Second} {
+		if got, err := ParseAckWindow(value); err != nil || got != want {
+			t.Fatalf("ParseAckWindow(%q): got %v, %v want %v", value, got, err, want)
+		}
+	}
+
+	if _, err := ParseAckWindow("25h"); err == nil {
+		t.Fatal("ParseAckWindow accepted more than a day")
+	}
+}
+
+// The tier of a class subscription wins over a bare camera one, like SubTopic.
+func TestSubTier(t *testing.T) {
+	t.Parallel()
+
+	data, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := data.CreateSubWithID(1, "ann", "telegram", false, false)
+	_ = sub.Subscribe("Porch")
+	_ = sub.Subscribe(CameraSubKey("Porch", ClassHuman))
+	SetSubTier(sub, CameraSubKey("Porch", ClassHuman), 2)
+
+	if got := SubTier(sub, "Porch", []string{ClassMotion, ClassHuman}); got != 2 {
+		t.Fatalf("human alert: got tier %d want 2", got)
+	}
+
+	if got := SubTier(sub, "Porch", []string{ClassMotion}); got != 0 {
+		t.Fatalf("motion alert: got tier %d want 0", got)
+	}
+
+	SetSubTier(sub, "Porch", MaxAckTier+5)
+
+	if got := SubTier(sub, "Porch", nil); got != MaxAckTier {
+		t.Fatalf("clamped: got tier %d want %d", got, MaxAckTier)
+	}
+}
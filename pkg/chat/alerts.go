@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golift.io/securityspy/v2"
+	"golift.io/subscribe"
+)
+
+// Buttons under a motion alert: a:{action}:{camera number}[:{class}]. The
+// camera goes by number: names can outgrow Telegram's 64 bytes of callback
+// data, and list positions shift as cameras come and go while alerts linger.
+const (
+	cbAlert        = "a:"
+	cbAlertSnap    = "a:p:"
+	cbAlertClip    = "a:v:"
+	cbAlertMute    = "a:m:"
+	cbAlertUnmute  = "a:r:"
+	cbAlertUnsub   = "a:u:"
+	alertMuteHours = 1
+)
+
+// AlertButtons returns the buttons for one subscriber's copy of a motion alert
+// from a camera: take a snapshot, take another clip, mute the camera for an
+// hour, or unsubscribe from the subscription that fired (a class subscription
+// before a bare-camera one). Nil when the subscriber has no subscription to
+// the camera among classes, e.g. an event subscriber.
+func AlertButtons(sub *subscribe.Subscriber, camNum int, camera string, classes []string) [][]Button {
+	if sub == nil || sub.Events == nil || camera == "" {
+		return nil
+	}
+
+	key := ""
+
+	for _, class := range append(slices.Clone(classes), ClassAny) {
+		if candidate := CameraSubKey(camera, class); sub.Events.Exists(candidate) {
+			key = candidate
+			break
+		}
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	_, class := ParseCameraSubKey(key)
+	num := strconv.Itoa(camNum)
+
+	return [][]Button{
+		{{Label: "Snapshot now", Data: cbAlertSnap + num}, {Label: "Another clip", Data: cbAlertClip + num}},
+		{
+			{Label: fmt.Sprintf("Mute this camera %dh", alertMuteHours), Data: cbAlertMute + num},
+			{Label: "Unsubscribe", Data: cbAlertUnsub + num + ":" + classShort(class)},
+		},
+	}
+}
+
+// handleAlertCallback runs an alert button. Replies are new messages: the
+// alert itself keeps its clip and buttons.
+func (c *Chat) handleAlertCallback(handler *Handler, data string) (*Reply, bool) {
+	if len(data) < len(cbAlertSnap) {
+		return &Reply{Toast: "Unknown button"}, false
+	}
+
+	// Every alert prefix is the same length: "a:" plus an action letter and ':'.
+	numStr, short, _ := strings.Cut(data[len(cbAlertSnap):], ":")
+
+	cam := c.cameraByNum(numStr)
+	if cam == nil {
+		return &Reply{Reply: "That camera is gone — try /cams.", Toast: "Missing"}, false
+	}
+
+	switch {
+	case strings.HasPrefix(data, cbAlertSnap):
+		return c.alertCapture(handler, cam, false), false
+	case strings.HasPrefix(data, cbAlertClip):
+		return c.alertCapture(handler, cam, true), false
+	case strings.HasPrefix(data, cbAlertMute):
+		return c.alertMute(handler, cam, alertMuteHours*time.Hour), true
+	case strings.HasPrefix(data, cbAlertUnmute):
+		return c.alertMute(handler, cam, 0), true
+	case strings.HasPrefix(data, cbAlertUnsub):
+		return c.alertUnsubscribe(handler, cam, classFromShort(short))
+	default:
+		return &Reply{Toast: "Unknown button"}, false
+	}
+}
+
+// cameraByNum looks up a camera by its SecuritySpy number, or nil.
+func (c *Chat) cameraByNum(num string) *securityspy.Camera {
+	cams := c.cameras()
+	if cams == nil {
+		return nil
+	}
+
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return nil
+	}
+
+	return cams.ByNum(n)
+}
+
+func (c *Chat) alertCapture(handler *Handler, cam *securityspy.Camera, video bool) *Reply {
+	kind := CaptionPhoto
+	if video {
+		kind = CaptionVideo
+	}
+
+	path, errMsg := c.snapOne(handler, cam, video)
+	files := []string{}
+
+	if path != "" {
+		files = []string{path}
+	}
+
+	return &Reply{Reply: nonEmpty(errMsg, CameraCaption(cam.Name, kind)), Toast: "Sending…", Files: files}
+}
+
+// alertMute pauses (or, with 0, resumes) every one of the subscriber's
+// subscriptions to the camera.
+func (c *Chat) alertMute(handler *Handler, cam *securityspy.Camera, dur time.Duration) *Reply {
+	classes := cameraSubscribedClasses(handler.Sub, cam.Name)
+	if len(classes) == 0 {
+		return &Reply{Reply: "You're not subscribed to " + cam.Name + ".", Toast: "Missing"}
+	}
+
+	for _, class := range classes {
+		_ = handler.Sub.Events.Pause(CameraSubKey(cam.Name, class), dur)
+	}
+
+	if dur == 0 {
+		return &Reply{Reply: cam.Name + " alerts are back on.", Toast: "Unmuted"}
+	}
+
+	return &Reply{
+		Reply: fmt.Sprintf("Muted %s for %s.", cam.Name, formatDuration(dur)),
+		Toast: "Muted",
+		Keyboard: [][]Button{
+			{{Label: "Unmute", Data: cbAlertUnmute + strconv.Itoa(cam.Number)}},
+		},
+	}
+}
+
+func (c *Chat) alertUnsubscribe(handler *Handler, cam *securityspy.Camera, class string) (*Reply, bool) {
+	key := CameraSubKey(cam.Name, class)
+	if handler.Sub.Events.Name(key) == "" {
+		return &Reply{Reply: "You're not subscribed to " + formatSubLabel(key) + ".", Toast: "Missing"}, false
+	}
+
+	handler.Sub.Events.Remove(key)
+
+	return &Reply{Reply: "Unsubscribed from " + formatSubLabel(key) + ".", Toast: "Removed"}, true
+}
@@ -0,0 +1,33 @@
+package chat
+
+import (
+	"testing"
+
+	"golift.io/subscribe"
+)
+
+func TestAlertButtons(t *testing.T) {
+	t.Parallel()
+
+	sub := &subscribe.Subscriber{ID: 1, Events: &subscribe.Events{Map: make(map[string]*subscribe.Rules)}}
+	_ = sub.Subscribe("Porch")
+	_ = sub.Subscribe(CameraSubKey("Porch", ClassVehicle))
+
+	rows := AlertButtons(sub, 2, "Porch", []string{ClassMotion, ClassVehicle})
+	if len(rows) != 2 || rows[1][1].Data != "a:u:2:v" {
+		t.Fatalf("class subscription should win: %+v", rows)
+	}
+
+	if rows = AlertButtons(sub, 2, "Porch", []string{ClassHuman}); rows[1][1].Data != "a:u:2:*" {
+		t.Fatalf("bare camera subscription: %+v", rows)
+	}
+
+	if rows = AlertButtons(sub, 5, "Garage", []string{ClassMotion}); rows != nil {
+		t.Fatalf("no subscription, no buttons: %+v", rows)
+	}
+
+	rows = AlertButtons(sub, 2, "Porch", nil)
+	if !readOnlyCallback(rows[0][0].Data) || readOnlyCallback(rows[1][0].Data) {
+		t.Fatal("group members may take snapshots from an alert, but not mute the camera")
+	}
+}
@@ -13,10 +13,13 @@ import (
 const (
 	camSettingsPrefix = "__cam:"
 
-	ruleScale  = "scale"
-	ruleLength = "length"
-	ruleSize   = "size"
-	ruleCodec  = "codec"
+	ruleScale    = "scale"
+	ruleLength   = "length"
+	ruleSize     = "size"
+	ruleCodec    = "codec"
+	ruleCoalesce = "coalesce"
+	rulePreRoll  = "preroll"
+	ruleExtend   = "extend"
 
 	ScaleFull    = "full"
 	ScaleHalf    = "half"
@@ -32,18 +35,79 @@ const (
 	DefaultClipSize   = 1572864 // 1.5 MiB
 	DefaultClipCodec  = CodecH265
 
+	// DefaultClipCoalesce leaves burst merging off until an admin picks a window.
+	DefaultClipCoalesce = time.Duration(0)
+
 	MinClipLengthSecs = 2
 	MaxClipLengthSecs = 15
 	MinClipSizeBytes  = 500 * 1024
 	MaxClipSizeBytes  = 3 * 1024 * 1024
+
+	MaxClipCoalesceSecs = 60
+
+	// MaxClipPreRollSecs is the most recorded footage from before a trigger
+	// that may lead a motion clip.
+	MaxClipPreRollSecs = 10
+
+	// MaxClipExtendSecs is the longest a motion clip may grow, a clip length
+	// at a time, while motion continues; MaxExtendedClipBytes is the largest.
+	MaxClipExtendSecs    = 60
+	MaxExtendedClipBytes = 12 * 1024 * 1024
+
+	// LargeMaxClipLengthSecs and LargeMaxClipSizeBytes replace the max length
+	// and size when Telegram uploads go to a local Bot API server, which takes
+	// files far beyond the public API's 50 MB. LargeMaxClipExtendSecs replaces
+	// the extension cap; an extended clip stays within the same size.
+	LargeMaxClipLengthSecs = 60
+	LargeMaxClipSizeBytes  = 64 * 1024 * 1024
+	LargeMaxClipExtendSecs = 300
 )
 
+// ClipLimits returns the longest clip length (seconds) and largest clip size
+// (bytes) an admin may pick. They are raised with LargeClips.
+func (c *Chat) ClipLimits() (int, int) {
+	if c != nil && c.LargeClips {
+		return LargeMaxClipLengthSecs, LargeMaxClipSizeBytes
+	}
+
+	return MaxClipLengthSecs, MaxClipSizeBytes
+}
+
+// ExtendLimits returns the longest (seconds) and largest (bytes) a clip may
+// grow while motion continues. They are raised with LargeClips.
+func (c *Chat) ExtendLimits() (int, int) {
+	if c != nil && c.LargeClips {
+		return LargeMaxClipExtendSecs, LargeMaxClipSizeBytes
+	}
+
+	return MaxClipExtendSecs, MaxExtendedClipBytes
+}
+
+// CameraClipSettings returns a camera's stored settings or defaults, within
+// ClipLimits and ExtendLimits.
+func (c *Chat) CameraClipSettings(camName string) ClipSettings {
+	maxSecs, maxSize := c.ClipLimits()
+	maxExtend, _ := c.ExtendLimits()
+
+	return cameraClipSettings(c.Subs, camName, maxSecs, maxSize, maxExtend)
+}
+
 // ClipSettings is the admin-global capture profile for one camera.
 type ClipSettings struct {
 	Scale  string
 	Length time.Duration
 	Size   int // max file size in bytes
 	VCodec string
+	// Coalesce merges further motion triggers into a clip that started less
+	// than this long ago instead of capturing another one. Zero disables it.
+	Coalesce time.Duration
+	// PreRoll leads motion clips with this much of SecuritySpy's recorded
+	// footage from before the trigger. Zero sends the live clip alone.
+	PreRoll time.Duration
+	// Extend keeps a motion clip recording, Length at a time, while more
+	// triggers arrive, up to this total length (see ExtendLimits). Zero (or
+	// not above Length) records Length once.
+	Extend time.Duration
 }
 
 // CamSettingsKey returns the reserved catalog event name for a camera.
@@ -56,7 +120,7 @@ func IsCamSettingsKey(name string) bool {
 	return strings.HasPrefix(name, camSettingsPrefix)
 }
 
-// CatalogEventNames lists subscribable global events (excludes __cam: settings keys).
+// CatalogEventNames lists subscribable global events (excludes reserved settings keys).
 func CatalogEventNames(events *subscribe.Events) []string {
 	if events == nil {
 		return nil
@@ -66,7 +130,7 @@ func CatalogEventNames(events *subscribe.Events) []string {
 	out := make([]string, 0, len(names))
 
 	for _, name := range names {
-		if IsCamSettingsKey(name) {
+		if IsReservedKey(name) {
 			continue
 		}
 
@@ -97,13 +161,19 @@ func EnsureCameraSettings(data *subscribe.Subscribe, camName string) {
 	})
 }
 
-// GetCameraClipSettings returns stored settings or defaults.
+// GetCameraClipSettings returns stored settings or defaults, within the standard
+// clip limits.
 func GetCameraClipSettings(data *subscribe.Subscribe, camName string) ClipSettings {
+	return cameraClipSettings(data, camName, MaxClipLengthSecs, MaxClipSizeBytes, MaxClipExtendSecs)
+}
+
+func cameraClipSettings(data *subscribe.Subscribe, camName string, maxSecs, maxSize, maxExtend int) ClipSettings {
 	settings := ClipSettings{
-		Scale:  DefaultClipScale,
-		Length: DefaultClipLength,
-		Size:   DefaultClipSize,
-		VCodec: DefaultClipCodec,
+		Scale:    DefaultClipScale,
+		Length:   DefaultClipLength,
+		Size:     DefaultClipSize,
+		VCodec:   DefaultClipCodec,
+		Coalesce: DefaultClipCoalesce,
 	}
 
 	if data == nil || data.Events == nil || camName == "" {
@@ -116,17 +186,29 @@ func GetCameraClipSettings(data *subscribe.Subscribe, camName string) ClipSettin
 	}
 
 	if length, ok := data.Events.RuleGetD(key, ruleLength); ok && length > 0 {
-		settings.Length = clampClipLength(length)
+		settings.Length = clampClipLength(length, maxSecs)
 	}
 
 	if size, ok := data.Events.RuleGetI(key, ruleSize); ok && size > 0 {
-		settings.Size = clampClipSize(size)
+		settings.Size = clampClipSize(size, maxSize)
 	}
 
 	if codec, ok := data.Events.RuleGetS(key, ruleCodec); ok && validCodec(codec) {
 		settings.VCodec = codec
 	}
 
+	if window, ok := data.Events.RuleGetD(key, ruleCoalesce); ok && window >= 0 {
+		settings.Coalesce = clampClipCoalesce(window)
+	}
+
+	if preRoll, ok := data.Events.RuleGetD(key, rulePreRoll); ok && preRoll >= 0 {
+		settings.PreRoll = clampClipPreRoll(preRoll)
+	}
+
+	if extend, ok := data.Events.RuleGetD(key, ruleExtend); ok && extend > 0 {
+		settings.Extend = clampClipLength(extend, maxExtend)
+	}
+
 	return settings
 }
 
@@ -148,23 +230,43 @@ func validCodec(codec string) bool {
 	}
 }
 
-func clampClipLength(d time.Duration) time.Duration {
+func clampClipLength(d time.Duration, maxSecs int) time.Duration {
 	secs := int(d.Round(time.Second) / time.Second)
-	secs = max(MinClipLengthSecs, min(secs, MaxClipLengthSecs))
+	secs = max(MinClipLengthSecs, min(secs, maxSecs))
 
 	return time.Duration(secs) * time.Second
 }
 
-func clampClipSize(size int) int {
-	return max(MinClipSizeBytes, min(size, MaxClipSizeBytes))
+func clampClipSize(size, maxSize int) int {
+	return max(MinClipSizeBytes, min(size, maxSize))
+}
+
+func clampClipCoalesce(d time.Duration) time.Duration {
+	secs := int(d.Round(time.Second) / time.Second)
+
+	return time.Duration(min(secs, MaxClipCoalesceSecs)) * time.Second
+}
+
+func clampClipPreRoll(d time.Duration) time.Duration {
+	secs := int(d.Round(time.Second) / time.Second)
+
+	return time.Duration(min(secs, MaxClipPreRollSecs)) * time.Second
 }
 
-func allowedClipLengthSecs(secs int) bool {
-	return secs >= MinClipLengthSecs && secs <= MaxClipLengthSecs
+func allowedClipLengthSecs(secs, maxSecs int) bool {
+	return secs >= MinClipLengthSecs && secs <= maxSecs
 }
 
-func allowedClipSizeBytes(size int) bool {
-	return size >= MinClipSizeBytes && size <= MaxClipSizeBytes
+func allowedClipSizeBytes(size, maxSize int) bool {
+	return size >= MinClipSizeBytes && size <= maxSize
+}
+
+func allowedClipCoalesceSecs(secs int) bool {
+	return secs >= 0 && secs <= MaxClipCoalesceSecs
+}
+
+func allowedClipPreRollSecs(secs int) bool {
+	return secs >= 0 && secs <= MaxClipPreRollSecs
 }
 
 // heightForScale maps full/half/third/quarter to a request height.
@@ -245,12 +347,26 @@ func resolveVCodec(cam *securityspy.Camera, settings ClipSettings) string {
 }
 
 // FormatClipSettings summarizes settings for Telegram button labels.
+// The burst-merge window, pre-roll and extension only show when they are turned on.
 func FormatClipSettings(settings ClipSettings) string {
-	return fmt.Sprintf("%s · %s · %s · %s",
+	summary := fmt.Sprintf("%s · %s · %s · %s",
 		scaleLabel(settings.Scale),
 		formatClipSecs(settings.Length),
 		formatByteSize(settings.Size),
 		codecLabel(settings.VCodec))
+	if settings.Coalesce > 0 {
+		summary += " · merge " + formatClipSecs(settings.Coalesce)
+	}
+
+	if settings.PreRoll > 0 {
+		summary += " · pre-roll " + formatClipSecs(settings.PreRoll)
+	}
+
+	if settings.Extend > settings.Length {
+		summary += " · extend to " + formatClipSecs(settings.Extend)
+	}
+
+	return summary
 }
 
 // cameraFrameSize returns "WIDTHxHEIGHT" or empty when unknown.
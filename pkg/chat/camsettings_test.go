@@ -81,6 +81,42 @@ func TestGetCameraClipSettingsClamps(t *testing.T) {
 	}
 }
 
+// LargeClips raises one Chat's limits; the standard ones still apply elsewhere.
+func TestLargeClipLimits(t *testing.T) {
+	t.Parallel()
+
+	events := &subscribe.Events{Map: make(map[string]*subscribe.Rules)}
+	data := &subscribe.Subscribe{Events: events}
+	EnsureCameraSettings(data, "Office")
+	key := CamSettingsKey("Office")
+	events.RuleSetD(key, ruleLength, 45*time.Second)
+	events.RuleSetI(key, ruleSize, 50*1024*1024)
+
+	large := &Chat{Subs: data, LargeClips: true}
+
+	got := large.CameraClipSettings("Office")
+	if got.Length != 45*time.Second || got.Size != 50*1024*1024 {
+		t.Fatalf("large clip settings clamped: %+v", got)
+	}
+
+	if got = (&Chat{Subs: data}).CameraClipSettings("Office"); got.Length != MaxClipLengthSecs*time.Second ||
+		got.Size != MaxClipSizeBytes {
+		t.Fatalf("standard limits: %+v", got)
+	}
+
+	events.RuleSetD(key, ruleLength, 10*time.Minute)
+	if got = large.CameraClipSettings("Office"); got.Length != LargeMaxClipLengthSecs*time.Second {
+		t.Fatalf("length: got %v want %ds", got.Length, LargeMaxClipLengthSecs)
+	}
+
+	maxSecs, maxSize := large.ClipLimits()
+	if !allowedClipLengthSecs(LargeMaxClipLengthSecs, maxSecs) ||
+		allowedClipLengthSecs(LargeMaxClipLengthSecs+1, maxSecs) ||
+		!allowedClipSizeBytes(LargeMaxClipSizeBytes, maxSize) || allowedClipSizeBytes(LargeMaxClipSizeBytes+1, maxSize) {
+		t.Fatal("wizard limits do not follow LargeClips")
+	}
+}
+
 func TestCameraClipSettingsRoundTrip(t *testing.T) {
 	t.Parallel()
 
@@ -172,3 +208,124 @@ func TestVideoClipOpsCodec(t *testing.T) {
 		t.Fatalf("zero native: got %+v", ops)
 	}
 }
+
+func TestGetCameraClipSettingsCoalesce(t *testing.T) {
+	t.Parallel()
+
+	events := &subscribe.Events{Map: make(map[string]*subscribe.Rules)}
+	data := &subscribe.Subscribe{Events: events}
+	EnsureCameraSettings(data, "Office")
+	key := CamSettingsKey("Office")
+
+	if got := GetCameraClipSettings(data, "Office"); got.Coalesce != 0 {
+		t.Fatalf("default coalesce: got %v want off", got.Coalesce)
+	}
+
+	events.RuleSetD(key, ruleCoalesce, 10*time.Second)
+	got := GetCameraClipSettings(data, "Office")
+	if got.Coalesce != 10*time.Second {
+		t.Fatalf("coalesce: got %v want 10s", got.Coalesce)
+	}
+	if summary := FormatClipSettings(got); summary != "½ · 6s · 1.5MB · h265 · merge 10s" {
+		t.Fatalf("summary: %q", summary)
+	}
+
+	events.RuleSetD(key, ruleCoalesce, 5*time.Minute)
+	if got := GetCameraClipSettings(data, "Office"); got.Coalesce != time.Duration(MaxClipCoalesceSecs)*time.Second {
+		t.Fatalf("max coalesce: got %v", got.Coalesce)
+	}
+}
+
+func TestGetCameraClipSettingsPreRoll(t *testing.T) {
+	t.Parallel()
+
+	events := &subscribe.Events{Map: make(map[string]*subscribe.Rules)}
+	data := &subscribe.Subscribe{Events: events}
+	EnsureCameraSettings(data, "Office")
+	key := CamSettingsKey("Office")
+
+	if got := GetCameraClipSettings(data, "Office"); got.PreRoll != 0 {
+		t.Fatalf("default pre-roll: got %v want off", got.PreRoll)
+	}
+
+	events.RuleSetD(key, rulePreRoll, 5*time.Second)
+	got := GetCameraClipSettings(data, "Office")
+	if summary := FormatClipSettings(got); summary != "½ · 6s · 1.5MB · h265 · pre-roll 5s" {
+		t.Fatalf("summary: %q", summary)
+	}
+
+	events.RuleSetD(key, rulePreRoll, time.Minute)
+	if got := GetCameraClipSettings(data, "Office"); got.PreRoll != time.Duration(MaxClipPreRollSecs)*time.Second {
+		t.Fatalf("max pre-roll: got %v", got.PreRoll)
+	}
+
+	if allowedClipPreRollSecs(MaxClipPreRollSecs+1) || !allowedClipPreRollSecs(0) {
+		t.Fatal("pre-roll bounds")
+	}
+}
+
+// An extension cap only counts when it is longer than the clip length. It has
+// its own limit, past the longest single clip.
+func TestGetCameraClipSettingsExtend(t *testing.T) {
+	t.Parallel()
+
+	events := &subscribe.Events{Map: make(map[string]*subscribe.Rules)}
+	data := &subscribe.Subscribe{Events: events}
+	EnsureCameraSettings(data, "Office")
+	key := CamSettingsKey("Office")
+
+	events.RuleSetD(key, ruleExtend, 15*time.Second)
+	got := GetCameraClipSettings(data, "Office")
+	if got.Extend != 15*time.Second || FormatClipSettings(got) != "½ · 6s · 1.5MB · h265 · extend to 15s" {
+		t.Fatalf("extend: %v %q", got.Extend, FormatClipSettings(got))
+	}
+
+	events.RuleSetD(key, ruleExtend, 45*time.Second)
+	if got := GetCameraClipSettings(data, "Office"); got.Extend != 45*time.Second {
+		t.Fatalf("extend past the clip length limit: got %v", got.Extend)
+	}
+
+	events.RuleSetD(key, ruleExtend, 10*time.Minute)
+	if got := GetCameraClipSettings(data, "Office"); got.Extend != MaxClipExtendSecs*time.Second {
+		t.Fatalf("max extend: got %v", got.Extend)
+	}
+
+	large := &Chat{Subs: data, LargeClips: true}
+	if got := large.CameraClipSettings("Office"); got.Extend != LargeMaxClipExtendSecs*time.Second {
+		t.Fatalf("max extend with large clips: got %v", got.Extend)
+	}
+
+	events.RuleSetD(key, ruleExtend, 15*time.Second)
+	events.RuleSetD(key, ruleLength, 15*time.Second)
+	if got := GetCameraClipSettings(data, "Office"); FormatClipSettings(got) != "½ · 15s · 1.5MB · h265" {
+		t.Fatalf("extend not above length: %q", FormatClipSettings(got))
+	}
+
+	reasons := []securityspy.TriggerEvent{securityspy.TriggerByMotion, securityspy.TriggerByHumanDetection}
+	if caption := ExtendedCaption("Office", reasons, 24*time.Second); caption != "Office (human) · 24s" {
+		t.Fatalf("caption: %q", caption)
+	}
+}
+
+// Each off-able preset screen starts at Off and its callbacks carry its own
+// kind; extend offers no more than the clip limits allow.
+func TestCamSetOffPresets(t *testing.T) {
+	t.Parallel()
+
+	for _, kind := range []string{"w", "a", "p", "x"} {
+		presets := (&Chat{}).camSetOffPresets(kind)
+		if presets.kind != kind || len(presets.values) < 2 || presets.values[0] != 0 || presets.title == "" {
+			t.Fatalf("%s presets: %+v", kind, presets)
+		}
+	}
+
+	for _, large := range []bool{false, true} {
+		c := &Chat{LargeClips: large}
+		maxExtend, _ := c.ExtendLimits()
+
+		values := c.camSetOffPresets("x").values
+		if last := values[len(values)-1]; last != maxExtend {
+			t.Fatalf("large %v: extend presets end at %ds, want %ds", large, last, maxExtend)
+		}
+	}
+}
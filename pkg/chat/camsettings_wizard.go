@@ -2,6 +2,7 @@ package chat
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -10,15 +11,23 @@ import (
 // Admin per-camera clip settings wizard (Telegram ≤64-byte callbacks).
 //
 // k              → camera list
-// k:{idx}        → camera menu (scale / length / size / codec)
+// k:{idx}        → camera menu (scale / length / size / codec / merge / pre-roll / extend)
 // k:{idx}:s      → scale presets
 // k:{idx}:l      → length presets
 // k:{idx}:z      → size presets
 // k:{idx}:c      → codec presets
+// k:{idx}:w      → burst-merge window presets
+// k:{idx}:a      → acknowledgement window presets
+// k:{idx}:p      → pre-roll presets
+// k:{idx}:x      → extend-while-active cap presets
 // k:{idx}:s:half → apply scale
 // k:{idx}:l:6    → apply length (seconds)
 // k:{idx}:z:N    → apply size (bytes)
 // k:{idx}:c:h265 → apply codec
+// k:{idx}:w:10   → apply merge window (seconds, 0 = off)
+// k:{idx}:a:5    → apply ack window (minutes, 0 = off)
+// k:{idx}:p:5    → apply pre-roll (seconds, 0 = off)
+// k:{idx}:x:30   → apply extension cap (seconds, 0 = off)
 
 func (c *Chat) handleCamSetWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
 	if data != cbCamSetRoot && !strings.HasPrefix(data, "k:") {
@@ -60,6 +69,8 @@ func (c *Chat) camSetWizardKind(idxStr, kind string) *Reply {
 		return c.camSetWizardSize(idxStr)
 	case "c":
 		return c.camSetWizardCodec(idxStr)
+	case "w", "a", "p", "x":
+		return c.camSetWizardOffPresets(idxStr, c.camSetOffPresets(kind))
 	default:
 		return &Reply{Reply: "Bad clip-settings pick.", Edit: true, Toast: "Error"}
 	}
@@ -84,7 +95,7 @@ func (c *Chat) camSetWizardRoot() *Reply {
 	msg.WriteString("Per-camera clip settings (everyone gets the same clip).\n\n")
 
 	for idx, cam := range cams {
-		settings := GetCameraClipSettings(c.Subs, cam.Name)
+		settings := c.CameraClipSettings(cam.Name)
 		summary := FormatClipSettings(settings)
 		fmt.Fprintf(&msg, "• %s — %s", cam.Name, summary)
 		if frame := cameraFrameSize(cam); frame != "" {
@@ -110,15 +121,15 @@ func (c *Chat) camSetWizardCam(idxStr string) *Reply {
 	}
 
 	cam := cams[idx]
-	settings := GetCameraClipSettings(c.Subs, cam.Name)
+	settings := c.CameraClipSettings(cam.Name)
 	current := FormatClipSettings(settings)
 	if frame := cameraFrameSize(cam); frame != "" {
 		current += " (" + frame + ")"
 	}
 
 	return &Reply{
-		Reply: fmt.Sprintf("%s clip settings\n\nCurrent: %s\n\nChoose what to change:",
-			cam.Name, current),
+		Reply: fmt.Sprintf("%s clip settings\n\nCurrent: %s\nAcknowledgement: %s\n\nChoose what to change:",
+			cam.Name, current, formatAckWindow(AckWindow(c.Subs, cam.Name))),
 		Edit: true,
 		Keyboard: [][]Button{
 			{
@@ -129,6 +140,14 @@ func (c *Chat) camSetWizardCam(idxStr string) *Reply {
 				{Label: "Size", Data: fmt.Sprintf("k:%d:z", idx)},
 				{Label: "Codec", Data: fmt.Sprintf("k:%d:c", idx)},
 			},
+			{
+				{Label: "Merge window", Data: fmt.Sprintf("k:%d:w", idx)},
+				{Label: "Acknowledgement", Data: fmt.Sprintf("k:%d:a", idx)},
+			},
+			{
+				{Label: "Pre-roll", Data: fmt.Sprintf("k:%d:p", idx)},
+				{Label: "Extend", Data: fmt.Sprintf("k:%d:x", idx)},
+			},
 			{{Label: "« Cameras", Data: cbCamSetRoot}, {Label: "Done", Data: cbCancel}},
 		},
 	}
@@ -170,6 +189,9 @@ func (c *Chat) camSetWizardLength(idxStr string) *Reply {
 	}
 
 	secs := []int{2, 3, 4, 5, 6, 8, 10, 15}
+	if maxSecs, _ := c.ClipLimits(); maxSecs > MaxClipLengthSecs {
+		secs = append(secs, 20, 30, 45, LargeMaxClipLengthSecs)
+	}
 	rows := make([][]Button, 0, 4)
 	row := make([]Button, 0, 4)
 
@@ -217,6 +239,10 @@ func (c *Chat) camSetWizardSize(idxStr string) *Reply {
 		2560 * 1024,
 		3 * 1024 * 1024,
 	}
+	if _, maxSize := c.ClipLimits(); maxSize > MaxClipSizeBytes {
+		sizes = append(sizes, 5*1024*1024, 10*1024*1024, 20*1024*1024,
+			35*1024*1024, 50*1024*1024, LargeMaxClipSizeBytes)
+	}
 	rows := make([][]Button, 0, 4)
 	row := make([]Button, 0, 3)
 
@@ -270,6 +296,84 @@ func (c *Chat) camSetWizardCodec(idxStr string) *Reply {
 	}
 }
 
+// offPresets is a preset screen for a setting 0 turns off: kind is its
+// callback letter and unit follows each number on the buttons.
+type offPresets struct {
+	kind   string
+	unit   string
+	values []int
+	title  string
+}
+
+// camSetOffPresets returns the merge, acknowledgement, pre-roll or extend screen.
+func (c *Chat) camSetOffPresets(kind string) offPresets {
+	switch kind {
+	case "a":
+		return offPresets{kind: kind, unit: "m", values: ackWindowMinutes, title: "Acknowledgement window.\n\n" +
+			"Alerts from this camera get an Acknowledge button. If nobody presses it within " +
+			"this window, the alert goes to the next tier of subscribers (set per subscription " +
+			"under /users). Whoever acknowledges is named on everyone's copy.\n\n" +
+			"Off = alerts go to every subscriber at once."}
+	case "p":
+		return offPresets{kind: kind, unit: "s", values: []int{0, 2, 3, 5, 8, MaxClipPreRollSecs}, title: "Pre-roll.\n\n" +
+			"A live clip starts after the trigger arrives, so it often misses the first seconds. " +
+			"With pre-roll, motion alerts start this long before the trigger, cut from SecuritySpy's " +
+			"recordings (continuous capture in short files works best) and joined to the live clip with ffmpeg. " +
+			"That adds a few seconds before the alert goes out.\n\n" +
+			"Off = the live clip alone. Without a recording or ffmpeg, the live clip is sent."}
+	case "x":
+		maxExtend, _ := c.ExtendLimits()
+		secs := slices.DeleteFunc([]int{0, 15, 30, 45, 60, 120, 180, 300}, func(sec int) bool { return sec > maxExtend })
+
+		return offPresets{kind: kind, unit: "s", values: secs, title: "Extend while active.\n\n" +
+			"When more motion triggers arrive while a clip is recording, it keeps recording " +
+			"another clip length at a time, up to this total. The caption gives the total length " +
+			"and every class seen. The pieces are joined with ffmpeg; without it, the first piece is sent.\n\n" +
+			"Off = every clip is the set length."}
+	default:
+		return offPresets{kind: "w", unit: "s", values: []int{0, 5, 10, 15, 30, 60}, title: "Burst merge window.\n\n" +
+			"SecuritySpy often fires several triggers for one person walking through. " +
+			"While a clip is recording, triggers that arrive within this window of its start " +
+			"join that clip (the caption lists every class seen) instead of sending another.\n\n" +
+			"Off = every trigger gets its own clip."}
+	}
+}
+
+// camSetWizardOffPresets shows an offPresets screen, three buttons to a row.
+func (c *Chat) camSetWizardOffPresets(idxStr string, presets offPresets) *Reply {
+	idx := atoiDefault(idxStr, -1)
+	cams := c.allCameras()
+	if idx < 0 || idx >= len(cams) {
+		return &Reply{Reply: "Camera gone — try again.", Edit: true, Toast: "Missing"}
+	}
+
+	rows := make([][]Button, 0, 4)
+	row := make([]Button, 0, 3)
+
+	for _, value := range presets.values {
+		label := fmt.Sprintf("%d%s", value, presets.unit)
+		if value == 0 {
+			label = "Off"
+		}
+
+		row = append(row, Button{Label: label, Data: fmt.Sprintf("k:%d:%s:%d", idx, presets.kind, value)})
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, []Button{
+		{Label: "« Back", Data: fmt.Sprintf("k:%d", idx)},
+		{Label: "Done", Data: cbCancel},
+	})
+
+	return &Reply{Reply: presets.title, Edit: true, Keyboard: rows}
+}
+
 func (c *Chat) camSetWizardApply(payload string) (*Reply, bool) {
 	parts := strings.Split(payload, ":")
 	if len(parts) != 3 {
@@ -293,17 +397,17 @@ func (c *Chat) camSetWizardApply(payload string) (*Reply, bool) {
 		return errReply, false
 	}
 
-	settings := GetCameraClipSettings(c.Subs, cam.Name)
+	settings := c.CameraClipSettings(cam.Name)
 	next := c.camSetWizardCam(strconv.Itoa(idx))
-	next.Reply = fmt.Sprintf("Updated %s → %s\n\n", cam.Name, FormatClipSettings(settings)) +
-		fmt.Sprintf("%s clip settings\n\nCurrent: %s\n\nChoose what to change:",
-			cam.Name, FormatClipSettings(settings))
+	next.Reply = fmt.Sprintf("Updated %s → %s\n\n", cam.Name, FormatClipSettings(settings)) + next.Reply
 	next.Toast = "Saved"
 
 	return next, true
 }
 
 func (c *Chat) camSetWizardApplyKind(key, kind, value string) *Reply {
+	maxSecs, maxSize := c.ClipLimits()
+
 	switch kind {
 	case "s":
 		if !validScale(value) {
@@ -313,9 +417,9 @@ func (c *Chat) camSetWizardApplyKind(key, kind, value string) *Reply {
 		c.Subs.Events.RuleSetS(key, ruleScale, value)
 	case "l":
 		secs, err := strconv.Atoi(value)
-		if err != nil || !allowedClipLengthSecs(secs) {
+		if err != nil || !allowedClipLengthSecs(secs, maxSecs) {
 			return &Reply{
-				Reply: fmt.Sprintf("Length must be %d–%ds.", MinClipLengthSecs, MaxClipLengthSecs),
+				Reply: fmt.Sprintf("Length must be %d–%ds.", MinClipLengthSecs, maxSecs),
 				Edit:  true,
 				Toast: "Error",
 			}
@@ -324,10 +428,10 @@ func (c *Chat) camSetWizardApplyKind(key, kind, value string) *Reply {
 		c.Subs.Events.RuleSetD(key, ruleLength, time.Duration(secs)*time.Second)
 	case "z":
 		size, err := strconv.Atoi(value)
-		if err != nil || !allowedClipSizeBytes(size) {
+		if err != nil || !allowedClipSizeBytes(size, maxSize) {
 			return &Reply{
 				Reply: fmt.Sprintf("Size must be %s–%s.",
-					formatByteSize(MinClipSizeBytes), formatByteSize(MaxClipSizeBytes)),
+					formatByteSize(MinClipSizeBytes), formatByteSize(maxSize)),
 				Edit:  true,
 				Toast: "Error",
 			}
@@ -340,6 +444,48 @@ func (c *Chat) camSetWizardApplyKind(key, kind, value string) *Reply {
 		}
 
 		c.Subs.Events.RuleSetS(key, ruleCodec, value)
+	case "w":
+		secs, err := strconv.Atoi(value)
+		if err != nil || !allowedClipCoalesceSecs(secs) {
+			return &Reply{
+				Reply: fmt.Sprintf("Merge window must be 0–%ds.", MaxClipCoalesceSecs),
+				Edit:  true,
+				Toast: "Error",
+			}
+		}
+
+		c.Subs.Events.RuleSetD(key, ruleCoalesce, time.Duration(secs)*time.Second)
+	case "p":
+		secs, err := strconv.Atoi(value)
+		if err != nil || !allowedClipPreRollSecs(secs) {
+			return &Reply{
+				Reply: fmt.Sprintf("Pre-roll must be 0–%ds.", MaxClipPreRollSecs),
+				Edit:  true,
+				Toast: "Error",
+			}
+		}
+
+		c.Subs.Events.RuleSetD(key, rulePreRoll, time.Duration(secs)*time.Second)
+	case "x":
+		maxExtend, _ := c.ExtendLimits()
+
+		secs, err := strconv.Atoi(value)
+		if err != nil || (secs != 0 && !allowedClipLengthSecs(secs, maxExtend)) {
+			return &Reply{
+				Reply: fmt.Sprintf("Extension must be off or %d–%ds.", MinClipLengthSecs, maxExtend),
+				Edit:  true,
+				Toast: "Error",
+			}
+		}
+
+		c.Subs.Events.RuleSetD(key, ruleExtend, time.Duration(secs)*time.Second)
+	case "a":
+		mins, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(ackWindowMinutes, mins) {
+			return &Reply{Reply: "Bad acknowledgement window.", Edit: true, Toast: "Error"}
+		}
+
+		SetAckWindow(c.Subs.Events, key, time.Duration(mins)*time.Minute)
 	default:
 		return &Reply{Reply: "Bad clip-settings pick.", Edit: true, Toast: "Error"}
 	}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/davidnewhall/motifini/pkg/archive"
+	"github.com/davidnewhall/motifini/pkg/history"
 	"golift.io/securityspy/v2"
 	"golift.io/subscribe"
 )
@@ -30,10 +32,24 @@ type Chat struct {
 	Subs    *subscribe.Subscribe
 	SSpy    *securityspy.Server
 	TempDir string
-	Cmds    []*Commands
-	Info    *log.Logger
-	Debug   *log.Logger
-	Error   *log.Logger
+	History *history.Store   // nil when the event history is off
+	Archive *archive.Archive // nil unless archive_dir is set
+	// FFmpeg trims SecuritySpy recordings that are larger than a camera's
+	// clip size. Empty looks for ffmpeg in the PATH.
+	FFmpeg string
+	// LargeClips raises the clip length and size limits to LargeMaxClipLengthSecs
+	// and LargeMaxClipSizeBytes, for Telegram uploads to a local Bot API server.
+	LargeClips bool
+	Cmds       []*Commands
+	Info       *log.Logger
+	Debug      *log.Logger
+	Error      *log.Logger
+	// AddEmail creates an email subscriber for an address, or returns the
+	// existing one (created false). Nil when email is not configured; the
+	// /users wizard only offers "Add email subscriber" when it is set.
+	AddEmail func(address string) (sub *subscribe.Subscriber, created bool, err error)
+	// ModeChanged, when set, announces a household mode change (SetMode).
+	ModeChanged func(mode, by string)
 }
 
 // ErrBadUsage is a standard error.
@@ -79,8 +95,30 @@ type Handler struct {
 	// SendFile, when set, delivers each captured file immediately (progressive Telegram sends).
 	// Path ownership transfers to the callback (it should delete the file when done).
 	SendFile func(path, caption string) error
+	// SendAlbum, when set, takes over from SendFile for all-camera sends: the
+	// captures go out in albums of up to MaxAlbumFiles, each with its caption.
+	// Path ownership transfers as with SendFile.
+	SendAlbum func(files []AlbumFile) error
+	// Progress, when set, reports how far a long capture has got (Telegram
+	// edits its "Fetching…" message).
+	Progress func(text string)
+	// ReadOnly is set for a group member who may look but not change the
+	// group's subscriptions: not a group admin and not a bot admin.
+	ReadOnly bool
+	// Thread is the forum topic the message came from, 0 outside topics.
+	// Subscriptions made in a topic send their alerts there.
+	Thread int
 }
 
+// AlbumFile is one captioned file in an album.
+type AlbumFile struct {
+	Path    string
+	Caption string
+}
+
+// MaxAlbumFiles is the most files in one album, Telegram's media group limit.
+const MaxAlbumFiles = 10
+
 // New just adds the basic commands to a Chat struct.
 func New(chatCfg *Chat) *Chat {
 	if chatCfg.TempDir == "" {
@@ -116,6 +154,10 @@ func (c *Chat) HandleCommand(handler *Handler) *Reply {
 		return reply
 	}
 
+	if handler.ReadOnly && !readOnlyCommand(commandName(handler.Text[0])) {
+		return &Reply{Reply: groupReadOnlyMsg}
+	}
+
 	if strings.EqualFold("help", commandName(handler.Text[0])) {
 		return c.doHelp(handler)
 	}
@@ -134,10 +176,18 @@ func (c *Chat) commandReady(handler *Handler) bool {
 		handler != nil && handler.Sub != nil && !SubIgnored(handler.Sub) && handler.Text != nil
 }
 
-// applyPendingRename returns a reply when a rename was consumed.
-// nil means fall through (no pending rename, or slash command cancelled it).
+// applyPendingRename returns a reply when a rename, add-email or schedule
+// prompt was consumed. nil means fall through (no prompt, or slash command cancelled it).
 func (c *Chat) applyPendingRename(handler *Handler) *Reply {
 	reply, handled, save := c.consumePendingRename(handler)
+	if !handled {
+		reply, handled, save = c.consumePendingEmail(handler)
+	}
+
+	if !handled {
+		reply, handled, save = c.consumePendingSchedule(handler)
+	}
+
 	if !handled {
 		return nil
 	}
@@ -155,6 +205,10 @@ func (c *Chat) HandleCallback(handler *Handler) *Reply {
 		return &Reply{}
 	}
 
+	if handler.ReadOnly && !readOnlyCallback(handler.Callback) {
+		return &Reply{Toast: "Group admins only"}
+	}
+
 	resp, save := c.handleWizardCallback(handler)
 	if save {
 		_ = SaveState(c.Subs)
@@ -34,7 +34,7 @@ func (c *Chat) adminCommands() *Commands { //nolint:funlen // it's not that bad.
 			{
 				Run:  c.cmdCamSet,
 				AKA:  []string{"camset", "clipset", "camsettings"},
-				Desc: "Per-camera clip settings (scale, length, size) for everyone.",
+				Desc: "Per-camera clip settings (scale, length, size, merge window) for everyone.",
 				Save: false,
 			},
 			{
@@ -79,6 +79,40 @@ func (c *Chat) nonAdminCommands() *Commands { //nolint:funlen // it's not that b
 				Desc: "Video clip via menu, or text: /vid Office",
 				Save: false,
 			},
+			{
+				Run:  c.cmdGrid,
+				AKA:  []string{"grid", "mosaic"},
+				Desc: "One picture with a snapshot from every camera.",
+				Save: false,
+			},
+			{
+				Run:  c.cmdMode,
+				AKA:  []string{"mode", "arm"},
+				Use:  "[armed|home|disarmed]",
+				Desc: "Show the household mode; admins change it: /mode home",
+				Save: true,
+			},
+			{
+				Run:  c.cmdHistory,
+				AKA:  []string{"history", "log"},
+				Use:  "[camera|event] [class] [period]",
+				Desc: "Recent alerts via menu, or text: /history Porch human 24h",
+				Save: false,
+			},
+			{
+				Run:  c.cmdRecent,
+				AKA:  []string{"recent", "clips"},
+				Use:  "[camera]",
+				Desc: "Archived motion clips via menu, or text: /recent Porch",
+				Save: false,
+			},
+			{
+				Run:  c.cmdRecordings,
+				AKA:  []string{"recordings", "recs"},
+				Use:  "[camera]",
+				Desc: "SecuritySpy recordings by day and time via menu, or text: /recordings Porch",
+				Save: false,
+			},
 			{
 				Run:  c.cmdDelay,
 				AKA:  []string{"delay"},
@@ -134,7 +168,7 @@ func (c *Chat) clipVidOps(cam *securityspy.Camera) (*securityspy.VidOps, ClipSet
 		name = cam.Name
 	}
 
-	settings := GetCameraClipSettings(c.Subs, name)
+	settings := c.CameraClipSettings(name)
 	ops := VideoClipOps(cam, settings)
 	ops.Quality = quality // JPEG only; stripped from RTSP by securityspy
 
@@ -180,7 +214,7 @@ func (c *Chat) cmdSub(handler *Handler) (*Reply, error) {
 
 	msg := "You've been subscribed to " + kind + ": " + formatSubLabel(key)
 
-	err = handler.Sub.Subscribe(key)
+	err = subscribeHere(handler, key)
 	if err != nil {
 		msg = "You're already subscribed to " + kind + ": " + formatSubLabel(key)
 	}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"slices"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+// Digest delivery. A subscription with a digest interval does not send its
+// alerts as they happen: the messenger records them and, once per interval,
+// sends one summary with counts, times and a mosaic of snapshots.
+const (
+	ruleDigest = "digest" // D rule on a subscription: the digest interval, 0 to send at once.
+
+	// MaxDigestInterval is the longest digest interval.
+	MaxDigestInterval = 24 * time.Hour
+)
+
+// digestHours are the digest interval choices in the /subs menu; 0 sends at once.
+var digestHours = []int{0, 1, 3, 6, 12, 24}
+
+// SubDigest returns the digest interval of a subscriber's alerts about an event
+// (a camera name or catalog event), or 0 to send them at once. Every matching
+// subscription must be a digest: one that sends at once wins, so a digest of
+// motion never holds back a human alert subscribed on its own.
+func SubDigest(sub *subscribe.Subscriber, name string, classes []string) time.Duration {
+	if sub == nil || sub.Events == nil || name == "" {
+		return 0
+	}
+
+	keys := make([]string, 0, len(classes)+1)
+	for _, class := range classes {
+		keys = append(keys, CameraSubKey(name, class))
+	}
+
+	var interval time.Duration
+
+	for _, key := range append(keys, name) {
+		if !sub.Events.Exists(key) {
+			continue
+		}
+
+		every, _ := sub.Events.RuleGetD(key, ruleDigest)
+		if every <= 0 {
+			return 0
+		}
+
+		if interval == 0 || every < interval {
+			interval = every
+		}
+	}
+
+	return min(interval, MaxDigestInterval)
+}
+
+// SetSubDigest sets the digest interval of one subscription; 0 sends at once.
+func SetSubDigest(sub *subscribe.Subscriber, key string, interval time.Duration) {
+	if sub == nil || sub.Events == nil {
+		return
+	}
+
+	sub.Events.RuleSetD(key, ruleDigest, min(max(interval, 0), MaxDigestInterval))
+}
+
+// subDigestRule is one subscription's own digest interval, for menus.
+func subDigestRule(sub *subscribe.Subscriber, key string) time.Duration {
+	every, _ := sub.Events.RuleGetD(key, ruleDigest)
+
+	return every
+}
+
+// SplitDigest separates the subscribers who get an event at once from the
+// ones who get it in their digest.
+func SplitDigest(subs []*subscribe.Subscriber, name string, classes []string) ([]*subscribe.Subscriber,
+	[]*subscribe.Subscriber,
+) {
+	var now, later []*subscribe.Subscriber
+
+	for _, sub := range subs {
+		if SubDigest(sub, name, classes) > 0 {
+			later = append(later, sub)
+		} else {
+			now = append(now, sub)
+		}
+	}
+
+	return now, later
+}
+
+// DigestLabel names an event for a digest line: "Porch · Human" for a camera
+// (its most specific class), or the catalog event's name.
+func DigestLabel(name string, classes []string) string {
+	if len(classes) == 0 {
+		return name
+	}
+
+	class := classes[0]
+	if i := slices.IndexFunc(classes, func(c string) bool { return c != ClassMotion }); i >= 0 {
+		class = classes[i]
+	}
+
+	return formatSubLabel(CameraSubKey(name, class))
+}
+
+// formatDigest shows a digest interval in menus.
+func formatDigest(interval time.Duration) string {
+	switch {
+	case interval <= 0:
+		return "at once"
+	case interval == time.Hour:
+		return "hourly digest"
+	case interval == MaxDigestInterval:
+		return "daily digest"
+	default:
+		return "digest every " + formatDuration(interval)
+	}
+}
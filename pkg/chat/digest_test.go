@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+// A digest only holds an alert back when every matching subscription is a
+// digest; the shortest interval wins.
+
+func TestSubDigest(t *testing.T) {
+	t.Parallel()
+
+	data, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := data.CreateSubWithID(1, "ann", "telegram", false, false)
+	_ = sub.Subscribe("Porch")
+	_ = sub.Subscribe(CameraSubKey("Porch", ClassHuman))
+
+	SetSubDigest(sub, "Porch", time.Hour)
+
+	if got := SubDigest(sub, "Porch", []string{ClassMotion}); got != time.Hour {
+		t.Fatalf("motion: got %v want 1h", got)
+	}
+
+	if got := SubDigest(sub, "Porch", []string{ClassMotion, ClassHuman}); got != 0 {
+		t.Fatalf("human subscribed at once: got %v want 0", got)
+	}
+
+	SetSubDigest(sub, CameraSubKey("Porch", ClassHuman), 48*time.Hour)
+
+	if got := SubDigest(sub, "Porch", []string{ClassMotion, ClassHuman}); got != time.Hour {
+		t.Fatalf("both digests: got %v want 1h", got)
+	}
+
+	if got := SubDigest(sub, "Porch", []string{ClassHuman}); got != time.Hour {
+		t.Fatalf("human: got %v want the shorter 1h", got)
+	}
+
+	now, later := SplitDigest([]*subscribe.Subscriber{sub}, "Porch", []string{ClassHuman})
+	if len(now) != 0 || len(later) != 1 {
+		t.Fatalf("split: %d now, %d later", len(now), len(later))
+	}
+
+	want := formatSubLabel(CameraSubKey("Porch", ClassHuman))
+	if got := DigestLabel("Porch", []string{ClassMotion, ClassHuman}); got != want {
+		t.Fatalf("label: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Digest wizard (from /subs → subscription).
+//
+// n:{idx}         → interval choices for one of your subscriptions
+// n:{idx}:{hours} → apply; 0 sends alerts at once again
+const cbDigestPref = "n:"
+
+func (c *Chat) handleDigestWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	payload, ok := strings.CutPrefix(data, cbDigestPref)
+	if !ok {
+		return nil, false, false
+	}
+
+	idxStr, hours, apply := strings.Cut(payload, ":")
+	if !apply {
+		return c.digestWizard(handler, idxStr), false, true
+	}
+
+	reply, save := c.digestWizardApply(handler, idxStr, hours)
+
+	return reply, save, true
+}
+
+func (c *Chat) digestWizard(handler *Handler, idxStr string) *Reply {
+	idx := atoiDefault(idxStr, -1)
+	names := handler.Sub.Events.Names()
+
+	if idx < 0 || idx >= len(names) {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}
+	}
+
+	event := names[idx]
+	current := subDigestRule(handler.Sub, event)
+
+	row := make([]Button, 0, len(digestHours))
+	rows := make([][]Button, 0, 3) //nolint:mnd // two rows of choices and back.
+
+	for _, hours := range digestHours {
+		label := "At once"
+		if hours > 0 {
+			label = fmt.Sprintf("%dh", hours)
+		}
+
+		if time.Duration(hours)*time.Hour == current {
+			label = "• " + label
+		}
+
+		row = append(row, Button{Label: label, Data: fmt.Sprintf("%s%d:%d", cbDigestPref, idx, hours)})
+		if len(row) == 3 { //nolint:mnd // three per row.
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, []Button{{Label: "« Back", Data: fmt.Sprintf("l:%d", idx)}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply: fmt.Sprintf("Delivery for %s: %s.\n\n"+
+			"A digest holds these alerts back and sends one summary per interval instead: "+
+			"how many there were, when, and a mosaic of snapshots.\n\nPick one:",
+			formatSubLabel(event), formatDigest(current)),
+		Edit:     true,
+		Keyboard: rows,
+	}
+}
+
+func (c *Chat) digestWizardApply(handler *Handler, idxStr, hoursStr string) (*Reply, bool) {
+	idx := atoiDefault(idxStr, -1)
+	names := handler.Sub.Events.Names()
+	hours := atoiDefault(hoursStr, -1)
+
+	if idx < 0 || idx >= len(names) {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}, false
+	}
+
+	if !slices.Contains(digestHours, hours) {
+		return &Reply{Reply: "Bad digest pick.", Edit: true, Toast: "Error"}, false
+	}
+
+	SetSubDigest(handler.Sub, names[idx], time.Duration(hours)*time.Hour)
+
+	next := c.digestWizard(handler, idxStr)
+	next.Toast = "Saved"
+
+	return next, true
+}
@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidnewhall/motifini/pkg/mosaic"
+	"golift.io/securityspy/v2"
+)
+
+// cbGridRoot is the "Grid of all cameras" button in the /cams menu.
+const cbGridRoot = "g"
+
+// gridQuality is the JPEG quality of the composed grid. Higher than a single
+// still's because every camera shares the one image.
+const gridQuality = 80
+
+// ErrNoCameras is returned by GridSnapshot when SecuritySpy has no cameras loaded.
+var ErrNoCameras = errors.New("no cameras loaded")
+
+// GridSnapshot captures a still from every online camera and composes them into
+// one labeled JPEG grid in TempDir; offline cameras, and any that fail to
+// capture, get a placeholder tile. progress may be nil. The caller owns (and
+// should remove) the returned file. The summary lists the cameras left out.
+func (c *Chat) GridSnapshot(reqID string, progress func(text string)) (string, string, error) {
+	c.refreshCameras()
+
+	cams := c.allCameras()
+	if len(cams) == 0 {
+		return "", "", ErrNoCameras
+	}
+
+	var (
+		handler = &Handler{ID: reqID}
+		tiles   = make([]mosaic.Tile, 0, len(cams))
+		errs    []string
+		online  int
+	)
+
+	for i, cam := range cams {
+		if !cam.Connected.Val {
+			tiles = append(tiles, mosaic.Tile{Label: cam.Name, Note: "offline"})
+			continue
+		}
+
+		online++
+
+		if progress != nil {
+			progress(fmt.Sprintf("Fetching %d of %d: %s…", i+1, len(cams), cam.Name))
+		}
+
+		img, errMsg := c.captureImage(handler, cam)
+		if errMsg != "" {
+			errs = append(errs, errMsg)
+		}
+
+		tiles = append(tiles, mosaic.Tile{Label: cam.Name, Image: img, Note: "no picture"})
+	}
+
+	path := filepath.Join(c.TempDir, fmt.Sprintf("chat_command_%v_grid.jpg", reqID))
+	if err := writeJPEG(path, mosaic.Compose(tiles, mosaic.DefaultWidth)); err != nil {
+		c.Error.Printf("[%v] grid: %v", reqID, err)
+		return "", "", err
+	}
+
+	summary := fmt.Sprintf("All cameras: %d of %d online.", online, len(cams))
+	if len(errs) > 0 {
+		summary += "\n" + strings.Join(errs, "\n")
+	}
+
+	return path, summary, nil
+}
+
+// captureImage is captureCam for a still, decoded. The temporary file is removed.
+func (c *Chat) captureImage(handler *Handler, cam *securityspy.Camera) (image.Image, string) {
+	path, errMsg := c.captureCam(handler, cam, false)
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	defer os.Remove(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "Error Reading '" + cam.Name + "' Picture: " + err.Error()
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		c.Error.Printf("[%v] decoding %s still: %v", handler.ID, cam.Name, err)
+		return nil, "Error Reading '" + cam.Name + "' Picture: " + err.Error()
+	}
+
+	return img, ""
+}
+
+func writeJPEG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating grid file: %w", err)
+	}
+
+	err = jpeg.Encode(file, img, &jpeg.Options{Quality: gridQuality})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("encoding grid: %w", err)
+	}
+
+	return nil
+}
+
+// cmdGrid is the /grid command.
+func (c *Chat) cmdGrid(handler *Handler) (*Reply, error) {
+	reply := c.gridReply(handler)
+	reply.Edit = false
+
+	return reply, nil
+}
+
+// gridReply builds the grid and attaches it; the summary is its caption.
+func (c *Chat) gridReply(handler *Handler) *Reply {
+	path, summary, err := c.GridSnapshot(handler.ID, handler.Progress)
+	if errors.Is(err, ErrNoCameras) {
+		return c.noCamerasReply()
+	} else if err != nil {
+		return &Reply{Reply: "Error building the grid: " + err.Error(), Edit: true, Toast: "Error"}
+	}
+
+	return &Reply{
+		Reply: summary,
+		Edit:  true,
+		Toast: "Sending…",
+		Files: []string{path},
+		Keyboard: [][]Button{
+			{{Label: "Again", Data: cbGridRoot}, {Label: "« Cameras", Data: cbCamsRoot}, {Label: "Done", Data: cbCancel}},
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"strings"
+
+	"golift.io/subscribe"
+)
+
+// ruleTopic is the subscription rule holding the forum topic its alerts go to.
+const ruleTopic = "topic"
+
+const groupReadOnlyMsg = "Only group admins can change this group's alerts."
+
+// readOnlyCommand reports whether a group member without admin rights may run a
+// command: the ones that only show cameras, menus and subscriptions.
+func readOnlyCommand(name string) bool {
+	switch name {
+	case "help", "cams", "cam", "cameras", "pics", "pic", "pictures",
+		"vid", "vids", "video", "grid", "mosaic", "events", "subs", "subscribers", "mode",
+		"history", "log", "recent", "clips", "recordings", "recs":
+		return true
+	default:
+		return false
+	}
+}
+
+// readOnlyCallback is readOnlyCommand for menu buttons. Subscribe, unsubscribe,
+// pause and delay buttons are refused; snapshots, clips and menus are not.
+func readOnlyCallback(data string) bool {
+	switch {
+	case data == cbCancel, data == cbHelpRoot, data == cbSubsRoot,
+		data == cbPicsRoot, data == cbVidsRoot, data == cbCamsRoot,
+		data == cbEvtsRoot, data == cbEvtsHdr, data == cbGridRoot, data == cbHistRoot,
+		data == cbRecentRoot, data == cbRecRoot:
+		return true
+	case strings.HasPrefix(data, "p:"), strings.HasPrefix(data, "v:"),
+		strings.HasPrefix(data, "c:p:"), strings.HasPrefix(data, "c:v:"),
+		strings.HasPrefix(data, cbAlertSnap), strings.HasPrefix(data, cbAlertClip),
+		strings.HasPrefix(data, cbHistPref), strings.HasPrefix(data, cbRecentPref),
+		strings.HasPrefix(data, cbRecPref):
+		return true
+	default: // c:{idx} opens a camera's page.
+		return strings.HasPrefix(data, "c:") && strings.Count(data, ":") == 1
+	}
+}
+
+// subscribeHere subscribes the handler's subscriber to key, and points the
+// subscription's alerts at the forum topic the request came from. Subscribing
+// again from another topic (or the main chat) moves it. The error is the
+// library's "already subscribed".
+func subscribeHere(handler *Handler, key string) error {
+	err := handler.Sub.Subscribe(key)
+
+	if _, ok := handler.Sub.Events.RuleGetI(key, ruleTopic); ok || handler.Thread != 0 {
+		handler.Sub.Events.RuleSetI(key, ruleTopic, handler.Thread)
+	}
+
+	return err //nolint:wrapcheck // callers only check for nil.
+}
+
+// SubTopic returns the forum topic for a subscriber's alerts about an event
+// (a camera name or catalog event), or 0 for the chat itself. Class
+// subscriptions are checked before a legacy bare-camera one.
+func SubTopic(sub *subscribe.Subscriber, name string, classes []string) int {
+	if sub == nil || sub.Events == nil || name == "" {
+		return 0
+	}
+
+	keys := make([]string, 0, len(classes)+1)
+	for _, class := range classes {
+		keys = append(keys, CameraSubKey(name, class))
+	}
+
+	for _, key := range append(keys, name) {
+		if topic, ok := sub.Events.RuleGetI(key, ruleTopic); ok && topic != 0 {
+			return topic
+		}
+	}
+
+	return 0
+}
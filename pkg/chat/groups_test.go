@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"testing"
+
+	"golift.io/subscribe"
+)
+
+func testGroupSub() *subscribe.Subscriber {
+	sub := &subscribe.Subscriber{
+		ID: -100123, API: "telegram", Contact: "Family",
+		Events: &subscribe.Events{Map: make(map[string]*subscribe.Rules)},
+	}
+	SetSubAuthed(sub, true)
+	SetSubGroup(sub, true)
+
+	return sub
+}
+
+// Group members without admin rights can look around but not change alerts.
+func TestGroupReadOnly(t *testing.T) {
+	t.Parallel()
+
+	data := testEventCatalog(t)
+	sub := testGroupSub()
+	data.Subscribers = []*subscribe.Subscriber{sub}
+	c := New(&Chat{Subs: data})
+
+	reply := c.HandleCommand(&Handler{Sub: sub, Text: []string{"/stop", "60"}, ReadOnly: true})
+	if reply.Reply != groupReadOnlyMsg {
+		t.Fatalf("/stop from a member: %q", reply.Reply)
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, Callback: "e:s:garage_opened", ReadOnly: true})
+	if reply.Toast == "" || sub.Events.Len() != 0 {
+		t.Fatalf("subscribe button from a member: %+v, %d subs", reply, sub.Events.Len())
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, Callback: cbCancel, ReadOnly: true})
+	if reply.Reply != "Done." {
+		t.Fatalf("cancel from a member: %+v", reply)
+	}
+
+	c.HandleCallback(&Handler{Sub: sub, Callback: "e:s:garage_opened"})
+
+	if sub.Events.Name("garage_opened") == "" {
+		t.Fatal("a group admin should be able to subscribe the group")
+	}
+}
+
+// A subscription made in a forum topic sends its alerts there, until it is
+// subscribed again from somewhere else.
+func TestSubscribeHereTopic(t *testing.T) {
+	t.Parallel()
+
+	sub := testGroupSub()
+	key := CameraSubKey("Porch", ClassHuman)
+
+	if err := subscribeHere(&Handler{Sub: sub, Thread: 12}, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := SubTopic(sub, "Porch", []string{ClassMotion, ClassHuman}); got != 12 {
+		t.Fatalf("topic for a human event: got %d want 12", got)
+	}
+
+	if got := SubTopic(sub, "Garage", []string{ClassHuman}); got != 0 {
+		t.Fatalf("topic for another camera: got %d want 0", got)
+	}
+
+	_ = subscribeHere(&Handler{Sub: sub}, key) // again, from the main chat.
+
+	if got := SubTopic(sub, "Porch", []string{ClassHuman}); got != 0 {
+		t.Fatalf("topic after moving to the main chat: got %d want 0", got)
+	}
+
+	person := &subscribe.Subscriber{
+		ID: 1, API: "telegram", Events: &subscribe.Events{Map: make(map[string]*subscribe.Rules)},
+	}
+
+	_ = subscribeHere(&Handler{Sub: person}, "Porch")
+
+	if _, ok := person.Events.RuleGetI("Porch", ruleTopic); ok {
+		t.Fatal("a subscription outside any topic should not get a topic rule")
+	}
+}
@@ -0,0 +1,298 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/history"
+	"golift.io/subscribe"
+)
+
+// History wizard (from /history and /help).
+//
+// y          → newest events matching the subscriber's filter
+// y:o{id}    → older than event id
+// y:n{id}    → newer than event id
+// y:k{class} → filter by class (its short code, * for any)
+// y:h{hours} → filter by period, 0 for all time
+// y:x        → clear the filter
+//
+// The filter lives in the subscriber's meta, so paging buttons stay short.
+const (
+	cbHistRoot       = "y"
+	cbHistPref       = "y:"
+	historyPage      = 10
+	historyFilterSep = "\t"
+)
+
+// historyPeriods are the period buttons, in hours; 0 is all time.
+var historyPeriods = []int{1, 24, 24 * 7, 0}
+
+// historyFilter narrows /history: a camera or event name, a class and a period.
+type historyFilter struct {
+	Name   string
+	Class  string
+	Period time.Duration
+}
+
+func getHistoryFilter(sub *subscribe.Subscriber) historyFilter {
+	value, _ := sub.GetMeta(metaKeyHistory)
+	text, _ := value.(string)
+	parts := strings.Split(text, historyFilterSep)
+
+	filter := historyFilter{Name: parts[0]}
+	if len(parts) > 1 {
+		filter.Class = parts[1]
+	}
+
+	if len(parts) > 2 { //nolint:mnd // name, class, period.
+		filter.Period, _ = time.ParseDuration(parts[2])
+	}
+
+	return filter
+}
+
+func setHistoryFilter(sub *subscribe.Subscriber, filter historyFilter) {
+	if filter == (historyFilter{}) {
+		DeleteSubMeta(sub, metaKeyHistory)
+		return
+	}
+
+	value := strings.Join([]string{filter.Name, filter.Class, filter.Period.String()}, historyFilterSep)
+	sub.SetMeta(metaKeyHistory, value)
+}
+
+// parseHistoryFilter reads /history arguments: a period (30m, 24h, 7d), a
+// class, and anything else is the camera or event name.
+func parseHistoryFilter(args []string) historyFilter {
+	var (
+		filter historyFilter
+		name   []string
+	)
+
+	for _, arg := range args {
+		if period, ok := parsePeriod(arg); ok {
+			filter.Period = period
+		} else if class := normalizeClass(arg); class == ClassMotion || class == ClassHuman ||
+			class == ClassVehicle || class == ClassAnimal {
+			filter.Class = class
+		} else {
+			name = append(name, arg)
+		}
+	}
+
+	filter.Name = strings.Join(name, " ")
+
+	return filter
+}
+
+// parsePeriod reads a Go duration, or a number of days like 7d.
+func parsePeriod(text string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(strings.ToLower(text), "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+
+	period, err := time.ParseDuration(text)
+
+	return period, err == nil && period > 0
+}
+
+func (f historyFilter) label() string {
+	parts := []string{}
+	if f.Name != "" {
+		parts = append(parts, f.Name)
+	}
+
+	if f.Class != "" {
+		parts = append(parts, classLabel(f.Class))
+	}
+
+	if f.Period > 0 {
+		parts = append(parts, "last "+formatDuration(f.Period))
+	}
+
+	if len(parts) == 0 {
+		return "everything"
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+func (f historyFilter) query() history.Query {
+	query := history.Query{Name: f.Name, Class: f.Class, Limit: historyPage}
+	if f.Period > 0 {
+		query.Since = time.Now().Add(-f.Period)
+	}
+
+	return query
+}
+
+func (c *Chat) cmdHistory(handler *Handler) (*Reply, error) {
+	if len(handler.Text) > 1 {
+		setHistoryFilter(handler.Sub, parseHistoryFilter(handler.Text[1:]))
+	}
+
+	reply := c.historyWizard(handler, history.Query{})
+	reply.Edit = false
+
+	return reply, nil
+}
+
+func (c *Chat) handleHistoryWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	if data != cbHistRoot && !strings.HasPrefix(data, cbHistPref) {
+		return nil, false, false
+	}
+
+	var (
+		page   history.Query
+		filter = getHistoryFilter(handler.Sub)
+		arg    = strings.TrimPrefix(data, cbHistPref)
+	)
+
+	switch {
+	case data == cbHistRoot:
+	case arg == "x":
+		setHistoryFilter(handler.Sub, historyFilter{})
+	case strings.HasPrefix(arg, "o"):
+		page.Before, _ = strconv.ParseInt(arg[1:], 10, 64)
+	case strings.HasPrefix(arg, "n"):
+		page.After, _ = strconv.ParseInt(arg[1:], 10, 64)
+	case strings.HasPrefix(arg, "k"):
+		filter.Class = classFromShort(arg[1:])
+		if filter.Class == ClassAny {
+			filter.Class = ""
+		}
+
+		setHistoryFilter(handler.Sub, filter)
+	case strings.HasPrefix(arg, "h"):
+		filter.Period = time.Duration(atoiDefault(arg[1:], 0)) * time.Hour
+		setHistoryFilter(handler.Sub, filter)
+	}
+
+	return c.historyWizard(handler, page), false, true
+}
+
+// historyWizard shows one page of the event history. Admins see who was
+// notified; everyone else sees how many.
+func (c *Chat) historyWizard(handler *Handler, page history.Query) *Reply {
+	if c.History == nil {
+		return &Reply{Reply: "Event history is off.", Edit: true}
+	}
+
+	filter := getHistoryFilter(handler.Sub)
+	query := filter.query()
+	query.Before, query.After = page.Before, page.After
+	entries, more := c.History.Find(query)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "History: %s.\n", filter.label())
+
+	if len(entries) == 0 {
+		msg.WriteString("\nNo events.")
+	}
+
+	for _, entry := range entries {
+		msg.WriteString("\n" + historyLine(&entry, SubAdmin(handler.Sub)))
+	}
+
+	msg.WriteString("\n\nFilter with text: /history Porch human 24h")
+
+	return &Reply{Reply: msg.String(), Edit: true, Keyboard: historyKeyboard(filter, entries, page, more)}
+}
+
+func historyKeyboard(filter historyFilter, entries []history.Entry, page history.Query, more bool) [][]Button {
+	classes := []Button{}
+	for _, class := range []string{ClassAny, ClassMotion, ClassHuman, ClassVehicle, ClassAnimal} {
+		label := classLabel(class)
+		if class == filter.Class || class == ClassAny && filter.Class == "" {
+			label = "• " + label
+		}
+
+		classes = append(classes, Button{Label: label, Data: cbHistPref + "k" + classShort(class)})
+	}
+
+	periods := []Button{}
+	for _, hours := range historyPeriods {
+		label := "All"
+		if hours > 0 {
+			label = formatHistoryPeriod(hours)
+		}
+
+		if time.Duration(hours)*time.Hour == filter.Period {
+			label = "• " + label
+		}
+
+		periods = append(periods, Button{Label: label, Data: fmt.Sprintf("%sh%d", cbHistPref, hours)})
+	}
+
+	paging := []Button{}
+	// Entries come newest first: older pages go past the last, newer before the first.
+	if len(entries) > 0 && (more || page.After > 0) {
+		oldest := entries[len(entries)-1].ID
+		paging = append(paging, Button{Label: "« Older", Data: fmt.Sprintf("%so%d", cbHistPref, oldest)})
+	}
+
+	if len(entries) > 0 && (page.Before > 0 || page.After > 0 && more) {
+		paging = append(paging, Button{Label: "Newer »", Data: fmt.Sprintf("%sn%d", cbHistPref, entries[0].ID)})
+	}
+
+	rows := [][]Button{classes, periods}
+	if len(paging) > 0 {
+		rows = append(rows, paging)
+	}
+
+	last := []Button{{Label: "Newest", Data: cbHistRoot}}
+	if filter != (historyFilter{}) {
+		last = append(last, Button{Label: "Clear filter", Data: cbHistPref + "x"})
+	}
+
+	return append(rows, append(last, Button{Label: "Done", Data: cbCancel}))
+}
+
+// formatHistoryPeriod labels a period button: 1h, 24h, 7d.
+func formatHistoryPeriod(hours int) string {
+	if hours%24 == 0 && hours > 24 { //nolint:mnd // hours in a day.
+		return strconv.Itoa(hours/24) + "d" //nolint:mnd // hours in a day.
+	}
+
+	return strconv.Itoa(hours) + "h"
+}
+
+// historyLine is one event in /history.
+func historyLine(entry *history.Entry, names bool) string {
+	layout := "15:04:05"
+	if time.Since(entry.Time) > 20*time.Hour { //nolint:mnd // roughly "not today".
+		layout = "Mon Jan 2 15:04"
+	}
+
+	line := entry.Time.Local().Format(layout) + " " + entry.Name()
+	if len(entry.Classes) > 0 {
+		line += " (" + strings.Join(entry.Classes, ", ") + ")"
+	}
+
+	switch {
+	case len(entry.Notified) > 0 && names:
+		line += " → " + strings.Join(entry.Notified, ", ")
+	case entry.Sent > 0:
+		line += fmt.Sprintf(" → %d sent", entry.Sent)
+	case entry.Digest == 0 && entry.Failed == 0:
+		line += " → nobody"
+	}
+
+	if entry.Failed > 0 {
+		line += fmt.Sprintf(" ⚠ %d failed", entry.Failed)
+	}
+
+	if entry.Spooled > 0 {
+		line += fmt.Sprintf(" (%d queued)", entry.Spooled)
+	}
+
+	if entry.Digest > 0 {
+		line += fmt.Sprintf(" +%d digest", entry.Digest)
+	}
+
+	return line
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/history"
+)
+
+// /history keeps its filter for the paging and filter buttons.
+func TestHistoryWizard(t *testing.T) {
+	t.Parallel()
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 25 {
+		_, _ = store.Add(history.Entry{
+			Time:     time.Now().Add(time.Duration(i-25) * time.Minute),
+			Camera:   "Porch",
+			Classes:  []string{ClassMotion, ClassHuman},
+			Notified: []string{"1:ann"},
+			Sent:     1,
+		})
+	}
+
+	_, _ = store.Add(history.Entry{Event: "garage_opened"})
+
+	sub := testGroupSub()
+	c := New(&Chat{Subs: testEventCatalog(t), TempDir: t.TempDir(), History: store})
+
+	reply := c.HandleCommand(&Handler{Sub: sub, Text: []string{"history", "porch", "human", "24h"}})
+	if !strings.Contains(reply.Reply, "History: porch · Human · last") || strings.Contains(reply.Reply, "garage") {
+		t.Fatalf("filtered page: %q", reply.Reply)
+	}
+
+	if strings.Count(reply.Reply, "Porch (motion, human)") != historyPage {
+		t.Fatalf("page size: %q", reply.Reply)
+	}
+
+	older := findButton(reply.Keyboard, "« Older")
+	if older == "" {
+		t.Fatalf("no Older button: %+v", reply.Keyboard)
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, Callback: older})
+	if findButton(reply.Keyboard, "Newer »") == "" || findButton(reply.Keyboard, "« Older") == "" {
+		t.Fatalf("middle page buttons: %+v", reply.Keyboard)
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, Callback: "y:x"})
+	if !strings.Contains(reply.Reply, "History: everything") ||
+		!strings.Contains(reply.Reply, "garage_opened → nobody") {
+		t.Fatalf("cleared filter: %q", reply.Reply)
+	}
+}
+
+func findButton(rows [][]Button, label string) string {
+	for _, row := range rows {
+		for _, button := range row {
+			if button.Label == label {
+				return button.Data
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golift.io/subscribe"
+)
+
+// Household modes. The mode is one reserved catalog entry, so it is saved
+// with the subscriber database. Each subscription lists the modes it fires
+// in (all of them until someone narrows it), and alerts only reach the
+// subscriptions that include the current mode.
+const (
+	ModeArmed    = "armed"
+	ModeHome     = "home"
+	ModeDisarmed = "disarmed"
+
+	// DefaultMode is the mode before anyone sets one.
+	DefaultMode = ModeArmed
+
+	modeKey     = "__mode"
+	ruleMode    = "mode"  // S rule on modeKey: the current mode.
+	ruleModeBy  = "by"    // S rule on modeKey: who set it.
+	ruleModes   = "modes" // S rule on a subscription: comma list, empty for all.
+	modeListSep = ","
+)
+
+// ErrBadMode is returned for a mode name that is not armed, home or disarmed.
+var ErrBadMode = errors.New("mode must be armed, home or disarmed")
+
+// Modes lists every household mode in menu order.
+func Modes() []string {
+	return []string{ModeArmed, ModeHome, ModeDisarmed}
+}
+
+// ParseMode returns the mode for a name or a common alias (away, stay, off).
+func ParseMode(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case ModeArmed, "arm", "away":
+		return ModeArmed, nil
+	case ModeHome, "stay", "night":
+		return ModeHome, nil
+	case ModeDisarmed, "disarm", "off":
+		return ModeDisarmed, nil
+	default:
+		return "", fmt.Errorf("%w, not %q", ErrBadMode, name)
+	}
+}
+
+// ModeLabel is a mode's name for menus and messages.
+func ModeLabel(mode string) string {
+	if mode == "" {
+		return ""
+	}
+
+	return strings.ToUpper(mode[:1]) + mode[1:]
+}
+
+// IsReservedKey reports whether a catalog entry holds settings rather than a
+// subscribable event: camera settings and the household mode.
+func IsReservedKey(name string) bool {
+	return IsCamSettingsKey(name) || name == modeKey
+}
+
+// HouseMode returns the current household mode and who set it.
+func HouseMode(data *subscribe.Subscribe) (string, string) {
+	if data == nil || data.Events == nil {
+		return DefaultMode, ""
+	}
+
+	mode, _ := data.Events.RuleGetS(modeKey, ruleMode)
+	if _, err := ParseMode(mode); err != nil {
+		return DefaultMode, ""
+	}
+
+	by, _ := data.Events.RuleGetS(modeKey, ruleModeBy)
+
+	return mode, by
+}
+
+// SetHouseMode stores the household mode. It reports whether the mode changed.
+func SetHouseMode(data *subscribe.Subscribe, mode, by string) bool {
+	if current, _ := HouseMode(data); current == mode && data.Events.Exists(modeKey) {
+		return false
+	}
+
+	if !data.Events.Exists(modeKey) {
+		_ = data.Events.New(modeKey, &subscribe.Rules{})
+	}
+
+	data.Events.RuleSetS(modeKey, ruleMode, mode)
+	data.Events.RuleSetS(modeKey, ruleModeBy, by)
+
+	return true
+}
+
+// SetMode changes the household mode and announces the change through
+// ModeChanged. by names who changed it. Callers save the state.
+func (c *Chat) SetMode(name, by string) (string, bool, error) {
+	mode, err := ParseMode(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !SetHouseMode(c.Subs, mode, by) {
+		return mode, false, nil
+	}
+
+	c.Info.Printf("Mode changed to %s by %s", mode, by)
+
+	if c.ModeChanged != nil {
+		c.ModeChanged(mode, by)
+	}
+
+	return mode, true, nil
+}
+
+// ModeMessage is the text of the Mode Changed system event.
+func ModeMessage(mode, by string) string {
+	if by == "" {
+		return "Mode changed to " + ModeLabel(mode) + "."
+	}
+
+	return "Mode changed to " + ModeLabel(mode) + " by " + by + "."
+}
+
+// SubModes returns the modes a subscription fires in.
+func SubModes(sub *subscribe.Subscriber, key string) []string {
+	list, _ := sub.Events.RuleGetS(key, ruleModes)
+
+	modes := make([]string, 0, len(Modes()))
+	for _, name := range strings.Split(list, modeListSep) {
+		if mode, err := ParseMode(name); err == nil && !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	if len(modes) == 0 {
+		return Modes()
+	}
+
+	return modes
+}
+
+// SetSubModes sets the modes a subscription fires in. None, or all of them,
+// clears the rule so the subscription fires in every mode.
+func SetSubModes(sub *subscribe.Subscriber, key string, modes []string) {
+	list := make([]string, 0, len(modes))
+
+	for _, mode := range Modes() {
+		if slices.Contains(modes, mode) {
+			list = append(list, mode)
+		}
+	}
+
+	if len(list) == len(Modes()) {
+		list = nil
+	}
+
+	sub.Events.RuleSetS(key, ruleModes, strings.Join(list, modeListSep))
+}
+
+// SubModeAllowed reports whether a subscription fires in mode.
+func SubModeAllowed(sub *subscribe.Subscriber, key, mode string) bool {
+	return sub == nil || sub.Events == nil || slices.Contains(SubModes(sub, key), mode)
+}
+
+// subModesLabel names a subscription's modes for menus.
+func subModesLabel(sub *subscribe.Subscriber, key string) string {
+	modes := SubModes(sub, key)
+	if len(modes) == len(Modes()) {
+		return "every mode"
+	}
+
+	return strings.Join(modes, " + ")
+}
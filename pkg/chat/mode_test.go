@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golift.io/subscribe"
+)
+
+// Alerts only reach subscriptions that fire in the current mode, and a mode
+// change is announced once.
+func TestHouseMode(t *testing.T) {
+	t.Parallel()
+
+	data, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var announced []string
+	c := New(&Chat{Subs: data, ModeChanged: func(mode, by string) { announced = append(announced, mode+"/"+by) }})
+
+	sub := data.CreateSubWithID(1, "ann", "telegram", false, false)
+	_ = sub.Subscribe(CameraSubKey("Porch", ClassHuman))
+	_ = sub.Subscribe(EventStreamDown)
+	SetSubModes(sub, CameraSubKey("Porch", ClassHuman), []string{ModeArmed})
+
+	if mode, _ := HouseMode(data); mode != DefaultMode {
+		t.Fatalf("unset: got %q", mode)
+	}
+
+	if got := CollectSubscribers(data, []string{CameraSubKey("Porch", ClassHuman)}); len(got) != 1 {
+		t.Fatalf("armed: got %d subscribers want 1", len(got))
+	}
+
+	if _, changed, err := c.SetMode("stay", "ann"); !changed || err != nil {
+		t.Fatalf("SetMode: changed=%v err=%v", changed, err)
+	}
+
+	if _, changed, _ := c.SetMode(ModeHome, "bob"); changed {
+		t.Fatal("setting the same mode again reported a change")
+	}
+
+	if len(announced) != 1 || announced[0] != "home/ann" {
+		t.Fatalf("announced: %v", announced)
+	}
+
+	if got := CollectSubscribers(data, []string{CameraSubKey("Porch", ClassHuman)}); len(got) != 0 {
+		t.Fatalf("home: got %d subscribers for an armed-only subscription", len(got))
+	}
+
+	if got := CollectSubscribers(data, []string{EventStreamDown}); len(got) != 1 {
+		t.Fatalf("home: got %d subscribers for an every-mode subscription", len(got))
+	}
+
+	if slices.Contains(CatalogEventNames(data.Events), modeKey) {
+		t.Fatal("the mode showed up as a catalog event")
+	}
+
+	SetSubModes(sub, EventStreamDown, Modes())
+
+	if list, _ := sub.Events.RuleGetS(EventStreamDown, ruleModes); list != "" {
+		t.Fatalf("every mode should clear the rule, got %q", list)
+	}
+}
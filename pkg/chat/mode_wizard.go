@@ -0,0 +1,202 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Mode wizard (from /mode, /help, and /subs → subscription).
+//
+// o                → current household mode; admins get a button per mode
+// o:{code}         → admins: switch to a mode (code is its first letter)
+// o:s:{idx}        → which modes one of your subscriptions fires in
+// o:s:{idx}:{code} → toggle one of those modes
+const (
+	cbModeRoot    = "o"
+	cbModeSubPref = "o:s:"
+)
+
+// modeByCode returns the mode whose first letter is code.
+func modeByCode(code string) (string, bool) {
+	for _, mode := range Modes() {
+		if mode[:1] == code {
+			return mode, true
+		}
+	}
+
+	return "", false
+}
+
+// modeHelp explains the modes; the same text heads /mode and the subscription page.
+const modeHelp = "Armed — nobody is home.\n" +
+	"Home — someone is home.\n" +
+	"Disarmed — the alarm is off."
+
+func (c *Chat) cmdMode(handler *Handler) (*Reply, error) {
+	if len(handler.Text) < twoItems {
+		root := c.modeWizardRoot(handler)
+		root.Edit = false
+
+		return root, nil
+	}
+
+	if !SubAdmin(handler.Sub) {
+		return &Reply{Reply: "Only admins can change the mode."}, nil
+	}
+
+	mode, changed, err := c.SetMode(handler.Text[1], subscriberDisplayName(handler.Sub))
+	if err != nil {
+		return &Reply{Reply: err.Error()}, ErrBadUsage
+	}
+
+	if !changed {
+		return &Reply{Reply: "Already " + ModeLabel(mode) + "."}, nil
+	}
+
+	return &Reply{Reply: "Mode is now " + ModeLabel(mode) + "."}, nil
+}
+
+func (c *Chat) handleModeWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	switch {
+	case data == cbModeRoot:
+		return c.modeWizardRoot(handler), false, true
+	case strings.HasPrefix(data, cbModeSubPref):
+		idxStr, code, toggle := strings.Cut(strings.TrimPrefix(data, cbModeSubPref), ":")
+		if !toggle {
+			return c.subModesWizard(handler, idxStr), false, true
+		}
+
+		reply, save := c.subModesWizardToggle(handler, idxStr, code)
+
+		return reply, save, true
+	case strings.HasPrefix(data, cbModeRoot+":"):
+		reply, save := c.modeWizardSet(handler, strings.TrimPrefix(data, cbModeRoot+":"))
+
+		return reply, save, true
+	default:
+		return nil, false, false
+	}
+}
+
+func (c *Chat) modeWizardRoot(handler *Handler) *Reply {
+	mode, by := HouseMode(c.Subs)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Household mode: %s", ModeLabel(mode))
+
+	if by != "" {
+		fmt.Fprintf(&msg, " (set by %s)", by)
+	}
+
+	msg.WriteString(".\n\n" + modeHelp + "\n\nA subscription fires in every mode until you " +
+		"narrow it: /subs → subscription → Modes. Human alerts only when Armed, for example.")
+
+	rows := make([][]Button, 0, 2) //nolint:mnd // modes and done rows.
+
+	if handler.Sub != nil && SubAdmin(handler.Sub) {
+		row := make([]Button, 0, len(Modes()))
+		for _, next := range Modes() {
+			label := ModeLabel(next)
+			if next == mode {
+				label = "• " + label
+			}
+
+			row = append(row, Button{Label: label, Data: cbModeRoot + ":" + next[:1]})
+		}
+
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, []Button{{Label: "Done", Data: cbCancel}})
+
+	return &Reply{Reply: msg.String(), Edit: true, Keyboard: rows}
+}
+
+func (c *Chat) modeWizardSet(handler *Handler, code string) (*Reply, bool) {
+	if reply := c.requireAdmin(handler); reply != nil {
+		return reply, false
+	}
+
+	mode, ok := modeByCode(code)
+	if !ok {
+		return &Reply{Reply: "Bad mode pick.", Edit: true, Toast: "Error"}, false
+	}
+
+	_, changed, err := c.SetMode(mode, subscriberDisplayName(handler.Sub))
+	if err != nil {
+		return &Reply{Reply: err.Error(), Edit: true, Toast: "Error"}, false
+	}
+
+	next := c.modeWizardRoot(handler)
+	next.Toast = ModeLabel(mode)
+
+	return next, changed
+}
+
+func (c *Chat) subModesWizard(handler *Handler, idxStr string) *Reply {
+	idx := atoiDefault(idxStr, -1)
+	names := handler.Sub.Events.Names()
+
+	if idx < 0 || idx >= len(names) {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}
+	}
+
+	event := names[idx]
+	modes := SubModes(handler.Sub, event)
+	current, _ := HouseMode(c.Subs)
+
+	row := make([]Button, 0, len(Modes()))
+	for _, mode := range Modes() {
+		mark := "☐ "
+		if slices.Contains(modes, mode) {
+			mark = "☑ "
+		}
+
+		data := fmt.Sprintf("%s%d:%s", cbModeSubPref, idx, mode[:1])
+		row = append(row, Button{Label: mark + ModeLabel(mode), Data: data})
+	}
+
+	return &Reply{
+		Reply: fmt.Sprintf("Modes for %s: %s.\nThe household is %s right now.\n\n%s\n\nTap a mode to turn it on or off:",
+			formatSubLabel(event), subModesLabel(handler.Sub, event), ModeLabel(current), modeHelp),
+		Edit: true,
+		Keyboard: [][]Button{
+			row,
+			{{Label: "« Back", Data: fmt.Sprintf("l:%d", idx)}, {Label: "Done", Data: cbCancel}},
+		},
+	}
+}
+
+func (c *Chat) subModesWizardToggle(handler *Handler, idxStr, code string) (*Reply, bool) {
+	idx := atoiDefault(idxStr, -1)
+	names := handler.Sub.Events.Names()
+	mode, ok := modeByCode(code)
+
+	if idx < 0 || idx >= len(names) || !ok {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}, false
+	}
+
+	event := names[idx]
+	modes := SubModes(handler.Sub, event)
+
+	if slices.Contains(modes, mode) {
+		if len(modes) == 1 {
+			next := c.subModesWizard(handler, idxStr)
+			next.Toast = "Keep at least one mode"
+
+			return next, false
+		}
+
+		modes = slices.DeleteFunc(modes, func(m string) bool { return m == mode })
+	} else {
+		modes = append(modes, mode)
+	}
+
+	SetSubModes(handler.Sub, event, modes)
+
+	next := c.subModesWizard(handler, idxStr)
+	next.Toast = "Saved"
+
+	return next, true
+}
@@ -0,0 +1,191 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/davidnewhall/motifini/pkg/archive"
+)
+
+// Recent clips wizard (from /recent and /help), for the clip archive.
+//
+// r                → cameras with archived clips
+// r:{cam}          → a camera's newest clips
+// r:{cam}:{name}   → send one again (name is the clip ID after the camera)
+const (
+	cbRecentRoot = "r"
+	cbRecentPref = "r:"
+	recentPage   = 10
+)
+
+func (c *Chat) cmdRecent(handler *Handler) (*Reply, error) {
+	var reply *Reply
+
+	if len(handler.Text) > 1 && c.Archive != nil {
+		name := strings.Join(handler.Text[1:], " ")
+		for idx, camera := range c.Archive.Cameras() {
+			if strings.EqualFold(camera, name) {
+				reply = c.recentWizardCamera(idx)
+			}
+		}
+
+		if reply == nil {
+			return &Reply{Reply: "No archived clips from " + name + "."}, nil
+		}
+	} else {
+		reply = c.recentWizardRoot()
+	}
+
+	reply.Edit = false
+
+	return reply, nil
+}
+
+func (c *Chat) handleRecentWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	if data == cbRecentRoot {
+		return c.recentWizardRoot(), false, true
+	}
+
+	payload, ok := strings.CutPrefix(data, cbRecentPref)
+	if !ok {
+		return nil, false, false
+	}
+
+	idxStr, name, resend := strings.Cut(payload, ":")
+	if !resend {
+		return c.recentWizardCamera(atoiDefault(idxStr, -1)), false, true
+	}
+
+	return c.recentWizardSend(handler, atoiDefault(idxStr, -1), name), false, true
+}
+
+func (c *Chat) recentWizardRoot() *Reply {
+	if c.Archive == nil {
+		return &Reply{Reply: "The clip archive is off. An admin can set archive_dir to keep motion clips.", Edit: true}
+	}
+
+	counts := make(map[string]int)
+	for _, clip := range c.Archive.List("", 0) {
+		counts[clip.Camera]++
+	}
+
+	cameras := c.Archive.Cameras()
+	rows := make([][]Button, 0, len(cameras)+1)
+
+	for idx, camera := range cameras {
+		rows = append(rows, []Button{{
+			Label: fmt.Sprintf("%s (%d)", camera, counts[camera]),
+			Data:  fmt.Sprintf("%s%d", cbRecentPref, idx),
+		}})
+	}
+
+	rows = append(rows, []Button{{Label: "Done", Data: cbCancel}})
+
+	msg := "Archived motion clips. Pick a camera:"
+	if len(cameras) == 0 {
+		msg = "No archived clips yet."
+	}
+
+	return &Reply{Reply: msg, Edit: true, Keyboard: rows}
+}
+
+// recentCamera returns the camera at an index of the archive's camera list.
+func (c *Chat) recentCamera(idx int) (string, bool) {
+	cameras := c.Archive.Cameras()
+	if idx < 0 || idx >= len(cameras) {
+		return "", false
+	}
+
+	return cameras[idx], true
+}
+
+func (c *Chat) recentWizardCamera(idx int) *Reply {
+	camera, ok := c.recentCamera(idx)
+	if !ok {
+		return &Reply{Reply: "No clips from that camera any more.", Edit: true, Toast: "Missing"}
+	}
+
+	clips := c.Archive.List(camera, recentPage)
+	rows := make([][]Button, 0, len(clips)+1)
+
+	for _, clip := range clips {
+		_, name, _ := strings.Cut(clip.ID, "/")
+		rows = append(rows, []Button{{
+			Label: recentLabel(&clip),
+			Data:  fmt.Sprintf("%s%d:%s", cbRecentPref, idx, name),
+		}})
+	}
+
+	rows = append(rows, []Button{{Label: "« Cameras", Data: cbRecentRoot}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply:    fmt.Sprintf("Newest clips from %s. Tap one to get it again:", camera),
+		Edit:     true,
+		Keyboard: rows,
+	}
+}
+
+// recentLabel names an archived clip: when it happened and what was seen.
+func recentLabel(clip *archive.Clip) string {
+	label := clip.Time.Local().Format("Mon Jan 2 15:04:05")
+	if len(clip.Classes) > 0 {
+		label += " · " + strings.Join(clip.Classes, ", ")
+	}
+
+	if clip.Video == "" {
+		label += " (still)"
+	}
+
+	return label
+}
+
+// recentWizardSend sends an archived clip (or its still, when no video was
+// kept) again. The camera's list stays up for the next pick.
+func (c *Chat) recentWizardSend(handler *Handler, idx int, name string) *Reply {
+	camera, ok := c.recentCamera(idx)
+	if !ok {
+		return &Reply{Reply: "No clips from that camera any more.", Edit: true, Toast: "Missing"}
+	}
+
+	var clip *archive.Clip
+
+	for _, found := range c.Archive.List(camera, 0) {
+		if strings.HasSuffix(found.ID, "/"+name) {
+			clip = &found
+			break
+		}
+	}
+
+	if clip == nil {
+		return &Reply{Reply: "That clip was pruned from the archive.", Edit: true, Toast: "Missing"}
+	}
+
+	file := clip.Video
+	if file == "" {
+		file = clip.Snapshot
+	}
+
+	path, err := c.Archive.CopyTo(clip, file, c.TempDir, "motifini_recent_"+handler.ID+"_")
+	if err != nil {
+		return &Reply{Reply: "Error reading the archive: " + err.Error(), Edit: true, Toast: "Error"}
+	}
+
+	caption := camera + " · " + recentLabel(clip)
+	next := c.recentWizardCamera(idx)
+	next.Toast = "Sending…"
+
+	if handler.SendFile == nil {
+		next.Reply, next.Files = caption, []string{path}
+		return next
+	}
+
+	if err := handler.SendFile(path, caption); err != nil {
+		c.Error.Printf("[%v] SendFile archived %s: %v", handler.ID, clip.ID, err)
+		_ = os.Remove(path)
+
+		return &Reply{Reply: "Error sending the clip: " + err.Error(), Edit: true, Toast: "Error"}
+	}
+
+	return next
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/archive"
+)
+
+// /recent lists a camera's archived clips and sends a copy of one, leaving
+// the archive's file alone.
+func TestRecentWizard(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	_ = os.WriteFile(video, []byte("clip"), 0o600)
+
+	clip := archive.Clip{Camera: "Porch", Time: time.Now(), Classes: []string{ClassHuman}}
+	kept, _ := store.Keep("ab12", clip, video, "")
+
+	sub := testGroupSub()
+	c := New(&Chat{Subs: testEventCatalog(t), TempDir: t.TempDir(), Archive: store})
+
+	reply := c.HandleCommand(&Handler{Sub: sub, ID: "req1", Text: []string{"recent", "porch"}})
+	if len(reply.Keyboard) != 2 || !strings.Contains(reply.Keyboard[0][0].Label, "human") {
+		t.Fatalf("camera page: %+v", reply.Keyboard)
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, ID: "req2", Callback: reply.Keyboard[0][0].Data})
+	if len(reply.Files) != 1 || !strings.HasPrefix(reply.Reply, "Porch · ") {
+		t.Fatalf("resend: %+v", reply)
+	}
+
+	_ = os.Remove(reply.Files[0]) // what the messenger does after sending
+
+	if clip, err := store.Get(kept.ID); err != nil || clip.Video == "" {
+		t.Fatalf("archive lost the clip: %v", err)
+	}
+
+	if got := c.HandleCallback(&Handler{Sub: sub, Callback: "r:0:20200101-000000-gone"}); got.Toast != "Missing" {
+		t.Fatalf("pruned clip: %+v", got)
+	}
+}
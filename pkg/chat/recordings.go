@@ -0,0 +1,456 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golift.io/securityspy/v2"
+)
+
+// Recordings wizard (from /recordings and /help), for SecuritySpy's own
+// motion and continuous recordings.
+//
+// f                           → cameras
+// f:{cam}                     → days (today and the week before)
+// f:{cam}:{date}              → time ranges of the day
+// f:{cam}:{date}:{from}       → the recordings in that range ("a" is the whole day)
+// f:{cam}:{date}:{from}:{at}  → send one (at is its Unix time)
+const (
+	cbRecRoot       = "f"
+	cbRecPref       = "f:"
+	recDateForm     = "20060102"
+	recDays         = 7
+	recBlockHours   = 4
+	recWholeDay     = "a"
+	recordingsPage  = 12
+	recRangesPerRow = 3
+	recTrimTimeout  = 5 * time.Minute
+	recDownloadName = "motifini_recording_%v_%d%s"
+)
+
+// ErrNoFFmpeg is returned when a recording needs trimming and ffmpeg is not found.
+var ErrNoFFmpeg = errors.New("ffmpeg not found; set ffmpeg_path to trim recordings")
+
+func (c *Chat) cmdRecordings(handler *Handler) (*Reply, error) {
+	if len(handler.Text) < twoItems {
+		root := c.recordingsWizardRoot()
+		root.Edit = false
+
+		return root, nil
+	}
+
+	name := strings.Join(handler.Text[1:], " ")
+	for idx, cam := range c.allCameras() {
+		if strings.EqualFold(cam.Name, name) {
+			reply := c.recordingsWizardDays(idx)
+			reply.Edit = false
+
+			return reply, nil
+		}
+	}
+
+	return &Reply{Reply: "Unknown Camera: " + name}, ErrBadUsage
+}
+
+func (c *Chat) handleRecordingsWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	if data == cbRecRoot {
+		return c.recordingsWizardRoot(), false, true
+	}
+
+	payload, ok := strings.CutPrefix(data, cbRecPref)
+	if !ok {
+		return nil, false, false
+	}
+
+	parts := strings.Split(payload, ":")
+	idx := atoiDefault(parts[0], -1)
+
+	switch len(parts) {
+	case 1:
+		return c.recordingsWizardDays(idx), false, true
+	case 2: //nolint:mnd // f:{cam}:{date}
+		return c.recordingsWizardRanges(idx, parts[1]), false, true
+	case 3: //nolint:mnd // f:{cam}:{date}:{from}
+		return c.recordingsWizardList(idx, parts[1], parts[2]), false, true
+	default:
+		at, _ := strconv.ParseInt(parts[3], 10, 64)
+
+		return c.recordingsWizardSend(handler, idx, parts[1], parts[2], at), false, true
+	}
+}
+
+func (c *Chat) recordingsWizardRoot() *Reply {
+	c.refreshCameras()
+	if len(c.allCameras()) == 0 {
+		return c.noCamerasReply()
+	}
+
+	rows := c.cameraButtonRows(cbRecPref, false)
+	rows = append(rows, []Button{{Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply:    "Review footage SecuritySpy recorded. Pick a camera:",
+		Edit:     true,
+		Keyboard: rows,
+	}
+}
+
+// recordingsCamera returns the camera at an index of the camera list.
+func (c *Chat) recordingsCamera(idx int) *securityspy.Camera {
+	cams := c.allCameras()
+	if idx < 0 || idx >= len(cams) {
+		return nil
+	}
+
+	return cams[idx]
+}
+
+func (c *Chat) recordingsWizardDays(idx int) *Reply {
+	cam := c.recordingsCamera(idx)
+	if cam == nil {
+		return &Reply{Reply: "Bad camera.", Edit: true, Toast: "Error"}
+	}
+
+	today := startOfDay(time.Now())
+	rows := make([][]Button, 0, recDays/twoItems+twoItems)
+	row := make([]Button, 0, twoItems)
+
+	for ago := range recDays {
+		day := today.AddDate(0, 0, -ago)
+		data := fmt.Sprintf("%s%d:%s", cbRecPref, idx, day.Format(recDateForm))
+		row = append(row, Button{Label: recDayLabel(day, ago), Data: data})
+
+		if len(row) == twoItems {
+			rows = append(rows, row)
+			row = make([]Button, 0, twoItems)
+		}
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, []Button{{Label: "« Cameras", Data: cbRecRoot}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{Reply: "Recordings from " + cam.Name + ". Pick a day:", Edit: true, Keyboard: rows}
+}
+
+func recDayLabel(day time.Time, ago int) string {
+	switch ago {
+	case 0:
+		return "Today"
+	case 1:
+		return "Yesterday"
+	default:
+		return day.Format("Mon Jan 2")
+	}
+}
+
+func (c *Chat) recordingsWizardRanges(idx int, date string) *Reply {
+	cam := c.recordingsCamera(idx)
+	day, err := time.ParseInLocation(recDateForm, date, time.Local)
+
+	if cam == nil || err != nil {
+		return &Reply{Reply: "Bad camera or day.", Edit: true, Toast: "Error"}
+	}
+
+	prefix := fmt.Sprintf("%s%d:%s:", cbRecPref, idx, date)
+	rows := [][]Button{{{Label: "Whole day", Data: prefix + recWholeDay}}}
+	row := make([]Button, 0, recRangesPerRow)
+
+	for hour := 0; hour < 24; hour += recBlockHours {
+		row = append(row, Button{
+			Label: fmt.Sprintf("%02d:00–%02d:00", hour, hour+recBlockHours),
+			Data:  prefix + strconv.Itoa(hour),
+		})
+
+		if len(row) == recRangesPerRow {
+			rows = append(rows, row)
+			row = make([]Button, 0, recRangesPerRow)
+		}
+	}
+
+	days := fmt.Sprintf("%s%d", cbRecPref, idx)
+	rows = append(rows, []Button{{Label: "« Days", Data: days}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply:    fmt.Sprintf("Recordings from %s on %s. Pick a time:", cam.Name, day.Format("Mon Jan 2")),
+		Edit:     true,
+		Keyboard: rows,
+	}
+}
+
+// recordingsRange turns a date and a range button into the times it covers.
+func recordingsRange(date, from string) (time.Time, time.Time, bool) {
+	day, err := time.ParseInLocation(recDateForm, date, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	if from == recWholeDay {
+		return day, day.AddDate(0, 0, 1), true
+	}
+
+	hour, err := strconv.Atoi(from)
+	if err != nil || hour < 0 || hour >= 24 || hour%recBlockHours != 0 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start := day.Add(time.Duration(hour) * time.Hour)
+
+	return start, start.Add(recBlockHours * time.Hour), true
+}
+
+// recording is a SecuritySpy recording file and the kind of recording it is.
+type recording struct {
+	*securityspy.File
+	Continuous bool
+}
+
+// recordings lists a camera's motion and continuous recordings in a time
+// range, newest first.
+func (c *Chat) recordings(cam *securityspy.Camera, from, until time.Time) ([]recording, error) {
+	if c.SSpy == nil || c.SSpy.Files == nil {
+		return nil, nil
+	}
+
+	motion, err := c.SSpy.Files.GetVideos([]int{cam.Number}, from, until)
+	if err != nil {
+		return nil, fmt.Errorf("listing recordings: %w", err)
+	}
+
+	continuous, err := c.SSpy.Files.GetCCVideos([]int{cam.Number}, from, until)
+	if err != nil {
+		return nil, fmt.Errorf("listing recordings: %w", err)
+	}
+
+	return sortRecordings(motion, continuous), nil
+}
+
+// sortRecordings merges motion and continuous recordings, newest first.
+func sortRecordings(motion, continuous []*securityspy.File) []recording {
+	files := make([]recording, 0, len(motion)+len(continuous))
+
+	for _, list := range []struct {
+		files      []*securityspy.File
+		continuous bool
+	}{{motion, false}, {continuous, true}} {
+		for _, file := range list.files {
+			if file != nil {
+				files = append(files, recording{File: file, Continuous: list.continuous})
+			}
+		}
+	}
+
+	slices.SortStableFunc(files, func(a, b recording) int { return b.Updated.Compare(a.Updated) })
+
+	return files
+}
+
+func (c *Chat) recordingsWizardList(idx int, date, from string) *Reply {
+	cam := c.recordingsCamera(idx)
+	start, until, ok := recordingsRange(date, from)
+
+	if cam == nil || !ok {
+		return &Reply{Reply: "Bad camera or time.", Edit: true, Toast: "Error"}
+	}
+
+	times := fmt.Sprintf("%s%d:%s", cbRecPref, idx, date)
+	back := [][]Button{{{Label: "« Times", Data: times}, {Label: "Done", Data: cbCancel}}}
+
+	files, err := c.recordings(cam, start, until)
+	if err != nil {
+		return &Reply{Reply: "Error from SecuritySpy: " + err.Error(), Edit: true, Toast: "Error", Keyboard: back}
+	}
+
+	when := start.Format("Mon Jan 2")
+	if from != recWholeDay {
+		when += " " + start.Format("15:04") + "–" + until.Format("15:04")
+	}
+
+	if len(files) == 0 {
+		return &Reply{Reply: fmt.Sprintf("No recordings from %s on %s.", cam.Name, when), Edit: true, Keyboard: back}
+	}
+
+	msg := fmt.Sprintf("Recordings from %s on %s. Tap one to get it:", cam.Name, when)
+	if len(files) > recordingsPage {
+		msg = fmt.Sprintf("Recordings from %s on %s, the newest %d of %d. Pick a shorter time for older ones:",
+			cam.Name, when, recordingsPage, len(files))
+		files = files[:recordingsPage]
+	}
+
+	rows := make([][]Button, 0, len(files)+len(back))
+	for _, file := range files {
+		rows = append(rows, []Button{{
+			Label: recordingLabel(file),
+			Data:  fmt.Sprintf("%s%d:%s:%s:%d", cbRecPref, idx, date, from, file.Updated.Unix()),
+		}})
+	}
+
+	rows = append(rows, back...)
+
+	return &Reply{Reply: msg, Edit: true, Keyboard: rows}
+}
+
+// recordingLabel names a recording: when, how big and what kind.
+func recordingLabel(file recording) string {
+	label := file.Updated.Local().Format("15:04:05")
+	if file.Link.Length > 0 {
+		label += " · " + formatByteSize(int(file.Link.Length))
+	}
+
+	if file.Continuous {
+		return label + " · continuous"
+	}
+
+	return label + " · motion"
+}
+
+// recordingsWizardSend downloads a recording, trims it to the camera's clip
+// size when it is larger, and sends it. The list stays up for the next pick.
+func (c *Chat) recordingsWizardSend(handler *Handler, idx int, date, from string, at int64) *Reply {
+	next := c.recordingsWizardList(idx, date, from)
+	cam := c.recordingsCamera(idx)
+	start, until, ok := recordingsRange(date, from)
+
+	if cam == nil || !ok {
+		return next
+	}
+
+	files, err := c.recordings(cam, start, until)
+	if err != nil {
+		return next // the list shows the error.
+	}
+
+	idxFile := slices.IndexFunc(files, func(file recording) bool { return file.Updated.Unix() == at })
+	if idxFile < 0 {
+		next.Toast = "Missing"
+		return next
+	}
+
+	if handler.Progress != nil {
+		handler.Progress("Fetching the " + cam.Name + " recording…")
+	}
+
+	path, err := c.fetchRecording(handler, cam, files[idxFile].File)
+	if err != nil {
+		c.Error.Printf("[%v] Recording %s %s: %v", handler.ID, cam.Name, files[idxFile].Title, err)
+		next.Reply, next.Toast = "Error getting the recording: "+err.Error(), "Error"
+
+		return next
+	}
+
+	caption := cam.Name + " · recorded " + files[idxFile].Updated.Local().Format("Mon Jan 2 15:04:05")
+	next.Toast = "Sending…"
+
+	if handler.SendFile == nil {
+		next.Reply, next.Files = caption, []string{path}
+		return next
+	}
+
+	if err := handler.SendFile(path, caption); err != nil {
+		c.Error.Printf("[%v] SendFile recording %s: %v", handler.ID, cam.Name, err)
+		_ = os.Remove(path)
+		next.Reply, next.Toast = "Error sending the recording: "+err.Error(), "Error"
+	}
+
+	return next
+}
+
+// fetchRecording saves a recording into TempDir and returns its path. A file
+// bigger than the camera's clip size is cut down to it with ffmpeg (scaled to
+// the camera's clip scale, when that is not full size).
+func (c *Chat) fetchRecording(handler *Handler, cam *securityspy.Camera, file *securityspy.File) (string, error) {
+	ext := strings.ToLower(filepath.Ext(file.Title))
+	if ext != ".mov" && ext != ".m4v" && ext != ".mp4" {
+		ext = ".m4v"
+	}
+
+	unix := file.Updated.Unix()
+	path := filepath.Join(c.TempDir, fmt.Sprintf(recDownloadName, handler.ID, unix, ext))
+
+	size, err := file.Save(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("downloading: %w", err)
+	}
+
+	settings := c.CameraClipSettings(cam.Name)
+	if size <= int64(settings.Size) {
+		return path, nil
+	}
+
+	defer os.Remove(path)
+
+	trimmed := filepath.Join(c.TempDir, fmt.Sprintf(recDownloadName, handler.ID, unix, "_trim.mp4"))
+	c.Info.Printf("[%v] Trimming %s recording (%s) to %s", handler.ID, cam.Name,
+		formatByteSize(int(size)), formatByteSize(settings.Size))
+
+	err = c.trimRecording(path, trimmed, int64(settings.Size), heightForScale(cam.Height, settings.Scale))
+	if err != nil {
+		_ = os.Remove(trimmed)
+		return "", err
+	}
+
+	return trimmed, nil
+}
+
+// trimRecording writes the start of src to dst, at most maxSize bytes. Height
+// 0 copies the streams as they are; otherwise the video is scaled to it and
+// encoded as H.264.
+func (c *Chat) trimRecording(src, dst string, maxSize int64, height int) error {
+	ffmpeg, err := LookFFmpeg(c.FFmpeg)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", src}
+	if height > 0 {
+		args = append(args, "-vf", "scale=-2:"+strconv.Itoa(height),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-c:a", "aac")
+	} else {
+		args = append(args, "-c", "copy")
+	}
+
+	args = append(args, "-fs", strconv.FormatInt(maxSize, 10), "-movflags", "+faststart", dst)
+
+	ctx, cancel := context.WithTimeout(context.Background(), recTrimTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("trimming with ffmpeg: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// LookFFmpeg returns the full path of the configured ffmpeg, or finds ffmpeg
+// in the PATH when none is configured.
+func LookFFmpeg(configured string) (string, error) {
+	if configured == "" {
+		configured = "ffmpeg"
+	}
+
+	path, err := exec.LookPath(configured)
+	if err != nil {
+		return "", ErrNoFFmpeg
+	}
+
+	return path, nil
+}
+
+// startOfDay is midnight, local time, on t's day.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Local().Date()
+
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golift.io/securityspy/v2"
+)
+
+func TestRecordingsRange(t *testing.T) {
+	t.Parallel()
+
+	start, until, ok := recordingsRange("20261017", "8")
+	if !ok || start.Hour() != 8 || until.Sub(start) != recBlockHours*time.Hour {
+		t.Fatalf("8am block: %v %v %v", start, until, ok)
+	}
+
+	start, until, ok = recordingsRange("20261017", recWholeDay)
+	if !ok || start.Hour() != 0 || until.Day() != 18 {
+		t.Fatalf("whole day: %v %v %v", start, until, ok)
+	}
+
+	for _, bad := range [][2]string{{"20261017", "5"}, {"20261017", "24"}, {"2026-10-17", "8"}} {
+		if _, _, ok := recordingsRange(bad[0], bad[1]); ok {
+			t.Errorf("%v should not parse", bad)
+		}
+	}
+}
+
+// Motion and continuous recordings come back as one list, newest first, and
+// each keeps its kind.
+func TestSortRecordings(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	motion := []*securityspy.File{{Updated: now.Add(-time.Hour)}, nil}
+	continuous := []*securityspy.File{{Updated: now, Link: securityspy.FileLink{Length: 3 << 20}}}
+
+	files := sortRecordings(motion, continuous)
+	if len(files) != 2 || !files[0].Continuous || files[1].Continuous {
+		t.Fatalf("sorted: %+v", files)
+	}
+
+	if got, want := recordingLabel(files[0]), now.Format("15:04:05")+" · 3MB · continuous"; got != want {
+		t.Errorf("label: %q, want %q", got, want)
+	}
+}
+
+func TestTrimRecordingNoFFmpeg(t *testing.T) {
+	t.Parallel()
+
+	c := New(&Chat{FFmpeg: filepath.Join(t.TempDir(), "ffmpeg")})
+	if err := c.trimRecording("in.m4v", "out.mp4", 1<<20, 0); !errors.Is(err, ErrNoFFmpeg) {
+		t.Fatalf("got %v, want ErrNoFFmpeg", err)
+	}
+
+	if _, err := LookFFmpeg(c.FFmpeg); !errors.Is(err, ErrNoFFmpeg) {
+		t.Fatalf("LookFFmpeg: got %v, want ErrNoFFmpeg", err)
+	}
+}
+
+// Without SecuritySpy cameras the wizard says so instead of an empty menu.
+func TestRecordingsWizardOffline(t *testing.T) {
+	t.Parallel()
+
+	c := New(&Chat{Subs: testEventCatalog(t), TempDir: t.TempDir()})
+
+	reply := c.HandleCommand(&Handler{Sub: testGroupSub(), ID: "req1", Text: []string{"recordings"}})
+	if reply.Toast != "Offline" {
+		t.Fatalf("no cameras: %+v", reply)
+	}
+
+	if !readOnlyCallback(cbRecPref + "0:20261017:8:1760690000") {
+		t.Error("sending a recording should be allowed for read-only group members")
+	}
+}
@@ -0,0 +1,331 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+// Weekly schedules. A schedule is a text rule like
+//
+//	on daily 22:00-07:00                      (alerts only at night)
+//	off weekdays 09:00-17:00 America/Chicago  (quiet during work hours)
+//	on sat,sun 08:00-20:00; mon-fri 18:00-22:00
+//
+// "on" lets alerts through only inside the ranges; "off" silences them there.
+// Ranges that end before they start run past midnight and belong to the day
+// they start on. An optional time zone ends the rule; the default is the
+// server's. "always" (or nothing) means no schedule.
+//
+// A subscription's schedule is an S rule on the subscriber's Events. The
+// subscriber's default lives in Meta: a reserved key on Events would show up
+// as a subscription everywhere they are listed.
+const (
+	ruleSchedule        = "schedule"
+	scheduleAlways      = "always"
+	minutesPerDay       = 24 * 60
+	daysPerWeek         = 7
+	scheduleRangeFields = 2
+	scheduleCacheMax    = 512 // distinct rules kept parsed; far more than are in use.
+)
+
+// ErrBadSchedule is returned for a schedule that does not parse.
+var ErrBadSchedule = errors.New("invalid schedule")
+
+// schedules caches parsed rules by their text. Every alert checks the schedule
+// of each subscriber and key, and a time zone is loaded from disk.
+var schedules = struct {
+	sync.Mutex
+	parsed map[string]parsedSchedule
+}{parsed: make(map[string]parsedSchedule)}
+
+type parsedSchedule struct {
+	sched *Schedule
+	err   error
+}
+
+// Schedule is a parsed weekly schedule. A nil Schedule is always active.
+type Schedule struct {
+	// Only is true for "on" schedules: alerts only inside the ranges.
+	Only   bool
+	Ranges []ScheduleRange
+	Loc    *time.Location
+}
+
+// ScheduleRange is one time range on a set of weekdays, in minutes since midnight.
+// End is before Start for a range that runs past midnight.
+type ScheduleRange struct {
+	Days  [daysPerWeek]bool // by time.Weekday
+	Start int
+	End   int
+}
+
+// ParseSchedule parses a schedule rule. Empty and "always" return nil.
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(strings.ReplaceAll(spec, ";", " ; "))
+	if len(fields) == 0 || (len(fields) == 1 && strings.EqualFold(fields[0], scheduleAlways)) {
+		return nil, nil //nolint:nilnil // no schedule is a valid answer.
+	}
+
+	sched := &Schedule{Loc: time.Local}
+
+	switch strings.ToLower(fields[0]) {
+	case "on", "only":
+		sched.Only = true
+	case "off", "quiet":
+	default:
+		return nil, fmt.Errorf("%w: start with on or off, not %q", ErrBadSchedule, fields[0])
+	}
+
+	fields = fields[1:]
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no time ranges", ErrBadSchedule)
+	}
+
+	// A trailing word that is not a time range is the time zone. Zone names
+	// may hold a dash too: Etc/GMT-5, America/Port-au-Prince.
+	if last := fields[len(fields)-1]; !isClockRange(last) && last != ";" {
+		loc, err := time.LoadLocation(last)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", ErrBadSchedule, last)
+		}
+
+		sched.Loc = loc
+		fields = fields[:len(fields)-1]
+	}
+
+	for part := range strings.SplitSeq(strings.Join(fields, " "), ";") {
+		rng, err := parseScheduleRange(strings.Fields(part))
+		if err != nil {
+			return nil, err
+		}
+
+		sched.Ranges = append(sched.Ranges, rng)
+	}
+
+	return sched, nil
+}
+
+// parseScheduleRange parses "[days] HH:MM-HH:MM".
+func parseScheduleRange(fields []string) (ScheduleRange, error) {
+	var rng ScheduleRange
+
+	switch len(fields) {
+	case 1:
+		fields = append([]string{"daily"}, fields...)
+	case scheduleRangeFields:
+	default:
+		return rng, fmt.Errorf("%w: want [days] HH:MM-HH:MM, got %q", ErrBadSchedule, strings.Join(fields, " "))
+	}
+
+	days, err := parseScheduleDays(fields[0])
+	if err != nil {
+		return rng, err
+	}
+
+	from, to, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return rng, fmt.Errorf("%w: want HH:MM-HH:MM, got %q", ErrBadSchedule, fields[1])
+	}
+
+	rng.Days = days
+
+	if rng.Start, err = parseClock(from); err != nil {
+		return rng, err
+	}
+
+	if rng.End, err = parseClock(to); err != nil {
+		return rng, err
+	}
+
+	if rng.Start == minutesPerDay || rng.Start == rng.End {
+		return rng, fmt.Errorf("%w: empty time range %q", ErrBadSchedule, fields[1])
+	}
+
+	return rng, nil
+}
+
+// isClockRange reports whether word is shaped like HH:MM-HH:MM (or HH-HH),
+// whether or not the times are valid.
+func isClockRange(word string) bool {
+	from, to, ok := strings.Cut(word, "-")
+
+	return ok && isClock(from) && isClock(to)
+}
+
+// isClock reports whether word is shaped like HH:MM or HH.
+func isClock(word string) bool {
+	hours, mins, hasMins := strings.Cut(word, ":")
+	digits := func(s string, most int) bool {
+		return s != "" && len(s) <= most && strings.Trim(s, "0123456789") == ""
+	}
+
+	return digits(hours, 2) && (!hasMins || digits(mins, 2)) //nolint:mnd // two-digit fields.
+}
+
+// parseScheduleDays parses daily, weekdays, weekends, or a comma list of
+// days and day ranges like mon-fri,sun.
+func parseScheduleDays(word string) ([daysPerWeek]bool, error) {
+	var days [daysPerWeek]bool
+
+	switch strings.ToLower(word) {
+	case "daily", "everyday", "all":
+		return [daysPerWeek]bool{true, true, true, true, true, true, true}, nil
+	case "weekdays":
+		return [daysPerWeek]bool{false, true, true, true, true, true, false}, nil
+	case "weekends":
+		return [daysPerWeek]bool{true, false, false, false, false, false, true}, nil
+	}
+
+	for item := range strings.SplitSeq(strings.ToLower(word), ",") {
+		from, to, isRange := strings.Cut(item, "-")
+
+		first, ok := parseWeekday(from)
+		last := first
+
+		if isRange {
+			var lastOK bool
+			last, lastOK = parseWeekday(to)
+			ok = ok && lastOK
+		}
+
+		if !ok {
+			return days, fmt.Errorf("%w: unknown day %q", ErrBadSchedule, item)
+		}
+
+		for day := first; ; day = (day + 1) % daysPerWeek {
+			days[day] = true
+
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+func parseWeekday(word string) (time.Weekday, bool) {
+	if len(word) < 3 { //nolint:mnd // the shortest day abbreviation.
+		return 0, false
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), word) {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseClock parses HH:MM or HH into minutes since midnight. 24:00 is allowed.
+func parseClock(clock string) (int, error) {
+	hours, mins, _ := strings.Cut(clock, ":")
+	if mins == "" {
+		mins = "0"
+	}
+
+	hour, err := strconv.Atoi(hours)
+	minute, err2 := strconv.Atoi(mins)
+
+	if err != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > minutesPerDay {
+		return 0, fmt.Errorf("%w: bad time %q", ErrBadSchedule, clock)
+	}
+
+	return hour*60 + minute, nil
+}
+
+// Active reports whether the schedule lets an alert through at now.
+func (s *Schedule) Active(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	now = now.In(s.Loc)
+	day, minute := now.Weekday(), now.Hour()*60+now.Minute()
+	yesterday := (day + daysPerWeek - 1) % daysPerWeek
+	inside := false
+
+	for _, rng := range s.Ranges {
+		if rng.Start < rng.End {
+			inside = inside || (rng.Days[day] && minute >= rng.Start && minute < rng.End)
+		} else {
+			inside = inside || (rng.Days[day] && minute >= rng.Start) || (rng.Days[yesterday] && minute < rng.End)
+		}
+	}
+
+	return inside == s.Only
+}
+
+// SubSchedule returns the schedule rule that applies to a subscriber's
+// subscription: its own, else the subscriber's default. "" means always.
+func SubSchedule(sub *subscribe.Subscriber, key string) string {
+	if sub == nil {
+		return ""
+	}
+
+	if sub.Events != nil {
+		if spec, _ := sub.Events.RuleGetS(key, ruleSchedule); spec != "" {
+			return spec
+		}
+	}
+
+	return SubDefaultSchedule(sub)
+}
+
+// SetSubSchedule sets a subscription's schedule; "" falls back to the default.
+func SetSubSchedule(sub *subscribe.Subscriber, key, spec string) {
+	sub.Events.RuleSetS(key, ruleSchedule, spec)
+}
+
+// SubDefaultSchedule returns the schedule for subscriptions without their own.
+func SubDefaultSchedule(sub *subscribe.Subscriber) string {
+	value, _ := sub.GetMeta(metaKeySchedule)
+	spec, _ := value.(string)
+
+	return spec
+}
+
+// SetSubDefaultSchedule sets the schedule for subscriptions without their own.
+func SetSubDefaultSchedule(sub *subscribe.Subscriber, spec string) {
+	if spec == "" {
+		DeleteSubMeta(sub, metaKeySchedule)
+		return
+	}
+
+	SetSubMeta(sub, metaKeySchedule, spec)
+}
+
+// SubScheduled reports whether a subscription's schedule lets an alert through
+// at now. A rule that no longer parses never silences alerts.
+func SubScheduled(sub *subscribe.Subscriber, key string, now time.Time) bool {
+	sched, err := cachedSchedule(SubSchedule(sub, key))
+
+	return err != nil || sched.Active(now)
+}
+
+// cachedSchedule is ParseSchedule for rules seen before. The result is shared,
+// so it must not be changed.
+func cachedSchedule(spec string) (*Schedule, error) {
+	schedules.Lock()
+	defer schedules.Unlock()
+
+	if parsed, ok := schedules.parsed[spec]; ok {
+		return parsed.sched, parsed.err
+	}
+
+	if len(schedules.parsed) >= scheduleCacheMax {
+		clear(schedules.parsed)
+	}
+
+	sched, err := ParseSchedule(spec)
+	schedules.parsed[spec] = parsedSchedule{sched: sched, err: err}
+
+	return sched, err
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+func TestScheduleActive(t *testing.T) {
+	t.Parallel()
+
+	utc := time.UTC
+	friday := time.Date(2026, time.October, 16, 0, 0, 0, 0, utc) // a Friday
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"", friday, true},
+		{"always", friday, true},
+		{"on daily 22:00-07:00 UTC", friday.Add(23 * time.Hour), true},
+		{"on daily 22:00-07:00 UTC", friday.Add(6 * time.Hour), true},
+		{"on daily 22:00-07:00 UTC", friday.Add(12 * time.Hour), false},
+		{"off weekdays 09:00-17:00 UTC", friday.Add(10 * time.Hour), false},
+		{"off weekdays 09:00-17:00 UTC", friday.Add(34 * time.Hour), true}, // Saturday 10:00
+		// Friday night's range runs into Saturday morning; Saturday's does not start until night.
+		{"on fri 22:00-02:00 UTC", friday.Add(25 * time.Hour), true},
+		{"on sat 22:00-02:00 UTC", friday.Add(25 * time.Hour), false},
+		{"on sat,sun 08:00-20:00; mon-thu 18:00-24:00 UTC", friday.Add(19 * time.Hour), false},
+		{"on sat,sun 08:00-20:00; mon-thu 18:00-24:00 UTC", friday.Add(33 * time.Hour), true},
+		// 15:00 UTC is 10:00 in Chicago (CDT).
+		{"off weekdays 09:00-17:00 America/Chicago", friday.Add(15 * time.Hour), false},
+		{"off weekdays 09:00-17:00 America/Chicago", friday.Add(13 * time.Hour), true},
+		// Zone names with a dash. Etc/GMT-5 is UTC+5: 15:00 UTC is 20:00 there.
+		{"on daily 19:00-21:00 Etc/GMT-5", friday.Add(15 * time.Hour), true},
+		{"on daily 19:00-21:00 Etc/GMT-5", friday.Add(19 * time.Hour), false},
+		{"on daily 08:00-12:00 America/Port-au-Prince", friday.Add(14 * time.Hour), true},
+		{"on 9-17 UTC", friday.Add(10 * time.Hour), true},
+	}
+
+	for _, test := range tests {
+		sched, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", test.spec, err)
+		}
+
+		if got := sched.Active(test.at); got != test.want {
+			t.Errorf("%q at %v: got %v want %v", test.spec, test.at, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"daily 22:00-07:00", "on", "on daily 25:00-26:00", "on funday 1-2",
+		"on daily 09:00-09:00", "on daily 09:00-17:00 Mars/Olympus"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted a bad schedule", bad)
+		}
+	}
+}
+
+// A subscription's own schedule wins over the subscriber's default, and
+// CollectSubscribers leaves out subscriptions outside their schedule.
+func TestSubScheduled(t *testing.T) {
+	t.Parallel()
+
+	data, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := data.CreateSubWithID(1, "ann", "telegram", false, false)
+	_ = sub.Subscribe("Porch")
+	_ = sub.Subscribe("Garage")
+
+	now := time.Now()
+	never := "on " + now.Add(time.Hour).Format("Mon") + " " + now.Add(time.Hour).Format("15:04") +
+		"-" + now.Add(2*time.Hour).Format("15:04") + " Local"
+
+	SetSubDefaultSchedule(sub, never)
+
+	if SubScheduled(sub, "Porch", now) {
+		t.Fatalf("default %q should hold alerts back now", never)
+	}
+
+	SetSubSchedule(sub, "Garage", scheduleAlways)
+
+	if got := CollectSubscribers(data, []string{"Porch"}); len(got) != 0 {
+		t.Fatalf("Porch: got %d subscribers outside the schedule", len(got))
+	}
+
+	if got := CollectSubscribers(data, []string{"Porch", "Garage"}); len(got) != 1 {
+		t.Fatalf("Garage: got %d subscribers want 1", len(got))
+	}
+
+	SetSubSchedule(sub, "Garage", "")
+
+	if SubScheduled(sub, "Garage", now) {
+		t.Fatal("Garage should follow the default again")
+	}
+}
+
+// A preset button sets the rule; Custom takes the next message as the rule.
+func TestScheduleWizard(t *testing.T) {
+	t.Parallel()
+
+	data := testEventCatalog(t)
+	sub := testGroupSub()
+	data.Subscribers = []*subscribe.Subscriber{sub}
+	c := New(&Chat{Subs: data, TempDir: t.TempDir()})
+	_ = sub.Subscribe("garage_opened")
+
+	c.HandleCallback(&Handler{Sub: sub, Callback: "w:0:n"})
+
+	if got := SubSchedule(sub, "garage_opened"); got != "on daily 22:00-07:00" {
+		t.Fatalf("nights preset: got %q", got)
+	}
+
+	c.HandleCallback(&Handler{Sub: sub, Callback: "w:d:c"})
+
+	reply := c.HandleCommand(&Handler{Sub: sub, Text: []string{"off", "mon-fri", "9-17", "UTC"}})
+	if got := SubDefaultSchedule(sub); got != "off mon-fri 9-17 UTC" {
+		t.Fatalf("custom default: got %q, reply %q", got, reply.Reply)
+	}
+
+	c.HandleCallback(&Handler{Sub: sub, Callback: "w:0:i"})
+
+	if got := SubSchedule(sub, "garage_opened"); got != "off mon-fri 9-17 UTC" {
+		t.Fatalf("use default: got %q", got)
+	}
+
+	reply = c.HandleCallback(&Handler{Sub: sub, Callback: "w:0:n", ReadOnly: true})
+	if reply.Toast == "" || SubSchedule(sub, "garage_opened") != "off mon-fri 9-17 UTC" {
+		t.Fatalf("schedule button from a group member: %+v", reply)
+	}
+}
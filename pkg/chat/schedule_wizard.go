@@ -0,0 +1,301 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golift.io/subscribe"
+)
+
+// Schedule wizard (from /subs).
+//
+// w               → default schedule and each subscription's
+// w:{d|idx}       → presets for the default (d) or one subscription
+// w:{d|idx}:{p}   → apply preset p; c asks for a custom rule as the next message
+const (
+	cbSchedRoot            = "w"
+	schedTargetDefault     = "d"
+	schedPresetDefault     = "i" // subscription follows the default
+	schedPresetCustom      = "c"
+	pendingScheduleMetaKey = "pendingSchedule"
+)
+
+// schedulePresets are the one-tap schedules. "a" means no schedule.
+var schedulePresets = []struct{ code, label, spec string }{
+	{"a", "Always", scheduleAlways},
+	{"n", "Nights only", "on daily 22:00-07:00"},
+	{"y", "Daytime only", "on daily 07:00-22:00"},
+	{"o", "Quiet weekdays 9-5", "off weekdays 09:00-17:00"},
+	{"e", "Weekends only", "on weekends 00:00-24:00"},
+}
+
+func (c *Chat) handleScheduleWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	if data == cbSchedRoot {
+		clearPendingInput(handler.Sub)
+
+		return c.scheduleWizardRoot(handler), false, true
+	}
+
+	payload, ok := strings.CutPrefix(data, cbSchedRoot+":")
+	if !ok {
+		return nil, false, false
+	}
+
+	target, preset, hasPreset := strings.Cut(payload, ":")
+
+	switch {
+	case !hasPreset:
+		clearPendingInput(handler.Sub)
+
+		return c.scheduleWizardTarget(handler, target), false, true
+	case preset == schedPresetCustom:
+		return c.scheduleWizardPrompt(handler, target), true, true
+	default:
+		reply, save := c.scheduleWizardApply(handler, target, preset)
+
+		return reply, save, true
+	}
+}
+
+// scheduleTargetKey resolves a callback target: the default, or a subscription index.
+func scheduleTargetKey(sub *subscribe.Subscriber, target string) (string, bool, bool) {
+	if target == schedTargetDefault {
+		return "", true, true
+	}
+
+	idx := atoiDefault(target, -1)
+	names := sub.Events.Names()
+
+	if idx < 0 || idx >= len(names) {
+		return "", false, false
+	}
+
+	return names[idx], false, true
+}
+
+// scheduleTarget is the callback target for a subscription key, or the default for "".
+func scheduleTarget(sub *subscribe.Subscriber, key string) string {
+	if key == "" {
+		return schedTargetDefault
+	}
+
+	for idx, name := range sub.Events.Names() {
+		if name == key {
+			return strconv.Itoa(idx)
+		}
+	}
+
+	return schedTargetDefault
+}
+
+// scheduleLabel names a schedule rule for menus: a preset's name, or the rule.
+func scheduleLabel(spec string) string {
+	if spec == "" {
+		return strings.ToLower(schedulePresets[0].label)
+	}
+
+	for _, preset := range schedulePresets {
+		if strings.EqualFold(spec, preset.spec) {
+			return strings.ToLower(preset.label)
+		}
+	}
+
+	return spec
+}
+
+// subScheduleLabel names the schedule of one subscription, noting when it is the default.
+func subScheduleLabel(sub *subscribe.Subscriber, key string) string {
+	if own, _ := sub.Events.RuleGetS(key, ruleSchedule); own != "" {
+		return scheduleLabel(own)
+	}
+
+	return scheduleLabel(SubDefaultSchedule(sub)) + " (default)"
+}
+
+func (c *Chat) scheduleWizardRoot(handler *Handler) *Reply {
+	names := handler.Sub.Events.Names()
+
+	rows := make([][]Button, 0, len(names)+2) //nolint:mnd // default and back rows.
+	rows = append(rows, []Button{{
+		Label: "Default: " + scheduleLabel(SubDefaultSchedule(handler.Sub)),
+		Data:  cbSchedRoot + ":" + schedTargetDefault,
+	}})
+
+	for idx, name := range names {
+		rows = append(rows, []Button{{
+			Label: formatSubLabel(name) + " · " + subScheduleLabel(handler.Sub, name),
+			Data:  fmt.Sprintf("%s:%d", cbSchedRoot, idx),
+		}})
+	}
+
+	rows = append(rows, []Button{{Label: "« Back", Data: cbSubsRoot}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply: "When should alerts arrive?\n\n" +
+			"A schedule lets alerts through only at certain times (nights only), or keeps " +
+			"them quiet at certain times (weekdays 9-5), every week, so you don't have to " +
+			"pause them by hand.\n\n" +
+			"The default applies to every subscription without its own schedule. Pick one to change:",
+		Edit:     true,
+		Keyboard: rows,
+	}
+}
+
+func (c *Chat) scheduleWizardTarget(handler *Handler, target string) *Reply {
+	key, isDefault, ok := scheduleTargetKey(handler.Sub, target)
+	if !ok {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}
+	}
+
+	title, current := "Default schedule", scheduleLabel(SubDefaultSchedule(handler.Sub))
+	if !isDefault {
+		title, current = "Schedule for "+formatSubLabel(key), subScheduleLabel(handler.Sub, key)
+	}
+
+	state := "get through"
+	if !SubScheduled(handler.Sub, key, time.Now()) {
+		state = "are held back"
+	}
+
+	rows := make([][]Button, 0, len(schedulePresets)+2) //nolint:mnd // custom and back rows.
+	for i := 0; i < len(schedulePresets); i += 2 {
+		row := []Button{}
+		for _, preset := range schedulePresets[i:min(i+2, len(schedulePresets))] {
+			row = append(row, Button{Label: preset.label, Data: cbSchedRoot + ":" + target + ":" + preset.code})
+		}
+
+		rows = append(rows, row)
+	}
+
+	custom := []Button{{Label: "Custom…", Data: cbSchedRoot + ":" + target + ":" + schedPresetCustom}}
+	if !isDefault {
+		custom = append(custom, Button{Label: "Use default", Data: cbSchedRoot + ":" + target + ":" + schedPresetDefault})
+	}
+
+	rows = append(rows, custom, []Button{{Label: "« Back", Data: cbSchedRoot}, {Label: "Done", Data: cbCancel}})
+
+	return &Reply{
+		Reply: fmt.Sprintf("%s: %s\nRight now its alerts %s.\n\nPick a schedule:", title, current, state),
+		Edit:  true, Keyboard: rows,
+	}
+}
+
+func (c *Chat) scheduleWizardApply(handler *Handler, target, code string) (*Reply, bool) {
+	key, isDefault, ok := scheduleTargetKey(handler.Sub, target)
+	if !ok {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}, false
+	}
+
+	spec, found := "", code == schedPresetDefault && !isDefault
+	for _, preset := range schedulePresets {
+		if preset.code == code {
+			spec, found = preset.spec, true
+		}
+	}
+
+	if !found {
+		return &Reply{Reply: "Bad schedule pick.", Edit: true, Toast: "Error"}, false
+	}
+
+	return c.scheduleWizardSet(handler, key, isDefault, spec), true
+}
+
+// scheduleWizardSet saves a schedule and shows the target's page again.
+func (c *Chat) scheduleWizardSet(handler *Handler, key string, isDefault bool, spec string) *Reply {
+	if isDefault {
+		if spec == scheduleAlways {
+			spec = ""
+		}
+
+		SetSubDefaultSchedule(handler.Sub, spec)
+	} else {
+		SetSubSchedule(handler.Sub, key, spec)
+	}
+
+	next := c.scheduleWizardTarget(handler, scheduleTarget(handler.Sub, key))
+	next.Reply = "Saved.\n\n" + next.Reply
+	next.Toast = "Saved"
+
+	return next
+}
+
+func (c *Chat) scheduleWizardPrompt(handler *Handler, target string) *Reply {
+	key, _, ok := scheduleTargetKey(handler.Sub, target)
+	if !ok {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}
+	}
+
+	clearPendingInput(handler.Sub)
+	SetSubMeta(handler.Sub, pendingScheduleMetaKey, key)
+
+	return &Reply{
+		Reply: "Send the schedule as your next message.\n\n" +
+			"Start with on (alerts only then) or off (quiet then), then days and times, " +
+			"and optionally a time zone:\n" +
+			"on daily 22:00-07:00\n" +
+			"off mon-fri 09:00-17:00 America/New_York\n" +
+			"on sat,sun 08:00-20:00; weekdays 18:00-23:00\n\n" +
+			"Or tap Cancel.",
+		Edit:     true,
+		Toast:    "Type a schedule",
+		Keyboard: [][]Button{{{Label: "Cancel", Data: cbSchedRoot + ":" + target}}},
+	}
+}
+
+func pendingScheduleKey(sub *subscribe.Subscriber) (string, bool) {
+	val, exists := sub.GetMeta(pendingScheduleMetaKey)
+	key, _ := val.(string)
+
+	return key, exists
+}
+
+// consumePendingSchedule applies the next free-text message as a custom
+// schedule. handled is false when no prompt is active.
+func (c *Chat) consumePendingSchedule(handler *Handler) (*Reply, bool, bool) {
+	if handler == nil || handler.Sub == nil || handler.ReadOnly || len(handler.Text) == 0 {
+		return nil, false, false
+	}
+
+	key, ok := pendingScheduleKey(handler.Sub)
+	if !ok {
+		return nil, false, false
+	}
+
+	clearPendingInput(handler.Sub)
+
+	// Slash commands cancel the prompt and fall through.
+	if strings.HasPrefix(handler.Text[0], "/") {
+		return nil, true, true
+	}
+
+	target := scheduleTarget(handler.Sub, key)
+	if key != "" && target == schedTargetDefault {
+		return &Reply{
+			Reply:    "That subscription is gone — nothing changed.",
+			Keyboard: [][]Button{{{Label: "Schedules", Data: cbSchedRoot}}},
+		}, true, true
+	}
+
+	spec := strings.Join(strings.Fields(strings.Join(handler.Text, " ")), " ")
+
+	if _, err := ParseSchedule(spec); err != nil {
+		return &Reply{
+			Reply: fmt.Sprintf("%v — nothing changed.", err),
+			Keyboard: [][]Button{{
+				{Label: "Try again", Data: cbSchedRoot + ":" + target + ":" + schedPresetCustom},
+				{Label: "Schedules", Data: cbSchedRoot},
+			}},
+		}, true, true
+	}
+
+	if spec == "" {
+		spec = scheduleAlways
+	}
+
+	next := c.scheduleWizardSet(handler, key, key == "", spec)
+	next.Edit = false // new message after free-text
+
+	return next, true, true
+}
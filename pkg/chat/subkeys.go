@@ -1,7 +1,9 @@
 package chat
 
 import (
+	"slices"
 	"strings"
+	"time"
 
 	"golift.io/securityspy/v2"
 	"golift.io/subscribe"
@@ -201,6 +203,20 @@ func NotifyKeys(cameraName string, reasons []securityspy.TriggerEvent) []string
 	return keys
 }
 
+// MergeReasons appends trigger reasons from more onto base, skipping duplicates.
+// Used when several motion events are folded into one clip.
+func MergeReasons(base, more []securityspy.TriggerEvent) []securityspy.TriggerEvent {
+	out := append([]securityspy.TriggerEvent(nil), base...)
+
+	for _, reason := range more {
+		if !slices.Contains(out, reason) {
+			out = append(out, reason)
+		}
+	}
+
+	return out
+}
+
 // Media caption kinds for on-demand grabs (not SecuritySpy classifications).
 const (
 	CaptionPhoto = "photo"
@@ -223,6 +239,13 @@ func EventCaption(name string, reasons []securityspy.TriggerEvent) string {
 	return CameraCaption(name, eventClassKind(reasons))
 }
 
+// ExtendedCaption is EventCaption for a clip longer than its camera's clip
+// length (it kept recording while motion went on, or has pre-roll); it adds
+// the clip's total length.
+func ExtendedCaption(name string, reasons []securityspy.TriggerEvent, length time.Duration) string {
+	return EventCaption(name, reasons) + " · " + formatClipSecs(length)
+}
+
 func eventClassKind(reasons []securityspy.TriggerEvent) string {
 	classes := ClassesFromReasons(reasons)
 
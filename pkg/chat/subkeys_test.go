@@ -80,6 +80,29 @@ func TestNotifyKeys(t *testing.T) {
 	}
 }
 
+func TestMergeReasons(t *testing.T) {
+	t.Parallel()
+
+	base := []securityspy.TriggerEvent{securityspy.TriggerByMotion}
+	merged := MergeReasons(base, []securityspy.TriggerEvent{
+		securityspy.TriggerByMotion,
+		securityspy.TriggerByHumanDetection,
+	})
+
+	if len(merged) != 2 || merged[0] != securityspy.TriggerByMotion ||
+		merged[1] != securityspy.TriggerByHumanDetection {
+		t.Fatalf("merged=%v", merged)
+	}
+
+	if len(base) != 1 {
+		t.Fatalf("MergeReasons modified base: %v", base)
+	}
+
+	if got := EventCaption("Office", merged); got != "Office (human)" {
+		t.Fatalf("caption=%q", got)
+	}
+}
+
 func TestCommandName(t *testing.T) {
 	t.Parallel()
 
@@ -111,20 +134,41 @@ func TestCameraSubBadges(t *testing.T) {
 func TestActiveKeysAmong(t *testing.T) {
 	t.Parallel()
 
-	if ActiveKeysAmong(nil, []string{"Office:human"}) != nil {
+	if ActiveKeysAmong(nil, []string{"Office:human"}, ModeArmed) != nil {
 		t.Fatal("nil sub")
 	}
 
 	sub := &subscribe.Subscriber{Events: &subscribe.Events{Map: make(map[string]*subscribe.Rules)}}
 	_ = sub.Subscribe("Office:human")
 
-	got := ActiveKeysAmong(sub, []string{"Office", "Office:human", "Office:motion"})
+	got := ActiveKeysAmong(sub, []string{"Office", "Office:human", "Office:motion"}, ModeArmed)
 	if len(got) != 1 || got[0] != "Office:human" {
 		t.Fatalf("got %v", got)
 	}
 
 	_ = sub.Events.Pause("Office:human", time.Hour)
-	if got = ActiveKeysAmong(sub, []string{"Office:human"}); len(got) != 0 {
+	if got = ActiveKeysAmong(sub, []string{"Office:human"}, ModeArmed); len(got) != 0 {
 		t.Fatalf("paused should be excluded: %v", got)
 	}
 }
+
+// A subscription muted in the current mode did not fire, so it is not active
+// (and is not paused along with the one that did).
+func TestActiveKeysAmongMode(t *testing.T) {
+	t.Parallel()
+
+	sub := &subscribe.Subscriber{Events: &subscribe.Events{Map: make(map[string]*subscribe.Rules)}}
+	_ = sub.Subscribe("Office:human")
+	_ = sub.Subscribe("Office:motion")
+	SetSubModes(sub, "Office:motion", []string{ModeArmed})
+
+	keys := []string{"Office:human", "Office:motion"}
+
+	if got := ActiveKeysAmong(sub, keys, ModeHome); len(got) != 1 || got[0] != "Office:human" {
+		t.Fatalf("home: got %v", got)
+	}
+
+	if got := ActiveKeysAmong(sub, keys, ModeArmed); len(got) != 2 {
+		t.Fatalf("armed: got %v", got)
+	}
+}
@@ -11,6 +11,10 @@ const (
 	metaKeyAuth        = "hasAuth"
 	metaKeyDisplayName = "displayName"
 	metaKeyUser        = "user"
+	metaKeyRoute       = "route"
+	metaKeyGroup       = "group"
+	metaKeySchedule    = "schedule"      // default for subscriptions without their own
+	metaKeyHistory     = "historyFilter" // the /history filter, so paging buttons stay short
 )
 
 // The helpers here read and write the subscribe.Subscriber fields that belong
@@ -58,6 +62,33 @@ func SetSubUser(sub *subscribe.Subscriber, user any) {
 	sub.SetMeta(metaKeyUser, user)
 }
 
+// SubRoute returns the network address that reaches a subscriber when its
+// numeric ID is not enough on its own, such as a Matrix room ID.
+func SubRoute(sub *subscribe.Subscriber) string {
+	value, _ := sub.GetMeta(metaKeyRoute)
+	route, _ := value.(string)
+
+	return route
+}
+
+// SetSubRoute records the network address for a subscriber.
+func SetSubRoute(sub *subscribe.Subscriber, route string) {
+	sub.SetMeta(metaKeyRoute, route)
+}
+
+// SubGroup reports whether a subscriber is a group chat rather than a person.
+func SubGroup(sub *subscribe.Subscriber) bool {
+	value, _ := sub.GetMeta(metaKeyGroup)
+	group, _ := value.(bool)
+
+	return group
+}
+
+// SetSubGroup marks a subscriber as a group chat.
+func SetSubGroup(sub *subscribe.Subscriber, group bool) {
+	sub.SetMeta(metaKeyGroup, group)
+}
+
 // SubAdmin reports whether a subscriber may run admin commands.
 func SubAdmin(sub *subscribe.Subscriber) bool {
 	return sub.IsAdmin()
@@ -51,6 +51,12 @@ func TestSubStateAccessors(t *testing.T) {
 	if _, ok := pendingRenameID(sub); ok {
 		t.Fatal("pending rename should be gone after DeleteSubMeta")
 	}
+
+	SetSubRoute(sub, "!room:example.org")
+
+	if got := SubRoute(sub); got != "!room:example.org" {
+		t.Fatalf("SetSubRoute: got %q want !room:example.org", got)
+	}
 }
 
 // Nil subscribers reach these helpers from callback paths where the record was
@@ -58,7 +64,7 @@ func TestSubStateAccessors(t *testing.T) {
 func TestSubStateNilSafe(t *testing.T) {
 	t.Parallel()
 
-	if SubAuthed(nil) || SubAdmin(nil) || SubIgnored(nil) || SubContact(nil) != "" {
+	if SubAuthed(nil) || SubAdmin(nil) || SubIgnored(nil) || SubContact(nil) != "" || SubRoute(nil) != "" {
 		t.Fatal("nil subscriber should read as empty")
 	}
 
@@ -70,6 +76,7 @@ func TestSubStateNilSafe(t *testing.T) {
 	SetSubMeta(nil, "k", "v")
 	SetSubDisplayName(nil, "x")
 	SetSubUser(nil, "x")
+	SetSubRoute(nil, "x")
 	DeleteSubMeta(nil, "k")
 
 	err := SaveState(nil)
@@ -10,6 +10,7 @@ const (
 	EventCameraOffline = "Camera Offline"
 	EventCameraOnline  = "Camera Online"
 	EventSecSpyError   = "SecuritySpy Error"
+	EventModeChanged   = "Mode Changed"
 )
 
 // BuiltInEvent is a catalog entry for the /events subscribe menu.
@@ -45,6 +46,10 @@ func BuiltInEvents() []BuiltInEvent {
 			Name: EventSecSpyError,
 			Desc: "SecuritySpy reported an ERROR on the event stream",
 		},
+		{
+			Name: EventModeChanged,
+			Desc: "Someone switched the household mode (armed, home or disarmed)",
+		},
 	}
 }
 
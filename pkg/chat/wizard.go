@@ -27,7 +27,7 @@ func (c *Chat) handleWizardCallback(handler *Handler) (*Reply, bool) {
 	}
 
 	if data == cbCancel {
-		clearPendingRename(handler.Sub)
+		clearPendingInput(handler.Sub)
 
 		return &Reply{Reply: "Done.", Edit: true, Toast: "OK"}, true
 	}
@@ -226,7 +226,7 @@ func (c *Chat) subWizardSubscribeCam(handler *Handler, payload string) (*Reply,
 	toast := "Subscribed ✓"
 	msg := fmt.Sprintf("Subscribed to %s (%s).", cam.Name, classLabel(class))
 
-	err = handler.Sub.Subscribe(key)
+	err = subscribeHere(handler, key)
 	if err != nil {
 		msg = fmt.Sprintf("Already subscribed to %s (%s).", cam.Name, classLabel(class))
 		toast = "Already on"
@@ -243,14 +243,14 @@ func (c *Chat) subWizardSubscribeEvt(handler *Handler, name string) (*Reply, boo
 	// Buttons carry the event name; resolve it (case-insensitively) against the
 	// live catalog so a renamed/removed event can never mis-subscribe.
 	event := c.Subs.Events.Name(name)
-	if event == "" || IsCamSettingsKey(event) {
+	if event == "" || IsReservedKey(event) {
 		return &Reply{Reply: "Event gone — try again.", Edit: true, Toast: "Missing"}, false
 	}
 
 	msg := "Subscribed to event: " + event
 	toast := "Subscribed ✓"
 
-	err := handler.Sub.Subscribe(event)
+	err := subscribeHere(handler, event)
 	if err != nil {
 		msg = "Already subscribed to: " + event
 		toast = "Already on"
@@ -405,7 +405,7 @@ func (c *Chat) resolveSubTarget(args []string) (string, string, error) {
 		return key, kind, err
 	}
 
-	if c.Subs.Events.Exists(joined) && !IsCamSettingsKey(joined) {
+	if c.Subs.Events.Exists(joined) && !IsReservedKey(joined) {
 		return joined, "event", nil
 	}
 
@@ -458,7 +458,8 @@ func isClassWord(word string) bool {
 	}
 }
 
-// CollectSubscribers returns unique subscribers matching any of the event keys.
+// CollectSubscribers returns unique subscribers matching any of the event keys
+// whose schedule and modes for that key let alerts through right now.
 func CollectSubscribers(data *subscribe.Subscribe, keys []string) []*subscribe.Subscriber {
 	if data == nil || len(keys) == 0 {
 		return nil
@@ -466,10 +467,12 @@ func CollectSubscribers(data *subscribe.Subscribe, keys []string) []*subscribe.S
 
 	seen := make(map[*subscribe.Subscriber]bool)
 	out := make([]*subscribe.Subscriber, 0)
+	now := time.Now()
+	mode, _ := HouseMode(data)
 
 	for _, key := range keys {
 		for _, sub := range data.GetSubscribers(key) {
-			if seen[sub] {
+			if seen[sub] || !SubScheduled(sub, key, now) || !SubModeAllowed(sub, key, mode) {
 				continue
 			}
 			seen[sub] = true
@@ -480,19 +483,22 @@ func CollectSubscribers(data *subscribe.Subscribe, keys []string) []*subscribe.S
 	return out
 }
 
-// ActiveKeysAmong returns which of keys the subscriber is subscribed to and not paused.
-func ActiveKeysAmong(sub *subscribe.Subscriber, keys []string) []string {
+// ActiveKeysAmong returns which of keys the subscriber is subscribed to, not
+// paused, scheduled for right now, and allowed in the household mode.
+func ActiveKeysAmong(sub *subscribe.Subscriber, keys []string, mode string) []string {
 	if sub == nil || sub.Events == nil {
 		return nil
 	}
 
+	now := time.Now()
+
 	out := make([]string, 0, len(keys))
 	for _, key := range keys {
 		if !sub.Events.Exists(key) {
 			continue
 		}
 
-		if sub.Events.IsPaused(key) {
+		if sub.Events.IsPaused(key) || !SubScheduled(sub, key, now) || !SubModeAllowed(sub, key, mode) {
 			continue
 		}
 
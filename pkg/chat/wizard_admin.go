@@ -13,6 +13,7 @@ import (
 // Admin subscriber-management wizard callbacks (Telegram ≤64 bytes).
 const (
 	cbUsersRoot = "m"
+	cbUsersHdr  = "m:hdr"
 )
 
 func (c *Chat) usersWizardRoot(handler *Handler) *Reply {
@@ -21,28 +22,42 @@ func (c *Chat) usersWizardRoot(handler *Handler) *Reply {
 	}
 
 	subs := c.Subs.Subscribers
-	rows := make([][]Button, 0, len(subs)+1)
+	rows := make([][]Button, 0, len(subs)+3) //nolint:mnd // header, add email, done.
 
 	var msg strings.Builder
 	fmt.Fprintf(&msg, "Subscriber management (%d).\n\n", len(subs))
-	msg.WriteString("Tap a person for details and actions.\n")
+	msg.WriteString("Tap a person or group for details and actions.\n")
 	msg.WriteString("★ admin · ⊘ ignored · ? not authenticated")
 
+	// People first, then group chats under their own header.
+	var groups [][]Button
+
 	for _, sub := range subs {
 		if sub == nil {
 			continue
 		}
 
-		rows = append(rows, []Button{{
-			Label: adminSubButtonLabel(sub),
-			Data:  fmt.Sprintf("m:i:%d", sub.ID),
-		}})
+		row := []Button{{Label: adminSubButtonLabel(sub), Data: fmt.Sprintf("m:i:%d", sub.ID)}}
+		if SubGroup(sub) {
+			groups = append(groups, row)
+		} else {
+			rows = append(rows, row)
+		}
+	}
+
+	if len(groups) > 0 {
+		rows = append(rows, []Button{{Label: fmt.Sprintf("— Groups (%d) —", len(groups)), Data: cbUsersHdr}})
+		rows = append(rows, groups...)
 	}
 
 	if len(rows) == 0 {
 		msg.WriteString("\n\n(none yet)")
 	}
 
+	if c.AddEmail != nil {
+		rows = append(rows, []Button{{Label: "Add email subscriber…", Data: cbUsersAddEmail}})
+	}
+
 	rows = append(rows, []Button{{Label: "Done", Data: cbCancel}})
 
 	return &Reply{Reply: msg.String(), Edit: true, Keyboard: rows}
@@ -81,9 +96,10 @@ func (c *Chat) usersWizardItem(handler *Handler, idStr string) *Reply {
 		rows = append(rows, []Button{{Label: "Ignore", Data: fmt.Sprintf("m:ignore:%d", target.ID)}})
 	}
 
-	if SubAdmin(target) {
+	switch {
+	case SubAdmin(target):
 		rows = append(rows, []Button{{Label: "Remove admin", Data: fmt.Sprintf("m:unadmin:%d", target.ID)}})
-	} else {
+	case !SubGroup(target): // a group's admins are its members.
 		rows = append(rows, []Button{{Label: "Make admin", Data: fmt.Sprintf("m:admin:%d", target.ID)}})
 	}
 
@@ -223,6 +239,9 @@ func (c *Chat) applyUsersAction(
 		return fmt.Sprintf("Unignored %s.", name), "Unignored", ""
 
 	case "admin":
+		if SubGroup(target) {
+			return "", "", "A group can't be an admin. Make its members admins instead."
+		}
 		SetSubAdmin(target, true)
 		SetSubIgnored(target, false)
 		SetSubAuthed(target, true)
@@ -258,6 +277,7 @@ func (c *Chat) usersWizardRenamePrompt(handler *Handler, idStr string) *Reply {
 		}
 	}
 
+	clearPendingInput(handler.Sub)
 	SetSubMeta(handler.Sub, pendingRenameMetaKey, target.ID)
 
 	return &Reply{
@@ -275,8 +295,11 @@ func (c *Chat) usersWizardRenamePrompt(handler *Handler, idStr string) *Reply {
 
 const pendingRenameMetaKey = "pendingRenameID"
 
-func clearPendingRename(sub *subscribe.Subscriber) {
+// clearPendingInput cancels any free-text prompt (rename, add email, schedule).
+func clearPendingInput(sub *subscribe.Subscriber) {
 	DeleteSubMeta(sub, pendingRenameMetaKey)
+	DeleteSubMeta(sub, pendingEmailMetaKey)
+	DeleteSubMeta(sub, pendingScheduleMetaKey)
 }
 
 func pendingRenameID(sub *subscribe.Subscriber) (int64, bool) {
@@ -326,13 +349,13 @@ func (c *Chat) consumePendingRename(handler *Handler) (*Reply, bool, bool) {
 
 	// Slash commands cancel the rename prompt and fall through.
 	if strings.HasPrefix(handler.Text[0], "/") {
-		clearPendingRename(handler.Sub)
+		clearPendingInput(handler.Sub)
 
 		return nil, true, true
 	}
 
 	name := strings.TrimSpace(strings.Join(handler.Text, " "))
-	clearPendingRename(handler.Sub)
+	clearPendingInput(handler.Sub)
 
 	if name == "" {
 		return &Reply{
@@ -341,7 +364,7 @@ func (c *Chat) consumePendingRename(handler *Handler) (*Reply, bool, bool) {
 		}, true, true
 	}
 
-	target, err := c.Subs.GetSubscriberByID(renameID, handler.API)
+	target, err := c.adminTargetByID(handler.API, strconv.FormatInt(renameID, 10))
 	if err != nil {
 		return &Reply{
 			Reply:    "That subscriber is gone — rename cancelled.",
@@ -376,11 +399,19 @@ func (c *Chat) adminTargetByID(api, idStr string) (*subscribe.Subscriber, error)
 	}
 
 	sub, err := c.Subs.GetSubscriberByID(targetID, api)
-	if err != nil {
-		return nil, fmt.Errorf("get subscriber %d: %w", targetID, err)
+	if err == nil {
+		return sub, nil
 	}
 
-	return sub, nil
+	// The list shows every API (email, webhook, other chat networks), so an
+	// admin may pick a subscriber from outside their own.
+	for _, sub := range c.Subs.Subscribers {
+		if sub != nil && sub.ID == targetID {
+			return sub, nil
+		}
+	}
+
+	return nil, fmt.Errorf("get subscriber %d: %w", targetID, err)
 }
 
 func subscriberDisplayName(sub *subscribe.Subscriber) string {
@@ -493,9 +524,14 @@ func adminSubDetail(sub *subscribe.Subscriber) string {
 		nEvents = sub.Events.Len()
 	}
 
+	kind := "person"
+	if SubGroup(sub) {
+		kind = "group chat"
+	}
+
 	return fmt.Sprintf(
-		"%s\nID: %d\nAPI: %s\nFlags: %s\nFirst seen: %s\nSubscriptions: %d",
-		subscriberDisplayName(sub), sub.ID, sub.API, adminSubFlags(sub),
+		"%s\nID: %d\nAPI: %s (%s)\nFlags: %s\nFirst seen: %s\nSubscriptions: %d",
+		subscriberDisplayName(sub), sub.ID, sub.API, kind, adminSubFlags(sub),
 		formatFirstSeen(sub.FirstSeen), nEvents)
 }
 
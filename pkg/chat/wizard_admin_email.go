@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golift.io/subscribe"
+)
+
+// Admin add-email-subscriber prompt (under /users, only when email is configured).
+//
+// m:addemail → ask for an address; the admin's next message is the address.
+
+const (
+	cbUsersAddEmail     = "m:addemail"
+	pendingEmailMetaKey = "pendingAddEmail"
+)
+
+func (c *Chat) usersWizardEmailPrompt(handler *Handler) *Reply {
+	if reply := c.requireAdmin(handler); reply != nil {
+		return reply
+	}
+
+	if c.AddEmail == nil {
+		return &Reply{
+			Reply: "Email is not configured.", Edit: true, Toast: "No email",
+			Keyboard: [][]Button{{{Label: "« Back", Data: cbUsersRoot}}},
+		}
+	}
+
+	clearPendingInput(handler.Sub)
+	SetSubMeta(handler.Sub, pendingEmailMetaKey, true)
+
+	return &Reply{
+		Reply: "Add an email subscriber.\n\nSend the address as your next message.\n" +
+			"Example: grandma@example.org\n\nThey get alerts for whatever you subscribe them to " +
+			"under Manage subscriptions.\n\nOr tap Cancel.",
+		Edit:     true,
+		Toast:    "Type an address",
+		Keyboard: [][]Button{{{Label: "Cancel", Data: cbUsersRoot}}},
+	}
+}
+
+func pendingEmailAdd(sub *subscribe.Subscriber) bool {
+	val, exists := sub.GetMeta(pendingEmailMetaKey)
+	pending, _ := val.(bool)
+
+	return exists && pending
+}
+
+// consumePendingEmail applies an admin's next free-text message as the address
+// for a new email subscriber. handled is false when no prompt is active.
+func (c *Chat) consumePendingEmail(handler *Handler) (*Reply, bool, bool) {
+	if handler == nil || handler.Sub == nil || !SubAdmin(handler.Sub) || len(handler.Text) == 0 ||
+		!pendingEmailAdd(handler.Sub) {
+		return nil, false, false
+	}
+
+	clearPendingInput(handler.Sub)
+
+	// Slash commands cancel the prompt and fall through.
+	if strings.HasPrefix(handler.Text[0], "/") || c.AddEmail == nil {
+		return nil, true, true
+	}
+
+	address := strings.TrimSpace(strings.Join(handler.Text, " "))
+
+	target, created, err := c.AddEmail(address)
+	if err != nil {
+		return &Reply{
+			Reply:    fmt.Sprintf("%v — nothing added.", err),
+			Keyboard: [][]Button{{{Label: "Try again", Data: cbUsersAddEmail}, {Label: "Users", Data: cbUsersRoot}}},
+		}, true, false
+	}
+
+	verb := "Added"
+	if !created {
+		verb = "Already a subscriber:"
+	}
+
+	next := c.usersWizardItem(handler, strconv.FormatInt(target.ID, 10))
+	next.Edit = false // new message after free-text
+	next.Reply = fmt.Sprintf("%s %s\n\n", verb, subscriberDisplayName(target)) + next.Reply
+	next.Toast = "Added"
+
+	return next, true, created
+}
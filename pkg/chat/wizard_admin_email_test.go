@@ -0,0 +1,83 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golift.io/subscribe"
+)
+
+var errTestAddress = errors.New("not a valid email address")
+
+func TestUsersWizardAddEmail(t *testing.T) {
+	t.Parallel()
+
+	admin, _, chat := adminSubsTestFixture(t)
+	handler := &Handler{API: "telegram", Sub: admin}
+
+	if root := chat.usersWizardRoot(handler); strings.Contains(keyboardData(root), cbUsersAddEmail) {
+		t.Fatal("the add-email button must be hidden when email is not configured")
+	}
+
+	chat.AddEmail = func(address string) (*subscribe.Subscriber, bool, error) {
+		if !strings.Contains(address, "@") {
+			return nil, false, errTestAddress
+		}
+
+		if sub, err := chat.Subs.GetSubscriberByID(99, "email"); err == nil {
+			return sub, false, nil
+		}
+
+		return chat.Subs.CreateSubWithID(99, address, "email", false, false), true, nil
+	}
+
+	if root := chat.usersWizardRoot(handler); !strings.Contains(keyboardData(root), cbUsersAddEmail) {
+		t.Fatal("the add-email button should show once email is configured")
+	}
+
+	chat.usersWizardEmailPrompt(handler)
+
+	handler.Text = []string{"grandma"}
+
+	reply, handled, save := chat.consumePendingEmail(handler)
+	if !handled || save || !strings.Contains(reply.Reply, "nothing added") {
+		t.Fatalf("bad address: handled=%v save=%v reply=%v", handled, save, reply)
+	}
+
+	if pendingEmailAdd(admin) {
+		t.Fatal("a consumed prompt must not stay pending")
+	}
+
+	chat.usersWizardEmailPrompt(handler)
+
+	handler.Text = []string{"grandma@example.org"}
+
+	reply, handled, save = chat.consumePendingEmail(handler)
+	if !handled || !save || !strings.HasPrefix(reply.Reply, "Added grandma@example.org") {
+		t.Fatalf("add: handled=%v save=%v reply=%v", handled, save, reply)
+	}
+
+	// The new subscriber is on another API; the admin's item page still finds it.
+	if !strings.Contains(reply.Reply, "API: email") {
+		t.Fatalf("expected the email subscriber's detail page, got %q", reply.Reply)
+	}
+
+	handler.Text = []string{"/help"}
+
+	if _, handled, _ := chat.consumePendingEmail(handler); handled {
+		t.Fatal("without a prompt, messages must fall through")
+	}
+}
+
+func keyboardData(reply *Reply) string {
+	var data []string
+
+	for _, row := range reply.Keyboard {
+		for _, btn := range row {
+			data = append(data, btn.Data)
+		}
+	}
+
+	return strings.Join(data, " ")
+}
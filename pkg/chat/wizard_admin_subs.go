@@ -17,6 +17,7 @@ import (
 // m:sd:{uid}:{idx}          → delay presets
 // m:sda:{uid}:{idx}:{secs}  → apply delay
 // m:su:{uid}:{idx}          → unsubscribe
+// m:st:{uid}:{idx}          → next escalation tier
 // m:ss:{uid}                → subscribe: pick trigger class
 // m:ss:{uid}:{class}        → subscribe: pick camera
 // m:ssa:{uid}:{class}:{idx} → subscribe: apply
@@ -46,6 +47,9 @@ func (c *Chat) adminSubsWizardRoot(handler *Handler, idStr string) *Reply {
 			until := time.Until(target.Events.PauseTime(event))
 			fmt.Fprintf(&msg, " (paused %s)", formatDuration(until))
 		}
+		if tier := subTierLabel(target.Events, event); tier != "" {
+			fmt.Fprintf(&msg, " · %s", tier)
+		}
 		rows = append(rows, []Button{{
 			Label: line,
 			Data:  fmt.Sprintf("m:si:%d:%d", target.ID, idx),
@@ -91,11 +95,14 @@ func (c *Chat) adminSubsWizardItem(handler *Handler, payload string) *Reply {
 	event := names[idx]
 	label := formatSubLabel(event)
 	uid := target.ID
+	tier, _ := target.Events.RuleGetI(event, ruleTier)
 
 	return &Reply{
 		Reply: fmt.Sprintf("Manage %s for %s\n\n"+
 			"Pause = silence this subscription for a while.\n"+
 			"Set delay = how often clips may arrive.\n"+
+			"Tier = when alerts that need acknowledgement reach them: "+
+			"tier 0 at once, each later tier when the one before doesn't acknowledge.\n"+
 			"Unsubscribe = remove this subscription.",
 			label, subscriberDisplayName(target)),
 		Edit: true,
@@ -108,6 +115,7 @@ func (c *Chat) adminSubsWizardItem(handler *Handler, payload string) *Reply {
 				{Label: "Set delay", Data: fmt.Sprintf("m:sd:%d:%d", uid, idx)},
 				{Label: "Unsubscribe", Data: fmt.Sprintf("m:su:%d:%d", uid, idx)},
 			},
+			{{Label: fmt.Sprintf("Tier %d → %d", tier, (tier+1)%(MaxAckTier+1)), Data: fmt.Sprintf("m:st:%d:%d", uid, idx)}},
 			{
 				{Label: "« Subs", Data: fmt.Sprintf("m:subs:%d", uid)},
 				{Label: "Done", Data: cbCancel},
@@ -282,6 +290,39 @@ func (c *Chat) adminSubsWizardUnsub(handler *Handler, payload string) (*Reply, b
 	return next, true
 }
 
+// adminSubsWizardTier moves a subscription to the next escalation tier,
+// wrapping from MaxAckTier back to 0.
+func (c *Chat) adminSubsWizardTier(handler *Handler, payload string) (*Reply, bool) {
+	if reply := c.requireAdmin(handler); reply != nil {
+		return reply, false
+	}
+
+	idStr, idxStr, found := strings.Cut(payload, ":")
+	if !found {
+		return &Reply{Reply: "Bad pick.", Edit: true, Toast: "Error"}, false
+	}
+
+	target, err := c.adminTargetByID(handler.API, idStr)
+	if err != nil {
+		return c.adminTargetGone(), false
+	}
+
+	idx := atoiDefault(idxStr, -1)
+	names := targetEventNames(target)
+	if idx < 0 || idx >= len(names) {
+		return &Reply{Reply: "Subscription gone.", Edit: true, Toast: "Missing"}, false
+	}
+
+	event := names[idx]
+	tier, _ := target.Events.RuleGetI(event, ruleTier)
+	SetSubTier(target, event, (tier+1)%(MaxAckTier+1))
+
+	next := c.adminSubsWizardItem(handler, payload)
+	next.Toast = "Saved"
+
+	return next, true
+}
+
 func (c *Chat) adminSubsWizardSubClass(handler *Handler, idStr string) *Reply {
 	if reply := c.requireAdmin(handler); reply != nil {
 		return reply
@@ -2,6 +2,7 @@ package chat
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 )
 
 // Extra callback prefixes for command wizards (pics/vid/stop/delay/cams/subs/help).
+// The schedule, mode and digest wizards' prefixes live in their own files.
 const (
 	cbPicsRoot   = "p"
 	cbVidsRoot   = "v"
@@ -27,6 +29,12 @@ const (
 )
 
 func (c *Chat) handleCommandWizardCallback(handler *Handler, data string) (*Reply, bool, bool) {
+	if strings.HasPrefix(data, cbAlert) {
+		reply, save := c.handleAlertCallback(handler, data)
+
+		return reply, save, true
+	}
+
 	if reply, save, ok := c.handleMediaWizardCallback(handler, data); ok {
 		return reply, save, true
 	}
@@ -35,6 +43,30 @@ func (c *Chat) handleCommandWizardCallback(handler *Handler, data string) (*Repl
 		return reply, save, true
 	}
 
+	if reply, save, ok := c.handleScheduleWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
+	if reply, save, ok := c.handleModeWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
+	if reply, save, ok := c.handleDigestWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
+	if reply, save, ok := c.handleRecentWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
+	if reply, save, ok := c.handleHistoryWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
+	if reply, save, ok := c.handleRecordingsWizardCallback(handler, data); ok {
+		return reply, save, true
+	}
+
 	if reply, save, ok := c.handleCamSetWizardCallback(handler, data); ok {
 		return reply, save, true
 	}
@@ -93,6 +125,8 @@ func (c *Chat) handleCamsEventsWizardCallback(handler *Handler, data string) (*R
 	switch {
 	case data == cbCamsRoot:
 		return c.camsWizardRoot(handler), false, true
+	case data == cbGridRoot:
+		return c.gridReply(handler), false, true
 	case strings.HasPrefix(data, "c:s:"):
 		reply, save := c.camsWizardSubscribe(handler, strings.TrimPrefix(data, "c:s:"))
 
@@ -158,14 +192,19 @@ func (c *Chat) handleUsersWizardCallback(handler *Handler, data string) (*Reply,
 	}
 
 	switch {
+	case data == cbUsersHdr:
+		// Section header tap — answer the callback, leave the menu alone.
+		return &Reply{}, false, true
+	case data == cbUsersAddEmail:
+		return c.usersWizardEmailPrompt(handler), true, true
 	case strings.HasPrefix(data, "m:rename:"):
 		return c.usersWizardRenamePrompt(handler, strings.TrimPrefix(data, "m:rename:")), true, true
 	case strings.HasPrefix(data, "m:i:"):
-		clearPendingRename(handler.Sub)
+		clearPendingInput(handler.Sub)
 
 		return c.usersWizardItem(handler, strings.TrimPrefix(data, "m:i:")), false, true
 	case data == cbUsersRoot:
-		clearPendingRename(handler.Sub)
+		clearPendingInput(handler.Sub)
 
 		return c.usersWizardRoot(handler), false, true
 	case strings.HasPrefix(data, "m:delok:"): // before m:del:
@@ -210,7 +249,7 @@ func (c *Chat) handleAdminSubsWizardCallback(handler *Handler, data string) (*Re
 
 	// Cancel any in-progress rename prompt (same as m:i: / m: root).
 	if handler != nil {
-		clearPendingRename(handler.Sub)
+		clearPendingInput(handler.Sub)
 	}
 
 	switch {
@@ -227,6 +266,10 @@ func (c *Chat) handleAdminSubsWizardCallback(handler *Handler, data string) (*Re
 	case strings.HasPrefix(data, "m:su:"):
 		reply, save := c.adminSubsWizardUnsub(handler, strings.TrimPrefix(data, "m:su:"))
 
+		return reply, save, true
+	case strings.HasPrefix(data, "m:st:"):
+		reply, save := c.adminSubsWizardTier(handler, strings.TrimPrefix(data, "m:st:"))
+
 		return reply, save, true
 	case strings.HasPrefix(data, "m:ssa:"):
 		reply, save := c.adminSubsWizardSubApply(handler, strings.TrimPrefix(data, "m:ssa:"))
@@ -250,7 +293,7 @@ func (c *Chat) handleAdminSubsWizardCallback(handler *Handler, data string) (*Re
 
 func isAdminSubsCallback(data string) bool {
 	for _, prefix := range []string{
-		"m:sda:", "m:sd:", "m:sp:", "m:su:", "m:ssa:", "m:ss:", "m:si:", "m:subs:",
+		"m:sda:", "m:sd:", "m:sp:", "m:su:", "m:st:", "m:ssa:", "m:ss:", "m:si:", "m:subs:",
 	} {
 		if strings.HasPrefix(data, prefix) {
 			return true
@@ -350,6 +393,7 @@ func (c *Chat) camsWizardRoot(handler *Handler) *Reply {
 	}
 
 	rows := c.cameraButtonRowsWithSubs("c:", false, sub)
+	rows = append(rows, []Button{{Label: "Grid of all cameras", Data: cbGridRoot}})
 	rows = append(rows, []Button{{Label: "Done", Data: cbCancel}})
 
 	online := 0
@@ -382,7 +426,7 @@ func (c *Chat) camsWizardCam(handler *Handler, idx int) *Reply {
 		status = "down"
 	}
 
-	settings := GetCameraClipSettings(c.Subs, cam.Name)
+	settings := c.CameraClipSettings(cam.Name)
 	clip := FormatClipSettings(settings)
 	if frame := cameraFrameSize(cam); frame != "" {
 		clip += " (" + frame + ")"
@@ -467,7 +511,7 @@ func (c *Chat) camsWizardSubscribe(handler *Handler, payload string) (*Reply, bo
 	toast := "Subscribed ✓"
 	msg := fmt.Sprintf("Subscribed to %s (%s).", cam.Name, classLabel(class))
 
-	err := handler.Sub.Subscribe(key)
+	err := subscribeHere(handler, key)
 	if err != nil {
 		msg = fmt.Sprintf("Already subscribed to %s (%s).", cam.Name, classLabel(class))
 		toast = "Already on"
@@ -680,17 +724,11 @@ func (c *Chat) snapOne(handler *Handler, cam *securityspy.Camera, video bool) (s
 		return "", "Skipping '" + cam.Name + "' (camera offline)"
 	}
 
-	path, errMsg := c.captureCam(handler, cam, video)
+	path, caption, errMsg := c.captureCaptioned(handler, cam, video)
 	if errMsg != "" {
 		return "", errMsg
 	}
 
-	kind := CaptionPhoto
-	if video {
-		kind = CaptionVideo
-	}
-
-	caption := CameraCaption(cam.Name, kind)
 	if handler.SendFile == nil {
 		return path, ""
 	}
@@ -706,6 +744,21 @@ func (c *Chat) snapOne(handler *Handler, cam *securityspy.Camera, video bool) (s
 	return "", "" // already delivered
 }
 
+// captureCaptioned is captureCam plus the file's caption.
+func (c *Chat) captureCaptioned(handler *Handler, cam *securityspy.Camera, video bool) (string, string, string) {
+	path, errMsg := c.captureCam(handler, cam, video)
+	if errMsg != "" {
+		return "", "", errMsg
+	}
+
+	kind := CaptionPhoto
+	if video {
+		kind = CaptionVideo
+	}
+
+	return path, CameraCaption(cam.Name, kind), ""
+}
+
 func (c *Chat) captureCam(handler *Handler, cam *securityspy.Camera, video bool) (string, string) {
 	if video {
 		path := filepath.Join(c.TempDir, fmt.Sprintf("chat_command_%v_%v.mp4", handler.ID, cam.Name))
@@ -743,7 +796,7 @@ func (c *Chat) captureCam(handler *Handler, cam *securityspy.Camera, video bool)
 
 func (c *Chat) snapAll(handler *Handler, video bool) ([]string, string) {
 	// Sequential on purpose: SecuritySpy encodes stills slowly, and Telegram
-	// gets each file as it finishes (via handler.SendFile) so the UI doesn't freeze.
+	// gets each file (or album) as it finishes so the UI doesn't freeze.
 	// Refresh first so Connected is current — skip dead cams instead of waiting on them.
 	if c.SSpy != nil {
 		err := c.SSpy.Refresh()
@@ -753,50 +806,98 @@ func (c *Chat) snapAll(handler *Handler, video bool) ([]string, string) {
 	}
 
 	var (
-		paths []string
-		errs  []string
-		okN   int
-		cams  = c.allCameras()
-		total int
+		cams   = c.allCameras()
+		online = make([]*securityspy.Camera, 0, len(cams))
+		batch  = &albumBatch{handler: handler, log: c.Error}
+		paths  []string
+		okN    int
 	)
 
 	for _, cam := range cams {
 		if !cam.Connected.Val {
-			errs = append(errs, "Skipping '"+cam.Name+"' (camera offline)")
+			batch.errs = append(batch.errs, "Skipping '"+cam.Name+"' (camera offline)")
 			continue
 		}
 
-		total++
+		online = append(online, cam)
 	}
 
-	c.Info.Printf("[%v] snapAll starting (%d online cameras, video=%v)", handler.ID, total, video)
+	c.Info.Printf("[%v] snapAll starting (%d online cameras, video=%v, albums=%v)",
+		handler.ID, len(online), video, handler.SendAlbum != nil)
 
-	for _, cam := range cams {
-		if !cam.Connected.Val {
-			continue
+	for i, cam := range online {
+		if handler.Progress != nil {
+			handler.Progress(fmt.Sprintf("Fetching %d of %d: %s…", i+1, len(online), cam.Name))
 		}
 
-		path, errMsg := c.snapOne(handler, cam, video)
-		if errMsg != "" {
-			errs = append(errs, errMsg)
+		if handler.SendAlbum == nil {
+			path, errMsg := c.snapOne(handler, cam, video)
+			if errMsg != "" {
+				batch.errs = append(batch.errs, errMsg)
+				continue
+			}
+
+			if path != "" {
+				paths = append(paths, path)
+			}
+
+			okN++
+
 			continue
 		}
 
-		if path != "" {
-			paths = append(paths, path)
+		path, caption, errMsg := c.captureCaptioned(handler, cam, video)
+		if errMsg != "" {
+			batch.errs = append(batch.errs, errMsg)
+			continue
 		}
 
-		okN++
+		batch.add(AlbumFile{Path: path, Caption: caption})
 	}
 
-	summary := fmt.Sprintf("Done — sent %d of %d online cameras.", okN, total)
-	if len(errs) > 0 {
-		summary += "\n" + strings.Join(errs, "\n")
+	batch.flush()
+
+	summary := fmt.Sprintf("Done — sent %d of %d online cameras.", okN+batch.sent, len(online))
+	if len(batch.errs) > 0 {
+		summary += "\n" + strings.Join(batch.errs, "\n")
 	}
 
 	return paths, summary
 }
 
+// albumBatch collects captures and sends them through handler.SendAlbum each
+// time MaxAlbumFiles are ready, and once more for the rest.
+type albumBatch struct {
+	handler *Handler
+	log     *log.Logger
+	files   []AlbumFile
+	sent    int
+	errs    []string
+}
+
+func (a *albumBatch) add(file AlbumFile) {
+	if a.files = append(a.files, file); len(a.files) == MaxAlbumFiles {
+		a.flush()
+	}
+}
+
+func (a *albumBatch) flush() {
+	files := a.files
+	if a.files = nil; len(files) == 0 {
+		return
+	}
+
+	err := a.handler.SendAlbum(files)
+	if err != nil {
+		a.log.Printf("[%v] SendAlbum (%d files): %v", a.handler.ID, len(files), err)
+		a.errs = append(a.errs, "Error Sending album: "+err.Error())
+
+		return
+	}
+
+	a.sent += len(files)
+}
+
 func (c *Chat) stopWizardRoot() *Reply {
 	return &Reply{
 		Reply: "Temporarily silence motion alerts.\n\n" +
@@ -1010,7 +1111,8 @@ func (c *Chat) subsWizardRoot(handler *Handler) *Reply {
 
 	var msg strings.Builder
 	msg.WriteString("Your alert subscriptions.\n\n")
-	msg.WriteString("Tap a subscription below to pause it, change how often clips arrive, or remove it.\n")
+	msg.WriteString("Tap a subscription below to pause it, change how often clips arrive, " +
+		"set when alerts may arrive, or remove it.\n")
 	if handler.Sub != nil && SubAdmin(handler.Sub) {
 		msg.WriteString("\nAdmin tip: use /users → person → Manage subscriptions to edit someone else's.\n")
 	}
@@ -1029,6 +1131,18 @@ func (c *Chat) subsWizardRoot(handler *Handler) *Reply {
 			fmt.Fprintf(&msg, " (paused %s)", formatDuration(until))
 		}
 
+		if spec := SubSchedule(handler.Sub, event); spec != "" && spec != scheduleAlways {
+			fmt.Fprintf(&msg, " · %s", scheduleLabel(spec))
+		}
+
+		if modes := SubModes(handler.Sub, event); len(modes) < len(Modes()) {
+			fmt.Fprintf(&msg, " · %s only", subModesLabel(handler.Sub, event))
+		}
+
+		if every := subDigestRule(handler.Sub, event); every > 0 {
+			fmt.Fprintf(&msg, " · %s", formatDigest(every))
+		}
+
 		rows = append(rows, []Button{{Label: line, Data: fmt.Sprintf("l:%d", idx)}})
 	}
 
@@ -1039,6 +1153,7 @@ func (c *Chat) subsWizardRoot(handler *Handler) *Reply {
 		{Label: "Pause", Data: cbStopRoot},
 		{Label: "Delay", Data: cbDelayRoot},
 	}, []Button{
+		{Label: "Schedule", Data: cbSchedRoot},
 		{Label: "Done", Data: cbCancel},
 	})
 
@@ -1059,6 +1174,9 @@ func (c *Chat) subsWizardItem(handler *Handler, idxStr string) *Reply {
 		Reply: "Manage " + label + "\n\n" +
 			"Pause = silence this subscription for a while.\n" +
 			"Set delay = how often clips for this one may arrive.\n" +
+			"Schedule = when alerts may arrive (" + subScheduleLabel(handler.Sub, event) + ").\n" +
+			"Modes = which household modes it fires in (" + subModesLabel(handler.Sub, event) + ").\n" +
+			"Delivery = alerts at once, or a digest (" + formatDigest(subDigestRule(handler.Sub, event)) + ").\n" +
 			"Unsubscribe = stop getting these alerts for good.",
 		Edit: true,
 		Keyboard: [][]Button{
@@ -1068,8 +1186,13 @@ func (c *Chat) subsWizardItem(handler *Handler, idxStr string) *Reply {
 			},
 			{
 				{Label: "Set delay", Data: fmt.Sprintf("d:%d", idx)},
-				{Label: "Unsubscribe", Data: fmt.Sprintf("u:%d", idx)},
+				{Label: "Schedule", Data: fmt.Sprintf("%s:%d", cbSchedRoot, idx)},
+			},
+			{
+				{Label: "Modes", Data: fmt.Sprintf("%s%d", cbModeSubPref, idx)},
+				{Label: "Delivery", Data: fmt.Sprintf("%s%d", cbDigestPref, idx)},
 			},
+			{{Label: "Unsubscribe", Data: fmt.Sprintf("u:%d", idx)}},
 			{{Label: "« Back", Data: cbSubsRoot}, {Label: "Done", Data: cbCancel}},
 		},
 	}
@@ -1083,14 +1206,18 @@ Here's what each button opens:
 
 • Subscribe — start getting alert videos when a camera sees motion, a person, a vehicle, or an animal
 • Unsubscribe — stop alerts you no longer want
-• My subs — see what you're subscribed to; tap one to pause, change frequency, or remove it
+• My subs — see what you're subscribed to; tap one to pause, change frequency, schedule, or remove it
 • Pause — temporarily mute alerts (no clips for N minutes) without unsubscribing
 • Snapshot — grab a still photo from a camera right now
 • Video — grab a short live clip from a camera right now
-• Cameras — browse cameras (shows your [M]/[H]/[V]/[A] subs); tap for snapshot, video, or subscribe/unsubscribe
+• Cameras — browse cameras (shows your [M]/[H]/[V]/[A] subs); tap for snapshot, video, or subscribe/unsubscribe,
+  or get one grid picture of every camera
 • Events — system alerts (stream up/down, camera offline/online, SecuritySpy errors) and any custom events
 • Delay — after a clip is sent for a subscription, wait this long before sending another
   for the same one (so you aren't flooded)
+• History — recent camera and event alerts and who got them; filter by camera, class and time
+• Recent — motion clips kept in the archive; send one again
+• Recordings — footage SecuritySpy recorded; pick a camera, day and time
 
 Tap a button below:`,
 		Edit: true,
@@ -1099,13 +1226,17 @@ Tap a button below:`,
 			{{Label: "My subs", Data: cbSubsRoot}, {Label: "Pause", Data: cbStopRoot}},
 			{{Label: "Snapshot", Data: cbPicsRoot}, {Label: "Video", Data: cbVidsRoot}},
 			{{Label: "Cameras", Data: cbCamsRoot}, {Label: "Events", Data: cbEvtsRoot}},
-			{{Label: "Delay", Data: cbDelayRoot}, {Label: "Done", Data: cbCancel}},
+			{{Label: "History", Data: cbHistRoot}, {Label: "Recent clips", Data: cbRecentRoot}},
+			{{Label: "Recordings", Data: cbRecRoot}, {Label: "Delay", Data: cbDelayRoot}},
+			{{Label: "Done", Data: cbCancel}},
 		},
 	}
 }
 
 func (c *Chat) helpWizardRootFor(handler *Handler) *Reply {
 	root := c.helpWizardRoot()
+	mode, _ := HouseMode(c.Subs)
+	root.Reply = "Mode: " + ModeLabel(mode) + "\n\n" + root.Reply
 	if handler != nil && handler.Sub != nil && SubAdmin(handler.Sub) {
 		// Insert Users / Clip settings before Done on the last row.
 		rows := root.Keyboard
@@ -1117,11 +1248,12 @@ func (c *Chat) helpWizardRootFor(handler *Handler) *Reply {
 					{Label: "Clip set", Data: cbCamSetRoot},
 				}, last...)
 				rows[len(rows)-1] = last
-				root.Keyboard = rows
+				root.Keyboard = append(rows[:len(rows)-1], []Button{{Label: "Mode", Data: cbModeRoot}}, last)
 			}
 		}
 		root.Reply += "\n• Users (admin) — allow/deny/ignore/admin/delete subscribers; manage their subscriptions" +
-			"\n• Clip set (admin) — per-camera scale / length / size for everyone"
+			"\n• Clip set (admin) — per-camera scale / length / size / merge window / pre-roll / extend for everyone" +
+			"\n• Mode (admin) — switch the household between Armed, Home and Disarmed"
 	}
 
 	return root
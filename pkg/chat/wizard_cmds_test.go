@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"testing"
+)
+
+var errTestAlbum = errors.New("too big")
+
+// Captures go out in full albums as they fill, then the rest in a last one.
+// A refused album counts as not sent and shows up in the summary errors.
+func TestAlbumBatch(t *testing.T) {
+	t.Parallel()
+
+	var sizes []int
+
+	handler := &Handler{ID: "test", SendAlbum: func(files []AlbumFile) error {
+		sizes = append(sizes, len(files))
+		if len(files) == 3 {
+			return errTestAlbum
+		}
+
+		return nil
+	}}
+	batch := &albumBatch{handler: handler, log: log.New(io.Discard, "", 0)}
+
+	for i := range 2*MaxAlbumFiles + 3 {
+		batch.add(AlbumFile{Path: strconv.Itoa(i), Caption: "cam " + strconv.Itoa(i)})
+	}
+
+	batch.flush()
+	batch.flush() // nothing left: no empty album.
+
+	if len(sizes) != 3 || sizes[0] != MaxAlbumFiles || sizes[1] != MaxAlbumFiles || sizes[2] != 3 {
+		t.Fatalf("album sizes: %v", sizes)
+	}
+
+	if batch.sent != 2*MaxAlbumFiles || len(batch.errs) != 1 {
+		t.Fatalf("sent %d, errs %v", batch.sent, batch.errs)
+	}
+}
@@ -34,6 +34,19 @@ type Data struct {
 	Sent       expvar.Int
 	Recv       expvar.Int
 	Errors     expvar.Int
+	// Motion pipeline counters (queued, dropped on a full camera queue, finished,
+	// folded into a clip already recording, extra clip lengths recorded for them).
+	MotionQueued   expvar.Int
+	MotionDropped  expvar.Int
+	MotionHandled  expvar.Int
+	MotionMerged   expvar.Int
+	MotionExtended expvar.Int
+	// Notification spool counters (saved for retry, delivered late, expired,
+	// dropped with nobody left to receive them).
+	SpoolQueued    expvar.Int
+	SpoolDelivered expvar.Int
+	SpoolExpired   expvar.Int
+	SpoolOrphaned  expvar.Int
 }
 
 // Map is the process-wide expvar export data.
@@ -53,6 +66,15 @@ func Init(name string) {
 	Map.Set("messge_sent", &Map.Sent)
 	Map.Set("messge_recv", &Map.Recv)
 	Map.Set("error_count", &Map.Errors)
+	Map.Set("motion_queued", &Map.MotionQueued)
+	Map.Set("motion_dropped", &Map.MotionDropped)
+	Map.Set("motion_handled", &Map.MotionHandled)
+	Map.Set("motion_merged", &Map.MotionMerged)
+	Map.Set("motion_extended", &Map.MotionExtended)
+	Map.Set("spool_queued", &Map.SpoolQueued)
+	Map.Set("spool_delivered", &Map.SpoolDelivered)
+	Map.Set("spool_expired", &Map.SpoolExpired)
+	Map.Set("spool_orphaned", &Map.SpoolOrphaned)
 	Map.StartAt.Set(time.Now().String())
 }
 
@@ -0,0 +1,327 @@
+// Package history keeps a record of every camera and Home Assistant event
+// Motifini handled: when, which camera and classes, who was notified and how
+// the delivery went. Entries are appended to a JSON-lines file and held in
+// memory for queries; old entries fall off by age and count.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention defaults.
+const (
+	DefaultMaxAge     = 30 * 24 * time.Hour
+	DefaultMaxEntries = 10000
+	// DefaultLimit and MaxLimit bound how many entries one query returns.
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+const (
+	fileMode = 0o600
+	// compactSlack is how many stale lines the file may carry past the live
+	// entries before it is rewritten.
+	compactSlack = 1000
+)
+
+// Entry is one recorded event.
+type Entry struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// Camera is set for camera motion and for notifies with camera media.
+	Camera  string   `json:"camera,omitempty"`
+	Classes []string `json:"classes,omitempty"`
+	// Event is the Home Assistant or system event name; empty for camera motion.
+	Event string `json:"event,omitempty"`
+	// Notified lists the subscribers alerted at once ("id:contact").
+	Notified []string `json:"notified,omitempty"`
+	Sent     int      `json:"sent"`
+	Failed   int      `json:"failed,omitempty"`
+	Spooled  int      `json:"spooled,omitempty"`
+	Digest   int      `json:"digest,omitempty"` // subscribers who get it in a digest
+	// Media is the archived clip or snapshot, when one was kept.
+	Media string `json:"media,omitempty"`
+}
+
+// Name is the camera or event the entry is about.
+func (e *Entry) Name() string {
+	if e.Event != "" {
+		return e.Event
+	}
+
+	return e.Camera
+}
+
+// Query filters entries. Zero fields match everything. Results come newest first.
+type Query struct {
+	Camera string // camera name, any case
+	Class  string // one of the entry's classes
+	Event  string // event name, any case
+	// Name matches either the camera or the event, for free-text filters.
+	Name   string
+	Since  time.Time
+	Until  time.Time
+	Before int64 // entries older than this ID, for paging back
+	After  int64 // entries newer than this ID, for paging forward
+	Limit  int   // DefaultLimit when 0, at most MaxLimit
+}
+
+// Store is the event history. A nil Store records and finds nothing.
+type Store struct {
+	path       string
+	maxAge     time.Duration
+	maxEntries int
+	mu         sync.RWMutex
+	entries    []*Entry // oldest first
+	lastID     int64
+	lines      int // lines in the file, live or not
+}
+
+// Open loads the history file at path, creating it when needed. maxAge and
+// maxEntries bound what is kept; 0 takes the defaults.
+func Open(path string, maxAge time.Duration, maxEntries int) (*Store, error) {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	store := &Store{path: path, maxAge: maxAge, maxEntries: maxEntries}
+
+	err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	store.prune(time.Now())
+
+	if store.lines > len(store.entries) {
+		err = store.compact()
+	}
+
+	return store, err
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("opening history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20) //nolint:mnd // long notified lists.
+
+	for scanner.Scan() {
+		s.lines++
+
+		entry := &Entry{}
+		if json.Unmarshal(scanner.Bytes(), entry) != nil || entry.ID <= s.lastID {
+			continue // a torn last line after a crash, or garbage.
+		}
+
+		s.entries = append(s.entries, entry)
+		s.lastID = entry.ID
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading history: %w", err)
+	}
+
+	return nil
+}
+
+// Add records an entry, stamping its ID (and Time when zero), and returns the ID.
+func (s *Store) Add(entry Entry) (int64, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	entry.ID = s.lastID
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	s.entries = append(s.entries, &entry)
+	s.prune(time.Now())
+
+	if s.lines-len(s.entries) >= compactSlack {
+		return entry.ID, s.compact()
+	}
+
+	return entry.ID, s.append(&entry)
+}
+
+// Find returns the entries matching a query, newest first, and whether more
+// match beyond the limit.
+func (s *Store) Find(query Query) ([]Entry, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	limit = min(limit, MaxLimit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make([]Entry, 0, limit)
+	more := false
+
+	// Paging forward walks oldest first from the cursor so the page sits right after it.
+	next, step, stop := len(s.entries)-1, -1, -1
+	if query.After > 0 {
+		next, step, stop = 0, 1, len(s.entries)
+	}
+
+	for ; next != stop; next += step {
+		entry := s.entries[next]
+		if !query.matches(entry) {
+			continue
+		}
+
+		if len(found) == limit {
+			more = true
+			break
+		}
+
+		found = append(found, *entry)
+	}
+
+	if query.After > 0 {
+		slices.Reverse(found)
+	}
+
+	return found, more
+}
+
+func (q *Query) matches(entry *Entry) bool {
+	switch {
+	case q.Before > 0 && entry.ID >= q.Before,
+		q.After > 0 && entry.ID <= q.After,
+		!q.Since.IsZero() && entry.Time.Before(q.Since),
+		!q.Until.IsZero() && entry.Time.After(q.Until),
+		q.Camera != "" && !strings.EqualFold(entry.Camera, q.Camera),
+		q.Event != "" && !strings.EqualFold(entry.Event, q.Event),
+		q.Name != "" && !strings.EqualFold(entry.Camera, q.Name) && !strings.EqualFold(entry.Event, q.Name),
+		q.Class != "" && !slices.ContainsFunc(entry.Classes, func(c string) bool { return strings.EqualFold(c, q.Class) }):
+		return false
+	default:
+		return true
+	}
+}
+
+// Len is how many entries are kept.
+func (s *Store) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.entries)
+}
+
+// prune drops entries past the age and count limits. Hold mu.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-s.maxAge)
+	drop := max(len(s.entries)-s.maxEntries, 0)
+
+	for drop < len(s.entries) && s.entries[drop].Time.Before(cutoff) {
+		drop++
+	}
+
+	if drop > 0 {
+		s.entries = slices.Delete(s.entries, 0, drop)
+	}
+}
+
+// append adds one line to the file. Hold mu.
+func (s *Store) append(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding history: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return fmt.Errorf("opening history: %w", err)
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+
+	s.lines++
+
+	return nil
+}
+
+// compact rewrites the file with only the live entries, through a temp file
+// so a crash never loses the history. Hold mu.
+func (s *Store) compact() error {
+	tmp := s.path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode)
+	if err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range s.entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("compacting history: %w", err)
+	}
+
+	s.lines = len(s.entries)
+
+	return nil
+}
@@ -0,0 +1,349 @@
+package messenger
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/subscribe"
+)
+
+// Alerts that need acknowledgement. An event with an ack window (see
+// chat.AckWindow) goes to its lowest tier of subscribers first, with an
+// Acknowledge button under each chat's copy. Each window that passes without
+// a press sends it on to the next tier. The first press stops the chain and
+// every copy sent so far is edited to say who acknowledged it.
+const (
+	// ackPrefix is the callback data of the Acknowledge button: ack:{alert ID}.
+	ackPrefix   = "ack:"
+	ackIDLength = 8
+	// ackRetention is how long a finished alert is remembered, so a late
+	// press still gets a sensible answer and copies still get edited.
+	ackRetention = 12 * time.Hour
+)
+
+// alertBackend is a Backend whose alerts can carry an Acknowledge button and
+// be rewritten once someone presses it. Subscribers on other backends still
+// get the alert when their tier comes up, without the button.
+type alertBackend interface {
+	Backend
+	// sendAlert sends upload, or text when upload is nil, with buttons under
+	// it and returns the message ID.
+	sendAlert(upload *Upload, reqID string, chatID int64, contact, text string, rows [][]chat.Button) (string, error)
+	// editAlert replaces the caption (media) or text of an alert, and its buttons.
+	editAlert(reqID string, chatID int64, messageID string, media bool, text string, rows [][]chat.Button) error
+}
+
+// pendingAck is one alert waiting for acknowledgement.
+type pendingAck struct {
+	id     string
+	reqID  string
+	event  Event // the alert's event; its ack field points back here.
+	msg    string
+	path   string // kept until the chain ends: later tiers need it.
+	window time.Duration
+
+	// Everything below is guarded by the Messenger's ackMu.
+	tiers    [][]*subscribe.Subscriber // not alerted yet, lowest first
+	copies   []ackCopy
+	ackedBy  string
+	ackedAt  time.Time
+	timer    *time.Timer
+	busy     bool // a tier is being sent; the files are in use.
+	released bool
+}
+
+// ackCopy is one chat's copy of an alert, for the edit on acknowledgement.
+type ackCopy struct {
+	backend   alertBackend
+	chatID    int64
+	messageID string
+	media     bool
+	rows      [][]chat.Button // buttons kept once the Acknowledge button goes.
+}
+
+// ackWindow returns the acknowledgement window for an event, or 0.
+func (m *Messenger) ackWindow(event *Event) time.Duration {
+	if event == nil {
+		return 0
+	}
+
+	return chat.AckWindow(m.Subs, event.Name)
+}
+
+// sendAckEvent sends an alert that needs acknowledgement to its lowest tier and
+// starts the escalation clock. The alert owns path and the event's snapshot
+// from here on; they are removed when the chain ends.
+func (m *Messenger) sendAckEvent(
+	reqID string, event *Event, msg, path string, subs []*subscribe.Subscriber, window time.Duration,
+) *Delivery {
+	alert := &pendingAck{
+		id:     ReqID(ackIDLength),
+		reqID:  reqID,
+		event:  *event,
+		msg:    msg,
+		path:   path,
+		window: window,
+		tiers:  ackTiers(subs, event),
+		busy:   true,
+	}
+	alert.event.ack = alert
+
+	first := alert.tiers[0]
+	alert.tiers = alert.tiers[1:]
+
+	m.ackMu.Lock()
+	if m.acks == nil {
+		m.acks = make(map[string]*pendingAck)
+	}
+
+	m.acks[alert.id] = alert
+	m.ackMu.Unlock()
+
+	m.Info.Printf("[%s] Alert %s for '%s' needs acknowledgement within %v (%d more tier(s))",
+		reqID, alert.id, event.Name, window, len(alert.tiers))
+
+	delivery := m.deliver(reqID, &alert.event, msg, path, first)
+	delivery.Spooled = m.spoolAck(alert, delivery.retry)
+	alert.event.alerted(first)
+
+	m.armAck(alert)
+
+	return delivery
+}
+
+// ackTiers groups subscribers by escalation tier, lowest first, leaving out empty tiers.
+func ackTiers(subs []*subscribe.Subscriber, event *Event) [][]*subscribe.Subscriber {
+	tiers := make([][]*subscribe.Subscriber, chat.MaxAckTier+1)
+
+	for _, sub := range subs {
+		tier := chat.SubTier(sub, event.Name, event.Classes)
+		tiers[tier] = append(tiers[tier], sub)
+	}
+
+	return slices.DeleteFunc(tiers, func(tier []*subscribe.Subscriber) bool { return len(tier) == 0 })
+}
+
+// armAck runs after a tier went out: wait one window for an acknowledgement
+// before the next tier, or, with none left, let go of the files.
+func (m *Messenger) armAck(alert *pendingAck) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+
+	alert.busy = false
+
+	switch {
+	case m.acks[alert.id] != alert:
+		alert.release() // dropped by Stop mid-send.
+	case alert.ackedBy != "":
+		alert.release() // acknowledged mid-send; the forget timer is already set.
+	case len(alert.tiers) == 0:
+		alert.release()
+		alert.timer = time.AfterFunc(ackRetention, func() { m.forgetAck(alert.id) })
+	default:
+		alert.timer = time.AfterFunc(alert.window, func() { m.escalate(alert) })
+	}
+}
+
+// escalate sends an unacknowledged alert to its next tier.
+func (m *Messenger) escalate(alert *pendingAck) {
+	m.ackMu.Lock()
+	if alert.ackedBy != "" || len(alert.tiers) == 0 || m.acks[alert.id] != alert {
+		m.ackMu.Unlock()
+		return
+	}
+
+	tier := alert.tiers[0]
+	alert.tiers = alert.tiers[1:]
+	alert.busy = true
+	m.ackMu.Unlock()
+
+	m.Info.Printf("[%s] Alert %s for '%s' not acknowledged within %v; escalating to %d subscriber(s)",
+		alert.reqID, alert.id, alert.event.Name, alert.window, len(tier))
+
+	delivery := m.deliver(alert.reqID, &alert.event, alert.msg, alert.path, tier)
+	m.spoolAck(alert, delivery.retry)
+	alert.event.alerted(tier)
+	m.armAck(alert)
+}
+
+// spoolAck spools the subscribers a tier could not reach. The spool takes its
+// files, and later tiers still need them, so it gets copies.
+func (m *Messenger) spoolAck(alert *pendingAck, retry []*subscribe.Subscriber) int {
+	if m.SpoolDir == "" || len(retry) == 0 {
+		return 0
+	}
+
+	event := alert.event
+	event.ack = nil
+	event.Snapshot = spoolCopy(event.Snapshot)
+
+	path := spoolCopy(alert.path)
+	if alert.path != "" && path == "" {
+		return 0
+	}
+
+	return m.spoolDelivery(alert.reqID, &event, alert.msg, path, retry)
+}
+
+// spoolCopy copies a file next to itself for the spool, or returns "".
+func spoolCopy(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	dst := filepath.Join(filepath.Dir(path), "spool_"+filepath.Base(path))
+	if copyFile(path, dst) != nil {
+		_ = os.Remove(dst)
+		return ""
+	}
+
+	return dst
+}
+
+// sendAckCopy sends one subscriber's copy of an alert with the Acknowledge
+// button and remembers it for the edit. A copy that went out after someone
+// acknowledged is edited at once.
+func (m *Messenger) sendAckCopy(
+	b alertBackend, alert *pendingAck, msg string, upload *Upload, sub *subscribe.Subscriber,
+) error {
+	rows := alertButtons(sub, &alert.event)
+	withAck := append(slices.Clone(rows), []chat.Button{{Label: "Acknowledge", Data: ackPrefix + alert.id}})
+
+	contact := chat.SubContact(sub)
+	if contact == "" {
+		contact = "?"
+	}
+
+	messageID, err := b.sendAlert(upload, alert.reqID, sub.ID, contact, msg, withAck)
+	if err != nil {
+		m.Error.Printf("[%s] Error Sending %s alert to %d:%s: %v", alert.reqID, b.Name(), sub.ID, contact, err)
+		return err
+	}
+
+	sent := ackCopy{backend: b, chatID: sub.ID, messageID: messageID, media: upload != nil, rows: rows}
+
+	m.ackMu.Lock()
+	alert.copies = append(alert.copies, sent)
+	acked, text := alert.ackedBy != "", alert.ackedText()
+	m.ackMu.Unlock()
+
+	if acked {
+		m.editAck(alert.reqID, sent, text)
+	}
+
+	return nil
+}
+
+// acknowledge records who acknowledged an alert, stops its escalation and
+// names them on every copy sent so far. It returns the toast for the press.
+func (m *Messenger) acknowledge(reqID, id, name string) string {
+	if name == "" {
+		name = "someone"
+	}
+
+	m.ackMu.Lock()
+
+	alert := m.acks[id]
+	if alert == nil {
+		m.ackMu.Unlock()
+		return "This alert has expired."
+	}
+
+	if alert.ackedBy != "" {
+		by := alert.ackedBy
+		m.ackMu.Unlock()
+
+		return "Already acknowledged by " + by + "."
+	}
+
+	alert.ackedBy, alert.ackedAt = name, time.Now()
+
+	if alert.timer != nil {
+		alert.timer.Stop()
+	}
+
+	alert.timer = time.AfterFunc(ackRetention, func() { m.forgetAck(id) })
+
+	if !alert.busy {
+		alert.release()
+	}
+
+	copies, text := slices.Clone(alert.copies), alert.ackedText()
+	m.ackMu.Unlock()
+
+	m.Info.Printf("[%s] Alert %s for '%s' acknowledged by %s; editing %d message(s)",
+		reqID, id, alert.event.Name, name, len(copies))
+
+	for _, sent := range copies {
+		m.editAck(reqID, sent, text)
+	}
+
+	return "Acknowledged"
+}
+
+// editAck rewrites one copy of an acknowledged alert: the acknowledgement
+// goes under the text and the Acknowledge button goes away.
+func (m *Messenger) editAck(reqID string, sent ackCopy, text string) {
+	err := sent.backend.editAlert(reqID, sent.chatID, sent.messageID, sent.media, text, sent.rows)
+	if err != nil {
+		m.Error.Printf("[%s] Error editing %s alert for %d: %v", reqID, sent.backend.Name(), sent.chatID, err)
+	}
+}
+
+// forgetAck drops a finished alert.
+func (m *Messenger) forgetAck(id string) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+
+	if alert := m.acks[id]; alert != nil {
+		alert.release()
+		delete(m.acks, id)
+	}
+}
+
+// stopAcks stops every pending escalation and forgets the alerts, for Stop.
+// An alert with a tier still being sent lets go of its files in armAck.
+func (m *Messenger) stopAcks() {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+
+	for id, alert := range m.acks {
+		if alert.timer != nil {
+			alert.timer.Stop()
+		}
+
+		if !alert.busy {
+			alert.release()
+		}
+
+		delete(m.acks, id)
+	}
+}
+
+// ackedText is the alert text with its acknowledgement. Hold ackMu.
+func (a *pendingAck) ackedText() string {
+	note := "✓ Acknowledged by " + a.ackedBy + " at " + a.ackedAt.Format(time.Kitchen)
+
+	return strings.TrimSpace(a.msg + "\n\n" + note)
+}
+
+// release removes the alert's files once nothing will send them again. Hold ackMu.
+func (a *pendingAck) release() {
+	if a.released {
+		return
+	}
+
+	a.released = true
+
+	if a.path != "" {
+		_ = os.Remove(a.path)
+	}
+
+	if a.event.Snapshot != "" {
+		_ = os.Remove(a.event.Snapshot)
+	}
+}
@@ -0,0 +1,420 @@
+package messenger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/subscribe"
+)
+
+// Backend is one chat network. Subscribers are routed to the backend whose Name
+// matches their API field, so a new network only needs a Backend, a config
+// section, and a line in New that registers it.
+type Backend interface {
+	// Name is the subscriber API this backend serves, e.g. "telegram".
+	Name() string
+	// Connect logs in to the network. Start calls it, again after every Stop.
+	Connect() error
+	// Receive hands inbound messages to Chat until stop is closed.
+	Receive(stop <-chan struct{})
+	// SendText sends a plain text message.
+	SendText(reqID string, chatID int64, contact, text string) error
+	// SendKeyboard sends a text message with buttons under it.
+	SendKeyboard(reqID string, chatID int64, contact, text string, rows [][]chat.Button) error
+	// SendFile sends a photo, video, audio file or document. Backends may set
+	// upload.Ref after the first send so later chats get the file by reference.
+	SendFile(upload *Upload, chatID int64, contact string) error
+	// EditMessage replaces the text and buttons of a message sent earlier.
+	EditMessage(reqID string, chatID int64, messageID, contact, text string, rows [][]chat.Button) error
+	// AnswerCallback acknowledges a button press with a short toast.
+	AnswerCallback(reqID, callbackID, toast string) error
+}
+
+// Upload is one local file on its way to one or more chats.
+type Upload struct {
+	ReqID   string
+	Path    string
+	Caption string
+	// Ref is a backend's handle for the file once uploaded (a Telegram file_id).
+	// Each backend only reads refs it set itself; deliver never shares one across APIs.
+	Ref string
+	// Keyboard is buttons to show under the file, for one chat. Backends
+	// without buttons ignore it.
+	Keyboard [][]chat.Button
+}
+
+// EventBackend is a Backend that wants the structured event behind a
+// notification, not just its caption. Delivery uses SendEvent in place of
+// SendText and SendFile for these.
+type EventBackend interface {
+	Backend
+	SendEvent(reqID string, event *Event, msg string, upload *Upload, chatID int64, contact string) error
+}
+
+// AddressBackend is a Backend whose subscribers are added by address (an email
+// address, a topic URL, a user key) rather than by messaging the bot.
+type AddressBackend interface {
+	Backend
+	// Address validates a subscriber address and returns its normal form.
+	Address(address string) (string, error)
+}
+
+// topicBackend is a Backend whose group chats can have forum topics. topic
+// returns a Backend that sends into one of them; edits stay where they are.
+type topicBackend interface {
+	Backend
+	topic(thread int) Backend
+}
+
+// Event describes where a notification came from. It is nil for replies and
+// admin notices.
+type Event struct {
+	Name    string    `json:"event"`             // subscribed event: camera name or catalog event
+	Camera  string    `json:"camera,omitempty"`  // camera the clip or snapshot came from
+	Classes []string  `json:"classes,omitempty"` // motion classes, e.g. motion, human
+	Time    time.Time `json:"timestamp"`
+	// Snapshot is an optional still of a clip alert, shown inline by email.
+	Snapshot string `json:"-"`
+	// Actions puts the alert buttons (snapshot, clip, mute, unsubscribe) under
+	// each chat's copy of a camera alert. CameraNum is the camera they act on.
+	Actions   bool `json:"-"`
+	CameraNum int  `json:"-"`
+	// Alerted, when set, is called with the subscribers the event goes out
+	// to: all of them, or each tier in turn for an alert that needs
+	// acknowledgement, so the caller can start their repeat delay.
+	Alerted func(subs []*subscribe.Subscriber) `json:"-"`
+	// ack is the escalation chain of an alert that needs acknowledgement.
+	ack *pendingAck
+}
+
+// alerted passes the subscribers an event went out to to its Alerted func.
+func (e *Event) alerted(subs []*subscribe.Subscriber) {
+	if e != nil && e.Alerted != nil && len(subs) > 0 {
+		e.Alerted(subs)
+	}
+}
+
+// alertButtons returns the buttons for a subscriber's copy of an event, if any.
+func alertButtons(sub *subscribe.Subscriber, event *Event) [][]chat.Button {
+	if event == nil || !event.Actions {
+		return nil
+	}
+
+	return chat.AlertButtons(sub, event.CameraNum, event.Camera, event.Classes)
+}
+
+// subBackend returns the backend for one subscriber's copy of a notification,
+// aimed at the forum topic the subscriber picked for the event, if any.
+func (m *Messenger) subBackend(b Backend, sub *subscribe.Subscriber, event *Event) Backend {
+	tb, ok := b.(topicBackend)
+	if !ok || event == nil {
+		return b
+	}
+
+	if thread := chat.SubTopic(sub, event.Name, event.Classes); thread != 0 {
+		return tb.topic(thread)
+	}
+
+	return b
+}
+
+// hashID maps a string address (room ID, URL) onto the numeric subscriber ID space.
+func hashID(address string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(address))
+
+	return int64(hash.Sum64() >> 1) //nolint:gosec // shifted into int64 range.
+}
+
+// notifyOnly supplies the Backend methods of a send-only service (webhook,
+// email, push): nothing to log in to, no commands, buttons or edits. Texts and
+// files go through send, the backend's SendEvent.
+type notifyOnly struct {
+	send func(reqID string, event *Event, msg string, upload *Upload, chatID int64, contact string) error
+}
+
+// Connect has nothing to log in to.
+func (notifyOnly) Connect() error {
+	return nil
+}
+
+// Receive returns at once: nobody sends commands back.
+func (notifyOnly) Receive(_ <-chan struct{}) {}
+
+// SendText sends a text-only notification.
+func (n notifyOnly) SendText(reqID string, chatID int64, contact, text string) error {
+	return n.send(reqID, nil, text, nil, chatID, contact)
+}
+
+// SendKeyboard sends the text; there are no buttons.
+func (n notifyOnly) SendKeyboard(reqID string, chatID int64, contact, text string, _ [][]chat.Button) error {
+	return n.send(reqID, nil, text, nil, chatID, contact)
+}
+
+// SendFile sends the file with its caption.
+func (n notifyOnly) SendFile(upload *Upload, chatID int64, contact string) error {
+	return n.send(upload.ReqID, nil, upload.Caption, upload, chatID, contact)
+}
+
+// EditMessage is a no-op: a sent notification cannot be changed.
+func (notifyOnly) EditMessage(_ string, _ int64, _, _, _ string, _ [][]chat.Button) error {
+	return nil
+}
+
+// AnswerCallback is a no-op: there are no buttons.
+func (notifyOnly) AnswerCallback(_, _, _ string) error {
+	return nil
+}
+
+// AddSubscriber creates an authenticated subscriber for an address on an
+// AddressBackend, or returns the existing one (created false). The subscriber
+// ID is derived from the address, so adding it twice finds the same record.
+func (m *Messenger) AddSubscriber(api, address string) (*subscribe.Subscriber, bool, error) {
+	b, ok := m.backend(api).(AddressBackend)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s is not configured", ErrUnknownAPI, api)
+	}
+
+	address, err := b.Address(address)
+	if err != nil {
+		return nil, false, err //nolint:wrapcheck // backends wrap their own errors.
+	}
+
+	id := hashID(address)
+	if sub, err := m.Subs.GetSubscriberByID(id, api); err == nil {
+		return sub, false, nil
+	}
+
+	sub := m.Subs.CreateSubWithID(id, address, api, false, false)
+	chat.SetSubAuthed(sub, true) // an admin or API caller added it; there is no /id here.
+
+	return sub, true, nil
+}
+
+// backend returns the backend that serves a subscriber API, or nil.
+func (m *Messenger) backend(api string) Backend {
+	return m.backends[api]
+}
+
+// Send delivers a text message, or a file with msg as its caption, to one chat
+// on the named backend. A Messenger that was never started sends nothing.
+func (m *Messenger) Send(api, reqID, msg, path string, chatID int64, contact string) error {
+	if m.backends == nil {
+		return nil
+	}
+
+	b := m.backend(api)
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownAPI, api)
+	}
+
+	var upload *Upload
+	if path != "" {
+		upload = &Upload{ReqID: reqID, Path: path, Caption: msg}
+	}
+
+	return m.sendVia(b, reqID, msg, upload, chatID, contact)
+}
+
+// sendVia sends upload when set, otherwise the text message, and logs failures.
+// Sharing one upload across calls lets a backend resend it by reference.
+func (m *Messenger) sendVia(b Backend, reqID, msg string, upload *Upload, chatID int64, contact string) error {
+	if contact == "" {
+		contact = "?"
+	}
+
+	if upload != nil {
+		err := b.SendFile(upload, chatID, contact)
+		if err != nil {
+			m.Error.Printf("[%s] Error Sending %s file to %d:%s: %v", reqID, b.Name(), chatID, contact, err)
+		}
+
+		return err //nolint:wrapcheck // backends wrap their own errors.
+	}
+
+	if msg == "" {
+		return nil
+	}
+
+	err := b.SendText(reqID, chatID, contact, msg)
+	if err != nil {
+		m.Error.Printf("[%s] Error Sending %s message to %d:%s: %v", reqID, b.Name(), chatID, contact, err)
+	}
+
+	return err //nolint:wrapcheck // backends wrap their own errors.
+}
+
+// sendEvent sends one notification, through SendEvent when the backend wants
+// the event and sendVia otherwise.
+func (m *Messenger) sendEvent(
+	b Backend, reqID string, event *Event, msg string, upload *Upload, chatID int64, contact string,
+) error {
+	eb, ok := b.(EventBackend)
+	if !ok {
+		return m.sendVia(b, reqID, msg, upload, chatID, contact)
+	}
+
+	err := eb.SendEvent(reqID, event, msg, upload, chatID, contact)
+	if err != nil {
+		m.Error.Printf("[%s] Error Sending %s notification to %d:%s: %v", reqID, b.Name(), chatID, contact, err)
+	}
+
+	return err //nolint:wrapcheck // backends wrap their own errors.
+}
+
+// inbound is one text message for receiveText.
+type inbound struct {
+	chatID int64
+	name   string // sender, or the group's title: the subscriber's display name
+	user   any    // provider's record for the chat, stored on the subscriber as-is
+	text   string
+	// group is set for group chats. The group is the subscriber; from names the
+	// sender and canEdit says whether they may change the group's subscriptions.
+	group   bool
+	from    string
+	canEdit func() bool
+	thread  int // forum topic the message was posted in
+}
+
+// receiveText runs the shared inbound flow for a text message: record the
+// chat as a subscriber, unlock it with "id <password>", and pass commands
+// from authenticated chats to Chat.
+func (m *Messenger) receiveText(b Backend, in *inbound, password string) {
+	api, chatID, displayName := b.Name(), in.chatID, in.name
+	m.Debug.Printf("%s [%d,%s] %s", api, chatID, displayName, in.text)
+
+	sub, err := m.Subs.GetSubscriberByID(chatID, api)
+	if err != nil {
+		// Every chat we receive a message from gets logged as a subscriber with
+		// no subscriptions. The first person (never a group) becomes admin.
+		admin := !in.group && len(m.Subs.GetAdmins()) == 0
+		sub = m.Subs.CreateSubWithID(chatID, displayName, api, admin, false)
+		chat.SetSubAuthed(sub, false)
+	}
+
+	chat.EnsureSubContact(sub, displayName)
+
+	if in.user != nil {
+		chat.SetSubUser(sub, in.user)
+	}
+
+	if displayName != "" {
+		chat.SetSubDisplayName(sub, displayName)
+	}
+
+	if in.group && !chat.SubGroup(sub) {
+		chat.SetSubGroup(sub, true)
+	}
+
+	text := in.text
+	if password != "" && strings.TrimPrefix(text, "/") == "id "+password {
+		chat.SetSubAuthed(sub, true)
+		sub = m.Subs.CreateSubWithID(chatID, displayName, api, chat.SubAdmin(sub), false)
+		chat.EnsureSubContact(sub, displayName)
+		_ = m.sendVia(b, "none", "You are now authenticated.", nil, chatID, displayName)
+		m.Info.Printf("%s Received from %d:%s (admin:%v, ignored:%v), 'id' command, authenticated.",
+			api, chatID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub))
+
+		return
+	} else if !chat.SubAuthed(sub) {
+		m.Info.Printf("%s Received from %d:%s (admin:%v, ignored:%v), NOT authenticated (ignored), rcvd: %s",
+			api, chatID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub), text)
+
+		return
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+
+	// Pass the message off to the chat command handler routines.
+	handler := &chat.Handler{
+		API:    api,
+		ID:     ReqID(IDLength),
+		Sub:    sub,
+		Text:   fields,
+		From:   displayName,
+		Thread: in.thread,
+	}
+
+	if in.group {
+		handler.From = in.from
+		handler.ReadOnly = in.canEdit == nil || !in.canEdit()
+	}
+
+	m.Info.Printf("[%s] %s Received from %d:%s (admin:%v, ignored:%v), size: %d, cmd: %s",
+		handler.ID, api, chatID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub),
+		len(text), handler.Text[0])
+
+	resp := m.Chat.HandleCommand(handler)
+	m.sendReply(b, chatID, "", "", handler.ID, displayName, resp)
+}
+
+// sendReply renders a chat.Reply on any backend: answer the button press, edit
+// the wizard message in place or send a new one, then send any attached files.
+func (m *Messenger) sendReply(
+	b Backend, chatID int64, messageID, callbackID, reqID, contact string, resp *chat.Reply,
+) {
+	if resp == nil {
+		return
+	}
+
+	if callbackID != "" {
+		err := b.AnswerCallback(reqID, callbackID, resp.Toast)
+		if err != nil {
+			m.Error.Printf("[%s] %s answerCallback: %v", reqID, b.Name(), err)
+		}
+	}
+
+	var err error
+
+	switch {
+	case resp.Edit && messageID != "":
+		err = b.EditMessage(reqID, chatID, messageID, contact, resp.Reply, resp.Keyboard)
+	case resp.Reply != "" && len(resp.Files) == 0 && len(resp.Keyboard) > 0:
+		err = b.SendKeyboard(reqID, chatID, contact, resp.Reply, resp.Keyboard)
+	case resp.Reply != "" && len(resp.Files) == 0:
+		err = b.SendText(reqID, chatID, contact, resp.Reply)
+	}
+
+	if err != nil {
+		m.Error.Printf("[%s] Error Sending %s reply to %d:%s: %v", reqID, b.Name(), chatID, contact, err)
+	}
+
+	m.sendReplyFiles(b, chatID, reqID, contact, resp)
+}
+
+// sendReplyFiles sends command output files. A path listed more than once is
+// uploaded once and resent by reference.
+func (m *Messenger) sendReplyFiles(b Backend, chatID int64, reqID, contact string, resp *chat.Reply) {
+	uploads := make(map[string]*Upload, len(resp.Files))
+
+	for i, path := range resp.Files {
+		caption := resp.Reply
+		if i > 0 {
+			caption = ""
+		}
+
+		upload, ok := uploads[path]
+		if !ok {
+			upload = &Upload{ReqID: reqID, Path: path}
+			uploads[path] = upload
+		}
+
+		upload.Caption = caption
+
+		err := b.SendFile(upload, chatID, contact)
+		if err != nil {
+			m.Error.Printf("[%s] Error Sending %s file to %d:%s: %v", reqID, b.Name(), chatID, contact, err)
+		}
+	}
+
+	for path := range uploads {
+		_ = os.Remove(path) // command-generated temps
+	}
+}
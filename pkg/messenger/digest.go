@@ -0,0 +1,445 @@
+package messenger
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/mosaic"
+	"golift.io/subscribe"
+)
+
+// Digests (see chat.SubDigest). Alerts for a digest subscription are recorded
+// instead of sent. Each subscriber with held alerts has a directory in
+// DigestDir with digest.json and the latest snapshot of each camera, so
+// digests survive restarts. Once a digest is due it goes out as one summary,
+// on a mosaic of the snapshots when there are any.
+const (
+	digestInterval   = time.Minute
+	digestFile       = "digest.json"
+	digestSending    = ".sending" // suffix of a digest directory while it goes out
+	digestMaxEntries = 500        // more are counted, not listed.
+	digestMaxTimes   = 6          // times listed per line
+	digestMaxTiles   = 9
+	digestQuality    = 85
+)
+
+// pendingDigest is one subscriber's held alerts.
+type pendingDigest struct {
+	API     string        `json:"api"`
+	ID      int64         `json:"id"`
+	Since   time.Time     `json:"since"`
+	Due     time.Time     `json:"due"`
+	Entries []digestEntry `json:"entries"`
+	Dropped int           `json:"dropped,omitempty"`
+	// Snapshots are file names in the digest directory, by camera.
+	Snapshots map[string]string `json:"snapshots,omitempty"`
+	dir       string
+}
+
+// digestEntry is one held alert.
+type digestEntry struct {
+	Time   time.Time `json:"time"`
+	Label  string    `json:"label"` // see chat.DigestLabel
+	Camera string    `json:"camera,omitempty"`
+}
+
+// RecordDigest holds an alert for the digests of subs, with a copy of the
+// event's snapshot; the caller still owns the snapshot. It returns the
+// subscribers it could not record, who should get the alert now.
+func (m *Messenger) RecordDigest(reqID string, event *Event, subs []*subscribe.Subscriber) []*subscribe.Subscriber {
+	if m.DigestDir == "" || event == nil {
+		return subs
+	}
+
+	m.digestMu.Lock()
+	defer m.digestMu.Unlock()
+
+	var failed []*subscribe.Subscriber
+
+	for _, sub := range subs {
+		err := m.recordDigest(event, sub)
+		if err != nil {
+			m.Error.Printf("[%s] Recording '%s' for the digest of %d: %v", reqID, event.Name, sub.ID, err)
+			failed = append(failed, sub)
+		}
+	}
+
+	if recorded := len(subs) - len(failed); recorded > 0 {
+		m.Debug.Printf("[%s] Recorded '%s' for %d digest(s)", reqID, event.Name, recorded)
+	}
+
+	return failed
+}
+
+// recordDigest adds one alert to a subscriber's digest. Hold digestMu.
+func (m *Messenger) recordDigest(event *Event, sub *subscribe.Subscriber) error {
+	now := time.Now()
+	due := now.Add(chat.SubDigest(sub, event.Name, event.Classes))
+	dir := filepath.Join(m.DigestDir, fmt.Sprintf("%s-%d", sub.API, sub.ID))
+
+	digest, err := loadDigest(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		digest = &pendingDigest{API: sub.API, ID: sub.ID, Since: now, Due: due, dir: dir}
+		err = os.MkdirAll(dir, spoolDirMode)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if due.Before(digest.Due) {
+		digest.Due = due // the interval got shorter.
+	}
+
+	if len(digest.Entries) < digestMaxEntries {
+		label := chat.DigestLabel(event.Name, event.Classes)
+		digest.Entries = append(digest.Entries, digestEntry{Time: now, Label: label, Camera: event.Camera})
+	} else {
+		digest.Dropped++
+	}
+
+	if event.Snapshot != "" && event.Camera != "" {
+		file := "snapshot-" + safeFileName(event.Camera) + ".jpg"
+		if copyFile(event.Snapshot, filepath.Join(dir, file)) == nil {
+			if digest.Snapshots == nil {
+				digest.Snapshots = make(map[string]string)
+			}
+
+			digest.Snapshots[event.Camera] = file // the latest one wins.
+		}
+	}
+
+	return digest.save()
+}
+
+// runDigests sends digests as they come due, until Stop. Digests that came
+// due while Motifini was down go out at once.
+func (m *Messenger) runDigests() {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+
+	m.flushDigests()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.flushDigests()
+		case <-m.stopall:
+			return
+		}
+	}
+}
+
+// flushDigests sends every digest that is due, and any left half sent when
+// Motifini stopped.
+func (m *Messenger) flushDigests() {
+	m.digestFlushMu.Lock()
+	defer m.digestFlushMu.Unlock()
+
+	dirs, err := os.ReadDir(m.DigestDir)
+	if err != nil {
+		m.Error.Printf("Reading digests: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		m.digestMu.Lock()
+
+		digest, err := loadDigest(filepath.Join(m.DigestDir, dir.Name()))
+		if err != nil || now.Before(digest.Due) {
+			m.digestMu.Unlock()
+			continue
+		}
+
+		if strings.HasSuffix(digest.dir, digestSending) {
+			m.digestMu.Unlock()
+			m.sendDigest(digest, now) // taken by an earlier run that never finished.
+
+			continue
+		}
+
+		// Later alerts start a new digest while this one is out.
+		taken := digest.dir + digestSending
+		err = os.Rename(digest.dir, taken)
+		m.digestMu.Unlock()
+
+		if err != nil {
+			m.Error.Printf("Sending digest %s: %v", dir.Name(), err)
+			continue
+		}
+
+		digest.dir = taken
+		m.sendDigest(digest, now)
+	}
+}
+
+// sendDigest delivers one digest. A digest the backend may take later goes
+// back in the queue; otherwise it is done with.
+func (m *Messenger) sendDigest(digest *pendingDigest, now time.Time) {
+	defer os.RemoveAll(digest.dir)
+
+	reqID := ReqID(IDLength)
+
+	sub, err := m.Subs.GetSubscriberByID(digest.ID, digest.API)
+	if err != nil || chat.SubIgnored(sub) {
+		return // deleted or ignored since.
+	}
+
+	text := digest.summary(now)
+	path := m.digestMosaic(reqID, digest)
+
+	if path != "" {
+		defer os.Remove(path)
+	}
+
+	subs := []*subscribe.Subscriber{sub}
+
+	// Long summaries do not fit a photo caption: the text goes first, then the
+	// mosaic. Once the text is out the digest is done; it is not sent twice
+	// for the sake of the snapshots.
+	if path != "" && len([]rune(text)) > telegramCaptionMaxLen {
+		delivery := m.deliver(reqID, nil, text, "", subs)
+		if len(delivery.retry) > 0 {
+			m.requeueDigest(digest, now)
+			return
+		}
+
+		if delivery.Sent > 0 && m.deliver(reqID, nil, "Digest snapshots", path, subs).Sent == 0 {
+			m.Error.Printf("[%s] Digest snapshots for %d:%s were not sent", reqID, sub.ID, chat.SubContact(sub))
+		}
+	} else if delivery := m.deliver(reqID, nil, text, path, subs); len(delivery.retry) > 0 {
+		m.requeueDigest(digest, now)
+		return
+	}
+
+	m.Info.Printf("[%s] Sent digest of %d alert(s) to %d:%s", reqID,
+		len(digest.Entries)+digest.Dropped, sub.ID, chat.SubContact(sub))
+}
+
+// requeueDigest puts a digest that could not go out back, merged with any
+// alerts recorded since, to try again after a while.
+func (m *Messenger) requeueDigest(digest *pendingDigest, now time.Time) {
+	m.digestMu.Lock()
+	defer m.digestMu.Unlock()
+
+	dir := strings.TrimSuffix(digest.dir, digestSending)
+
+	if later, err := loadDigest(dir); err == nil {
+		digest.Entries = append(digest.Entries, later.Entries...)
+		digest.Dropped += later.Dropped
+
+		if digest.Snapshots == nil {
+			digest.Snapshots = make(map[string]string)
+		}
+
+		for camera, file := range later.Snapshots {
+			_ = moveFile(filepath.Join(dir, file), filepath.Join(digest.dir, file))
+			digest.Snapshots[camera] = file
+		}
+	}
+
+	digest.Due = now.Add(spoolBackoffMin)
+
+	err := digest.save()
+	if err == nil {
+		_ = os.RemoveAll(dir)
+		err = os.Rename(digest.dir, dir)
+	}
+
+	if err != nil {
+		m.Error.Printf("Requeueing digest for %d: %v", digest.ID, err)
+	}
+}
+
+// summary lists a digest's alerts: a count per camera class or event, busiest
+// first, with the times they happened.
+func (d *pendingDigest) summary(now time.Time) string {
+	groups := make(map[string][]time.Time)
+	for _, entry := range d.Entries {
+		groups[entry.Label] = append(groups[entry.Label], entry.Time)
+	}
+
+	labels := make([]string, 0, len(groups))
+	for label := range groups {
+		labels = append(labels, label)
+	}
+
+	slices.SortFunc(labels, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(groups[b]), len(groups[a])), strings.Compare(a, b))
+	})
+
+	layout := "15:04"
+	if d.Since.YearDay() != now.YearDay() {
+		layout = "Mon 15:04"
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "🗒 Digest: %d alert(s) since %s", len(d.Entries)+d.Dropped, d.Since.Format(layout))
+
+	for _, label := range labels {
+		times := groups[label]
+		shown := make([]string, 0, digestMaxTimes)
+
+		for _, at := range times[:min(len(times), digestMaxTimes)] {
+			shown = append(shown, at.Format(layout))
+		}
+
+		fmt.Fprintf(&msg, "\n• %s — %d (%s", label, len(times), strings.Join(shown, ", "))
+
+		if more := len(times) - len(shown); more > 0 {
+			fmt.Fprintf(&msg, ", +%d more", more)
+		}
+
+		msg.WriteString(")")
+	}
+
+	if d.Dropped > 0 {
+		fmt.Fprintf(&msg, "\n…and %d more not listed.", d.Dropped)
+	}
+
+	return msg.String()
+}
+
+// digestMosaic composes a digest's snapshots into one JPEG in TempDir, busiest
+// cameras first. It returns "" when there are none.
+func (m *Messenger) digestMosaic(reqID string, digest *pendingDigest) string {
+	counts := make(map[string]int)
+	for _, entry := range digest.Entries {
+		counts[entry.Camera]++
+	}
+
+	cameras := make([]string, 0, len(digest.Snapshots))
+	for camera := range digest.Snapshots {
+		cameras = append(cameras, camera)
+	}
+
+	slices.SortFunc(cameras, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), strings.Compare(a, b))
+	})
+
+	tiles := make([]mosaic.Tile, 0, digestMaxTiles)
+
+	for _, camera := range cameras[:min(len(cameras), digestMaxTiles)] {
+		img, err := readJPEG(filepath.Join(digest.dir, digest.Snapshots[camera]))
+		if err != nil {
+			m.Debug.Printf("[%s] Digest snapshot for %s: %v", reqID, camera, err)
+			continue
+		}
+
+		tiles = append(tiles, mosaic.Tile{Label: fmt.Sprintf("%s (%d)", camera, counts[camera]), Image: img})
+	}
+
+	if len(tiles) == 0 {
+		return ""
+	}
+
+	path := filepath.Join(m.TempDir, "motifini_digest_"+reqID+".jpg")
+
+	err := writeDigestJPEG(path, mosaic.Compose(tiles, mosaic.DefaultWidth))
+	if err != nil {
+		m.Error.Printf("[%s] Digest mosaic: %v", reqID, err)
+		return ""
+	}
+
+	return path
+}
+
+func readJPEG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	return img, nil
+}
+
+func writeDigestJPEG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating mosaic: %w", err)
+	}
+
+	err = jpeg.Encode(file, img, &jpeg.Options{Quality: digestQuality})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("encoding mosaic: %w", err)
+	}
+
+	return nil
+}
+
+// safeFileName keeps letters and digits of a camera name for a file name.
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
+
+func loadDigest(dir string) (*pendingDigest, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, digestFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading digest: %w", err)
+	}
+
+	digest := &pendingDigest{dir: dir}
+
+	err = json.Unmarshal(buf, digest)
+	if err != nil {
+		return nil, fmt.Errorf("decoding digest: %w", err)
+	}
+
+	return digest, nil
+}
+
+// save writes digest.json through a temp file so a crash never leaves half a digest.
+func (d *pendingDigest) save() error {
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding digest: %w", err)
+	}
+
+	tmp := filepath.Join(d.dir, digestFile+".tmp")
+
+	err = os.WriteFile(tmp, buf, spoolFileMode)
+	if err != nil {
+		return fmt.Errorf("writing digest: %w", err)
+	}
+
+	err = os.Rename(tmp, filepath.Join(d.dir, digestFile))
+	if err != nil {
+		return fmt.Errorf("writing digest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golift.io/subscribe"
+)
+
+// errFlood is a send error worth retrying; errBlocked is one that is not.
+var (
+	errFlood   = &tgbotapi.Error{Code: http.StatusTooManyRequests, Message: "Too Many Requests"}
+	errBlocked = &tgbotapi.Error{Code: http.StatusForbidden, Message: "Forbidden: bot was blocked by the user"}
+)
+
+// newDigestMessenger returns a stub messenger keeping digests in a temp dir,
+// with one subscriber who gets Porch alerts in an hourly digest.
+func newDigestMessenger(t *testing.T, backend *stubBackend) (*Messenger, *subscribe.Subscriber) {
+	t.Helper()
+
+	m, subs := newStubMessenger(t, backend, "ann")
+	m.DigestDir = t.TempDir()
+	m.TempDir = t.TempDir()
+
+	_ = subs[0].Subscribe("Porch")
+	chat.SetSubDigest(subs[0], "Porch", time.Hour)
+
+	return m, subs[0]
+}
+
+// digestSnapshot writes a small JPEG and returns its path.
+func digestSnapshot(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "still.jpg")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, 16, 9)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// recordPorch holds one Porch alert, with a snapshot when snapshot is set.
+func recordPorch(t *testing.T, m *Messenger, sub *subscribe.Subscriber, snapshot string) {
+	t.Helper()
+
+	event := &Event{Name: "Porch", Camera: "Porch", Classes: []string{chat.ClassMotion}, Snapshot: snapshot}
+	if failed := m.RecordDigest("req", event, []*subscribe.Subscriber{sub}); len(failed) != 0 {
+		t.Fatal("alert was not recorded")
+	}
+}
+
+// makeDue moves a subscriber's digest due time into the past.
+func makeDue(t *testing.T, m *Messenger, sub *subscribe.Subscriber) {
+	t.Helper()
+
+	digest, err := loadDigest(filepath.Join(m.DigestDir, fmt.Sprintf("%s-%d", sub.API, sub.ID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest.Due = time.Now().Add(-time.Second)
+
+	if err := digest.save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func digestDirs(t *testing.T, m *Messenger) []string {
+	t.Helper()
+
+	dirs, err := os.ReadDir(m.DigestDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		names = append(names, dir.Name())
+	}
+
+	return names
+}
+
+// A digest is kept on disk until it is due, survives a restart, and then goes
+// out once as a summary on a mosaic of the snapshots.
+func TestDigestRecordAndFlush(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{}
+	m, sub := newDigestMessenger(t, backend)
+	snapshot := digestSnapshot(t)
+
+	recordPorch(t, m, sub, snapshot)
+	recordPorch(t, m, sub, "")
+
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Fatalf("the caller's snapshot was taken: %v", err)
+	}
+
+	m.flushDigests()
+
+	if texts, _ := backend.sent(); len(texts) != 0 {
+		t.Fatalf("sent before it was due: %q", texts)
+	}
+
+	// A restart: a new messenger on the same directory.
+	restarted := &Messenger{
+		Info: m.Info, Debug: m.Debug, Error: m.Error, Subs: m.Subs, backends: m.backends,
+		DigestDir: m.DigestDir, TempDir: m.TempDir,
+	}
+
+	makeDue(t, restarted, sub)
+	restarted.flushDigests()
+	restarted.flushDigests()
+
+	texts, files := backend.sent()
+	if len(texts) != 1 || !strings.Contains(texts[0], "2 alert(s)") || files[0] == "" {
+		t.Fatalf("sent %q with %q", texts, files)
+	}
+
+	if left := digestDirs(t, m); len(left) != 0 {
+		t.Fatalf("sent digest left behind: %v", left)
+	}
+}
+
+// A digest that fails for a passing reason goes back in the queue, merged
+// with alerts recorded while it was out, and is sent once later.
+func TestDigestRequeue(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{}
+	m, sub := newDigestMessenger(t, backend)
+	backend.fail = func(string, string) error {
+		recordPorch(t, m, sub, "") // arrives while the digest is being sent.
+		return errFlood
+	}
+
+	recordPorch(t, m, sub, "")
+	makeDue(t, m, sub)
+	m.flushDigests()
+
+	digest, err := loadDigest(filepath.Join(m.DigestDir, "stub-1"))
+	if err != nil {
+		t.Fatalf("digest not requeued: %v (%v)", err, digestDirs(t, m))
+	}
+
+	if len(digest.Entries) != 2 || time.Until(digest.Due) > spoolBackoffMin {
+		t.Fatalf("requeued: %d entries, due %v", len(digest.Entries), digest.Due)
+	}
+
+	backend.fail = nil
+
+	makeDue(t, m, sub)
+	m.flushDigests()
+
+	if texts, _ := backend.sent(); len(texts) != 1 || !strings.Contains(texts[0], "2 alert(s)") {
+		t.Fatalf("sent %q", texts)
+	}
+}
+
+// A digest the backend refuses for good is dropped, not retried.
+func TestDigestPermanentFailure(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{fail: func(string, string) error { return errBlocked }}
+	m, sub := newDigestMessenger(t, backend)
+
+	recordPorch(t, m, sub, digestSnapshot(t))
+	makeDue(t, m, sub)
+	m.flushDigests()
+
+	if left := digestDirs(t, m); len(left) != 0 {
+		t.Fatalf("refused digest kept: %v", left)
+	}
+}
+
+// A summary too long for a caption goes out as text, then the mosaic. When
+// only the mosaic fails the text is not sent again.
+func TestDigestLongSummaryMosaicFails(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{fail: func(_, file string) error {
+		if file != "" {
+			return errFlood
+		}
+
+		return nil
+	}}
+	m, sub := newDigestMessenger(t, backend)
+
+	dir := filepath.Join(m.DigestDir, "stub-1")
+	digest := &pendingDigest{
+		API: apiStub, ID: sub.ID, Since: time.Now(), Due: time.Now().Add(-time.Second),
+		Snapshots: map[string]string{"Porch": "snapshot-Porch.jpg"}, dir: dir,
+	}
+
+	for i := range 80 {
+		digest.Entries = append(digest.Entries, digestEntry{
+			Time: time.Now(), Label: fmt.Sprintf("Camera %02d motion", i), Camera: "Porch",
+		})
+	}
+
+	if err := os.MkdirAll(dir, spoolDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(digestSnapshot(t), filepath.Join(dir, "snapshot-Porch.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := digest.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len([]rune(digest.summary(time.Now()))) <= telegramCaptionMaxLen {
+		t.Fatal("summary fits a caption; the test needs a longer one")
+	}
+
+	m.flushDigests()
+	m.flushDigests()
+
+	texts, files := backend.sent()
+	if len(texts) != 1 || files[0] != "" || !strings.HasPrefix(texts[0], "🗒 Digest: 80 alert(s)") {
+		t.Fatalf("sent %q with %q", texts, files)
+	}
+
+	if left := digestDirs(t, m); len(left) != 0 {
+		t.Fatalf("digest requeued after its text went out: %v", left)
+	}
+}
+
+// A digest left half sent by a crash goes out on the next flush.
+func TestDigestLeftSending(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{}
+	m, sub := newDigestMessenger(t, backend)
+
+	recordPorch(t, m, sub, "")
+	makeDue(t, m, sub)
+
+	dir := filepath.Join(m.DigestDir, "stub-1")
+	if err := os.Rename(dir, dir+digestSending); err != nil {
+		t.Fatal(err)
+	}
+
+	m.flushDigests()
+
+	if texts, _ := backend.sent(); len(texts) != 1 {
+		t.Fatalf("sent %q", texts)
+	}
+
+	if _, err := os.Stat(dir + digestSending); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("half-sent digest left behind: %v", err)
+	}
+}
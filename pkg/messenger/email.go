@@ -0,0 +1,460 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Email defaults.
+const (
+	DefaultEmailMaxAttachment = 10 * mebibyte
+	EmailSecuritySTARTTLS     = "starttls"
+	EmailSecurityTLS          = "tls"
+	EmailSecurityNone         = "none"
+)
+
+const (
+	emailTimeout    = time.Minute
+	emailLineLength = 76 // base64 line length from RFC 2045
+	emailSubjectMax = 78
+	emailSnapshotID = "snapshot@motifini"
+)
+
+// ErrEmailConfig is returned when the [email] section is missing a required value.
+var ErrEmailConfig = errors.New("email host and from are required; security must be starttls, tls or none")
+
+// ErrEmailAddress is returned for an email subscriber whose contact is not an address.
+var ErrEmailAddress = errors.New("not a valid email address")
+
+// EmailConfig is the SMTP settings from the config file.
+type EmailConfig struct {
+	Host string `toml:"host"`
+	// Port defaults to 587 for starttls, 465 for tls and 25 for none.
+	Port int `toml:"port"`
+	// Security is starttls (default), tls (implicit TLS) or none.
+	Security string `toml:"security"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// From is the sender, e.g. "Motifini <cameras@example.org>".
+	From string `toml:"from"`
+	// MaxAttachment is the largest clip attached, in bytes. Bigger clips are
+	// mentioned in the mail but left out.
+	MaxAttachment int `toml:"max_attachment"`
+}
+
+// emailBackend mails notifications to email subscribers: the subscriber's
+// contact is the address. Camera alerts are HTML with the snapshot inline and
+// the clip attached; text-only events are plain text. Email is send-only.
+type emailBackend struct {
+	*Messenger
+	notifyOnly
+
+	config *EmailConfig
+	from   *mail.Address
+}
+
+func newEmailBackend(m *Messenger, config *EmailConfig) *emailBackend {
+	e := &emailBackend{Messenger: m, config: config}
+	e.notifyOnly = notifyOnly{send: e.SendEvent}
+
+	return e
+}
+
+// EmailID is the subscriber ID for an email address.
+func EmailID(address string) int64 {
+	return hashID(strings.ToLower(address))
+}
+
+// Address checks an email subscriber's address and lowercases it.
+func (e *emailBackend) Address(address string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrEmailAddress, address)
+	}
+
+	return strings.ToLower(parsed.Address), nil
+}
+
+// Name is the subscriber API served by this backend.
+func (e *emailBackend) Name() string {
+	return APIEmail
+}
+
+// Connect checks the config and fills in defaults. The SMTP server is only
+// contacted when there is something to send.
+func (e *emailBackend) Connect() error {
+	if e.config.Security == "" {
+		e.config.Security = EmailSecuritySTARTTLS
+	}
+
+	if e.config.MaxAttachment <= 0 {
+		e.config.MaxAttachment = DefaultEmailMaxAttachment
+	}
+
+	if e.config.Port == 0 {
+		switch e.config.Security {
+		case EmailSecurityTLS:
+			e.config.Port = 465 //nolint:mnd // SMTPS.
+		case EmailSecurityNone:
+			e.config.Port = 25 //nolint:mnd // SMTP.
+		default:
+			e.config.Port = 587 //nolint:mnd // submission.
+		}
+	}
+
+	switch e.config.Security {
+	case EmailSecuritySTARTTLS, EmailSecurityTLS, EmailSecurityNone:
+	default:
+		return ErrEmailConfig
+	}
+
+	from, err := mail.ParseAddress(e.config.From)
+	if err != nil || e.config.Host == "" {
+		return ErrEmailConfig
+	}
+
+	e.from = from
+	e.Info.Printf("Email notifications via %s:%d (%s) from %s",
+		e.config.Host, e.config.Port, e.config.Security, from.Address)
+
+	return nil
+}
+
+// SendEvent mails one notification to the address in contact.
+func (e *emailBackend) SendEvent(
+	reqID string, event *Event, msg string, upload *Upload, chatID int64, contact string,
+) error {
+	to, err := mail.ParseAddress(contact)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrEmailAddress, contact)
+	}
+
+	body, err := e.message(reqID, event, msg, upload, to)
+	if err != nil {
+		return err
+	}
+
+	err = e.send(to.Address, body)
+	if err != nil {
+		return err
+	}
+
+	e.Info.Printf("[%s] Email: sent %.2fMb to %d:%s", reqID, float64(len(body))/mebibyte, chatID, to.Address)
+
+	return nil
+}
+
+// message builds the RFC 5322 mail: plain text without media, otherwise HTML
+// with an image shown inline and other files (clips) attached.
+func (e *emailBackend) message(
+	reqID string, event *Event, msg string, upload *Upload, to *mail.Address,
+) ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", e.from.String())
+	header.Set("To", to.String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", emailSubject(event, msg)))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-Id", fmt.Sprintf("<%d.%s@motifini>", time.Now().UnixNano(), reqID))
+	header.Set("Mime-Version", "1.0")
+
+	if upload == nil {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+
+		qp := quotedprintable.NewWriter(&buf)
+		_, _ = qp.Write([]byte(msg + "\n"))
+		_ = qp.Close() // writing to memory.
+
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	writeHeader(&buf, header)
+
+	inline, attach, note, err := e.mediaParts(event, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeRelated(mixed, emailHTML(event, msg, note, inline != ""), inline)
+	if err == nil && attach != "" {
+		err = writeFilePart(mixed, attach, "attachment", "")
+	}
+
+	if err == nil {
+		err = mixed.Close()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("building email: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mediaParts decides which file is shown inline (an image, or the alert's
+// snapshot) and which is attached (a clip under MaxAttachment).
+func (e *emailBackend) mediaParts(event *Event, upload *Upload) (string, string, string, error) {
+	info, err := os.Stat(upload.Path)
+	if err != nil {
+		return "", "", "", fmt.Errorf("reading file: %w", err)
+	}
+
+	if strings.HasPrefix(mime.TypeByExtension(filepath.Ext(upload.Path)), "image/") {
+		return upload.Path, "", "", nil
+	}
+
+	inline := ""
+	if event != nil && event.Snapshot != "" {
+		inline = event.Snapshot
+	}
+
+	if info.Size() > int64(e.config.MaxAttachment) {
+		return inline, "", fmt.Sprintf("The clip (%.1f MB) is over the %.1f MB attachment limit and was not attached.",
+			float64(info.Size())/mebibyte, float64(e.config.MaxAttachment)/mebibyte), nil
+	}
+
+	return inline, upload.Path, "", nil
+}
+
+// send delivers one message over SMTP.
+func (e *emailBackend) send(to string, body []byte) error {
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	tlsConfig := &tls.Config{ServerName: e.config.Host, MinVersion: tls.VersionTLS12}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if e.config.Security == EmailSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("connecting to smtp server: %w", err)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer client.Close()
+
+	if e.config.Security == EmailSecuritySTARTTLS {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if e.config.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err = client.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+
+	if err = client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+
+	if _, err = data.Write(body); err == nil {
+		err = data.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+
+	_ = client.Quit()
+
+	return nil
+}
+
+// emailSubject is the caption, or the first line of a text message.
+func emailSubject(event *Event, msg string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	if subject == "" && event != nil {
+		subject = event.Name
+	}
+
+	subject = "Motifini: " + subject
+	if runes := []rune(subject); len(runes) > emailSubjectMax {
+		subject = string(runes[:emailSubjectMax-1]) + "…"
+	}
+
+	return subject
+}
+
+// emailHTML is the HTML body for a media notification.
+func emailHTML(event *Event, msg, note string, inline bool) string {
+	var body strings.Builder
+
+	body.WriteString("<!DOCTYPE html><html><body style=\"font-family: sans-serif\">\n")
+	fmt.Fprintf(&body, "<p><b>%s</b></p>\n", strings.ReplaceAll(html.EscapeString(msg), "\n", "<br>"))
+
+	if inline {
+		fmt.Fprintf(&body, "<p><img src=\"cid:%s\" alt=\"snapshot\" style=\"max-width: 100%%\"></p>\n", emailSnapshotID)
+	}
+
+	if event != nil && !event.Time.IsZero() {
+		fmt.Fprintf(&body, "<p>%s", html.EscapeString(event.Time.Format("Mon Jan 2 15:04:05")))
+
+		if event.Camera != "" {
+			fmt.Fprintf(&body, " · %s", html.EscapeString(event.Camera))
+		}
+
+		if len(event.Classes) > 0 {
+			fmt.Fprintf(&body, " · %s", html.EscapeString(strings.Join(event.Classes, ", ")))
+		}
+
+		body.WriteString("</p>\n")
+	}
+
+	if note != "" {
+		fmt.Fprintf(&body, "<p><i>%s</i></p>\n", html.EscapeString(note))
+	}
+
+	body.WriteString("</body></html>\n")
+
+	return body.String()
+}
+
+// writeRelated adds the HTML body to the mail, wrapped with its inline image
+// in multipart/related when there is one.
+func writeRelated(mixed *multipart.Writer, body, inline string) error {
+	if inline == "" {
+		return writeHTMLPart(mixed, body)
+	}
+
+	var buf bytes.Buffer
+
+	related := multipart.NewWriter(&buf)
+
+	err := writeHTMLPart(related, body)
+	if err == nil {
+		err = writeFilePart(related, inline, "inline", emailSnapshotID)
+	}
+
+	if err == nil {
+		err = related.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + related.Boundary()},
+	})
+	if err != nil {
+		return fmt.Errorf("creating part: %w", err)
+	}
+
+	_, err = part.Write(buf.Bytes())
+
+	return err //nolint:wrapcheck // writing to memory.
+}
+
+func writeHTMLPart(form *multipart.Writer, body string) error {
+	part, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return fmt.Errorf("creating part: %w", err)
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	_, _ = qp.Write([]byte(body))
+
+	return qp.Close() //nolint:wrapcheck // writing to memory.
+}
+
+// writeFilePart adds a base64 file part; contentID makes it referable from the HTML.
+func writeFilePart(form *multipart.Writer, path, disposition, contentID string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	name := filepath.Base(path)
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {mimeType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType(disposition, map[string]string{"filename": name})},
+	}
+
+	if contentID != "" {
+		header.Set("Content-Id", "<"+contentID+">")
+	}
+
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("creating part: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > emailLineLength {
+		_, _ = io.WriteString(part, encoded[:emailLineLength]+"\r\n")
+		encoded = encoded[emailLineLength:]
+	}
+
+	_, err = io.WriteString(part, encoded+"\r\n")
+
+	return err //nolint:wrapcheck // writing to memory.
+}
+
+// writeHeader writes mail headers in a stable order, then the blank line.
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{
+		"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+	} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+
+	buf.WriteString("\r\n")
+}
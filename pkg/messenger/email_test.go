@@ -0,0 +1,150 @@
+package messenger
+
+import (
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEmail(t *testing.T, maxAttachment int) *emailBackend {
+	t.Helper()
+
+	discard := log.New(io.Discard, "", 0)
+	backend := newEmailBackend(&Messenger{Info: discard, Debug: discard, Error: discard}, &EmailConfig{
+		Host: "smtp.example.org", From: "Motifini <cameras@example.org>", MaxAttachment: maxAttachment,
+	})
+
+	err := backend.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	return backend
+}
+
+// parseEmail returns the top-level content type and each leaf part's
+// content type and disposition, walking nested multiparts.
+func parseEmail(t *testing.T, body []byte) (string, []string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+
+	var (
+		leaves []string
+		walk   func(contentType string, body io.Reader)
+	)
+
+	walk = func(contentType string, body io.Reader) {
+		mediaType, params, _ := mime.ParseMediaType(contentType)
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			leaves = append(leaves, mediaType)
+			return
+		}
+
+		reader := multipart.NewReader(body, params["boundary"])
+
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				return
+			}
+
+			disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			if disposition != "" {
+				leaves = append(leaves, disposition+":"+part.Header.Get("Content-Type"))
+				continue
+			}
+
+			walk(part.Header.Get("Content-Type"), part)
+		}
+	}
+
+	contentType := msg.Header.Get("Content-Type")
+	walk(contentType, msg.Body)
+
+	return contentType, leaves
+}
+
+func writeTestFile(t *testing.T, name string, size int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestEmailMessageLayout(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestEmail(t, 1024)
+	to := &mail.Address{Address: "grandma@example.org"}
+	event := &Event{
+		Name: "Porch", Camera: "Porch", Classes: []string{"human"}, Time: time.Now(),
+		Snapshot: writeTestFile(t, "Porch.jpg", 10),
+	}
+
+	// System events are plain text.
+	body, err := backend.message("req", nil, "Camera Offline: Garage", nil, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType, _ := parseEmail(t, body); !strings.HasPrefix(contentType, "text/plain") {
+		t.Fatalf("text event content type: %s", contentType)
+	}
+
+	// A clip under the cap: HTML with the snapshot inline, clip attached.
+	upload := &Upload{Path: writeTestFile(t, "Porch.mp4", 512)}
+
+	body, err = backend.message("req", event, "Porch (human)", upload, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, leaves := parseEmail(t, body)
+	if got := strings.Join(leaves, ","); got != "text/html,inline:image/jpeg,attachment:video/mp4" {
+		t.Fatalf("clip parts: %s", got)
+	}
+
+	// Over the cap the clip is left out and the mail says so.
+	upload = &Upload{Path: writeTestFile(t, "Porch.mp4", 2048)}
+
+	body, err = backend.message("req", event, "Porch (human)", upload, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, leaves = parseEmail(t, body)
+	if got := strings.Join(leaves, ","); got != "text/html,inline:image/jpeg" ||
+		!strings.Contains(string(body), "attachment limit") {
+		t.Fatalf("oversized clip parts: %s", got)
+	}
+
+	// A snapshot notification shows the photo itself inline.
+	upload = &Upload{Path: writeTestFile(t, "Garage.jpg", 10)}
+
+	body, err = backend.message("req", &Event{Name: "garage_opened"}, "Garage door", upload, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, leaves = parseEmail(t, body)
+	if got := strings.Join(leaves, ","); got != "text/html,inline:image/jpeg" {
+		t.Fatalf("photo parts: %s", got)
+	}
+}
@@ -0,0 +1,620 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+)
+
+// Matrix client-server API tuning.
+const (
+	matrixSyncTimeout = 30 * time.Second
+	matrixHTTPTimeout = 2 * time.Minute // uploads and long-poll syncs
+	matrixRetryWait   = 5 * time.Second
+	matrixRetries     = 3
+	matrixMaxWait     = time.Minute
+	matrixRoomQueue   = 16 // messages waiting for one room's worker
+)
+
+// ErrMatrixConfig is returned when the [matrix] section is missing a required value.
+var ErrMatrixConfig = errors.New("matrix homeserver and access_token are required")
+
+// MatrixConfig is the Matrix bot settings from the config file.
+type MatrixConfig struct {
+	Homeserver  string `toml:"homeserver"`
+	AccessToken string `toml:"access_token"`
+	Pass        string `toml:"password"`
+	Debug       bool   `toml:"debug"`
+}
+
+// matrixBackend talks to a Matrix homeserver as a bot account. Each subscriber
+// is one room; the room ID is kept on the subscriber (chat.SubRoute) and the
+// subscriber ID is a stable hash of it. Matrix has no inline buttons, so a
+// keyboard becomes a numbered list and a reply with just a number presses it.
+type matrixBackend struct {
+	*Messenger
+
+	config *MatrixConfig
+	client *http.Client
+	userID string
+	since  string
+	txn    atomic.Int64
+	mu     sync.Mutex
+	rooms  map[int64]string       // subscriber ID -> room ID, learned on receive
+	menus  map[string]*matrixMenu // room ID -> last keyboard shown there
+}
+
+// matrixMenu is a keyboard rendered as numbered options in a room.
+type matrixMenu struct {
+	eventID string   // message holding the options; edits replace it
+	data    []string // callback data by option number - 1
+}
+
+// matrixError is an error response from the homeserver.
+type matrixError struct {
+	Status     int
+	ErrCode    string `json:"errcode"`
+	Message    string `json:"error"`
+	RetryAfter int64  `json:"retry_after_ms"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("matrix %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+// HTTPStatus lets the spool tell rate limits and server errors from refusals.
+func (e *matrixError) HTTPStatus() int {
+	return e.Status
+}
+
+// matrixEvent is the part of a room event the bot reads.
+type matrixEvent struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+// matrixSync is the part of a /sync response the bot reads.
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+func newMatrixBackend(m *Messenger, config *MatrixConfig) *matrixBackend {
+	return &matrixBackend{
+		Messenger: m,
+		config:    config,
+		client:    &http.Client{Timeout: matrixHTTPTimeout},
+		rooms:     make(map[int64]string),
+		menus:     make(map[string]*matrixMenu),
+	}
+}
+
+// matrixChatID maps a room ID onto the numeric subscriber ID space.
+func matrixChatID(roomID string) int64 {
+	return hashID(roomID)
+}
+
+// Name is the subscriber API served by this backend.
+func (x *matrixBackend) Name() string {
+	return APIMatrix
+}
+
+// Connect checks the access token and skips the room history, so commands sent
+// while motifini was down are not replayed.
+func (x *matrixBackend) Connect() error {
+	if x.config.Homeserver == "" || x.config.AccessToken == "" {
+		return ErrMatrixConfig
+	}
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+
+	ctx := context.Background()
+
+	err := x.do(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, "", &whoami)
+	if err != nil {
+		return fmt.Errorf("access token failed: %w", err)
+	}
+
+	x.userID = whoami.UserID
+	x.Info.Printf("Authorized on Matrix account %s", x.userID)
+
+	var sync matrixSync
+
+	err = x.do(ctx, http.MethodGet, "/_matrix/client/v3/sync?timeout=0", nil, "", &sync)
+	if err != nil {
+		return fmt.Errorf("initial sync: %w", err)
+	}
+
+	x.since = sync.NextBatch
+
+	return nil
+}
+
+// Receive long-polls /sync, joins rooms the bot is invited to, and hands
+// messages to Chat until stop closes.
+func (x *matrixBackend) Receive(stop <-chan struct{}) {
+	x.Info.Println("Connecting to Matrix!")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	inboxes := make(map[string]chan matrixEvent) // room ID -> its worker's queue.
+
+	for ctx.Err() == nil {
+		var sync matrixSync
+
+		path := "/_matrix/client/v3/sync?timeout=" + strconv.FormatInt(matrixSyncTimeout.Milliseconds(), 10) +
+			"&since=" + url.QueryEscape(x.since)
+
+		err := x.do(ctx, http.MethodGet, path, nil, "", &sync)
+		if err != nil {
+			if ctx.Err() == nil {
+				x.Error.Printf("Matrix sync: %v", err)
+				sleepCtx(ctx, matrixRetryWait)
+			}
+
+			continue
+		}
+
+		x.since = sync.NextBatch
+		x.handleSync(ctx, &sync, inboxes)
+	}
+}
+
+func (x *matrixBackend) handleSync(ctx context.Context, sync *matrixSync, inboxes map[string]chan matrixEvent) {
+	for roomID := range sync.Rooms.Invite {
+		err := x.do(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), struct{}{}, "", nil)
+		if err != nil {
+			x.Error.Printf("Matrix join %s: %v", roomID, err)
+		} else {
+			x.Info.Printf("Matrix joined room %s", roomID)
+		}
+	}
+
+	for roomID, room := range sync.Rooms.Join {
+		for _, event := range room.Timeline.Events {
+			if event.Type != "m.room.message" || event.Content.MsgType != "m.text" || event.Sender == x.userID {
+				continue
+			}
+
+			// Commands can fetch slow media, so each room has a worker: rooms
+			// never wait on each other, and a room's messages run in order.
+			inbox := inboxes[roomID]
+			if inbox == nil {
+				inbox = make(chan matrixEvent, matrixRoomQueue)
+				inboxes[roomID] = inbox
+
+				go x.work(ctx, roomID, inbox)
+			}
+
+			select {
+			case inbox <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// work handles one room's messages, one at a time, until ctx is done.
+func (x *matrixBackend) work(ctx context.Context, roomID string, inbox <-chan matrixEvent) {
+	for {
+		select {
+		case event := <-inbox:
+			x.receive(roomID, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive routes a room message: a bare number answers the last menu shown in
+// the room, anything else is a command.
+func (x *matrixBackend) receive(roomID string, event matrixEvent) {
+	chatID := matrixChatID(roomID)
+	text := strings.TrimSpace(event.Content.Body)
+
+	x.mu.Lock()
+	x.rooms[chatID] = roomID
+	x.mu.Unlock()
+
+	if data, eventID, ok := x.menuChoice(roomID, text); ok {
+		if x.handleChoice(chatID, event.Sender, data, eventID) {
+			return
+		}
+	}
+
+	x.receiveText(x, &inbound{chatID: chatID, name: event.Sender, text: text}, x.config.Pass)
+
+	sub, err := x.Subs.GetSubscriberByID(chatID, APIMatrix)
+	if err == nil && chat.SubRoute(sub) != roomID {
+		chat.SetSubRoute(sub, roomID)
+	}
+}
+
+// menuChoice returns the callback data for a numbered reply to the room's menu.
+func (x *matrixBackend) menuChoice(roomID, text string) (string, string, bool) {
+	num, err := strconv.Atoi(text)
+	if err != nil {
+		return "", "", false
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	menu := x.menus[roomID]
+	if menu == nil || num < 1 || num > len(menu.data) {
+		return "", "", false
+	}
+
+	return menu.data[num-1], menu.eventID, true
+}
+
+// handleChoice runs a menu option like a Telegram button press.
+func (x *matrixBackend) handleChoice(chatID int64, sender, data, eventID string) bool {
+	sub, err := x.Subs.GetSubscriberByID(chatID, APIMatrix)
+	if err != nil || !chat.SubAuthed(sub) {
+		return false
+	}
+
+	handler := &chat.Handler{
+		API:      APIMatrix,
+		ID:       ReqID(IDLength),
+		Sub:      sub,
+		From:     sender,
+		Callback: data,
+		Text:     []string{data},
+	}
+
+	x.Info.Printf("[%s] Matrix option from %d:%s data=%s", handler.ID, chatID, sender, data)
+
+	if data == "p:a" || data == "v:a" {
+		handler.SendFile = func(path, caption string) error {
+			err := x.SendFile(&Upload{ReqID: handler.ID, Path: path, Caption: caption}, chatID, sender)
+			_ = os.Remove(path)
+
+			return err
+		}
+	}
+
+	resp := x.Chat.HandleCallback(handler)
+	x.sendReply(x, chatID, eventID, "", handler.ID, sender, resp)
+
+	return true
+}
+
+// roomID finds the room for a subscriber ID.
+func (x *matrixBackend) roomID(chatID int64) (string, error) {
+	x.mu.Lock()
+	roomID, ok := x.rooms[chatID]
+	x.mu.Unlock()
+
+	if ok {
+		return roomID, nil
+	}
+
+	sub, err := x.Subs.GetSubscriberByID(chatID, APIMatrix)
+	if err != nil {
+		return "", fmt.Errorf("matrix subscriber %d: %w", chatID, err)
+	}
+
+	if roomID = chat.SubRoute(sub); roomID == "" {
+		return "", fmt.Errorf("%w: no room for matrix subscriber %d", ErrNillConfigItem, chatID)
+	}
+
+	return roomID, nil
+}
+
+// SendText sends a plain text message.
+func (x *matrixBackend) SendText(reqID string, chatID int64, contact, text string) error {
+	return x.SendKeyboard(reqID, chatID, contact, text, nil)
+}
+
+// SendKeyboard sends text followed by the keyboard as numbered options.
+func (x *matrixBackend) SendKeyboard(reqID string, chatID int64, _, text string, rows [][]chat.Button) error {
+	roomID, err := x.roomID(chatID)
+	if err != nil {
+		return err
+	}
+
+	body, data := matrixMenuText(text, rows)
+
+	eventID, err := x.sendEvent(roomID, map[string]any{"msgtype": "m.text", "body": body})
+	if err != nil {
+		return fmt.Errorf("[%s] sending matrix message: %w", reqID, err)
+	}
+
+	x.setMenu(roomID, eventID, data)
+
+	return nil
+}
+
+// EditMessage replaces an earlier message (m.replace) and its options.
+func (x *matrixBackend) EditMessage(
+	reqID string, chatID int64, messageID, _, text string, rows [][]chat.Button,
+) error {
+	roomID, err := x.roomID(chatID)
+	if err != nil {
+		return err
+	}
+
+	body, data := matrixMenuText(text, rows)
+	content := map[string]any{
+		"msgtype":       "m.text",
+		"body":          "* " + body,
+		"m.new_content": map[string]any{"msgtype": "m.text", "body": body},
+		"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": messageID},
+	}
+
+	_, err = x.sendEvent(roomID, content)
+	if err != nil {
+		return fmt.Errorf("[%s] editing matrix message: %w", reqID, err)
+	}
+
+	x.setMenu(roomID, messageID, data)
+
+	return nil
+}
+
+// AnswerCallback is a no-op: a numbered reply has no spinner to stop.
+func (x *matrixBackend) AnswerCallback(_, _, _ string) error {
+	return nil
+}
+
+// SendFile uploads to the homeserver media repository once and sends the
+// returned mxc:// URI to every room after that.
+func (x *matrixBackend) SendFile(upload *Upload, chatID int64, contact string) error {
+	roomID, err := x.roomID(chatID)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(upload.Path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	name := filepath.Base(upload.Path)
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	if upload.Ref == "" {
+		x.Info.Printf("[%s] Matrix: Uploading %s (%.2fMb)", upload.ReqID, upload.Path, float64(info.Size())/mebibyte)
+
+		upload.Ref, err = x.uploadMedia(upload.Path, name, mimeType)
+		if err != nil {
+			return err
+		}
+	}
+
+	body := upload.Caption
+	if body == "" {
+		body = name
+	}
+
+	x.Info.Printf("[%s] Matrix: Sending %s to %d:%s", upload.ReqID, name, chatID, contact)
+
+	_, err = x.sendEvent(roomID, map[string]any{
+		"msgtype":  matrixMsgType(mimeType),
+		"body":     body,
+		"filename": name,
+		"url":      upload.Ref,
+		"info":     map[string]any{"mimetype": mimeType, "size": info.Size()},
+	})
+	if err != nil {
+		return fmt.Errorf("[%s] sending matrix file: %w", upload.ReqID, err)
+	}
+
+	return nil
+}
+
+func (x *matrixBackend) uploadMedia(path, name, mimeType string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	var reply struct {
+		ContentURI string `json:"content_uri"`
+	}
+
+	err = x.do(context.Background(), http.MethodPost,
+		"/_matrix/media/v3/upload?filename="+url.QueryEscape(name), file, mimeType, &reply)
+	if err != nil {
+		return "", fmt.Errorf("uploading matrix media: %w", err)
+	}
+
+	return reply.ContentURI, nil
+}
+
+// sendEvent sends an m.room.message and returns its event ID.
+func (x *matrixBackend) sendEvent(roomID string, content map[string]any) (string, error) {
+	txnID := fmt.Sprintf("motifini.%d.%d", time.Now().UnixNano(), x.txn.Add(1))
+
+	var reply struct {
+		EventID string `json:"event_id"`
+	}
+
+	err := x.do(context.Background(), http.MethodPut,
+		"/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/send/m.room.message/"+txnID, content, "", &reply)
+
+	return reply.EventID, err
+}
+
+func (x *matrixBackend) setMenu(roomID, eventID string, data []string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(data) == 0 {
+		delete(x.menus, roomID)
+		return
+	}
+
+	x.menus[roomID] = &matrixMenu{eventID: eventID, data: data}
+}
+
+// do calls the homeserver, retrying rate-limited (429) responses. body is JSON
+// encoded unless it is an io.Reader, which is sent as-is with contentType.
+func (x *matrixBackend) do(ctx context.Context, method, path string, body any, contentType string, reply any) error {
+	for attempt := 1; ; attempt++ {
+		err := x.request(ctx, method, path, body, contentType, reply)
+
+		var mxErr *matrixError
+		if !errors.As(err, &mxErr) || mxErr.Status != http.StatusTooManyRequests || attempt > matrixRetries {
+			return err
+		}
+
+		if _, isReader := body.(io.Reader); isReader {
+			return err // the upload body was consumed; let the caller retry.
+		}
+
+		wait := min(time.Duration(max(mxErr.RetryAfter, 1))*time.Millisecond, matrixMaxWait)
+		x.Error.Printf("Matrix rate limited: retrying in %s (%d/%d)", wait, attempt, matrixRetries)
+		sleepCtx(ctx, wait)
+	}
+}
+
+func (x *matrixBackend) request(
+	ctx context.Context, method, path string, body any, contentType string, reply any,
+) error {
+	var reader io.Reader
+
+	switch data := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = data
+	default:
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+
+		reader, contentType = bytes.NewReader(buf), "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(x.config.Homeserver, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+x.config.AccessToken)
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("matrix request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if x.config.Debug {
+		x.Debug.Printf("Matrix %s %s: %s", method, path, resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		mxErr := &matrixError{Status: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(mxErr)
+
+		return mxErr
+	}
+
+	if reply == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(reply)
+	if err != nil {
+		return fmt.Errorf("decoding matrix reply: %w", err)
+	}
+
+	return nil
+}
+
+// matrixMenuText appends keyboard buttons as a numbered list and returns the
+// callback data in the same order.
+func matrixMenuText(text string, rows [][]chat.Button) (string, []string) {
+	var (
+		body strings.Builder
+		data []string
+	)
+
+	body.WriteString(text)
+
+	for _, row := range rows {
+		for _, btn := range row {
+			data = append(data, btn.Data)
+
+			if len(data) == 1 {
+				body.WriteString("\n\nReply with a number:")
+			}
+
+			fmt.Fprintf(&body, "\n%d. %s", len(data), btn.Label)
+		}
+	}
+
+	return body.String(), data
+}
+
+func matrixMsgType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "m.image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "m.video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "m.audio"
+	default:
+		return "m.file"
+	}
+}
+
+// sleepCtx waits for wait or until ctx is done.
+func sleepCtx(ctx context.Context, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
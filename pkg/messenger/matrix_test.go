@@ -0,0 +1,233 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/subscribe"
+)
+
+// fakeHomeserver answers the client-server calls the Matrix backend makes and
+// records what was uploaded and sent.
+type fakeHomeserver struct {
+	mu       sync.Mutex
+	uploads  int
+	limited  int                         // respond 429 to this many sends first
+	messages map[string][]map[string]any // room ID -> sent event contents
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`)
+
+		return
+	}
+
+	switch path := r.URL.EscapedPath(); {
+	case path == "/_matrix/client/v3/account/whoami":
+		_, _ = io.WriteString(w, `{"user_id":"@motifini:example.org"}`)
+	case path == "/_matrix/client/v3/sync":
+		_, _ = io.WriteString(w, `{"next_batch":"s1"}`)
+	case path == "/_matrix/media/v3/upload":
+		_, _ = io.Copy(io.Discard, r.Body)
+		f.uploads++
+		_, _ = io.WriteString(w, `{"content_uri":"mxc://example.org/clip"}`)
+	case strings.HasPrefix(path, "/_matrix/client/v3/rooms/") && r.Method == http.MethodPut:
+		if f.limited > 0 {
+			f.limited--
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"errcode":"M_LIMIT_EXCEEDED","error":"slow down","retry_after_ms":1}`)
+
+			return
+		}
+
+		room, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/rooms/"), "/send/")
+		content := make(map[string]any)
+		_ = json.NewDecoder(r.Body).Decode(&content)
+		f.messages[room] = append(f.messages[room], content)
+		_, _ = io.WriteString(w, `{"event_id":"$event`+room+`"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"errcode":"M_UNRECOGNIZED","error":"unknown endpoint"}`)
+	}
+}
+
+// newTestMatrix connects a backend to a fake homeserver with one subscriber per room.
+func newTestMatrix(t *testing.T, rooms ...string) (*matrixBackend, *fakeHomeserver) {
+	t.Helper()
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatalf("subscribe.GetDB: %v", err)
+	}
+
+	for _, room := range rooms {
+		sub := subs.CreateSubWithID(matrixChatID(room), "@user:example.org", APIMatrix, false, false)
+		chat.SetSubRoute(sub, room)
+	}
+
+	fake := &fakeHomeserver{messages: make(map[string][]map[string]any)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	discard := log.New(io.Discard, "", 0)
+	msgs := &Messenger{Subs: subs, Info: discard, Debug: discard, Error: discard}
+	backend := newMatrixBackend(msgs, &MatrixConfig{Homeserver: server.URL, AccessToken: "token"})
+
+	err = backend.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	if backend.userID != "@motifini:example.org" || backend.since != "s1" {
+		t.Fatalf("Connect did not record whoami and sync: %q %q", backend.userID, backend.since)
+	}
+
+	return backend, fake
+}
+
+func TestMatrixChatID(t *testing.T) {
+	t.Parallel()
+
+	first, second := matrixChatID("!a:example.org"), matrixChatID("!b:example.org")
+
+	if first != matrixChatID("!a:example.org") {
+		t.Fatal("room chat IDs must be stable across calls")
+	}
+
+	if first <= 0 || second <= 0 || first == second {
+		t.Fatalf("room chat IDs must be positive and distinct: %d %d", first, second)
+	}
+}
+
+// A clip sent to several rooms is uploaded to the media repository once.
+func TestMatrixSendFileUploadsOnce(t *testing.T) {
+	t.Parallel()
+
+	rooms := []string{"!a:example.org", "!b:example.org"}
+	backend, fake := newTestMatrix(t, rooms...)
+
+	path := filepath.Join(t.TempDir(), "Porch.mp4")
+
+	err := os.WriteFile(path, []byte("not really a video"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := &Upload{ReqID: "req", Path: path, Caption: "Porch motion"}
+
+	for _, room := range rooms {
+		err = backend.SendFile(upload, matrixChatID(room), "@user:example.org")
+		if err != nil {
+			t.Fatalf("SendFile %s: %v", room, err)
+		}
+	}
+
+	if fake.uploads != 1 {
+		t.Fatalf("uploads: got %d want 1", fake.uploads)
+	}
+
+	for _, room := range rooms {
+		sent := fake.messages[room]
+		if len(sent) != 1 || sent[0]["msgtype"] != "m.video" ||
+			sent[0]["url"] != "mxc://example.org/clip" || sent[0]["body"] != "Porch motion" {
+			t.Fatalf("room %s got %v", room, sent)
+		}
+	}
+}
+
+// Keyboards become numbered options, and a number picks the matching button.
+func TestMatrixKeyboardOptions(t *testing.T) {
+	t.Parallel()
+
+	room := "!a:example.org"
+	backend, fake := newTestMatrix(t, room)
+	fake.limited = 1 // the first send is rate limited and retried.
+
+	rows := [][]chat.Button{
+		{{Label: "Snapshot", Data: "p:a"}, {Label: "Video", Data: "v:a"}},
+		{{Label: "Close", Data: "x"}},
+	}
+
+	err := backend.SendKeyboard("req", matrixChatID(room), "@user:example.org", "Cameras", rows)
+	if err != nil {
+		t.Fatalf("SendKeyboard: %v", err)
+	}
+
+	want := "Cameras\n\nReply with a number:\n1. Snapshot\n2. Video\n3. Close"
+	if sent := fake.messages[room]; len(sent) != 1 || sent[0]["body"] != want {
+		t.Fatalf("sent %v, want body %q", sent, want)
+	}
+
+	data, eventID, ok := backend.menuChoice(room, "2")
+	if !ok || data != "v:a" || eventID != "$event"+room {
+		t.Fatalf("menuChoice(2): %q %q %v", data, eventID, ok)
+	}
+
+	if _, _, ok := backend.menuChoice(room, "4"); ok {
+		t.Fatal("an option past the end of the menu must not match")
+	}
+
+	if _, _, ok := backend.menuChoice(room, "/help"); ok {
+		t.Fatal("commands must not match a menu option")
+	}
+}
+
+// A room's messages run one at a time in sync order: the command after the
+// password only works if the password was handled first.
+func TestMatrixRoomOrder(t *testing.T) {
+	t.Parallel()
+
+	room := "!new:example.org"
+	backend, fake := newTestMatrix(t)
+	backend.config.Pass = "secret"
+	backend.Chat = chat.New(&chat.Chat{Subs: backend.Subs})
+
+	var sync matrixSync
+
+	err := json.Unmarshal([]byte(`{"rooms":{"join":{"`+room+`":{"timeline":{"events":[
+		{"type":"m.room.message","sender":"@ann:example.org","content":{"msgtype":"m.text","body":"id secret"}},
+		{"type":"m.room.message","sender":"@ann:example.org","content":{"msgtype":"m.text","body":"/help"}}
+	]}}}}}`), &sync)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend.handleSync(ctx, &sync, make(map[string]chan matrixEvent))
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		fake.mu.Lock()
+		sent := fake.messages[room]
+		fake.mu.Unlock()
+
+		if len(sent) < 2 {
+			continue
+		}
+
+		if sent[0]["body"] != "You are now authenticated." {
+			t.Fatalf("first reply: %v", sent[0])
+		}
+
+		return
+	}
+
+	t.Fatal("the command after the password got no reply")
+}
@@ -1,4 +1,6 @@
-// Package messenger disambiguates messenger protocols. Currently only supports Telegram.
+// Package messenger disambiguates messenger protocols. Each chat network is a
+// Backend registered under its subscriber API name; Telegram, Matrix, email,
+// outbound webhooks and the ntfy and Pushover push services are built in.
 package messenger
 
 import (
@@ -8,32 +10,93 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/davidnewhall/motifini/pkg/chat"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"golift.io/subscribe"
 )
 
 // Supported messenger APIs.
 const (
 	APITelegram = "telegram"
+	APIMatrix   = "matrix"
+	APIWebhook  = "webhook"
+	APIEmail    = "email"
+	APINtfy     = "ntfy"
+	APIPushover = "pushover"
 )
 
 // Messenger is all the data needed to initialize this library.
 type Messenger struct {
 	Chat     *chat.Chat
-	telebot  *tgbotapi.BotAPI
+	backends map[string]Backend // by subscriber API name
 	Telegram *TelegramConfig
+	Matrix   *MatrixConfig
+	Webhook  *WebhookConfig
+	Email    *EmailConfig
+	Ntfy     *NtfyConfig
+	Pushover *PushoverConfig
 	Subs     *subscribe.Subscribe
 	Info     *log.Logger
 	Debug    *log.Logger
 	Error    *log.Logger
 	TempDir  string
-	stopall  chan struct{}
+	// SpoolDir holds notifications that could not be delivered yet; empty disables retries.
+	SpoolDir string
+	// SpoolMaxAge is how long a spooled notification is retried before it is dropped.
+	SpoolMaxAge time.Duration
+	// DigestDir holds alerts waiting for their subscriber's digest; empty sends them at once.
+	DigestDir      string
+	stopall        chan struct{}
+	running        sync.WaitGroup // background loops started by Start; Stop waits for them
+	spoolMu        sync.Mutex     // one spool flush at a time; guards the counts below
+	spoolDelivered int            // late deliveries since the backlog started
+	spoolExpired   int            // expired entries since the backlog started
+	spoolOrphaned  int            // entries dropped with no reachable subscriber left
+	ackMu          sync.Mutex
+	acks           map[string]*pendingAck // alerts awaiting acknowledgement, by ID
+	digestMu       sync.Mutex             // guards DigestDir
+	digestFlushMu  sync.Mutex             // one digest flush at a time
 }
 
-// ErrNillConfigItem is returned when a required Messenger field is missing.
-var ErrNillConfigItem = errors.New("a required configuration item was not provided")
+// Errors returned by this package.
+var (
+	// ErrNillConfigItem is returned when a required Messenger field is missing.
+	ErrNillConfigItem = errors.New("a required configuration item was not provided")
+	// ErrUnknownAPI is recorded for subscribers whose messenger API is not supported.
+	ErrUnknownAPI = errors.New("unknown notification API")
+)
+
+// Delivery is the outcome of sending one notification to a list of subscribers.
+type Delivery struct {
+	Sent   int
+	Failed []*subscribe.Subscriber
+	// Spooled is how many of the failed subscribers will get it later from the spool.
+	Spooled int
+	retry   []*subscribe.Subscriber // failed with an error worth retrying
+}
+
+// Total is how many subscribers a delivery was attempted for.
+func (d *Delivery) Total() int {
+	return d.Sent + len(d.Failed)
+}
+
+func (d *Delivery) record(mu *sync.Mutex, sub *subscribe.Subscriber, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch {
+	case err == nil:
+		d.Sent++
+	case retryableSendErr(err):
+		d.retry = append(d.retry, sub)
+		fallthrough
+	default:
+		d.Failed = append(d.Failed, sub)
+	}
+}
 
 // New provides a messenger handler.
 func New(msgCfg *Messenger) error {
@@ -41,10 +104,6 @@ func New(msgCfg *Messenger) error {
 		return fmt.Errorf("%w: already running", ErrNillConfigItem)
 	}
 
-	if msgCfg.Telegram == nil {
-		return fmt.Errorf("%w: telegram is nil, need at least one", ErrNillConfigItem)
-	}
-
 	if msgCfg.Chat == nil {
 		return fmt.Errorf("%w: chat is nil", ErrNillConfigItem)
 	}
@@ -69,47 +128,225 @@ func New(msgCfg *Messenger) error {
 		msgCfg.TempDir = "/tmp/"
 	}
 
+	if msgCfg.SpoolMaxAge <= 0 {
+		msgCfg.SpoolMaxAge = DefaultSpoolMaxAge
+	}
+
+	msgCfg.backends = make(map[string]Backend)
+	if msgCfg.Telegram != nil {
+		msgCfg.register(newTelegramBackend(msgCfg, msgCfg.Telegram))
+	}
+
+	if msgCfg.Matrix != nil && msgCfg.Matrix.Homeserver != "" {
+		msgCfg.register(newMatrixBackend(msgCfg, msgCfg.Matrix))
+	}
+
+	if msgCfg.Webhook != nil {
+		msgCfg.register(newWebhookBackend(msgCfg, msgCfg.Webhook))
+	}
+
+	if msgCfg.Email != nil && msgCfg.Email.Host != "" {
+		msgCfg.register(newEmailBackend(msgCfg, msgCfg.Email))
+		msgCfg.Chat.AddEmail = func(address string) (*subscribe.Subscriber, bool, error) {
+			return msgCfg.AddSubscriber(APIEmail, address)
+		}
+	}
+
+	if msgCfg.Ntfy != nil {
+		msgCfg.register(newNtfyBackend(msgCfg, msgCfg.Ntfy))
+	}
+
+	if msgCfg.Pushover != nil && msgCfg.Pushover.Token != "" {
+		msgCfg.register(newPushoverBackend(msgCfg, msgCfg.Pushover))
+	}
+
+	if len(msgCfg.backends) == 0 {
+		return fmt.Errorf("%w: no messenger configured, need at least one", ErrNillConfigItem)
+	}
+
 	return msgCfg.Start()
 }
 
+// register adds a backend under its API name; subscribers with that API are sent through it.
+func (m *Messenger) register(b Backend) {
+	m.backends[b.Name()] = b
+}
+
 // Start connects configured messengers and begins background receivers.
 func (m *Messenger) Start() error {
 	m.stopall = make(chan struct{})
 
-	if m.Telegram != nil {
-		err := m.connectTelegram()
+	for name, b := range m.backends {
+		err := b.Connect()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		m.running.Go(func() { b.Receive(m.stopall) })
+	}
+
+	if m.SpoolDir != "" {
+		err := os.MkdirAll(m.SpoolDir, spoolDirMode)
+		if err != nil {
+			return fmt.Errorf("creating spool dir: %w", err)
+		}
+
+		m.running.Go(m.runSpool)
+	}
+
+	if m.DigestDir != "" {
+		err := os.MkdirAll(m.DigestDir, spoolDirMode)
 		if err != nil {
-			return err
+			return fmt.Errorf("creating digest dir: %w", err)
 		}
 
-		go m.startTelegram()
+		m.running.Go(m.runDigests)
 	}
 
 	return nil
 }
 
-// Stop closes the telegram routine.
+// Stop ends every backend's receive loop, the spool and digests, and drops
+// alerts waiting for acknowledgement so none escalates later. It returns
+// once the receivers have let go of their connections and the spool and
+// digests have finished any flush in progress, so Start may follow.
 func (m *Messenger) Stop() {
 	close(m.stopall)
+	m.running.Wait()
+	m.stopAcks()
 }
 
 // SendFileOrMsg will send a notification to any subscriber provided using any supported messenger.
 // This method is used by event handlers to notify subscribers.
 // When path is set, the file is removed after all subscribers have been attempted.
-func (m *Messenger) SendFileOrMsg(reqID, msg, path string, subs []*subscribe.Subscriber) {
+// Subscribers that could not be reached for a passing reason (network, flood
+// wait, Telegram outage) are saved to SpoolDir with the file and retried later.
+// The returned Delivery lists subscribers that still failed after retries.
+func (m *Messenger) SendFileOrMsg(reqID, msg, path string, subs []*subscribe.Subscriber) *Delivery {
+	return m.SendEvent(reqID, nil, msg, path, subs)
+}
+
+// SendEvent is SendFileOrMsg for a notification with a known source. Chat
+// backends only see msg; webhooks and email also get the event's name, camera
+// and classes. The event's Snapshot file is removed like path. An event that
+// needs acknowledgement only goes to its first tier here; the rest follow
+// later, and the returned Delivery covers the first tier.
+func (m *Messenger) SendEvent(reqID string, event *Event, msg, path string, subs []*subscribe.Subscriber) *Delivery {
+	if window := m.ackWindow(event); window > 0 && len(subs) > 0 && m.backends != nil {
+		return m.sendAckEvent(reqID, event, msg, path, subs, window)
+	}
+
 	if path != "" {
 		defer os.Remove(path) // best-effort temp cleanup
 	}
 
+	if event != nil && event.Snapshot != "" {
+		defer os.Remove(event.Snapshot)
+	}
+
+	delivery := m.deliver(reqID, event, msg, path, subs)
+	delivery.Spooled = m.spoolDelivery(reqID, event, msg, path, delivery.retry)
+	event.alerted(subs)
+
+	return delivery
+}
+
+// deliver sends a notification to each subscriber through its backend. The first
+// send per backend goes out alone so later chats can reuse the uploaded file
+// (a Telegram file_id); the rest go in parallel. Callers own path.
+func (m *Messenger) deliver(reqID string, event *Event, msg, path string, subs []*subscribe.Subscriber) *Delivery {
+	var (
+		delivery = &Delivery{}
+		uploads  = make(map[string]*Upload) // by API; refs are backend specific.
+		primed   = make(map[string]bool)    // APIs with one successful send.
+		wait     sync.WaitGroup
+		mu       sync.Mutex
+	)
+
+	if m.backends == nil {
+		return delivery // never started.
+	}
+
+	large := m.largeClip(path)
+
 	for _, sub := range subs {
-		switch sub.API {
-		case APITelegram:
-			m.SendTelegram(reqID, msg, path, sub.ID, chat.SubContact(sub))
-		default:
+		msg, path := msg, path
+		if large != "" && sub.API != APITelegram {
+			msg, path = strings.TrimSpace(msg+"\n\n"+large), "" // only Telegram takes it.
+		}
+
+		b := m.backend(sub.API)
+		if b == nil {
 			m.Error.Printf("[%v] Unknown Notification API '%v' for contact: %v",
 				reqID, sub.API, chat.SubContact(sub))
+			delivery.record(&mu, sub, ErrUnknownAPI)
+
+			continue
+		}
+
+		b = m.subBackend(b, sub, event)
+
+		upload := uploads[sub.API]
+		if upload == nil && path != "" {
+			upload = &Upload{ReqID: reqID, Path: path, Caption: msg}
+			uploads[sub.API] = upload
 		}
+
+		if !primed[sub.API] {
+			if upload != nil {
+				upload.Keyboard = alertButtons(sub, event)
+			}
+
+			err := m.sendOne(b, reqID, event, msg, upload, sub)
+			primed[sub.API] = err == nil
+			delivery.record(&mu, sub, err)
+
+			continue
+		}
+
+		var ref *Upload
+		if upload != nil {
+			ref = new(*upload) // each goroutine gets its own copy.
+			ref.Keyboard = alertButtons(sub, event)
+		}
+
+		wait.Go(func() {
+			delivery.record(&mu, sub, m.sendOne(b, reqID, event, msg, ref, sub))
+		})
 	}
+
+	wait.Wait()
+
+	return delivery
+}
+
+// largeClip returns a note for subscribers on other services when path is a
+// clip past the standard size, which only Telegram's local Bot API server takes.
+func (m *Messenger) largeClip(path string) string {
+	if path == "" || m.Chat == nil || !m.Chat.LargeClips {
+		return ""
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= chat.MaxClipSizeBytes {
+		return ""
+	}
+
+	return fmt.Sprintf("(The %.1f MB clip is too large to send here; it went to Telegram.)",
+		float64(info.Size())/mebibyte)
+}
+
+// sendOne sends one subscriber's copy of a notification. Copies of an alert
+// awaiting acknowledgement carry the Acknowledge button where the backend
+// has buttons.
+func (m *Messenger) sendOne(
+	b Backend, reqID string, event *Event, msg string, upload *Upload, sub *subscribe.Subscriber,
+) error {
+	if ab, ok := b.(alertBackend); ok && event != nil && event.ack != nil {
+		return m.sendAckCopy(ab, event.ack, msg, upload, sub)
+	}
+
+	return m.sendEvent(b, reqID, event, msg, upload, sub.ID, chat.SubContact(sub))
 }
 
 // ReqID makes a random string to identify requests in the logs.
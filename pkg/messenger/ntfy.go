@@ -0,0 +1,200 @@
+package messenger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultNtfyServer is where bare topic names are published.
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// ErrNtfyTopic is returned for an ntfy subscriber whose contact is not a topic or topic URL.
+var ErrNtfyTopic = errors.New("ntfy contact must be a topic name or an http(s) topic URL")
+
+// NtfyConfig is the ntfy settings from the config file.
+type NtfyConfig struct {
+	// Server is prefixed to subscribers added by topic name alone. Default: https://ntfy.sh
+	Server string `toml:"server"`
+	// Token is an access token for protected topics. Username and Password are
+	// used instead when Token is empty.
+	Token    string `toml:"token"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// ntfyBackend publishes notifications to ntfy topics: the subscriber's contact
+// is the topic URL. Files are uploaded as the request body, with the text,
+// title, priority and tags in headers. ntfy is send-only.
+type ntfyBackend struct {
+	*Messenger
+	notifyOnly
+
+	config *NtfyConfig
+	client *http.Client
+}
+
+func newNtfyBackend(m *Messenger, config *NtfyConfig) *ntfyBackend {
+	n := &ntfyBackend{
+		Messenger: m,
+		config:    config,
+		client:    &http.Client{Timeout: pushTimeout},
+	}
+	n.notifyOnly = notifyOnly{send: n.SendEvent}
+
+	return n
+}
+
+// Name is the subscriber API served by this backend.
+func (n *ntfyBackend) Name() string {
+	return APINtfy
+}
+
+// Connect fills in the default server.
+func (n *ntfyBackend) Connect() error {
+	if n.config.Server == "" {
+		n.config.Server = DefaultNtfyServer
+	}
+
+	n.config.Server = strings.TrimSuffix(n.config.Server, "/")
+	n.Info.Printf("ntfy notifications enabled, default server %s", n.config.Server)
+
+	return nil
+}
+
+// Address turns a topic name or topic URL into the topic URL.
+func (n *ntfyBackend) Address(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address != "" && !strings.Contains(address, "/") {
+		server := n.config.Server
+		if server == "" {
+			server = DefaultNtfyServer
+		}
+
+		address = strings.TrimSuffix(server, "/") + "/" + address
+	}
+
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") ||
+		parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return "", fmt.Errorf("%w: %q", ErrNtfyTopic, address)
+	}
+
+	return strings.TrimSuffix(address, "/"), nil
+}
+
+// SendEvent publishes one notification to the topic URL in contact.
+func (n *ntfyBackend) SendEvent(
+	reqID string, event *Event, msg string, upload *Upload, _ int64, contact string,
+) error {
+	topic, err := n.Address(contact)
+	if err != nil {
+		return err
+	}
+
+	var (
+		body   io.Reader = strings.NewReader(msg)
+		method           = http.MethodPost
+		file   *os.File
+	)
+
+	if upload != nil {
+		if file, err = os.Open(upload.Path); err != nil {
+			return fmt.Errorf("opening file: %w", err)
+		}
+		defer file.Close()
+
+		body, method = file, http.MethodPut
+	}
+
+	req, err := http.NewRequest(method, topic, body) //nolint:noctx // client has a timeout.
+	if err != nil {
+		return fmt.Errorf("creating ntfy request: %w", err)
+	}
+
+	n.headers(req, event, msg, upload)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("publishing to ntfy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var reply struct {
+			Error string `json:"error"`
+		}
+
+		_ = json.NewDecoder(io.LimitReader(resp.Body, mebibyte)).Decode(&reply)
+
+		return &pushError{API: APINtfy, Status: resp.StatusCode, Message: reply.Error}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	n.Debug.Printf("[%s] ntfy: published to %s", reqID, topic)
+
+	return nil
+}
+
+// headers sets the ntfy publish headers. Non-ASCII values are RFC 2047 encoded,
+// which ntfy decodes.
+func (n *ntfyBackend) headers(req *http.Request, event *Event, msg string, upload *Upload) {
+	header := req.Header
+	header.Set("User-Agent", "motifini")
+	header.Set("Title", mime.QEncoding.Encode("utf-8", pushTitle(event)))
+	header.Set("Priority", strconv.Itoa(ntfyPriority(eventPriority(event))))
+
+	if tags := ntfyTags(event); len(tags) > 0 {
+		header.Set("Tags", strings.Join(tags, ","))
+	}
+
+	if upload != nil {
+		header.Set("Filename", filepath.Base(upload.Path))
+		// With a file as the body, the text rides in a header.
+		header.Set("Message", mime.QEncoding.Encode("utf-8", msg))
+	}
+
+	switch {
+	case n.config.Token != "":
+		header.Set("Authorization", "Bearer "+n.config.Token)
+	case n.config.Username != "":
+		req.SetBasicAuth(n.config.Username, n.config.Password)
+	}
+}
+
+// ntfyPriority maps onto ntfy's 1 (min) to 5 (max) scale.
+func ntfyPriority(priority pushPriority) int {
+	switch priority {
+	case pushLow:
+		return 2 //nolint:mnd // ntfy "low".
+	case pushHigh:
+		return 4 //nolint:mnd // ntfy "high".
+	case pushUrgent:
+		return 5 //nolint:mnd // ntfy "urgent".
+	default:
+		return 3 //nolint:mnd // ntfy "default".
+	}
+}
+
+// ntfyTags are the event's motion classes, plus a warning sign on urgent events.
+// ntfy shows tags that name an emoji as the emoji.
+func ntfyTags(event *Event) []string {
+	if event == nil {
+		return nil
+	}
+
+	tags := append([]string{}, event.Classes...)
+	if eventPriority(event) == pushUrgent {
+		tags = append(tags, "warning")
+	}
+
+	return tags
+}
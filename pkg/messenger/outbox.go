@@ -0,0 +1,236 @@
+package messenger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Outbound Telegram delivery tuning.
+const (
+	telegramSendSlots = 8           // chats sent to at once
+	telegramLaneDepth = 16          // queued sends per chat before callers block
+	telegramLaneIdle  = time.Minute // an idle chat's goroutine exits after this
+	telegramRetries   = 3           // flood-wait retries per message
+	telegramMaxWait   = time.Minute // longest retry_after honored
+)
+
+// ErrTelegramAlbum is returned when Telegram accepts an album but answers with no messages.
+var ErrTelegramAlbum = errors.New("telegram returned no messages for the album")
+
+// telegramOutbox carries every outgoing Telegram message. Each chat gets its own
+// lane, so messages to one chat arrive in the order they were sent, while a
+// shared slot pool lets different chats send in parallel. HTTP 429 responses
+// are retried after Telegram's retry_after; callers block until the final result.
+type telegramOutbox struct {
+	bot   *tgbotapi.BotAPI
+	log   *log.Logger
+	slots chan struct{}
+	mu    sync.Mutex
+	lanes map[int64]*telegramLane
+}
+
+type telegramLane struct {
+	jobs    chan *telegramJob
+	pending int // jobs handed to this lane and not finished; guarded by outbox.mu
+}
+
+type telegramJob struct {
+	reqID  string
+	chatID int64
+	call   telegramCall
+	done   chan telegramResult
+}
+
+// telegramCall makes one Bot API request.
+type telegramCall func(bot *tgbotapi.BotAPI) (tgbotapi.Message, error)
+
+type telegramResult struct {
+	msg tgbotapi.Message
+	err error
+}
+
+func newTelegramOutbox(bot *tgbotapi.BotAPI, logger *log.Logger) *telegramOutbox {
+	return &telegramOutbox{
+		bot:   bot,
+		log:   logger,
+		slots: make(chan struct{}, telegramSendSlots),
+		lanes: make(map[int64]*telegramLane),
+	}
+}
+
+// send queues a message on its chat's lane and waits for the delivery result.
+func (o *telegramOutbox) send(reqID string, chatID int64, call telegramCall) (tgbotapi.Message, error) {
+	job := &telegramJob{reqID: reqID, chatID: chatID, call: call, done: make(chan telegramResult, 1)}
+
+	o.mu.Lock()
+
+	lane := o.lanes[chatID]
+	if lane == nil {
+		lane = &telegramLane{jobs: make(chan *telegramJob, telegramLaneDepth)}
+		o.lanes[chatID] = lane
+
+		go o.run(chatID, lane)
+	}
+
+	lane.pending++
+	o.mu.Unlock()
+
+	lane.jobs <- job
+	result := <-job.done
+
+	return result.msg, result.err
+}
+
+// run drains one chat's lane until it has been idle for a while.
+func (o *telegramOutbox) run(chatID int64, lane *telegramLane) {
+	idle := time.NewTimer(telegramLaneIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case job := <-lane.jobs:
+			msg, err := o.deliver(job)
+			job.done <- telegramResult{msg: msg, err: err}
+
+			o.mu.Lock()
+			lane.pending--
+			o.mu.Unlock()
+			idle.Reset(telegramLaneIdle)
+		case <-idle.C:
+			o.mu.Lock()
+			if lane.pending == 0 {
+				delete(o.lanes, chatID)
+				o.mu.Unlock()
+
+				return
+			}
+			o.mu.Unlock()
+			idle.Reset(telegramLaneIdle)
+		}
+	}
+}
+
+// deliver sends one message, sleeping out flood-wait responses between tries.
+// The send slot is released while waiting so other chats keep moving.
+func (o *telegramOutbox) deliver(job *telegramJob) (tgbotapi.Message, error) {
+	for attempt := 1; ; attempt++ {
+		o.slots <- struct{}{}
+		msg, err := job.call(o.bot)
+		<-o.slots
+
+		wait := telegramRetryAfter(err)
+		if wait == 0 || attempt > telegramRetries {
+			return msg, err //nolint:wrapcheck // callers wrap with their own context.
+		}
+
+		o.log.Printf("[%s] Telegram flood wait for chat %d: retrying in %s (%d/%d)",
+			job.reqID, job.chatID, wait, attempt, telegramRetries)
+		time.Sleep(wait)
+	}
+}
+
+// telegramSend is a send built from raw params. This version of the library
+// has no message_thread_id, so new messages and files are sent this way to
+// reach forum topics.
+type telegramSend struct {
+	method string
+	params tgbotapi.Params
+	files  []tgbotapi.RequestFile
+	album  bool // answered with a message per item.
+}
+
+// newTelegramSend starts a send to a chat, in a forum topic unless thread is
+// 0, with buttons if there are rows.
+func newTelegramSend(method string, chatID int64, thread int, rows [][]chat.Button) (*telegramSend, error) {
+	req := &telegramSend{method: method, params: make(tgbotapi.Params)}
+	req.params.AddNonZero64("chat_id", chatID)
+	req.params.AddNonZero("message_thread_id", thread)
+
+	if kb := telegramInlineKeyboard(rows); kb != nil {
+		if err := req.params.AddInterface("reply_markup", kb); err != nil {
+			return nil, fmt.Errorf("encoding keyboard: %w", err)
+		}
+	}
+
+	return req, nil
+}
+
+// do makes the request. Files on disk are uploaded; file_ids go as params.
+// An album returns the first of its messages.
+func (r *telegramSend) do(bot *tgbotapi.BotAPI) (tgbotapi.Message, error) {
+	var (
+		resp *tgbotapi.APIResponse
+		err  error
+	)
+
+	if slices.ContainsFunc(r.files, func(file tgbotapi.RequestFile) bool { return file.Data.NeedsUpload() }) {
+		resp, err = bot.UploadFiles(r.method, r.params, r.files)
+	} else {
+		for _, file := range r.files {
+			r.params[file.Name] = file.Data.SendData()
+		}
+
+		resp, err = bot.MakeRequest(r.method, r.params)
+	}
+
+	if err != nil {
+		return tgbotapi.Message{}, err //nolint:wrapcheck // callers wrap with their own context.
+	}
+
+	if r.album {
+		var msgs []tgbotapi.Message
+		if err = json.Unmarshal(resp.Result, &msgs); err != nil {
+			return tgbotapi.Message{}, err //nolint:wrapcheck // callers wrap with their own context.
+		}
+
+		if len(msgs) == 0 {
+			return tgbotapi.Message{}, ErrTelegramAlbum
+		}
+
+		return msgs[0], nil
+	}
+
+	var msg tgbotapi.Message
+	err = json.Unmarshal(resp.Result, &msg)
+
+	return msg, err //nolint:wrapcheck // callers wrap with their own context.
+}
+
+// telegramRetryAfter returns how long Telegram asked us to wait, or zero when
+// the error is not a flood-wait (429) response.
+func telegramRetryAfter(err error) time.Duration {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.RetryAfter < 1 {
+		return 0
+	}
+
+	return min(time.Duration(tgErr.RetryAfter)*time.Second, telegramMaxWait)
+}
+
+// send routes a Telegram message through the outbox.
+func (t *telegramBackend) send(reqID string, chatID int64, msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return t.call(reqID, chatID, func(bot *tgbotapi.BotAPI) (tgbotapi.Message, error) {
+		return bot.Send(msg) //nolint:wrapcheck // callers wrap with their own context.
+	})
+}
+
+// sendParams routes a send built from raw params through the outbox.
+func (t *telegramBackend) sendParams(reqID string, chatID int64, req *telegramSend) (tgbotapi.Message, error) {
+	return t.call(reqID, chatID, req.do)
+}
+
+func (t *telegramBackend) call(reqID string, chatID int64, call telegramCall) (tgbotapi.Message, error) {
+	if t.outbox == nil {
+		return call(t.bot)
+	}
+
+	return t.outbox.send(reqID, chatID, call)
+}
@@ -0,0 +1,231 @@
+package messenger
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newTestOutbox() *telegramOutbox {
+	return newTelegramOutbox(nil, log.New(io.Discard, "", 0))
+}
+
+// waitFor fails the test when ch has nothing within a few seconds.
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case value := <-ch:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal(what)
+
+		var zero T
+
+		return zero
+	}
+}
+
+// Messages to one chat are sent one at a time, in the order they were queued.
+func TestOutboxOrderPerChat(t *testing.T) {
+	t.Parallel()
+
+	var (
+		outbox  = newTestOutbox()
+		mu      sync.Mutex
+		order   []int
+		busy    bool
+		overlap bool
+		started = make(chan struct{}, 1)
+		hold    = make(chan struct{})
+		done    sync.WaitGroup
+	)
+
+	call := func(n int) telegramCall {
+		return func(*tgbotapi.BotAPI) (tgbotapi.Message, error) {
+			mu.Lock()
+			overlap = overlap || busy
+			busy = true
+			mu.Unlock()
+
+			if n == 0 {
+				started <- struct{}{}
+				<-hold
+			}
+
+			mu.Lock()
+			busy = false
+			order = append(order, n)
+			mu.Unlock()
+
+			return tgbotapi.Message{MessageID: n}, nil
+		}
+	}
+
+	done.Go(func() { _, _ = outbox.send("req", 1, call(0)) })
+	waitFor(t, started, "first message was not sent")
+
+	// Queue the rest one by one behind the held first message.
+	for n := 1; n <= 5; n++ {
+		done.Go(func() {
+			if msg, _ := outbox.send("req", 1, call(n)); msg.MessageID != n {
+				t.Errorf("message %d got the result of %d", n, msg.MessageID)
+			}
+		})
+
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			outbox.mu.Lock()
+			queued := len(outbox.lanes[1].jobs)
+			outbox.mu.Unlock()
+
+			if queued == n {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("message %d was not queued", n)
+			}
+		}
+	}
+
+	close(hold)
+	done.Wait()
+
+	if overlap || len(order) != 6 {
+		t.Fatalf("overlapping sends %v, sent %v", overlap, order)
+	}
+
+	for i, n := range order {
+		if i != n {
+			t.Fatalf("sent out of order: %v", order)
+		}
+	}
+}
+
+// Different chats do not wait for each other.
+func TestOutboxChatsInParallel(t *testing.T) {
+	t.Parallel()
+
+	outbox := newTestOutbox()
+	started := make(chan int64, 2)
+	hold := make(chan struct{})
+
+	var done sync.WaitGroup
+
+	for _, chatID := range []int64{1, 2} {
+		done.Go(func() {
+			_, _ = outbox.send("req", chatID, func(*tgbotapi.BotAPI) (tgbotapi.Message, error) {
+				started <- chatID
+				<-hold
+
+				return tgbotapi.Message{}, nil
+			})
+		})
+	}
+
+	// Both are in flight before either is let go.
+	waitFor(t, started, "no chat was sent to")
+	waitFor(t, started, "a chat waited for another chat")
+	close(hold)
+	done.Wait()
+}
+
+// A 429 is retried after retry_after, and other chats keep sending meanwhile.
+func TestOutboxRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	outbox := newTestOutbox()
+	calls := 0
+	start := time.Now()
+	flooded := make(chan struct{})
+
+	var done sync.WaitGroup
+
+	done.Go(func() {
+		_, err := outbox.send("req", 1, func(*tgbotapi.BotAPI) (tgbotapi.Message, error) {
+			if calls++; calls == 1 {
+				close(flooded)
+				return tgbotapi.Message{}, &tgbotapi.Error{
+					Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1},
+				}
+			}
+
+			return tgbotapi.Message{}, nil
+		})
+		if err != nil {
+			t.Errorf("send after flood wait: %v", err)
+		}
+	})
+
+	waitFor(t, flooded, "flooded chat was not sent to")
+
+	if _, err := outbox.send("req", 2, func(*tgbotapi.BotAPI) (tgbotapi.Message, error) {
+		return tgbotapi.Message{}, nil
+	}); err != nil || time.Since(start) >= time.Second {
+		t.Fatalf("other chat held up by a flood wait: %v after %v", err, time.Since(start))
+	}
+
+	done.Wait()
+
+	if calls != 2 || time.Since(start) < time.Second {
+		t.Fatalf("%d calls in %v", calls, time.Since(start))
+	}
+}
+
+// A flood wait is not retried forever.
+func TestTelegramRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	flood := &tgbotapi.Error{
+		Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5},
+	}
+	if wait := telegramRetryAfter(flood); wait != 5*time.Second {
+		t.Fatalf("retry_after 5: %v", wait)
+	}
+
+	flood.RetryAfter = 3600
+	if wait := telegramRetryAfter(flood); wait != telegramMaxWait {
+		t.Fatalf("retry_after 3600: %v", wait)
+	}
+
+	if wait := telegramRetryAfter(&tgbotapi.Error{Code: http.StatusBadRequest}); wait != 0 {
+		t.Fatalf("400: %v", wait)
+	}
+}
+
+// An album answered with no messages is an error, not an empty success.
+func TestTelegramSendEmptyAlbum(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"motifini_bot"}}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer server.Close()
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := newTelegramSend("sendMediaGroup", 1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.album = true
+
+	if _, err := req.do(bot); !errors.Is(err, ErrTelegramAlbum) {
+		t.Fatalf("empty album: %v", err)
+	}
+}
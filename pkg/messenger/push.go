@@ -0,0 +1,91 @@
+package messenger
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/subscribe"
+)
+
+// pushTimeout bounds one push request, attachment included.
+const pushTimeout = 30 * time.Second
+
+// pushPriority is how loudly a phone push should ring. Each push service maps
+// it onto its own scale.
+type pushPriority int
+
+const (
+	pushLow pushPriority = iota
+	pushDefault
+	pushHigh
+	pushUrgent
+)
+
+// eventPriority ranks a notification: a person on camera is high, an animal
+// low, losing the SecuritySpy link urgent. Everything else is default.
+func eventPriority(event *Event) pushPriority {
+	if event == nil {
+		return pushDefault
+	}
+
+	switch event.Name {
+	case chat.EventStreamDown, chat.EventSecSpyError:
+		return pushUrgent
+	case chat.EventCameraOffline:
+		return pushHigh
+	}
+
+	switch {
+	case slices.Contains(event.Classes, chat.ClassHuman):
+		return pushHigh
+	case len(event.Classes) > 0 && !slices.ContainsFunc(event.Classes, func(class string) bool {
+		return class != chat.ClassAnimal
+	}):
+		return pushLow // animals only.
+	default:
+		return pushDefault
+	}
+}
+
+// pushTitle is the notification title: the camera or event name.
+func pushTitle(event *Event) string {
+	switch {
+	case event == nil || event.Name == "":
+		return "Motifini"
+	case event.Camera != "":
+		return event.Camera
+	default:
+		return event.Name
+	}
+}
+
+// WantsSnapshot reports whether any subscriber's backend shows a still next to
+// (or instead of) a clip: email inlines it, Pushover only takes images.
+func WantsSnapshot(subs []*subscribe.Subscriber) bool {
+	return slices.ContainsFunc(subs, func(sub *subscribe.Subscriber) bool {
+		return sub.API == APIEmail || sub.API == APIPushover
+	})
+}
+
+// pushError is a non-2xx response from a push service.
+type pushError struct {
+	API     string
+	Status  int
+	Message string
+}
+
+func (e *pushError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s responded %d %s", e.API, e.Status, http.StatusText(e.Status))
+	}
+
+	return fmt.Sprintf("%s responded %d: %s", e.API, e.Status, e.Message)
+}
+
+// HTTPStatus lets the spool tell rate limits and server errors from refusals.
+func (e *pushError) HTTPStatus() int {
+	return e.Status
+}
@@ -0,0 +1,214 @@
+package messenger
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/subscribe"
+)
+
+func newTestPushMessenger() *Messenger {
+	discard := log.New(io.Discard, "", 0)
+	return &Messenger{Info: discard, Debug: discard, Error: discard, backends: make(map[string]Backend)}
+}
+
+func TestEventPriority(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		event *Event
+		want  pushPriority
+	}{
+		{nil, pushDefault},
+		{&Event{Name: chat.EventStreamDown}, pushUrgent},
+		{&Event{Name: chat.EventSecSpyError}, pushUrgent},
+		{&Event{Name: chat.EventCameraOffline}, pushHigh},
+		{&Event{Name: chat.EventStarted}, pushDefault},
+		{&Event{Name: "Porch", Classes: []string{chat.ClassMotion, chat.ClassHuman}}, pushHigh},
+		{&Event{Name: "Porch", Classes: []string{chat.ClassAnimal}}, pushLow},
+		{&Event{Name: "Porch", Classes: []string{chat.ClassAnimal, chat.ClassVehicle}}, pushDefault},
+		{&Event{Name: "Porch", Classes: []string{chat.ClassMotion}}, pushDefault},
+	} {
+		if got := eventPriority(test.event); got != test.want {
+			t.Errorf("eventPriority(%+v) = %d, want %d", test.event, got, test.want)
+		}
+	}
+}
+
+// A clip is PUT as the body; the caption, title, priority and tags ride in headers.
+func TestNtfySendEventUpload(t *testing.T) {
+	t.Parallel()
+
+	var (
+		header http.Header
+		body   []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/porch" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "Porch.mp4")
+
+	err := os.WriteFile(path, []byte("clip"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := newNtfyBackend(newTestPushMessenger(), &NtfyConfig{Token: "tk_abc"})
+	event := &Event{Name: "Porch", Camera: "Porch", Classes: []string{"motion", "human"}, Time: time.Now()}
+
+	err = backend.SendEvent("req", event, "Porch – human", &Upload{ReqID: "req", Path: path}, 1, server.URL+"/porch")
+	if err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	msg, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Message"))
+	if string(body) != "clip" || header.Get("Filename") != "Porch.mp4" || msg != "Porch – human" ||
+		header.Get("Title") != "Porch" || header.Get("Priority") != "4" || header.Get("Tags") != "motion,human" ||
+		header.Get("Authorization") != "Bearer tk_abc" {
+		t.Fatalf("body %q headers %v", body, header)
+	}
+}
+
+func TestNtfyAddress(t *testing.T) {
+	t.Parallel()
+
+	backend := newNtfyBackend(newTestPushMessenger(), &NtfyConfig{Server: "https://ntfy.example.org/"})
+
+	for address, want := range map[string]string{
+		"porch":                      "https://ntfy.example.org/porch",
+		" https://push.local/cams/ ": "https://push.local/cams",
+		"https://push.local/":        "",
+		"ftp://push.local/cams":      "",
+		"":                           "",
+	} {
+		got, err := backend.Address(address)
+		if got != want || (want == "") != errors.Is(err, ErrNtfyTopic) {
+			t.Errorf("Address(%q) = %q, %v; want %q", address, got, err, want)
+		}
+	}
+}
+
+// A clip alert to Pushover carries the snapshot, not the clip, and urgent
+// events are sent at emergency priority.
+func TestPushoverSendEvent(t *testing.T) {
+	t.Parallel()
+
+	const user = "uQiRzpo4DXghDmr9QzzfQu27cmVRsG"
+
+	var (
+		form       map[string][]string
+		attachment string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseMultipartForm(mebibyte)
+		if err != nil || r.FormValue("user") != user {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":0,"errors":["user identifier is invalid"]}`))
+
+			return
+		}
+
+		form, attachment = r.MultipartForm.Value, ""
+		if files := r.MultipartForm.File["attachment"]; len(files) > 0 {
+			attachment = files[0].Filename
+		}
+
+		_, _ = w.Write([]byte(`{"status":1,"request":"abc"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	clip, snap := filepath.Join(dir, "Porch.mp4"), filepath.Join(dir, "Porch.jpg")
+
+	for _, path := range []string{clip, snap} {
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := newPushoverBackend(newTestPushMessenger(), &PushoverConfig{Token: "app"})
+	backend.apiURL = server.URL
+
+	event := &Event{Name: "Porch", Camera: "Porch", Classes: []string{"animal"}, Time: time.Now(), Snapshot: snap}
+
+	err := backend.SendEvent("req", event, "Porch (animal)", &Upload{Path: clip}, 1, user)
+	if err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if attachment != "Porch.jpg" || form["priority"][0] != "-1" || form["title"][0] != "Porch" ||
+		form["message"][0] != "Porch (animal)" || form["token"][0] != "app" {
+		t.Fatalf("attachment %q form %v", attachment, form)
+	}
+
+	err = backend.SendText("req", 1, user, "")
+	if err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+
+	err = backend.SendEvent("req", &Event{Name: chat.EventStreamDown}, "lost it", nil, 1, user)
+	if err != nil || form["priority"][0] != "2" || form["retry"] == nil || form["expire"] == nil || attachment != "" {
+		t.Fatalf("urgent: %v form %v attachment %q", err, form, attachment)
+	}
+
+	err = backend.SendText("req", 1, strings.Repeat("x", 30), "hello")
+
+	var pushErr *pushError
+	if !errors.As(err, &pushErr) || pushErr.Message != "user identifier is invalid" || retryableSendErr(err) {
+		t.Fatalf("rejected key should fail without retry: %v", err)
+	}
+
+	err = backend.SendText("req", 1, "short", "hello")
+	if !errors.Is(err, ErrPushoverUser) || retryableSendErr(err) {
+		t.Fatalf("malformed key should fail without retry: %v", err)
+	}
+}
+
+// Push subscribers are added by address and keyed by it; adding twice finds the same one.
+func TestAddSubscriber(t *testing.T) {
+	t.Parallel()
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestPushMessenger()
+	m.Subs = subs
+	m.register(newNtfyBackend(m, &NtfyConfig{}))
+
+	sub, created, err := m.AddSubscriber(APINtfy, "porch")
+	if err != nil || !created || sub.Contact != "https://ntfy.sh/porch" || !chat.SubAuthed(sub) {
+		t.Fatalf("add: %v %v %+v", err, created, sub)
+	}
+
+	again, created, err := m.AddSubscriber(APINtfy, "https://ntfy.sh/porch")
+	if err != nil || created || again != sub {
+		t.Fatalf("re-add: %v %v %+v", err, created, again)
+	}
+
+	_, _, err = m.AddSubscriber(APIPushover, "uQiRzpo4DXghDmr9QzzfQu27cmVRsG")
+	if !errors.Is(err, ErrUnknownAPI) {
+		t.Fatalf("unconfigured API: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package messenger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pushover API limits and the emergency-priority repeat settings.
+const (
+	pushoverURL           = "https://api.pushover.net/1/messages.json"
+	pushoverMaxMessage    = 1024
+	pushoverMaxTitle      = 250
+	pushoverMaxAttachment = 5 * mebibyte
+	pushoverRetry         = 60   // seconds between emergency repeats (minimum 30).
+	pushoverExpire        = 3600 // seconds to keep repeating an unacknowledged emergency.
+)
+
+// ErrPushoverUser is returned for a Pushover subscriber whose contact is not a user or group key.
+var ErrPushoverUser = errors.New("pushover contact must be a 30 character user or group key")
+
+var pushoverKey = regexp.MustCompile(`^[A-Za-z0-9]{30}$`)
+
+// PushoverConfig is the Pushover settings from the config file.
+type PushoverConfig struct {
+	// Token is the application API token from pushover.net.
+	Token string `toml:"app_token"`
+}
+
+// pushoverBackend sends notifications through the Pushover API: the
+// subscriber's contact is their user (or group) key. Pushover only takes image
+// attachments, so a clip alert carries its snapshot. Pushover is send-only.
+type pushoverBackend struct {
+	*Messenger
+	notifyOnly
+
+	config *PushoverConfig
+	client *http.Client
+	apiURL string
+}
+
+// pushoverReply is the JSON body of every Pushover API response.
+type pushoverReply struct {
+	Status  int      `json:"status"`
+	Request string   `json:"request"`
+	Errors  []string `json:"errors"`
+}
+
+func newPushoverBackend(m *Messenger, config *PushoverConfig) *pushoverBackend {
+	p := &pushoverBackend{
+		Messenger: m,
+		config:    config,
+		client:    &http.Client{Timeout: pushTimeout},
+		apiURL:    pushoverURL,
+	}
+	p.notifyOnly = notifyOnly{send: p.SendEvent}
+
+	return p
+}
+
+// Name is the subscriber API served by this backend.
+func (p *pushoverBackend) Name() string {
+	return APIPushover
+}
+
+// Connect has nothing to log in to; keys are checked on every send.
+func (p *pushoverBackend) Connect() error {
+	p.Info.Printf("Pushover notifications enabled")
+	return nil
+}
+
+// Address checks a Pushover user or group key.
+func (p *pushoverBackend) Address(address string) (string, error) {
+	if address = strings.TrimSpace(address); !pushoverKey.MatchString(address) {
+		return "", fmt.Errorf("%w: %q", ErrPushoverUser, address)
+	}
+
+	return address, nil
+}
+
+// SendEvent sends one notification to the user key in contact.
+func (p *pushoverBackend) SendEvent(
+	reqID string, event *Event, msg string, upload *Upload, _ int64, contact string,
+) error {
+	user, err := p.Address(contact)
+	if err != nil {
+		return err
+	}
+
+	body, contentType, err := p.form(event, msg, user, pushoverImage(event, upload))
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.apiURL, contentType, body) //nolint:noctx // client has a timeout.
+	if err != nil {
+		return fmt.Errorf("posting to pushover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var reply pushoverReply
+
+	_ = json.NewDecoder(io.LimitReader(resp.Body, mebibyte)).Decode(&reply)
+
+	if resp.StatusCode != http.StatusOK || reply.Status != 1 {
+		return &pushError{API: APIPushover, Status: resp.StatusCode, Message: strings.Join(reply.Errors, "; ")}
+	}
+
+	p.Debug.Printf("[%s] Pushover: sent request %s", reqID, reply.Request)
+
+	return nil
+}
+
+// form builds the multipart message request. Emergency priority repeats until
+// acknowledged in the app, or for an hour.
+func (p *pushoverBackend) form(event *Event, msg, user, image string) (*bytes.Buffer, string, error) {
+	var (
+		buf      bytes.Buffer
+		form     = multipart.NewWriter(&buf)
+		priority = pushoverPriority(eventPriority(event))
+		title    = truncate(pushTitle(event), pushoverMaxTitle)
+	)
+
+	if msg = strings.TrimSpace(msg); msg == "" {
+		msg = title // message is required.
+	}
+
+	fields := [][2]string{
+		{"token", p.config.Token},
+		{"user", user},
+		{"title", title},
+		{"message", truncate(msg, pushoverMaxMessage)},
+		{"priority", strconv.Itoa(priority)},
+	}
+
+	if priority == 2 { //nolint:mnd // emergency.
+		fields = append(fields, [2]string{"retry", strconv.Itoa(pushoverRetry)},
+			[2]string{"expire", strconv.Itoa(pushoverExpire)})
+	}
+
+	if event != nil && !event.Time.IsZero() {
+		fields = append(fields, [2]string{"timestamp", strconv.FormatInt(event.Time.Unix(), 10)})
+	}
+
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return nil, "", fmt.Errorf("encoding pushover form: %w", err)
+		}
+	}
+
+	if image != "" {
+		if err := writePushoverAttachment(form, image); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", fmt.Errorf("encoding pushover form: %w", err)
+	}
+
+	return &buf, form.FormDataContentType(), nil
+}
+
+// writePushoverAttachment adds the image as the "attachment" form file.
+func writePushoverAttachment(form *multipart.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="attachment"; filename=%q`, filepath.Base(path)))
+	header.Set("Content-Type", mime.TypeByExtension(filepath.Ext(path)))
+
+	part, err := form.CreatePart(header)
+	if err == nil {
+		_, err = io.Copy(part, file)
+	}
+
+	if err != nil {
+		return fmt.Errorf("encoding pushover attachment: %w", err)
+	}
+
+	return nil
+}
+
+// pushoverImage picks the attachment: the upload when it is an image, else the
+// event's snapshot. Nothing is attached over Pushover's size limit.
+func pushoverImage(event *Event, upload *Upload) string {
+	path := ""
+
+	switch {
+	case upload != nil && strings.HasPrefix(mime.TypeByExtension(filepath.Ext(upload.Path)), "image/"):
+		path = upload.Path
+	case event != nil && event.Snapshot != "":
+		path = event.Snapshot
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() > pushoverMaxAttachment {
+		return ""
+	}
+
+	return path
+}
+
+// pushoverPriority maps onto Pushover's -2 (silent) to 2 (emergency) scale.
+func pushoverPriority(priority pushPriority) int {
+	switch priority {
+	case pushLow:
+		return -1
+	case pushHigh:
+		return 1
+	case pushUrgent:
+		return 2 //nolint:mnd // emergency.
+	default:
+		return 0
+	}
+}
+
+// truncate cuts s to at most limit runes.
+func truncate(s string, limit int) string {
+	if runes := []rune(s); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+
+	return s
+}
@@ -0,0 +1,441 @@
+package messenger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/export"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golift.io/subscribe"
+)
+
+// DefaultSpoolMaxAge is how long an undelivered notification is retried before it is dropped.
+const DefaultSpoolMaxAge = 24 * time.Hour
+
+// Spool timing and layout.
+const (
+	spoolInterval   = 30 * time.Second
+	spoolBackoffMin = 30 * time.Second
+	spoolBackoffMax = 30 * time.Minute
+	spoolEntryFile  = "entry.json"
+	spoolDirMode    = 0o750
+	spoolFileMode   = 0o600
+)
+
+// spoolEntry is one undelivered notification waiting in SpoolDir. Each entry is
+// a directory holding entry.json and, for media notifications, the file itself.
+type spoolEntry struct {
+	ReqID      string           `json:"req_id"`
+	Msg        string           `json:"msg"`
+	File       string           `json:"file,omitempty"` // media file name inside the entry directory
+	Event      *Event           `json:"event,omitempty"`
+	Snapshot   string           `json:"snapshot,omitempty"` // event snapshot file name inside the entry directory
+	Actions    bool             `json:"actions,omitempty"`  // the event's alert buttons; not in Event's JSON.
+	CameraNum  int              `json:"camera_num,omitempty"`
+	Recipients []spoolRecipient `json:"recipients"`
+	Created    time.Time        `json:"created"`
+	NextTry    time.Time        `json:"next_try"`
+	Attempts   int              `json:"attempts"`
+	dir        string
+}
+
+// spoolRecipient identifies a subscriber; contact details are looked up again at retry time.
+type spoolRecipient struct {
+	API string `json:"api"`
+	ID  int64  `json:"id"`
+}
+
+// retryableSendErr reports whether a failed send is worth trying again later.
+// Network errors, flood waits, server errors and SMTP 4xx replies are; a
+// blocked bot, a bad chat, a rejected address or a missing file are not.
+func retryableSendErr(err error) bool {
+	if err == nil || errors.Is(err, ErrUnknownAPI) || errors.Is(err, ErrWebhookURL) ||
+		errors.Is(err, ErrEmailAddress) || errors.Is(err, ErrNtfyTopic) || errors.Is(err, ErrPushoverUser) ||
+		errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return tgErr.Code == http.StatusTooManyRequests || tgErr.Code >= http.StatusInternalServerError
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500 //nolint:mnd // SMTP 5xx replies are permanent, 4xx transient.
+	}
+
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		status := statusErr.HTTPStatus()
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// httpStatusError is an error carrying the HTTP status of a failed request to
+// a backend's server (Matrix homeserver, webhook receiver).
+type httpStatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// spoolDelivery saves a notification for the subscribers it could not reach yet.
+// The media file is moved into the spool, so the caller's cleanup no longer finds it.
+// Returns how many subscribers were queued for retry.
+func (m *Messenger) spoolDelivery(reqID string, event *Event, msg, path string, subs []*subscribe.Subscriber) int {
+	if m.SpoolDir == "" || len(subs) == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	entry := &spoolEntry{
+		ReqID:      reqID,
+		Msg:        msg,
+		Event:      event,
+		Recipients: make([]spoolRecipient, 0, len(subs)),
+		Created:    now,
+		NextTry:    now.Add(spoolBackoff(0)),
+		dir:        filepath.Join(m.SpoolDir, fmt.Sprintf("%d-%s", now.UnixNano(), reqID)),
+	}
+
+	if event != nil {
+		entry.Actions, entry.CameraNum = event.Actions, event.CameraNum
+	}
+
+	for _, sub := range subs {
+		entry.Recipients = append(entry.Recipients, spoolRecipient{API: sub.API, ID: sub.ID})
+	}
+
+	err := os.MkdirAll(entry.dir, spoolDirMode)
+	if err != nil {
+		m.Error.Printf("[%s] Spooling notification: %v", reqID, err)
+		return 0
+	}
+
+	if path != "" {
+		entry.File = filepath.Base(path)
+
+		err = moveFile(path, filepath.Join(entry.dir, entry.File))
+		if err != nil {
+			m.Error.Printf("[%s] Spooling notification file: %v", reqID, err)
+			_ = os.RemoveAll(entry.dir)
+
+			return 0
+		}
+	}
+
+	if event != nil && event.Snapshot != "" {
+		entry.Snapshot = filepath.Base(event.Snapshot)
+		if moveFile(event.Snapshot, filepath.Join(entry.dir, entry.Snapshot)) != nil {
+			entry.Snapshot = "" // the clip still goes out; only email misses the still.
+		}
+	}
+
+	// entry.json goes last: the retry loop skips directories without one.
+	err = entry.save()
+	if err != nil {
+		m.Error.Printf("[%s] Spooling notification: %v", reqID, err)
+		_ = os.RemoveAll(entry.dir)
+
+		return 0
+	}
+
+	export.Map.SpoolQueued.Add(1)
+	m.Info.Printf("[%s] Queued notification for %d subscriber(s) to retry: %s", reqID, len(subs), entry.dir)
+
+	return len(subs)
+}
+
+// runSpool replays notifications left from an earlier run, then retries the spool until Stop.
+func (m *Messenger) runSpool() {
+	ticker := time.NewTicker(spoolInterval)
+	defer ticker.Stop()
+
+	m.flushSpool()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.flushSpool()
+		case <-m.stopall:
+			return
+		}
+	}
+}
+
+// flushSpool retries every entry that is due and drops the ones past SpoolMaxAge.
+// When the spool drains after holding a backlog, admins get a summary.
+func (m *Messenger) flushSpool() {
+	m.spoolMu.Lock()
+	defer m.spoolMu.Unlock()
+
+	remaining := 0
+
+	for _, entry := range m.readSpool() {
+		switch {
+		case time.Since(entry.Created) > m.SpoolMaxAge:
+			m.expireSpoolEntry(entry)
+		case time.Now().Before(entry.NextTry):
+			remaining++
+		case !m.retrySpoolEntry(entry):
+			remaining++
+		}
+	}
+
+	if remaining == 0 && m.spoolDelivered+m.spoolExpired+m.spoolOrphaned > 0 {
+		m.notifySpoolFlushed()
+	}
+}
+
+// readSpool loads every complete entry, oldest first.
+func (m *Messenger) readSpool() []*spoolEntry {
+	dirs, err := os.ReadDir(m.SpoolDir)
+	if err != nil {
+		m.Error.Printf("Reading notification spool: %v", err)
+		return nil
+	}
+
+	entries := make([]*spoolEntry, 0, len(dirs))
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		entry, err := loadSpoolEntry(filepath.Join(m.SpoolDir, dir.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // still being written.
+		} else if err != nil {
+			m.Error.Printf("Reading spooled notification %s: %v", dir.Name(), err)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+
+	return entries
+}
+
+// retrySpoolEntry sends an entry to the subscribers still waiting for it and
+// reports whether the entry is finished (delivered or nobody left to send to).
+func (m *Messenger) retrySpoolEntry(entry *spoolEntry) bool {
+	subs := make([]*subscribe.Subscriber, 0, len(entry.Recipients))
+
+	for _, recipient := range entry.Recipients {
+		sub, err := m.Subs.GetSubscriberByID(recipient.ID, recipient.API)
+		if err != nil || chat.SubIgnored(sub) {
+			continue // deleted or ignored since; nobody to send to.
+		}
+
+		subs = append(subs, sub)
+	}
+
+	path := ""
+	if entry.File != "" {
+		path = filepath.Join(entry.dir, entry.File)
+	}
+
+	msg := "⏱ Delayed — held since " + entry.Created.Format("Jan 2 15:04")
+	if entry.Msg != "" {
+		msg = entry.Msg + "\n\n" + msg
+	}
+
+	if len(subs) == 0 {
+		m.orphanSpoolEntry(entry, "every subscriber was deleted or ignored")
+		return true
+	}
+
+	var event *Event
+	if entry.Event != nil {
+		event = new(*entry.Event)
+		event.Actions, event.CameraNum = entry.Actions, entry.CameraNum
+
+		if entry.Snapshot != "" {
+			event.Snapshot = filepath.Join(entry.dir, entry.Snapshot)
+		}
+	}
+
+	delivery := m.deliver(entry.ReqID, event, msg, path, subs)
+
+	if len(delivery.retry) == 0 && delivery.Sent == 0 {
+		m.orphanSpoolEntry(entry, "every remaining send failed for good")
+		return true
+	} else if len(delivery.retry) == 0 {
+		_ = os.RemoveAll(entry.dir)
+
+		m.spoolDelivered++
+		export.Map.SpoolDelivered.Add(1)
+		m.Info.Printf("[%s] Delivered queued notification to %d of %d subscriber(s) after %d attempt(s)",
+			entry.ReqID, delivery.Sent, len(entry.Recipients), entry.Attempts+1)
+
+		return true
+	}
+
+	entry.Attempts++
+	entry.NextTry = time.Now().Add(spoolBackoff(entry.Attempts))
+	entry.Recipients = entry.Recipients[:0]
+
+	for _, sub := range delivery.retry {
+		entry.Recipients = append(entry.Recipients, spoolRecipient{API: sub.API, ID: sub.ID})
+	}
+
+	err := entry.save()
+	if err != nil {
+		m.Error.Printf("[%s] Updating queued notification: %v", entry.ReqID, err)
+	}
+
+	m.Debug.Printf("[%s] Queued notification still undelivered for %d subscriber(s); next try %s",
+		entry.ReqID, len(entry.Recipients), entry.NextTry.Format(time.TimeOnly))
+
+	return false
+}
+
+func (m *Messenger) expireSpoolEntry(entry *spoolEntry) {
+	_ = os.RemoveAll(entry.dir)
+
+	m.spoolExpired++
+	export.Map.SpoolExpired.Add(1)
+	m.Error.Printf("[%s] Dropped queued notification after %s: %d subscriber(s) never received it",
+		entry.ReqID, m.SpoolMaxAge, len(entry.Recipients))
+}
+
+// orphanSpoolEntry drops an entry nobody can receive any more. It was never
+// delivered, so it is counted apart from late deliveries.
+func (m *Messenger) orphanSpoolEntry(entry *spoolEntry, why string) {
+	_ = os.RemoveAll(entry.dir)
+
+	m.spoolOrphaned++
+	export.Map.SpoolOrphaned.Add(1)
+	m.Error.Printf("[%s] Dropped queued notification after %d attempt(s): %s",
+		entry.ReqID, entry.Attempts+1, why)
+}
+
+// notifySpoolFlushed tells admins a delivery backlog has cleared, then resets the counts.
+func (m *Messenger) notifySpoolFlushed() {
+	msg := fmt.Sprintf("📬 Notification backlog cleared: %d delivered late", m.spoolDelivered)
+	if m.spoolExpired > 0 {
+		msg += fmt.Sprintf(", %d dropped after %s", m.spoolExpired, m.SpoolMaxAge)
+	}
+
+	if m.spoolOrphaned > 0 {
+		msg += fmt.Sprintf(", %d dropped with nobody left to receive them", m.spoolOrphaned)
+	}
+
+	m.Info.Println(msg)
+	m.spoolDelivered, m.spoolExpired, m.spoolOrphaned = 0, 0, 0
+
+	admins := make([]*subscribe.Subscriber, 0)
+
+	for _, admin := range m.Subs.GetAdmins() {
+		if !chat.SubIgnored(admin) {
+			admins = append(admins, admin)
+		}
+	}
+
+	m.deliver(ReqID(IDLength), nil, msg+".", "", admins)
+}
+
+func loadSpoolEntry(dir string) (*spoolEntry, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, spoolEntryFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading spool entry: %w", err)
+	}
+
+	entry := &spoolEntry{dir: dir}
+
+	err = json.Unmarshal(buf, entry)
+	if err != nil {
+		return nil, fmt.Errorf("decoding spool entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// save writes entry.json through a temp file so a crash never leaves half an entry.
+func (e *spoolEntry) save() error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding spool entry: %w", err)
+	}
+
+	tmp := filepath.Join(e.dir, spoolEntryFile+".tmp")
+
+	err = os.WriteFile(tmp, buf, spoolFileMode)
+	if err != nil {
+		return fmt.Errorf("writing spool entry: %w", err)
+	}
+
+	err = os.Rename(tmp, filepath.Join(e.dir, spoolEntryFile))
+	if err != nil {
+		return fmt.Errorf("writing spool entry: %w", err)
+	}
+
+	return nil
+}
+
+// spoolBackoff doubles the retry wait per attempt, from spoolBackoffMin up to spoolBackoffMax.
+func spoolBackoff(attempts int) time.Duration {
+	wait := spoolBackoffMin
+	for range attempts {
+		wait *= 2
+		if wait >= spoolBackoffMax {
+			return spoolBackoffMax
+		}
+	}
+
+	return wait
+}
+
+// moveFile renames src to dst, copying when they sit on different filesystems.
+func moveFile(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	_ = os.Remove(src)
+
+	return nil
+}
+
+// copyFile copies src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, spoolFileMode)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("copying file: %w", err)
+	}
+
+	return nil
+}
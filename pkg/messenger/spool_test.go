@@ -0,0 +1,425 @@
+package messenger
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/export"
+	"golift.io/subscribe"
+)
+
+// TestMain initializes the expvar export map that the spool counts into.
+func TestMain(m *testing.M) {
+	export.Init("motifini_messenger_test")
+	os.Exit(m.Run())
+}
+
+// newTestSpool returns a Telegram-backed messenger spooling into a temp dir,
+// with one subscriber per name; the first is an admin.
+func newTestSpool(t *testing.T, fake *fakeBotAPI, names ...string) (*Messenger, []*subscribe.Subscriber) {
+	t.Helper()
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestTelegram(t, fake, &TelegramConfig{}).Messenger
+	m.Subs = subs
+	m.SpoolDir = t.TempDir()
+	m.SpoolMaxAge = time.Hour
+
+	list := make([]*subscribe.Subscriber, 0, len(names))
+	for i, name := range names {
+		list = append(list, subs.CreateSubWithID(int64(i+1), name, APITelegram, i == 0, false))
+	}
+
+	return m, list
+}
+
+// stubBackend is a Backend that records what it sends. A send waits for hold
+// to close when it is set, and fails with fail's error when that is set.
+type stubBackend struct {
+	started chan struct{} // one value per send, when not nil
+	hold    chan struct{}
+	fail    func(text, file string) error
+	mu      sync.Mutex
+	texts   []string
+	files   []string
+}
+
+const apiStub = "stub"
+
+func (b *stubBackend) Name() string                        { return apiStub }
+func (b *stubBackend) Connect() error                      { return nil }
+func (b *stubBackend) Receive(stop <-chan struct{})        { <-stop }
+func (b *stubBackend) AnswerCallback(_, _, _ string) error { return nil }
+
+func (b *stubBackend) SendText(_ string, _ int64, _, text string) error {
+	return b.send(text, "")
+}
+
+func (b *stubBackend) SendKeyboard(_ string, _ int64, _, text string, _ [][]chat.Button) error {
+	return b.send(text, "")
+}
+
+func (b *stubBackend) SendFile(upload *Upload, _ int64, _ string) error {
+	return b.send(upload.Caption, filepath.Base(upload.Path))
+}
+
+func (b *stubBackend) EditMessage(_ string, _ int64, _, _, _ string, _ [][]chat.Button) error {
+	return nil
+}
+
+func (b *stubBackend) send(text, file string) error {
+	if b.started != nil {
+		b.started <- struct{}{}
+	}
+
+	if b.hold != nil {
+		<-b.hold
+	}
+
+	if b.fail != nil {
+		if err := b.fail(text, file); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.texts = append(b.texts, text)
+	b.files = append(b.files, file)
+
+	return nil
+}
+
+func (b *stubBackend) sent() ([]string, []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.texts...), append([]string(nil), b.files...)
+}
+
+// newStubMessenger returns a messenger with only stub subscribers, one per name.
+func newStubMessenger(t *testing.T, backend *stubBackend, names ...string) (*Messenger, []*subscribe.Subscriber) {
+	t.Helper()
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Messenger{Info: discard, Debug: discard, Error: discard, Subs: subs, backends: make(map[string]Backend)}
+	m.register(backend)
+
+	list := make([]*subscribe.Subscriber, 0, len(names))
+	for i, name := range names {
+		list = append(list, subs.CreateSubWithID(int64(i+1), name, apiStub, false, false))
+	}
+
+	return m, list
+}
+
+// spoolTestFile writes a small file to spool and returns its path.
+func spoolTestFile(t *testing.T, name string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// entry.json keeps everything a replay needs, including the alert button
+// fields the Event leaves out of its JSON.
+func TestSpoolEntryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	when := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC)
+	entry := &spoolEntry{
+		ReqID:      "req",
+		Msg:        "Porch (human)",
+		File:       "porch.jpg",
+		Event:      &Event{Name: "Porch", Camera: "Porch", Classes: []string{chat.ClassHuman}, Time: when},
+		Snapshot:   "still.jpg",
+		Actions:    true,
+		CameraNum:  3,
+		Recipients: []spoolRecipient{{API: APITelegram, ID: 1}, {API: APIEmail, ID: 2}},
+		Created:    when,
+		NextTry:    when.Add(spoolBackoffMin),
+		Attempts:   2,
+		dir:        t.TempDir(),
+	}
+
+	if err := entry.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadSpoolEntry(entry.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded, entry) {
+		t.Fatalf("round trip:\n got %+v\nwant %+v", loaded, entry)
+	}
+
+	if _, err := os.Stat(filepath.Join(entry.dir, spoolEntryFile+".tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+}
+
+func TestSpoolBackoff(t *testing.T) {
+	t.Parallel()
+
+	for attempts, want := range []time.Duration{
+		30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		16 * time.Minute, spoolBackoffMax, spoolBackoffMax,
+	} {
+		if got := spoolBackoff(attempts); got != want {
+			t.Errorf("spoolBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	if got := spoolBackoff(100); got != spoolBackoffMax {
+		t.Errorf("spoolBackoff(100) = %v, want %v", got, spoolBackoffMax)
+	}
+}
+
+// A replayed alert still carries its buttons and says it was held.
+func TestSpoolReplay(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	m, subs := newTestSpool(t, fake, "ann")
+	_ = subs[0].Subscribe(chat.CameraSubKey("Porch", chat.ClassHuman))
+
+	path := spoolTestFile(t, "porch.jpg")
+	event := &Event{
+		Name: "Porch", Camera: "Porch", Classes: []string{chat.ClassMotion, chat.ClassHuman},
+		Actions: true, CameraNum: 3,
+	}
+
+	if queued := m.spoolDelivery("req", event, "Porch (human)", path, subs); queued != 1 {
+		t.Fatalf("queued %d", queued)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file not moved into the spool: %v", err)
+	}
+
+	entries := m.readSpool()
+	if len(entries) != 1 || !entries[0].Actions || entries[0].CameraNum != 3 {
+		t.Fatalf("spooled: %+v", entries)
+	}
+
+	if !m.retrySpoolEntry(entries[0]) || m.spoolDelivered != 1 || m.spoolOrphaned != 0 {
+		t.Fatalf("replay not delivered: delivered %d orphaned %d", m.spoolDelivered, m.spoolOrphaned)
+	}
+
+	if left := m.readSpool(); len(left) != 0 {
+		t.Fatalf("delivered entry left in the spool: %+v", left)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.sent) != 1 {
+		t.Fatalf("sent %d messages", len(fake.sent))
+	}
+
+	if markup := fake.sent[0].Get("reply_markup"); !strings.Contains(markup, `"a:u:3:h"`) {
+		t.Fatalf("replayed alert lost its buttons: %q", markup)
+	}
+
+	if caption := fake.sent[0].Get("caption"); !strings.Contains(caption, "Delayed") {
+		t.Fatalf("caption: %q", caption)
+	}
+}
+
+// An entry whose subscribers were all deleted or ignored is dropped, and
+// counted apart from late deliveries.
+func TestSpoolNobodyLeft(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	m, subs := newTestSpool(t, fake, "admin", "bob")
+
+	if queued := m.spoolDelivery("req", nil, "hello", "", subs[1:]); queued != 1 {
+		t.Fatalf("queued %d", queued)
+	}
+
+	chat.SetSubIgnored(subs[1], true)
+
+	entries := m.readSpool()
+	if len(entries) != 1 {
+		t.Fatalf("spooled: %+v", entries)
+	}
+
+	if !m.retrySpoolEntry(entries[0]) || m.spoolDelivered != 0 || m.spoolOrphaned != 1 {
+		t.Fatalf("delivered %d orphaned %d", m.spoolDelivered, m.spoolOrphaned)
+	}
+
+	if fake.called("sendMessage") {
+		t.Fatal("sent to an ignored subscriber")
+	}
+
+	m.flushSpool() // the spool is empty: admins hear about it.
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.sent) != 1 || !strings.Contains(fake.sent[0].Get("text"), "0 delivered late, 1 dropped with nobody") {
+		t.Fatalf("summary: %v", fake.sent)
+	}
+}
+
+// Entries past SpoolMaxAge are dropped without another try.
+func TestSpoolExpiry(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	m, subs := newTestSpool(t, fake, "admin", "bob")
+
+	if queued := m.spoolDelivery("req", nil, "hello", spoolTestFile(t, "porch.jpg"), subs[1:]); queued != 1 {
+		t.Fatalf("queued %d", queued)
+	}
+
+	entry := m.readSpool()[0]
+	entry.Created = time.Now().Add(-2 * m.SpoolMaxAge)
+
+	if err := entry.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	m.flushSpool()
+
+	if left := m.readSpool(); len(left) != 0 {
+		t.Fatalf("expired entry left in the spool: %+v", left)
+	}
+
+	if fake.called("sendPhoto") {
+		t.Fatal("expired entry was retried")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.sent) != 1 || !strings.Contains(fake.sent[0].Get("text"), "1 dropped after 1h0m0s") {
+		t.Fatalf("summary: %v", fake.sent)
+	}
+}
+
+// A half-written or corrupt entry.json is skipped and left for a person to
+// look at; entries that are not due yet wait.
+func TestSpoolTornEntry(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	m, subs := newTestSpool(t, fake, "ann")
+
+	torn := filepath.Join(m.SpoolDir, "1-torn")
+	writing := filepath.Join(m.SpoolDir, "2-writing")
+
+	for _, dir := range []string{torn, writing} {
+		if err := os.MkdirAll(dir, spoolDirMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(torn, spoolEntryFile), []byte(`{"req_id":"to`), spoolFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(writing, spoolEntryFile+".tmp"), []byte(`{}`), spoolFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if queued := m.spoolDelivery("req", nil, "hello", "", subs); queued != 1 {
+		t.Fatalf("queued %d", queued)
+	}
+
+	entries := m.readSpool()
+	if len(entries) != 1 || entries[0].ReqID != "req" {
+		t.Fatalf("entries: %+v", entries)
+	}
+
+	m.flushSpool() // the good entry is not due yet.
+
+	if fake.called("sendMessage") {
+		t.Fatal("retried an entry before it was due")
+	}
+
+	for _, dir := range []string{torn, writing, entries[0].dir} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+	}
+}
+
+// Stop waits for a flush in progress, so the next Start never flushes the
+// same entries at the same time. Run with -race.
+func TestSpoolStopStartDuringFlush(t *testing.T) {
+	t.Parallel()
+
+	backend := &stubBackend{started: make(chan struct{}, 1), hold: make(chan struct{})}
+	m, subs := newStubMessenger(t, backend, "ann")
+	m.SpoolDir = t.TempDir()
+	m.SpoolMaxAge = time.Hour
+
+	if queued := m.spoolDelivery("req", nil, "hello", "", subs); queued != 1 {
+		t.Fatalf("queued %d", queued)
+	}
+
+	entry := m.readSpool()[0]
+	entry.NextTry = time.Now().Add(-time.Second)
+
+	if err := entry.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-backend.started: // the first flush is sending; it holds there.
+	case <-time.After(5 * time.Second):
+		t.Fatal("spool was not flushed on start")
+	}
+
+	stopped := make(chan struct{})
+	go func() { m.Stop(); close(stopped) }()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned during a flush")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(backend.hold)
+	<-stopped
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Stop()
+
+	if texts, _ := backend.sent(); len(texts) != 1 {
+		t.Fatalf("sent %d times: %q", len(texts), texts)
+	}
+}
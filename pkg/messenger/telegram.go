@@ -1,10 +1,17 @@
 package messenger
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidnewhall/motifini/pkg/chat"
@@ -18,31 +25,114 @@ const (
 	mebibyte              = 1024 * 1024
 	uploadWait            = 20 * time.Second
 	telegramCaptionMaxLen = 1024
+	telegramPollRetry     = 3 * time.Second
 )
 
+// telegramAllowedUpdates are the update types requested by polling and webhook.
+var telegramAllowedUpdates = []string{"message", "callback_query"}
+
+// ErrTelegramProxy is returned when telegram.proxy is not a usable proxy URL.
+var ErrTelegramProxy = errors.New("telegram proxy must be an http://, https:// or socks5:// URL")
+
 // TelegramConfig is the Telegram bot settings from the config file.
 type TelegramConfig struct {
 	Token string `toml:"token"`
 	Debug bool   `toml:"debug"`
 	Pass  string `toml:"password"`
+	// APIURL is the base URL of a self-hosted telegram-bot-api server, e.g.
+	// http://127.0.0.1:8081. Empty uses https://api.telegram.org.
+	APIURL string `toml:"api_url"`
+	// Local says the server at APIURL runs with --local, so uploads may reach
+	// 2000 MB and /camset offers longer, larger clips.
+	Local bool `toml:"local"`
+	// Proxy is an http://, https:// or socks5:// proxy URL for all Bot API requests.
+	Proxy string `toml:"proxy"`
+	// WebhookURL switches from long polling to webhook mode: Telegram POSTs
+	// updates to this public https URL. Polling is used if it cannot be set.
+	WebhookURL string `toml:"webhook_url"`
+	// WebhookSecret is sent back by Telegram in X-Telegram-Bot-Api-Secret-Token.
+	// A random one is used when empty.
+	WebhookSecret string `toml:"webhook_secret"`
+	// WebhookListen is an address for a dedicated update listener. When empty,
+	// updates arrive on the web server at TelegramWebhookPath.
+	WebhookListen string `toml:"webhook_listen"`
+	// WebhookCert and WebhookKey serve the dedicated listener over TLS.
+	WebhookCert string `toml:"webhook_cert"`
+	WebhookKey  string `toml:"webhook_key"`
+}
+
+// telegramBackend is the Telegram Bot API Backend. It shares the Messenger's
+// subscribers, chat handler and loggers.
+type telegramBackend struct {
+	*Messenger
+
+	config *TelegramConfig
+	bot    *tgbotapi.BotAPI
+	outbox *telegramOutbox
+	hook   telegramHook
 }
 
-func (m *Messenger) connectTelegram() error {
-	var err error
+func newTelegramBackend(m *Messenger, config *TelegramConfig) *telegramBackend {
+	return &telegramBackend{Messenger: m, config: config}
+}
 
-	m.telebot, err = tgbotapi.NewBotAPI(m.Telegram.Token)
+// Name is the subscriber API served by this backend.
+func (t *telegramBackend) Name() string {
+	return APITelegram
+}
+
+// LargeFiles reports whether uploads go to a local Bot API server, which
+// accepts files far beyond the public API's 50 MB limit.
+func (c *TelegramConfig) LargeFiles() bool {
+	return c != nil && c.APIURL != "" && c.Local
+}
+
+// Connect authorizes the bot token and registers the command menu.
+func (t *telegramBackend) Connect() error {
+	client, err := t.httpClient()
+	if err != nil {
+		return err
+	}
+
+	endpoint := tgbotapi.APIEndpoint
+	if t.config.APIURL != "" {
+		endpoint = strings.TrimSuffix(t.config.APIURL, "/") + "/bot%s/%s"
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithClient(t.config.Token, endpoint, client)
 	if err != nil {
 		return fmt.Errorf("token failed: %w", err)
 	}
 
-	m.Info.Printf("Authorized on account %s", m.telebot.Self.UserName)
-	m.telebot.Debug = m.Telegram.Debug
-	m.registerTelegramCommands()
+	t.Info.Printf("Authorized on account %s", bot.Self.UserName)
+	bot.Debug = t.config.Debug
+	t.bot = bot
+	t.outbox = newTelegramOutbox(bot, t.Error)
+	t.registerCommands()
 
 	return nil
 }
 
-func (m *Messenger) registerTelegramCommands() {
+// httpClient is the Bot API client, through the configured proxy if any.
+func (t *telegramBackend) httpClient() (*http.Client, error) {
+	if t.config.Proxy == "" {
+		return &http.Client{}, nil
+	}
+
+	// The URL may carry a password, so it is left out of the error.
+	proxy, err := url.Parse(t.config.Proxy)
+	if err != nil || proxy.Host == "" ||
+		(proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" && proxy.Scheme != "socks5h") {
+		return nil, ErrTelegramProxy
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always *http.Transport.
+	transport.Proxy = http.ProxyURL(proxy)
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func (t *telegramBackend) registerCommands() {
 	cmds := []tgbotapi.BotCommand{
 		{Command: "help", Description: "Menu of everything"},
 		{Command: "sub", Description: "Subscribe (tap menu)"},
@@ -52,75 +142,168 @@ func (m *Messenger) registerTelegramCommands() {
 		{Command: "cams", Description: "Cameras — snapshot or video"},
 		{Command: "pics", Description: "Snapshot (tap a camera)"},
 		{Command: "vid", Description: "Video clip (tap a camera)"},
+		{Command: "grid", Description: "One picture of every camera"},
 		{Command: "stop", Description: "Pause alerts (tap menu)"},
 		{Command: "delay", Description: "Repeat delay (tap menu)"},
 		{Command: "events", Description: "Events — tap to subscribe"},
 	}
 
-	_, err := m.telebot.Request(tgbotapi.NewSetMyCommands(cmds...))
+	_, err := t.bot.Request(tgbotapi.NewSetMyCommands(cmds...))
 	if err != nil {
-		m.Error.Printf("Telegram setMyCommands: %v", err)
+		t.Error.Printf("Telegram setMyCommands: %v", err)
 	}
 }
 
-func (m *Messenger) startTelegram() {
-	m.Info.Println("Connecting to Telegram!")
-
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = int(time.Minute.Seconds())
-
-	updates := m.telebot.GetUpdatesChan(u)
-	defer m.telebot.StopReceivingUpdates()
+// Receive hands Telegram messages and button presses to Chat, by webhook when
+// one is configured and can be set, otherwise by long polling.
+func (t *telegramBackend) Receive(stop <-chan struct{}) {
+	updates, done := t.listen()
+	defer done()
 
 	for {
 		select {
 		case update := <-updates:
 			switch {
 			case update.CallbackQuery != nil:
-				m.recvTelegramCallback(update.CallbackQuery)
+				t.recvCallback(update.CallbackQuery, update.Thread)
 			case update.Message != nil:
-				m.recvTelegramHandler(update.Message)
+				t.recvMessage(update.Message, update.Thread)
 			}
-		case <-m.stopall:
+		case <-stop:
 			return
 		}
 	}
 }
 
-func (m *Messenger) recvTelegramCallback(callback *tgbotapi.CallbackQuery) {
+// listen returns the update channel and a func that stops it. Stopping a
+// poller aborts its long poll and waits for it, so the next one is not
+// refused with 409 Conflict.
+func (t *telegramBackend) listen() (<-chan telegramUpdate, func()) {
+	if t.config.WebhookURL != "" {
+		updates, err := t.startWebhook()
+		if err == nil {
+			return updates, t.stopWebhook
+		}
+
+		t.Error.Printf("Telegram webhook: %v; falling back to long polling", err)
+	}
+
+	t.Info.Println("Connecting to Telegram!")
+	t.deleteWebhook() // getUpdates is refused while a webhook is set.
+
+	var (
+		updates     = make(chan telegramUpdate, telegramHookBuffer)
+		ctx, cancel = context.WithCancel(context.Background())
+		poller      sync.WaitGroup
+	)
+
+	poller.Go(func() { t.poll(ctx, updates) })
+
+	return updates, func() {
+		cancel()
+		poller.Wait()
+	}
+}
+
+// poll long-polls getUpdates until ctx ends, which also aborts the request in
+// flight. It decodes the updates itself to keep the forum topic of each message.
+func (t *telegramBackend) poll(ctx context.Context, updates chan<- telegramUpdate) {
+	params := tgbotapi.Params{"timeout": strconv.Itoa(int(time.Minute.Seconds()))}
+	_ = params.AddInterface("allowed_updates", telegramAllowedUpdates)
+
+	bot := *t.bot // the library takes no context; this copy's client adds it.
+	bot.Client = contextClient{ctx: ctx, client: t.bot.Client}
+
+	for offset := 0; ctx.Err() == nil; {
+		params.AddNonZero("offset", offset)
+
+		var batch []telegramUpdate
+
+		resp, err := bot.MakeRequest("getUpdates", params)
+		if err == nil {
+			err = json.Unmarshal(resp.Result, &batch)
+		}
+
+		if err != nil && ctx.Err() != nil {
+			return
+		} else if err != nil {
+			t.Error.Printf("Telegram getUpdates: %v; retrying in %s", err, telegramPollRetry)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(telegramPollRetry):
+				continue
+			}
+		}
+
+		for _, update := range batch {
+			if update.UpdateID < offset {
+				continue
+			}
+
+			offset = update.UpdateID + 1
+
+			select {
+			case updates <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// contextClient sends every request with ctx, so ending ctx aborts a long poll.
+type contextClient struct {
+	ctx    context.Context //nolint:containedctx // tgbotapi requests take no context.
+	client tgbotapi.HTTPClient
+}
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx)) //nolint:wrapcheck // the library wraps it.
+}
+
+func (t *telegramBackend) recvCallback(callback *tgbotapi.CallbackQuery, thread int) {
 	if callback == nil || callback.From == nil || callback.Message == nil {
 		return
 	}
 
 	displayName := telegramContactName(callback.From)
-	m.Debug.Printf("Telegram callback [%d,%s] %s", callback.Message.Chat.ID, displayName, callback.Data)
+	name := displayName // the subscriber's name: the sender, or the group's title.
 
-	sub, err := m.Subs.GetSubscriberByID(callback.Message.Chat.ID, APITelegram)
+	group := telegramGroup(callback.Message.Chat)
+	if group {
+		name = callback.Message.Chat.Title
+	}
+
+	t.Debug.Printf("Telegram callback [%d,%s] %s", callback.Message.Chat.ID, displayName, callback.Data)
+
+	sub, err := t.Subs.GetSubscriberByID(callback.Message.Chat.ID, APITelegram)
 	if err != nil {
-		_, _ = m.telebot.Request(tgbotapi.NewCallback(callback.ID, "Not authenticated"))
+		_, _ = t.bot.Request(tgbotapi.NewCallback(callback.ID, "Not authenticated"))
 
 		return
 	}
 
 	if !chat.SubAuthed(sub) {
-		_, _ = m.telebot.Request(tgbotapi.NewCallback(callback.ID, "Not authenticated"))
-		m.Info.Printf("Telegram callback from %d:%s NOT authenticated", callback.Message.Chat.ID, displayName)
+		_, _ = t.bot.Request(tgbotapi.NewCallback(callback.ID, "Not authenticated"))
+		t.Info.Printf("Telegram callback from %d:%s NOT authenticated", callback.Message.Chat.ID, displayName)
 
 		return
 	}
 
-	chat.EnsureSubContact(sub, displayName)
+	chat.EnsureSubContact(sub, name)
 
-	if displayName != "" {
-		chat.SetSubDisplayName(sub, displayName)
+	if name != "" {
+		chat.SetSubDisplayName(sub, name)
 	}
 
 	// Never block the Telegram update loop on slow media fetches.
-	go m.handleTelegramCallback(callback, sub, displayName)
+	go t.handleCallback(callback, sub, displayName, group, thread)
 }
 
-func (m *Messenger) handleTelegramCallback(
-	callback *tgbotapi.CallbackQuery, sub *subscribe.Subscriber, displayName string,
+func (t *telegramBackend) handleCallback(
+	callback *tgbotapi.CallbackQuery, sub *subscribe.Subscriber, displayName string, group bool, thread int,
 ) {
 	handler := &chat.Handler{
 		API:      APITelegram,
@@ -129,93 +312,41 @@ func (m *Messenger) handleTelegramCallback(
 		From:     displayName,
 		Callback: callback.Data,
 		Text:     []string{callback.Data},
+		Thread:   thread,
+		ReadOnly: group && !t.groupEditor(callback.Message.Chat.ID, callback.From),
 	}
+	b := t.topic(thread)
+	chatID, messageID := callback.Message.Chat.ID, strconv.Itoa(callback.Message.MessageID)
 
-	m.Info.Printf("[%s] Telegram callback from %d:%s data=%s",
-		handler.ID, callback.Message.Chat.ID, displayName, callback.Data)
+	t.Info.Printf("[%s] Telegram callback from %d:%s data=%s", handler.ID, chatID, displayName, callback.Data)
+
+	if id, ok := strings.CutPrefix(callback.Data, ackPrefix); ok {
+		toast := t.acknowledge(handler.ID, id, displayName)
+		_, _ = t.bot.Request(tgbotapi.NewCallback(callback.ID, toast))
+
+		return
+	}
 
 	toast := "…"
 	mediaAll := callback.Data == "p:a" || callback.Data == "v:a"
 	mediaOne := strings.HasPrefix(callback.Data, "p:") || strings.HasPrefix(callback.Data, "v:") ||
-		strings.HasPrefix(callback.Data, "c:p:") || strings.HasPrefix(callback.Data, "c:v:")
-	if mediaAll || mediaOne {
+		strings.HasPrefix(callback.Data, "c:p:") || strings.HasPrefix(callback.Data, "c:v:") ||
+		strings.HasPrefix(callback.Data, "a:p:") || strings.HasPrefix(callback.Data, "a:v:")
+	grid := callback.Data == "g"
+	if mediaAll || mediaOne || grid {
 		toast = "Working…"
 	}
-	_, _ = m.telebot.Request(tgbotapi.NewCallback(callback.ID, toast))
-
-	if mediaAll {
-		kind := "snapshots"
-		if callback.Data == "v:a" {
-			kind = "video clips"
-		}
-		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID,
-			"Fetching "+kind+" — they'll arrive one at a time as each camera finishes…")
-		_, err := m.telebot.Send(edit)
-		if err != nil {
-			m.Error.Printf("[%s] status edit: %v", handler.ID, err)
-		}
-
-		handler.SendFile = func(path, caption string) error {
-			err := m.SendTelegramFile(handler.ID, path, caption, callback.Message.Chat.ID, displayName)
-			_ = os.Remove(path)
-
-			return err
-		}
-	}
-
-	resp := m.Chat.HandleCallback(handler)
-	m.sendTelegramReply(callback.Message.Chat.ID, callback.Message.MessageID, "", handler.ID, displayName, resp)
-}
-
-func (m *Messenger) recvTelegramHandler(msg *tgbotapi.Message) {
-	displayName := telegramContactName(msg.From)
-	m.Debug.Printf("Telegram [%d,%s] %s", msg.Chat.ID, displayName, msg.Text)
-
-	sub, err := m.Subs.GetSubscriberByID(msg.Chat.ID, APITelegram)
-	if err != nil {
-		// Every account we receive a message from gets logged as a subscriber with no subscriptions.
-		sub = m.Subs.CreateSubWithID(msg.Chat.ID, displayName,
-			APITelegram, len(m.Subs.GetAdmins()) == 0, false)
-		chat.SetSubAuthed(sub, false)
-	}
+	_, _ = t.bot.Request(tgbotapi.NewCallback(callback.ID, toast))
 
-	chat.EnsureSubContact(sub, displayName)
-	chat.SetSubUser(sub, msg.From)
-
-	if displayName != "" {
-		chat.SetSubDisplayName(sub, displayName)
-	}
-
-	if strings.TrimPrefix(msg.Text, "/") == "id "+m.Telegram.Pass {
-		chat.SetSubAuthed(sub, true)
-		sub = m.Subs.CreateSubWithID(msg.Chat.ID, displayName,
-			APITelegram, chat.SubAdmin(sub), false)
-		chat.EnsureSubContact(sub, displayName)
-		m.SendTelegram("none", "You are now authenticated.", "", msg.Chat.ID, displayName)
-		m.Info.Printf("Telegram Received from %d:%s (admin:%v, ignored:%v), 'id' command, authenticated.",
-			msg.Chat.ID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub))
-
-		return
-	} else if !chat.SubAuthed(sub) {
-		m.Info.Printf("Telegram Received from %d:%s (admin:%v, ignored:%v), NOT authenticated (ignored), rcvd: %s",
-			msg.Chat.ID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub), msg.Text)
-
-		return
-	}
-
-	// Pass the message off to the chat command handler routines.
-	handler := &chat.Handler{
-		API:  APITelegram,
-		ID:   ReqID(IDLength),
-		Sub:  sub,
-		Text: strings.Fields(msg.Text),
-		From: displayName,
+	switch {
+	case mediaAll:
+		t.albumHandler(handler, callback.Data == "v:a", chatID, messageID, displayName, thread)
+	case grid:
+		t.gridHandler(handler, chatID, messageID, displayName)
 	}
 
-	m.Info.Printf("[%s] Telegram Received from %d:%s (admin:%v, ignored:%v), size: %d, cmd: %s",
-		handler.ID, msg.Chat.ID, displayName, chat.SubAdmin(sub), chat.SubIgnored(sub),
-		len(msg.Text), handler.Text[0])
-	m.replyTelegramHandler(msg, handler)
+	resp := t.Chat.HandleCallback(handler)
+	t.sendReply(b, chatID, messageID, "", handler.ID, displayName, resp)
 }
 
 // telegramContactName prefers @username; falls back to first/last name.
@@ -231,91 +362,79 @@ func telegramContactName(from *tgbotapi.User) string {
 	return strings.TrimSpace(from.FirstName + " " + from.LastName)
 }
 
-func (m *Messenger) replyTelegramHandler(msg *tgbotapi.Message, handler *chat.Handler) {
-	resp := m.Chat.HandleCommand(handler)
-	m.sendTelegramReply(msg.Chat.ID, 0, "", handler.ID, handler.From, resp)
-}
-
-func (m *Messenger) sendTelegramReply(
-	chatID int64, messageID int, callbackID, reqID, contact string, resp *chat.Reply,
-) {
-	if resp == nil {
-		return
+// AnswerCallback stops the button spinner and shows toast (a blank one when empty).
+func (t *telegramBackend) AnswerCallback(reqID, callbackID, toast string) error {
+	if toast == "" {
+		toast = " "
 	}
 
-	m.answerTelegramCallback(callbackID, reqID, resp.Toast)
-
-	kb := telegramInlineKeyboard(resp.Keyboard)
-	switch {
-	case resp.Edit && messageID != 0:
-		m.editTelegramMessage(chatID, messageID, reqID, contact, resp.Reply, kb)
-	case resp.Reply != "" && len(resp.Files) == 0:
-		m.sendTelegramText(chatID, reqID, contact, resp.Reply, kb)
+	_, err := t.bot.Request(tgbotapi.NewCallback(callbackID, toast))
+	if err != nil {
+		return fmt.Errorf("answering telegram callback: %w", err)
 	}
 
-	m.sendTelegramReplyFiles(chatID, reqID, contact, resp)
+	return nil
 }
 
-func (m *Messenger) answerTelegramCallback(callbackID, reqID, toast string) {
-	if callbackID == "" {
-		return
-	}
-
-	if toast == "" {
-		toast = " "
-	}
-
-	_, err := m.telebot.Request(tgbotapi.NewCallback(callbackID, toast))
+// EditMessage rewrites a message in place. No rows clears its keyboard.
+func (t *telegramBackend) EditMessage(
+	reqID string, chatID int64, messageID, _, text string, rows [][]chat.Button,
+) error {
+	msgID, err := strconv.Atoi(messageID)
 	if err != nil {
-		m.Error.Printf("[%s] Telegram answerCallback: %v", reqID, err)
+		return fmt.Errorf("telegram message id %q: %w", messageID, err)
 	}
-}
 
-func (m *Messenger) editTelegramMessage(
-	chatID int64, messageID int, reqID, contact, text string, kb *tgbotapi.InlineKeyboardMarkup,
-) {
-	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
-	if kb != nil {
+	edit := tgbotapi.NewEditMessageText(chatID, msgID, text)
+	if kb := telegramInlineKeyboard(rows); kb != nil {
 		edit.ReplyMarkup = kb
 	} else {
 		empty := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
 		edit.ReplyMarkup = &empty
 	}
 
-	_, err := m.telebot.Send(edit)
+	_, err = t.send(reqID, chatID, edit)
 	if err != nil {
-		m.Error.Printf("[%s] Error editing Telegram message to %d:%s: %v", reqID, chatID, contact, err)
+		return fmt.Errorf("editing telegram message: %w", err)
 	}
+
+	return nil
 }
 
-func (m *Messenger) sendTelegramText(
-	chatID int64, reqID, contact, text string, kb *tgbotapi.InlineKeyboardMarkup,
-) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	if kb != nil {
-		msg.ReplyMarkup = kb
-	}
+// SendText sends a plain text message.
+func (t *telegramBackend) SendText(reqID string, chatID int64, _, text string) error {
+	return t.sendKeyboard(reqID, chatID, text, nil, 0)
+}
 
-	_, err := m.telebot.Send(msg)
-	if err != nil {
-		m.Error.Printf("[%s] Error Sending Telegram message to %d:%s: %v", reqID, chatID, contact, err)
-	}
+// SendKeyboard sends a text message with an inline keyboard.
+func (t *telegramBackend) SendKeyboard(reqID string, chatID int64, _, text string, rows [][]chat.Button) error {
+	return t.sendKeyboard(reqID, chatID, text, rows, 0)
 }
 
-func (m *Messenger) sendTelegramReplyFiles(chatID int64, reqID, contact string, resp *chat.Reply) {
-	for i, path := range resp.Files {
-		caption := resp.Reply
-		if i > 0 {
-			caption = ""
-		}
+func (t *telegramBackend) sendKeyboard(
+	reqID string, chatID int64, text string, rows [][]chat.Button, thread int,
+) error {
+	_, err := t.sendKeyboardMsg(reqID, chatID, text, rows, thread)
+	return err
+}
 
-		err := m.SendTelegramFile(reqID, path, caption, chatID, contact)
-		if err != nil {
-			m.Error.Printf("[%s] Error Sending Telegram file to %d:%s: %v", reqID, chatID, contact, err)
-		}
+// sendKeyboardMsg is sendKeyboard that returns the sent message.
+func (t *telegramBackend) sendKeyboardMsg(
+	reqID string, chatID int64, text string, rows [][]chat.Button, thread int,
+) (tgbotapi.Message, error) {
+	req, err := newTelegramSend("sendMessage", chatID, thread, rows)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	req.params["text"] = text
 
-		_ = os.Remove(path) // command-generated temps
+	sent, err := t.sendParams(reqID, chatID, req)
+	if err != nil {
+		return sent, fmt.Errorf("sending telegram: %w", err)
 	}
+
+	return sent, nil
 }
 
 func telegramInlineKeyboard(rows [][]chat.Button) *tgbotapi.InlineKeyboardMarkup {
@@ -337,87 +456,131 @@ func telegramInlineKeyboard(rows [][]chat.Button) *tgbotapi.InlineKeyboardMarkup
 	return &kb
 }
 
-// SendTelegram sends a text message or file to a Telegram chat ID.
-func (m *Messenger) SendTelegram(reqID, msg, path string, telegramID int64, contact string) {
-	if m.telebot == nil {
-		return
+// withKeyboard puts buttons under a message; none leaves it bare.
+func withKeyboard(base *tgbotapi.BaseChat, rows [][]chat.Button) {
+	if len(rows) > 0 {
+		base.ReplyMarkup = telegramInlineKeyboard(rows)
 	}
+}
+
+// SendTelegram sends a text message or file to a Telegram chat ID.
+// It returns the delivery error after retries, which is also logged.
+func (m *Messenger) SendTelegram(reqID, msg, path string, telegramID int64, contact string) error {
+	return m.Send(APITelegram, reqID, msg, path, telegramID, contact)
+}
 
+// SendFile sends by file_id when a previous chat already received the file
+// (upload.Ref), and re-uploads from disk if Telegram rejects the reference.
+// The first successful upload records the file_id, so a clip is uploaded once
+// no matter how many subscribers get it. Callers own cleanup of upload.Path.
+func (t *telegramBackend) SendFile(upload *Upload, telegramID int64, contact string) error {
+	return t.sendFile(upload, telegramID, contact, 0)
+}
+
+func (t *telegramBackend) sendFile(upload *Upload, telegramID int64, contact string, thread int) error {
+	_, err := t.sendFileMsg(upload, telegramID, contact, thread)
+	return err
+}
+
+// sendFileMsg is sendFile that returns the sent message.
+func (t *telegramBackend) sendFileMsg(
+	upload *Upload, telegramID int64, contact string, thread int,
+) (tgbotapi.Message, error) {
 	if contact == "" {
 		contact = "?"
 	}
 
-	if path != "" {
-		err := m.SendTelegramFile(reqID, path, msg, telegramID, contact)
-		if err != nil {
-			m.Error.Printf("[%s] Error Sending Telegram file to %d:%s: %v", reqID, telegramID, contact, err)
-		}
-	} else if msg != "" {
-		_, err := m.telebot.Send(tgbotapi.NewMessage(telegramID, msg))
-		if err != nil {
-			m.Error.Printf("[%s] Error Sending Telegram message to %d:%s: %v", reqID, telegramID, contact, err)
+	if upload.Ref != "" {
+		msg, err := t.sendMedia(upload, telegramID, contact, tgbotapi.FileID(upload.Ref), thread)
+		if err == nil {
+			return msg, nil
 		}
-	}
-}
 
-// SendTelegramFile uploads a local file to Telegram.
-// Callers own cleanup of path (so the same file can be sent to multiple chats).
-func (m *Messenger) SendTelegramFile(reqID, path, caption string, telegramID int64, contact string) error {
-	if m.telebot == nil {
-		return nil
+		t.Error.Printf("[%s] Telegram: file_id send to %d:%s failed, uploading again: %v",
+			upload.ReqID, telegramID, contact, err)
 	}
 
-	if contact == "" {
-		contact = "?"
+	msg, err := t.sendMedia(upload, telegramID, contact, tgbotapi.FilePath(upload.Path), thread)
+	if err != nil {
+		return msg, err
 	}
 
-	fileInfo, err := os.Stat(path)
+	upload.Ref = telegramFileID(&msg)
+
+	return msg, nil
+}
+
+func (t *telegramBackend) sendMedia(
+	upload *Upload, telegramID int64, contact string, file tgbotapi.RequestFileData, thread int,
+) (tgbotapi.Message, error) {
+	fileInfo, err := os.Stat(upload.Path)
 	if err != nil {
-		return fmt.Errorf("reading file: %w", err)
+		return tgbotapi.Message{}, fmt.Errorf("reading file: %w", err)
 	}
 
-	caption = trimTelegramCaption(caption)
+	reqID, path := upload.ReqID, upload.Path
+	caption := trimTelegramCaption(upload.Caption)
 	dest := fmt.Sprintf("%d:%s", telegramID, contact)
 
-	switch ext := filepath.Ext(path); ext {
+	how := "upload"
+	if !file.NeedsUpload() {
+		how = "file_id"
+	}
+
+	kind, field := "Document", "document"
+
+	switch filepath.Ext(path) {
 	case ".gif", ".jpg", ".jpeg", ".png":
-		m.Info.Printf("[%s] Telegram: Sending Photo (%s, %.2fMb) to %s",
-			reqID, path, float64(fileInfo.Size())/mebibyte, dest)
-		photo := tgbotapi.NewPhoto(telegramID, tgbotapi.FilePath(path))
-		photo.AllowSendingWithoutReply = true
-		photo.DisableNotification = false
-		photo.Caption = caption
-		_, err = m.telebot.Send(photo)
+		kind, field = "Photo", "photo"
 	case ".mov", ".m4v", ".mp4":
-		m.Info.Printf("[%s] Telegram: Sending Video (%s, %.2fMb) to %s",
-			reqID, path, float64(fileInfo.Size())/mebibyte, dest)
-		video := tgbotapi.NewVideo(telegramID, tgbotapi.FilePath(path))
-		video.SupportsStreaming = true
-		video.Caption = caption
-		started := time.Now()
-		_, err = m.telebot.Send(video)
-		if err == nil {
-			m.Info.Printf("[%s] Telegram: Sent Video to %s in %s", reqID, dest, time.Since(started).Round(time.Millisecond))
-		}
+		kind, field = "Video", "video"
 	case ".wav", ".mp3":
-		m.Info.Printf("[%s] Telegram: Sending Audio (%s, %.2fMb) to %s",
-			reqID, path, float64(fileInfo.Size())/mebibyte, dest)
-		audio := tgbotapi.NewAudio(telegramID, tgbotapi.FilePath(path))
-		audio.Caption = caption
-		_, err = m.telebot.Send(audio)
-	default:
-		m.Info.Printf("[%s] Telegram: Sending Document (%s, %.2fMb) to %s",
-			reqID, path, float64(fileInfo.Size())/mebibyte, dest)
-		doc := tgbotapi.NewDocument(telegramID, tgbotapi.FilePath(path))
-		doc.Caption = caption
-		_, err = m.telebot.Send(doc)
+		kind, field = "Audio", "audio"
 	}
 
+	req, err := newTelegramSend("send"+kind, telegramID, thread, upload.Keyboard)
 	if err != nil {
-		return fmt.Errorf("sending telegram: %w", err)
+		return tgbotapi.Message{}, err
 	}
 
-	return nil
+	req.params.AddNonEmpty("caption", caption)
+	req.params.AddBool("supports_streaming", kind == "Video")
+	req.files = []tgbotapi.RequestFile{{Name: field, Data: file}}
+
+	t.Info.Printf("[%s] Telegram: Sending %s (%s, %.2fMb, %s) to %s",
+		reqID, kind, path, float64(fileInfo.Size())/mebibyte, how, dest)
+
+	started := time.Now()
+
+	msg, err := t.sendParams(reqID, telegramID, req)
+	if err == nil && kind == "Video" {
+		t.Info.Printf("[%s] Telegram: Sent Video to %s in %s", reqID, dest, time.Since(started).Round(time.Millisecond))
+	}
+
+	if err != nil {
+		return msg, fmt.Errorf("sending telegram: %w", err)
+	}
+
+	return msg, nil
+}
+
+// telegramFileID returns the file_id of the media in a sent message.
+// Telegram may turn a silent MP4 into an animation, so check that too.
+func telegramFileID(msg *tgbotapi.Message) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return msg.Photo[len(msg.Photo)-1].FileID // largest size last
+	case msg.Video != nil:
+		return msg.Video.FileID
+	case msg.Animation != nil:
+		return msg.Animation.FileID
+	case msg.Audio != nil:
+		return msg.Audio.FileID
+	case msg.Document != nil:
+		return msg.Document.FileID
+	default:
+		return ""
+	}
 }
 
 func trimTelegramCaption(caption string) string {
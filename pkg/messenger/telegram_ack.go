@@ -0,0 +1,75 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendAlert sends an alert that awaits acknowledgement: the file, or the text
+// when there is none, with buttons under it. It returns the message ID.
+func (t *telegramBackend) sendAlert(
+	upload *Upload, reqID string, chatID int64, contact, text string, rows [][]chat.Button,
+) (string, error) {
+	return t.sendAlertIn(upload, reqID, chatID, contact, text, rows, 0)
+}
+
+// sendAlert sends an alert that awaits acknowledgement into the topic.
+func (t *telegramTopic) sendAlert(
+	upload *Upload, reqID string, chatID int64, contact, text string, rows [][]chat.Button,
+) (string, error) {
+	return t.sendAlertIn(upload, reqID, chatID, contact, text, rows, t.thread)
+}
+
+func (t *telegramBackend) sendAlertIn(
+	upload *Upload, reqID string, chatID int64, contact, text string, rows [][]chat.Button, thread int,
+) (string, error) {
+	var (
+		msg tgbotapi.Message
+		err error
+	)
+
+	if upload == nil {
+		msg, err = t.sendKeyboardMsg(reqID, chatID, text, rows, thread)
+	} else {
+		upload.Keyboard = rows
+		msg, err = t.sendFileMsg(upload, chatID, contact, thread)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(msg.MessageID), nil
+}
+
+// editAlert rewrites an alert sent by sendAlert: its caption when it carries
+// a file, otherwise its text.
+func (t *telegramBackend) editAlert(
+	reqID string, chatID int64, messageID string, media bool, text string, rows [][]chat.Button,
+) error {
+	if !media {
+		return t.EditMessage(reqID, chatID, messageID, "", text, rows)
+	}
+
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("telegram message id %q: %w", messageID, err)
+	}
+
+	edit := tgbotapi.NewEditMessageCaption(chatID, msgID, trimTelegramCaption(text))
+	if kb := telegramInlineKeyboard(rows); kb != nil {
+		edit.ReplyMarkup = kb
+	} else {
+		edit.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	}
+
+	_, err = t.send(reqID, chatID, edit)
+	if err != nil {
+		return fmt.Errorf("editing telegram caption: %w", err)
+	}
+
+	return nil
+}
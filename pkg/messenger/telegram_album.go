@@ -0,0 +1,124 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// albumHandler sets up an all-camera snapshot or clip request: captures go out
+// in albums as they fill, and the "Fetching…" message that holds the menu
+// shows which camera is being captured until the summary replaces it.
+func (t *telegramBackend) albumHandler(
+	handler *chat.Handler, video bool, chatID int64, messageID, contact string, thread int,
+) {
+	kind := "snapshots"
+	if video {
+		kind = "video clips"
+	}
+
+	status := func(text string) {
+		err := t.EditMessage(handler.ID, chatID, messageID, contact, text, nil)
+		if err != nil {
+			t.Error.Printf("[%s] status edit: %v", handler.ID, err)
+		}
+	}
+
+	status(fmt.Sprintf("Fetching %s — they'll arrive in albums of up to %d as cameras finish…",
+		kind, chat.MaxAlbumFiles))
+
+	handler.Progress = func(text string) { status("Fetching " + kind + " — " + text) }
+	handler.SendAlbum = func(files []chat.AlbumFile) error {
+		defer func() {
+			for _, file := range files {
+				_ = os.Remove(file.Path)
+			}
+		}()
+
+		return t.sendAlbum(handler.ID, chatID, contact, files, thread)
+	}
+	handler.SendFile = func(path, caption string) error {
+		err := t.sendFile(&Upload{ReqID: handler.ID, Path: path, Caption: caption}, chatID, contact, thread)
+		_ = os.Remove(path)
+
+		return err
+	}
+}
+
+// gridHandler shows which camera the grid is waiting on in the message that
+// holds the menu, until the finished grid's summary replaces it.
+func (t *telegramBackend) gridHandler(handler *chat.Handler, chatID int64, messageID, contact string) {
+	handler.Progress = func(text string) {
+		err := t.EditMessage(handler.ID, chatID, messageID, contact, "Building the grid — "+text, nil)
+		if err != nil {
+			t.Error.Printf("[%s] status edit: %v", handler.ID, err)
+		}
+	}
+}
+
+// sendAlbum sends files as one media group, each with its own caption. A lone
+// file is sent on its own (an album needs two), and if Telegram refuses the
+// album the files are sent one at a time instead. Callers own the files.
+func (t *telegramBackend) sendAlbum(
+	reqID string, chatID int64, contact string, files []chat.AlbumFile, thread int,
+) error {
+	if len(files) == 1 {
+		return t.sendFile(&Upload{ReqID: reqID, Path: files[0].Path, Caption: files[0].Caption}, chatID, contact, thread)
+	}
+
+	req, err := newTelegramSend("sendMediaGroup", chatID, thread, nil)
+	if err != nil {
+		return err
+	}
+
+	media := make([]telegramInputMedia, 0, len(files))
+
+	for idx, file := range files {
+		name := fmt.Sprintf("file-%d", idx)
+		item := telegramInputMedia{Type: "photo", Media: "attach://" + name, Caption: trimTelegramCaption(file.Caption)}
+
+		switch filepath.Ext(file.Path) {
+		case ".mov", ".m4v", ".mp4":
+			item.Type, item.SupportsStreaming = "video", true
+		}
+
+		media = append(media, item)
+		req.files = append(req.files, tgbotapi.RequestFile{Name: name, Data: tgbotapi.FilePath(file.Path)})
+	}
+
+	if err = req.params.AddInterface("media", media); err != nil {
+		return fmt.Errorf("encoding album: %w", err)
+	}
+
+	req.album = true
+
+	t.Info.Printf("[%s] Telegram: Sending album of %d files to %d:%s", reqID, len(files), chatID, contact)
+
+	_, err = t.sendParams(reqID, chatID, req)
+	if err == nil {
+		return nil
+	}
+
+	t.Error.Printf("[%s] Telegram: album to %d:%s failed, sending files one at a time: %v",
+		reqID, chatID, contact, err)
+
+	errs := make([]error, 0, len(files))
+	for _, file := range files {
+		errs = append(errs, t.sendFile(&Upload{ReqID: reqID, Path: file.Path, Caption: file.Caption},
+			chatID, contact, thread))
+	}
+
+	return errors.Join(errs...)
+}
+
+// telegramInputMedia is one item of an album, its file attached by name.
+type telegramInputMedia struct {
+	Type              string `json:"type"`
+	Media             string `json:"media"`
+	Caption           string `json:"caption,omitempty"`
+	SupportsStreaming bool   `json:"supports_streaming,omitempty"`
+}
@@ -0,0 +1,134 @@
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegramUpdate is an update plus the forum topic its message belongs to,
+// which this version of the Bot API library does not decode.
+type telegramUpdate struct {
+	tgbotapi.Update
+	// Thread is the message_thread_id of a message posted in a forum topic,
+	// or of the message under a pressed button. 0 outside topics.
+	Thread int
+}
+
+// telegramTopicFields are the forum fields missing from tgbotapi.Message.
+type telegramTopicFields struct {
+	ThreadID int  `json:"message_thread_id"`
+	IsTopic  bool `json:"is_topic_message"`
+}
+
+// UnmarshalJSON decodes the update, then the topic of its message. Replies in
+// groups without topics carry a message_thread_id too, so only is_topic_message counts.
+func (u *telegramUpdate) UnmarshalJSON(raw []byte) error {
+	if err := json.Unmarshal(raw, &u.Update); err != nil {
+		return fmt.Errorf("decoding telegram update: %w", err)
+	}
+
+	var topics struct {
+		Message  *telegramTopicFields `json:"message"`
+		Callback *struct {
+			Message *telegramTopicFields `json:"message"`
+		} `json:"callback_query"`
+	}
+
+	if err := json.Unmarshal(raw, &topics); err != nil {
+		return fmt.Errorf("decoding telegram update: %w", err)
+	}
+
+	msg := topics.Message
+	if topics.Callback != nil {
+		msg = topics.Callback.Message
+	}
+
+	if msg != nil && msg.IsTopic {
+		u.Thread = msg.ThreadID
+	}
+
+	return nil
+}
+
+// telegramTopic is the Telegram backend aimed at one forum topic: new messages
+// and files go into the topic. Edits and button answers need no topic.
+type telegramTopic struct {
+	*telegramBackend
+	thread int
+}
+
+// topic returns the backend that sends into a forum topic; 0 is the chat itself.
+func (t *telegramBackend) topic(thread int) Backend {
+	if thread == 0 {
+		return t
+	}
+
+	return &telegramTopic{telegramBackend: t, thread: thread}
+}
+
+// SendText sends a plain text message into the topic.
+func (t *telegramTopic) SendText(reqID string, chatID int64, _, text string) error {
+	return t.sendKeyboard(reqID, chatID, text, nil, t.thread)
+}
+
+// SendKeyboard sends a text message with buttons into the topic.
+func (t *telegramTopic) SendKeyboard(reqID string, chatID int64, _, text string, rows [][]chat.Button) error {
+	return t.sendKeyboard(reqID, chatID, text, rows, t.thread)
+}
+
+// SendFile sends a file into the topic.
+func (t *telegramTopic) SendFile(upload *Upload, chatID int64, contact string) error {
+	return t.sendFile(upload, chatID, contact, t.thread)
+}
+
+// telegramGroup reports whether a chat is a group rather than a person.
+func telegramGroup(c *tgbotapi.Chat) bool {
+	return c != nil && (c.IsGroup() || c.IsSuperGroup())
+}
+
+// recvMessage hands a text message to receiveText. In a group the group is
+// the subscriber, and the sender's rights decide what they may change.
+func (t *telegramBackend) recvMessage(msg *tgbotapi.Message, thread int) {
+	in := &inbound{
+		chatID: msg.Chat.ID,
+		name:   telegramContactName(msg.From),
+		user:   msg.From,
+		text:   msg.Text,
+		thread: thread,
+	}
+
+	if telegramGroup(msg.Chat) {
+		in.group, in.from, in.name, in.user = true, in.name, msg.Chat.Title, msg.Chat
+		// An anonymous group admin posts as the group itself.
+		anonymous := msg.SenderChat != nil && msg.SenderChat.ID == msg.Chat.ID
+		in.canEdit = func() bool { return anonymous || t.groupEditor(msg.Chat.ID, msg.From) }
+	}
+
+	t.receiveText(t.topic(thread), in, t.config.Pass)
+}
+
+// groupEditor reports whether a group member may change the group's
+// subscriptions: bot admins (by their private chat) and the group's own admins.
+func (t *telegramBackend) groupEditor(chatID int64, from *tgbotapi.User) bool {
+	if from == nil {
+		return false
+	}
+
+	if sub, err := t.Subs.GetSubscriberByID(from.ID, APITelegram); err == nil &&
+		chat.SubAdmin(sub) && !chat.SubIgnored(sub) {
+		return true
+	}
+
+	member, err := t.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: from.ID},
+	})
+	if err != nil {
+		t.Error.Printf("Telegram getChatMember %d in %d: %v", from.ID, chatID, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
@@ -0,0 +1,725 @@
+package messenger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golift.io/subscribe"
+)
+
+// fakeBotAPI answers getMe, setWebhook, deleteWebhook, getUpdates,
+// getChatMember and the send and edit methods, and records the methods called
+// and messages sent or edited.
+type fakeBotAPI struct {
+	mu          sync.Mutex
+	calls       []string
+	sent        []url.Values
+	secret      string
+	status      string // getChatMember status
+	refuseSet   bool
+	refuseAlbum bool
+	refuseRef   bool // reject files sent by file_id
+	holdPoll    bool // getUpdates waits, like a long poll, until the client goes away
+	polling     int  // getUpdates requests open now
+}
+
+func (f *fakeBotAPI) handler(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if err := r.ParseMultipartForm(mebibyte); err != nil {
+		_ = r.ParseForm()
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	refuse, refuseAlbum, refuseRef := f.refuseSet, f.refuseAlbum, f.refuseRef
+	if method == "setWebhook" {
+		f.secret = r.PostForm.Get("secret_token")
+	}
+
+	if method == "sendMessage" || method == "sendPhoto" || method == "sendMediaGroup" ||
+		strings.HasPrefix(method, "editMessage") {
+		f.sent = append(f.sent, r.PostForm)
+	}
+	f.mu.Unlock()
+
+	switch {
+	case method == "getMe":
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"motifini_bot"}}`))
+	case method == "setWebhook" && refuse:
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook"}`))
+	case method == "getChatMember":
+		_, _ = fmt.Fprintf(w, `{"ok":true,"result":{"user":{"id":7},"status":%q}}`, f.status)
+	case method == "sendMediaGroup" && refuseAlbum:
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`))
+	case method == "sendMediaGroup":
+		_, _ = w.Write([]byte(`{"ok":true,"result":[{"message_id":10,"chat":{"id":1}},{"message_id":11,"chat":{"id":1}}]}`))
+	case method == "sendPhoto" && refuseRef && r.PostForm.Get("photo") != "":
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: wrong file identifier"}`))
+	case method == "sendPhoto":
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":12,"chat":{"id":1},"photo":[{"file_id":"p"}]}}`))
+	case method == "sendMessage", strings.HasPrefix(method, "editMessage"):
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":9,"chat":{"id":-100}}}`))
+	case method == "getUpdates" && f.holdPoll:
+		f.mu.Lock()
+		f.polling++
+		f.mu.Unlock()
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+
+		f.mu.Lock()
+		f.polling--
+		f.mu.Unlock()
+	case method == "getUpdates":
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"ok":true,"result":[]}`))
+	default:
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (f *fakeBotAPI) called(method string) bool {
+	return f.count(method) > 0
+}
+
+func (f *fakeBotAPI) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+
+	for _, call := range f.calls {
+		if call == method {
+			count++
+		}
+	}
+
+	return count
+}
+
+func newTestTelegram(t *testing.T, fake *fakeBotAPI, config *TelegramConfig) *telegramBackend {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(fake.handler))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("NewBotAPI: %v", err)
+	}
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Messenger{Info: discard, Debug: discard, Error: discard, backends: make(map[string]Backend)}
+	backend := newTelegramBackend(m, config)
+	backend.bot = bot
+	m.register(backend)
+
+	return backend
+}
+
+func postUpdate(m *Messenger, secret string) int {
+	body := `{"update_id":7,"message":{"message_id":1,"chat":{"id":42},"text":"/help"}}`
+	req := httptest.NewRequest(http.MethodPost, TelegramWebhookPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		req.Header.Set(telegramSecretHeader, secret)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeTelegramWebhook(rec, req)
+
+	return rec.Code
+}
+
+// Updates are only accepted with the secret token given to setWebhook.
+func TestTelegramWebhookSecret(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{WebhookURL: "https://cams.example.org/tg"})
+
+	if code := postUpdate(backend.Messenger, "anything"); code != http.StatusNotFound {
+		t.Fatalf("before webhook mode: got %d, want 404", code)
+	}
+
+	updates, done := backend.listen()
+	defer done()
+
+	if !fake.called("setWebhook") || fake.secret == "" {
+		t.Fatalf("setWebhook not called with a secret: %v", fake.calls)
+	}
+
+	if code := postUpdate(backend.Messenger, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("bad secret: got %d, want 401", code)
+	}
+
+	if code := postUpdate(backend.Messenger, fake.secret); code != http.StatusOK {
+		t.Fatalf("good secret: got %d, want 200", code)
+	}
+
+	select {
+	case update := <-updates:
+		if update.Message == nil || update.Message.Text != "/help" || update.Message.Chat.ID != 42 {
+			t.Fatalf("update: %+v", update)
+		}
+	default:
+		t.Fatal("update was not queued")
+	}
+}
+
+// A refused setWebhook falls back to long polling, after clearing any webhook.
+func TestTelegramWebhookFallback(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{refuseSet: true}
+	backend := newTestTelegram(t, fake, &TelegramConfig{WebhookURL: "https://cams.example.org/tg"})
+
+	_, err := backend.startWebhook()
+	if !errors.Is(err, ErrTelegramWebhook) {
+		t.Fatalf("startWebhook: %v", err)
+	}
+
+	updates, done := backend.listen()
+	defer done()
+
+	if updates == nil || !fake.called("deleteWebhook") {
+		t.Fatalf("expected polling after deleteWebhook: %v", fake.calls)
+	}
+
+	if code := postUpdate(backend.Messenger, fake.secret); code != http.StatusNotFound {
+		t.Fatalf("webhook route while polling: got %d, want 404", code)
+	}
+}
+
+// Connect talks to api_url when set, and rejects a proxy it cannot use.
+func TestTelegramConnectAPIURL(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	server := httptest.NewServer(http.HandlerFunc(fake.handler))
+	t.Cleanup(server.Close)
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Messenger{Info: discard, Debug: discard, Error: discard}
+
+	backend := newTelegramBackend(m, &TelegramConfig{Token: "token", APIURL: server.URL + "/", Local: true})
+	if err := backend.Connect(); err != nil || !fake.called("getMe") || !backend.config.LargeFiles() {
+		t.Fatalf("Connect via api_url: %v, calls %v", err, fake.calls)
+	}
+
+	backend = newTelegramBackend(m, &TelegramConfig{Token: "token", Proxy: "ftp://proxy.local:21"})
+	if err := backend.Connect(); !errors.Is(err, ErrTelegramProxy) {
+		t.Fatalf("bad proxy: %v", err)
+	}
+}
+
+// Stop aborts the open long poll and waits for it, so the next Start does not
+// poll alongside it (Telegram answers that with 409 Conflict).
+func TestTelegramStopEndsPoll(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{holdPoll: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.handler))
+	t.Cleanup(server.Close)
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Messenger{Info: discard, Debug: discard, Error: discard, backends: make(map[string]Backend)}
+	m.register(newTelegramBackend(m, &TelegramConfig{Token: "token", APIURL: server.URL + "/"}))
+
+	polling := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		return fake.polling
+	}
+
+	for range 2 {
+		if err := m.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		for deadline := time.Now().Add(5 * time.Second); polling() == 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("no long poll started")
+			}
+		}
+
+		start := time.Now()
+		m.Stop()
+
+		if took := time.Since(start); took > 5*time.Second {
+			t.Fatalf("Stop waited out the long poll: %v", took)
+		}
+
+		for deadline := time.Now().Add(5 * time.Second); polling() != 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d long poll(s) still open after Stop", polling())
+			}
+		}
+	}
+}
+
+// A group is one subscriber that never becomes admin. Members who are not
+// group admins cannot change its alerts, and replies go back to their topic.
+func TestTelegramGroupTopic(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{status: "member"}
+	backend := newTestTelegram(t, fake, &TelegramConfig{Pass: "secret"})
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.Subs = subs
+	backend.Chat = chat.New(&chat.Chat{Subs: subs})
+
+	receive := func(text string) url.Values {
+		t.Helper()
+
+		raw := `{"update_id":1,"message":{"message_id":40,"message_thread_id":5,"is_topic_message":true,` +
+			`"from":{"id":7,"first_name":"Ann"},"chat":{"id":-100,"type":"supergroup","title":"Family"},` +
+			`"text":` + strconv.Quote(text) + `}}`
+
+		var update telegramUpdate
+		if err := json.Unmarshal([]byte(raw), &update); err != nil || update.Thread != 5 {
+			t.Fatalf("decode: %v, thread %d", err, update.Thread)
+		}
+
+		backend.recvMessage(update.Message, update.Thread)
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		if len(fake.sent) == 0 {
+			t.Fatalf("%s: no reply", text)
+		}
+
+		return fake.sent[len(fake.sent)-1]
+	}
+
+	receive("/id secret")
+
+	sub, err := subs.GetSubscriberByID(-100, APITelegram)
+	if err != nil || !chat.SubGroup(sub) || chat.SubAdmin(sub) || sub.GetContact() != "Family" {
+		t.Fatalf("group subscriber: %v %+v", err, sub)
+	}
+
+	reply := receive("/stop 60")
+	if !strings.Contains(reply.Get("text"), "group admins") || reply.Get("message_thread_id") != "5" ||
+		reply.Get("reply_to_message_id") != "" {
+		t.Fatalf("member reply: %v", reply)
+	}
+}
+
+// Snapshots go out as one media group; a lone file, or an album Telegram
+// refuses, is sent as separate photos.
+func TestTelegramSendAlbum(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := make([]chat.AlbumFile, 0, 2)
+
+	for _, name := range []string{"Porch", "Garage"} {
+		path := filepath.Join(dir, name+".jpg")
+		if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		files = append(files, chat.AlbumFile{Path: path, Caption: name})
+	}
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	if err := backend.sendAlbum("req", 1, "ann", files, 5); err != nil {
+		t.Fatalf("album: %v", err)
+	}
+
+	fake.mu.Lock()
+	album := fake.sent[0]
+	fake.mu.Unlock()
+
+	if album.Get("message_thread_id") != "5" ||
+		album.Get("media") != `[{"type":"photo","media":"attach://file-0","caption":"Porch"},`+
+			`{"type":"photo","media":"attach://file-1","caption":"Garage"}]` {
+		t.Fatalf("album request: %v", album)
+	}
+
+	if err := backend.sendAlbum("req", 1, "ann", files[:1], 0); err != nil {
+		t.Fatalf("single: %v", err)
+	}
+
+	if fake.count("sendMediaGroup") != 1 || fake.count("sendPhoto") != 1 {
+		t.Fatalf("calls: %v", fake.calls)
+	}
+
+	fake = &fakeBotAPI{refuseAlbum: true}
+	backend = newTestTelegram(t, fake, &TelegramConfig{})
+
+	if err := backend.sendAlbum("req", 1, "ann", files, 5); err != nil || fake.count("sendPhoto") != len(files) {
+		t.Fatalf("fallback: %v, calls %v", err, fake.calls)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for _, sent := range fake.sent {
+		if sent.Get("message_thread_id") != "5" {
+			t.Fatalf("photo left the topic: %v", sent)
+		}
+	}
+}
+
+// A camera alert carries buttons for the subscription that fired; a
+// subscriber without one gets the file bare.
+func TestTelegramAlertButtons(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	human := subs.CreateSubWithID(1, "ann", APITelegram, false, false)
+	_ = human.Subscribe(chat.CameraSubKey("Porch", chat.ClassHuman))
+	other := subs.CreateSubWithID(2, "bob", APITelegram, false, false)
+	_ = other.Subscribe("Doorbell")
+
+	path := filepath.Join(t.TempDir(), "porch.jpg")
+	if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	event := &Event{
+		Name: "Porch", Camera: "Porch", Classes: []string{chat.ClassMotion, chat.ClassHuman},
+		Actions: true, CameraNum: 3,
+	}
+
+	delivery := backend.deliver("req", event, "Porch (human)", path, []*subscribe.Subscriber{human, other})
+	if delivery.Sent != 2 {
+		t.Fatalf("delivery: %+v", delivery)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	markup := make(map[string]string, len(fake.sent))
+	for _, sent := range fake.sent {
+		markup[sent.Get("chat_id")] = sent.Get("reply_markup")
+	}
+
+	if !strings.Contains(markup["1"], `"a:u:3:h"`) || !strings.Contains(markup["1"], `"a:p:3"`) {
+		t.Fatalf("human subscriber's buttons: %s", markup["1"])
+	}
+
+	if markup["2"] != "" {
+		t.Fatalf("event subscriber got buttons: %s", markup["2"])
+	}
+}
+
+// An alert that needs acknowledgement goes to tier 0 with an Acknowledge
+// button, escalates to tier 1 when nobody presses it, and once acknowledged
+// every copy names who did. Each tier is reported alerted as it goes out.
+func TestTelegramAckEscalation(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.Subs = subs
+	_ = subs.Events.New("garage_opened", &subscribe.Rules{})
+	chat.SetAckWindow(subs.Events, "garage_opened", 50*time.Millisecond)
+
+	ann := subs.CreateSubWithID(1, "ann", APITelegram, false, false)
+	_ = ann.Subscribe("garage_opened")
+	bob := subs.CreateSubWithID(2, "bob", APITelegram, false, false)
+	_ = bob.Subscribe("garage_opened")
+	chat.SetSubTier(bob, "garage_opened", 1)
+
+	var (
+		alertMu sync.Mutex
+		alerted []string
+	)
+
+	event := &Event{Name: "garage_opened", Time: time.Now(), Alerted: func(subs []*subscribe.Subscriber) {
+		alertMu.Lock()
+		defer alertMu.Unlock()
+
+		for _, sub := range subs {
+			alerted = append(alerted, sub.Contact)
+		}
+	}}
+
+	delivery := backend.SendEvent("req", event, "Garage opened", "", []*subscribe.Subscriber{ann, bob})
+	if delivery.Sent != 1 {
+		t.Fatalf("first tier: %+v", delivery)
+	}
+
+	alertMu.Lock()
+	if len(alerted) != 1 || alerted[0] != "ann" {
+		t.Fatalf("alerted with the first tier: %v", alerted)
+	}
+	alertMu.Unlock()
+
+	for deadline := time.Now().Add(2 * time.Second); fake.count("sendMessage") < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("no escalation: %v", fake.calls)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	backend.ackMu.Lock()
+	ids := make([]string, 0, len(backend.acks))
+	for id := range backend.acks {
+		ids = append(ids, id)
+	}
+	backend.ackMu.Unlock()
+
+	if len(ids) != 1 {
+		t.Fatalf("tracked alerts: %v", ids)
+	}
+
+	alertMu.Lock()
+	if len(alerted) != 2 || alerted[1] != "bob" {
+		t.Fatalf("alerted after escalation: %v", alerted)
+	}
+	alertMu.Unlock()
+
+	if toast := backend.acknowledge("req", ids[0], "ann"); toast != "Acknowledged" {
+		t.Fatalf("ack toast: %q", toast)
+	}
+
+	if toast := backend.acknowledge("req", ids[0], "bob"); !strings.Contains(toast, "ann") {
+		t.Fatalf("second ack toast: %q", toast)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	edited := 0
+
+	for _, sent := range fake.sent {
+		if sent.Get("message_id") == "" {
+			if !strings.Contains(sent.Get("reply_markup"), `"ack:`+ids[0]+`"`) {
+				t.Fatalf("alert to %s without Acknowledge: %s", sent.Get("chat_id"), sent.Get("reply_markup"))
+			}
+
+			continue
+		}
+
+		if !strings.Contains(sent.Get("text"), "Acknowledged by ann") {
+			t.Fatalf("edit: %v", sent)
+		}
+
+		edited++
+	}
+
+	if edited != 2 {
+		t.Fatalf("edited %d copies, want 2", edited)
+	}
+}
+
+// Stop drops alerts waiting for acknowledgement; none escalates afterwards.
+func TestTelegramAckStop(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.Subs = subs
+	_ = subs.Events.New("garage_opened", &subscribe.Rules{})
+	chat.SetAckWindow(subs.Events, "garage_opened", 50*time.Millisecond)
+
+	ann := subs.CreateSubWithID(1, "ann", APITelegram, false, false)
+	_ = ann.Subscribe("garage_opened")
+	bob := subs.CreateSubWithID(2, "bob", APITelegram, false, false)
+	_ = bob.Subscribe("garage_opened")
+	chat.SetSubTier(bob, "garage_opened", 1)
+
+	event := &Event{Name: "garage_opened", Time: time.Now()}
+
+	delivery := backend.SendEvent("req", event, "Garage opened", "", []*subscribe.Subscriber{ann, bob})
+	if delivery.Sent != 1 {
+		t.Fatalf("first tier: %+v", delivery)
+	}
+
+	backend.stopall = make(chan struct{})
+	backend.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	if sent := fake.count("sendMessage"); sent != 1 {
+		t.Fatalf("escalated after Stop: %d messages", sent)
+	}
+
+	backend.ackMu.Lock()
+	defer backend.ackMu.Unlock()
+
+	if len(backend.acks) != 0 {
+		t.Fatalf("alerts kept after Stop: %d", len(backend.acks))
+	}
+}
+
+// A clip past the standard size goes only to Telegram on a local Bot API
+// server; other services get the message and a note instead.
+func TestTelegramLargeClipOnly(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		body []byte
+		file string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ = io.ReadAll(r.Body)
+		file = r.Header.Get("Filename")
+	}))
+	defer server.Close()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+	backend.Chat = &chat.Chat{LargeClips: true}
+	backend.register(newNtfyBackend(backend.Messenger, &NtfyConfig{}))
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tg := subs.CreateSubWithID(1, "ann", APITelegram, false, false)
+	ntfy := subs.CreateSub(server.URL+"/porch", APINtfy, false, false)
+
+	path := filepath.Join(t.TempDir(), "porch.jpg")
+	if err := os.WriteFile(path, make([]byte, chat.MaxClipSizeBytes+1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := backend.deliver("req", nil, "Porch", path, []*subscribe.Subscriber{tg, ntfy})
+	if delivery.Sent != 2 {
+		t.Fatalf("delivery: %+v", delivery)
+	}
+
+	if !fake.called("sendPhoto") {
+		t.Fatal("Telegram did not get the clip")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file != "" || !strings.HasPrefix(string(body), "Porch\n\n(The 3.0 MB clip is too large") {
+		t.Fatalf("ntfy got %q %q", file, body)
+	}
+}
+
+// A file goes up once; later chats get it by the file_id Telegram returned.
+func TestTelegramSendFileReusesFileID(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	subs, err := subscribe.GetDB(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := []*subscribe.Subscriber{
+		subs.CreateSubWithID(1, "ann", APITelegram, false, false),
+		subs.CreateSubWithID(2, "bob", APITelegram, false, false),
+		subs.CreateSubWithID(3, "cat", APITelegram, false, false),
+	}
+
+	path := filepath.Join(t.TempDir(), "porch.jpg")
+	if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery := backend.deliver("req", nil, "Porch", path, list); delivery.Sent != len(list) {
+		t.Fatalf("delivery: %+v", delivery)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	refs := 0
+
+	for _, sent := range fake.sent {
+		if sent.Get("photo") == "p" {
+			refs++
+		} else if sent.Get("photo") != "" {
+			t.Fatalf("unexpected photo param: %v", sent)
+		}
+	}
+
+	if len(fake.sent) != len(list) || refs != len(list)-1 {
+		t.Fatalf("want 1 upload and %d file_id sends, got %d sends, %d by file_id", len(list)-1, len(fake.sent), refs)
+	}
+}
+
+// When Telegram rejects a file_id, the file is uploaded again and the new
+// file_id kept for the next chat.
+func TestTelegramSendFileStaleFileID(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeBotAPI{refuseRef: true}
+	backend := newTestTelegram(t, fake, &TelegramConfig{})
+
+	path := filepath.Join(t.TempDir(), "porch.jpg")
+	if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := &Upload{ReqID: "req", Path: path, Caption: "Porch", Ref: "stale"}
+
+	if err := backend.SendFile(upload, 1, "ann"); err != nil {
+		t.Fatalf("SendFile: %v", err)
+	}
+
+	if fake.count("sendPhoto") != 2 || upload.Ref != "p" {
+		t.Fatalf("calls %v, ref %q", fake.calls, upload.Ref)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.sent[0].Get("photo") != "stale" || fake.sent[1].Get("photo") != "" {
+		t.Fatalf("want the file_id, then an upload: %v", fake.sent)
+	}
+}
@@ -0,0 +1,190 @@
+package messenger
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TelegramWebhookPath is where the web server accepts Telegram updates in
+// webhook mode. A reverse proxy forwards the public webhook_url here.
+const TelegramWebhookPath = "/api/v1.0/telegram/webhook"
+
+const (
+	telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	telegramSecretBytes  = 32
+	telegramHookBuffer   = 100
+	telegramHookTimeout  = 10 * time.Second
+)
+
+// ErrTelegramWebhook is returned when setWebhook is refused or the URL is unusable.
+var ErrTelegramWebhook = errors.New("setting telegram webhook failed")
+
+// telegramHook is the webhook receive state. updates is nil unless webhook
+// mode is active, so requests that arrive while polling are refused.
+type telegramHook struct {
+	mu      sync.RWMutex
+	secret  string
+	updates chan telegramUpdate
+	server  *http.Server // dedicated listener, when webhook_listen is set.
+}
+
+// ServeTelegramWebhook accepts one update POSTed by Telegram. It answers 404
+// unless the Telegram backend is in webhook mode, and 401 when the secret
+// token header does not match.
+func (m *Messenger) ServeTelegramWebhook(writer http.ResponseWriter, request *http.Request) {
+	t, _ := m.backend(APITelegram).(*telegramBackend)
+	if t == nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	t.serveWebhook(writer, request)
+}
+
+func (t *telegramBackend) serveWebhook(writer http.ResponseWriter, request *http.Request) {
+	t.hook.mu.RLock()
+	secret, updates := t.hook.secret, t.hook.updates
+	t.hook.mu.RUnlock()
+
+	switch {
+	case updates == nil:
+		http.NotFound(writer, request)
+		return
+	case request.Method != http.MethodPost:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case subtle.ConstantTimeCompare([]byte(request.Header.Get(telegramSecretHeader)), []byte(secret)) != 1:
+		t.Error.Printf("Telegram webhook: bad secret token from %s", request.RemoteAddr)
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	var update telegramUpdate
+
+	err := json.NewDecoder(io.LimitReader(request.Body, mebibyte)).Decode(&update)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A full buffer means Receive is stuck; a 503 makes Telegram send it again later.
+	select {
+	case updates <- update:
+		writer.WriteHeader(http.StatusOK)
+	case <-request.Context().Done():
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// startWebhook opens the dedicated listener (if any), then asks Telegram to
+// POST updates to webhook_url with the secret token.
+func (t *telegramBackend) startWebhook() (<-chan telegramUpdate, error) {
+	hookURL, err := url.Parse(t.config.WebhookURL)
+	if err != nil || hookURL.Scheme != "https" || hookURL.Host == "" {
+		return nil, fmt.Errorf("%w: webhook_url must be an https URL", ErrTelegramWebhook)
+	}
+
+	secret := t.config.WebhookSecret
+	if secret == "" {
+		buf := make([]byte, telegramSecretBytes)
+		_, _ = rand.Read(buf)
+		secret = hex.EncodeToString(buf)
+	}
+
+	updates := make(chan telegramUpdate, telegramHookBuffer)
+
+	t.hook.mu.Lock()
+	t.hook.secret, t.hook.updates = secret, updates
+	t.hook.mu.Unlock()
+
+	if t.config.WebhookListen != "" {
+		if err = t.listenWebhook(); err != nil {
+			t.stopWebhook()
+			return nil, err
+		}
+	}
+
+	params := tgbotapi.Params{"url": hookURL.String(), "secret_token": secret}
+	_ = params.AddInterface("allowed_updates", telegramAllowedUpdates)
+
+	_, err = t.bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		t.stopWebhook()
+		return nil, fmt.Errorf("%w: %w", ErrTelegramWebhook, err)
+	}
+
+	t.Info.Printf("Receiving Telegram updates by webhook at %s", hookURL.Redacted())
+
+	return updates, nil
+}
+
+// listenWebhook serves updates on webhook_listen, over TLS when a cert is set.
+// Every path is accepted; the secret token is the check.
+func (t *telegramBackend) listenWebhook() error {
+	listener, err := net.Listen("tcp", t.config.WebhookListen)
+	if err != nil {
+		return fmt.Errorf("telegram webhook listener: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:      http.HandlerFunc(t.serveWebhook),
+		ReadTimeout:  telegramHookTimeout,
+		WriteTimeout: telegramHookTimeout,
+	}
+
+	t.hook.mu.Lock()
+	t.hook.server = server
+	t.hook.mu.Unlock()
+
+	go func() {
+		var err error
+		if t.config.WebhookCert != "" {
+			err = server.ServeTLS(listener, t.config.WebhookCert, t.config.WebhookKey)
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Error.Printf("Telegram webhook listener stopped: %v", err)
+		}
+	}()
+
+	t.Info.Printf("Telegram webhook listener on %s", listener.Addr())
+
+	return nil
+}
+
+// stopWebhook stops accepting updates and closes the dedicated listener. The
+// webhook stays set with Telegram, which holds updates until the next start.
+func (t *telegramBackend) stopWebhook() {
+	t.hook.mu.Lock()
+	server := t.hook.server
+	t.hook.secret, t.hook.updates, t.hook.server = "", nil, nil
+	t.hook.mu.Unlock()
+
+	if server != nil {
+		_ = server.Close()
+	}
+}
+
+// deleteWebhook removes a webhook left over from an earlier run, keeping any
+// pending updates for the poller.
+func (t *telegramBackend) deleteWebhook() {
+	_, err := t.bot.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		t.Error.Printf("Telegram deleteWebhook: %v", err)
+	}
+}
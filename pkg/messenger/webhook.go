@@ -0,0 +1,224 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// webhookTimeout bounds one POST, clip upload included.
+const webhookTimeout = 30 * time.Second
+
+// Webhook request headers.
+const (
+	WebhookSignatureHeader = "X-Motifini-Signature" // sha256=<hex HMAC of the body>
+	WebhookEventHeader     = "X-Motifini-Event"
+	WebhookRequestHeader   = "X-Motifini-Request-Id"
+)
+
+// ErrWebhookURL is returned for a webhook subscriber whose contact is not an http(s) URL.
+var ErrWebhookURL = errors.New("webhook contact must be an http:// or https:// URL")
+
+// WebhookConfig is the outbound webhook settings from the config file.
+type WebhookConfig struct {
+	// Secret signs every request body with HMAC-SHA256 when set.
+	Secret string `toml:"secret"`
+}
+
+// webhookBackend POSTs notifications to webhook subscribers: the subscriber's
+// contact is the URL. The body is JSON describing the event, or multipart with
+// that JSON in a "payload" part and the clip or snapshot in a "file" part.
+// Webhooks are send-only; they never receive commands.
+type webhookBackend struct {
+	*Messenger
+	notifyOnly
+
+	config *WebhookConfig
+	client *http.Client
+}
+
+// webhookPayload is the JSON body sent to a webhook.
+type webhookPayload struct {
+	*Event
+
+	Caption string `json:"caption"`
+	ReqID   string `json:"req_id"`
+	File    string `json:"file,omitempty"`
+	Mime    string `json:"mime,omitempty"`
+}
+
+// webhookError is a non-2xx response from a webhook receiver.
+type webhookError struct {
+	Status int
+}
+
+func (e *webhookError) Error() string {
+	return fmt.Sprintf("webhook responded %d %s", e.Status, http.StatusText(e.Status))
+}
+
+// HTTPStatus lets the spool tell rate limits and server errors from refusals.
+func (e *webhookError) HTTPStatus() int {
+	return e.Status
+}
+
+func newWebhookBackend(m *Messenger, config *WebhookConfig) *webhookBackend {
+	w := &webhookBackend{
+		Messenger: m,
+		config:    config,
+		client:    &http.Client{Timeout: webhookTimeout},
+	}
+	w.notifyOnly = notifyOnly{send: w.SendEvent}
+
+	return w
+}
+
+// WebhookID is the subscriber ID for a webhook URL.
+func WebhookID(hookURL string) int64 {
+	return hashID(hookURL)
+}
+
+// ValidWebhookURL checks a webhook subscriber's contact before it is saved.
+func ValidWebhookURL(hookURL string) error {
+	parsed, err := url.Parse(hookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrWebhookURL
+	}
+
+	return nil
+}
+
+// Name is the subscriber API served by this backend.
+func (w *webhookBackend) Name() string {
+	return APIWebhook
+}
+
+// SendEvent posts one notification to the webhook URL in contact.
+func (w *webhookBackend) SendEvent(
+	reqID string, event *Event, msg string, upload *Upload, _ int64, contact string,
+) error {
+	if ValidWebhookURL(contact) != nil {
+		return fmt.Errorf("%w: %q", ErrWebhookURL, contact)
+	}
+
+	if event == nil {
+		event = &Event{Time: time.Now()}
+	}
+
+	payload := &webhookPayload{Event: event, Caption: msg, ReqID: reqID}
+
+	body, contentType, err := w.body(payload, upload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, contact, bytes.NewReader(body)) //nolint:noctx // client has a timeout.
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "motifini")
+	req.Header.Set(WebhookEventHeader, event.Name)
+	req.Header.Set(WebhookRequestHeader, reqID)
+
+	if w.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+WebhookSignature(w.config.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &webhookError{Status: resp.StatusCode}
+	}
+
+	w.Debug.Printf("[%s] Webhook: posted %d bytes to %s", reqID, len(body), contact)
+
+	return nil
+}
+
+// body encodes the payload as JSON, or as multipart when there is a file.
+// Bodies are built in memory so they can be signed; clips are a few MB at most.
+func (w *webhookBackend) body(payload *webhookPayload, upload *Upload) ([]byte, string, error) {
+	if upload == nil {
+		buf, err := json.Marshal(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("encoding webhook payload: %w", err)
+		}
+
+		return buf, "application/json", nil
+	}
+
+	payload.File = filepath.Base(upload.Path)
+	if payload.Mime = mime.TypeByExtension(filepath.Ext(payload.File)); payload.Mime == "" {
+		payload.Mime = "application/octet-stream"
+	}
+
+	file, err := os.Open(upload.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+
+	form := multipart.NewWriter(&buf)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="payload"`)
+	header.Set("Content-Type", "application/json")
+
+	part, err := form.CreatePart(header)
+	if err == nil {
+		err = json.NewEncoder(part).Encode(payload)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding webhook payload: %w", err)
+	}
+
+	header = make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, payload.File))
+	header.Set("Content-Type", payload.Mime)
+
+	part, err = form.CreatePart(header)
+	if err == nil {
+		_, err = io.Copy(part, file)
+	}
+
+	if err == nil {
+		err = form.Close()
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding webhook file: %w", err)
+	}
+
+	return buf.Bytes(), form.FormDataContentType(), nil
+}
+
+// WebhookSignature is the hex HMAC-SHA256 of a webhook body, as sent in
+// X-Motifini-Signature after "sha256=". Receivers compute it over the raw body.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
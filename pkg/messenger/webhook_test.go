@@ -0,0 +1,117 @@
+package messenger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestWebhook(secret string) *webhookBackend {
+	discard := log.New(io.Discard, "", 0)
+
+	return newWebhookBackend(&Messenger{Info: discard, Debug: discard, Error: discard},
+		&WebhookConfig{Secret: secret})
+}
+
+// A clip notification is multipart: the JSON payload, then the file. The
+// signature covers the raw body.
+func TestWebhookSendEventMultipart(t *testing.T) {
+	t.Parallel()
+
+	var (
+		payload webhookPayload
+		file    []byte
+		name    string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+WebhookSignature("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.Unmarshal([]byte(form.Value["payload"][0]), &payload)
+
+		part, _ := form.File["file"][0].Open()
+		file, _ = io.ReadAll(part)
+		name = form.File["file"][0].Filename
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "Porch.mp4")
+
+	err := os.WriteFile(path, []byte("clip"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := &Event{Name: "Porch", Camera: "Porch", Classes: []string{"motion", "human"}, Time: time.Now()}
+
+	err = newTestWebhook("s3cret").SendEvent("req", event, "Porch (human)",
+		&Upload{ReqID: "req", Path: path}, 1, server.URL)
+	if err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if payload.Name != "Porch" || payload.Camera != "Porch" || len(payload.Classes) != 2 ||
+		payload.Caption != "Porch (human)" || payload.ReqID != "req" || payload.Mime != "video/mp4" {
+		t.Fatalf("payload: %+v", payload)
+	}
+
+	if string(file) != "clip" || name != "Porch.mp4" {
+		t.Fatalf("file part: %q %q", name, file)
+	}
+}
+
+// Receiver errors keep their status so the spool only retries 429 and 5xx.
+func TestWebhookErrorsRetryable(t *testing.T) {
+	t.Parallel()
+
+	var status atomic.Int32
+
+	status.Store(http.StatusServiceUnavailable)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	hook := newTestWebhook("")
+
+	err := hook.SendText("req", 1, server.URL, "hello")
+	if !retryableSendErr(err) {
+		t.Fatalf("503 should be retried: %v", err)
+	}
+
+	status.Store(http.StatusNotFound)
+
+	err = hook.SendText("req", 1, server.URL, "hello")
+	if err == nil || retryableSendErr(err) {
+		t.Fatalf("404 should fail without retry: %v", err)
+	}
+
+	err = hook.SendText("req", 1, "not a url", "hello")
+	if !errors.Is(err, ErrWebhookURL) || retryableSendErr(err) {
+		t.Fatalf("a bad URL should fail without retry: %v", err)
+	}
+}
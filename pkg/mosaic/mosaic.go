@@ -0,0 +1,230 @@
+// Package mosaic composes camera stills into one labeled grid image. It is pure
+// Go (image and image/draw), so it needs no image tools on the host. Tiles
+// without a picture, such as offline cameras, are drawn as placeholders.
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Grid defaults.
+const (
+	DefaultWidth  = 1920     // pixels across the whole grid
+	DefaultAspect = 16.0 / 9 // assumed camera shape when no tile has a picture
+	gap           = 4        // pixels between tiles
+	emptyPenalty  = 0.1      // layout cost of each unused cell
+	tieMargin     = 1e-9     // costs this close are a tie (averaged aspects round)
+)
+
+//nolint:gochecknoglobals // fixed palette.
+var (
+	background  = color.RGBA{R: 16, G: 16, B: 16, A: 255}
+	placeholder = color.RGBA{R: 48, G: 48, B: 48, A: 255}
+	labelBar    = color.RGBA{A: 160}
+	labelText   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	noteText    = color.RGBA{R: 230, G: 120, B: 80, A: 255}
+)
+
+// Tile is one camera in the grid.
+type Tile struct {
+	// Label is drawn across the bottom of the tile, usually the camera name.
+	Label string
+	// Image is the still. Nil draws a placeholder with Note in the middle.
+	Image image.Image
+	// Note explains a missing image, e.g. "offline".
+	Note string
+}
+
+// Layout picks columns and rows for n tiles of the given shape (width/height)
+// so the whole grid comes out closest to 16:9, with few empty cells. Ties go
+// to more columns.
+func Layout(n int, aspect float64) (int, int) {
+	if n < 1 {
+		return 0, 0
+	}
+
+	bestCols, bestRows, bestCost := 1, n, math.Inf(1)
+
+	for cols := 1; cols <= n; cols++ {
+		rows := (n + cols - 1) / cols
+		cost := math.Abs(math.Log(float64(cols)*aspect/float64(rows)/DefaultAspect)) +
+			emptyPenalty*float64(cols*rows-n)
+
+		if cost <= bestCost+tieMargin {
+			bestCols, bestRows, bestCost = cols, rows, cost
+		}
+	}
+
+	return bestCols, bestRows
+}
+
+// Compose draws the tiles into a grid width pixels wide (DefaultWidth if 0).
+// Cells take the average shape of the pictures; each picture is scaled to fit
+// its cell and centered.
+func Compose(tiles []Tile, width int) *image.RGBA {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+
+	aspect := averageAspect(tiles)
+	cols, rows := Layout(len(tiles), aspect)
+
+	if cols == 0 {
+		return image.NewRGBA(image.Rect(0, 0, width, int(float64(width)/DefaultAspect)))
+	}
+
+	cellW := width / cols
+	cellH := int(math.Round(float64(cellW) / aspect))
+	canvas := image.NewRGBA(image.Rect(0, 0, cellW*cols, cellH*rows))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	for i, tile := range tiles {
+		x, y := (i%cols)*cellW, (i/cols)*cellH
+		cell := image.Rect(x+gap/2, y+gap/2, x+cellW-gap/2, y+cellH-gap/2) //nolint:mnd // half a gap each side.
+		drawTile(canvas, cell, tile)
+	}
+
+	return canvas
+}
+
+// averageAspect is the mean width/height of the tiles with pictures.
+func averageAspect(tiles []Tile) float64 {
+	var (
+		sum   float64
+		count int
+	)
+
+	for _, tile := range tiles {
+		if tile.Image == nil {
+			continue
+		}
+
+		if b := tile.Image.Bounds(); b.Dx() > 0 && b.Dy() > 0 {
+			sum += float64(b.Dx()) / float64(b.Dy())
+			count++
+		}
+	}
+
+	if count == 0 {
+		return DefaultAspect
+	}
+
+	return sum / float64(count)
+}
+
+func drawTile(canvas *image.RGBA, cell image.Rectangle, tile Tile) {
+	scale := textScale(cell.Dy())
+
+	if tile.Image == nil {
+		draw.Draw(canvas, cell, image.NewUniform(placeholder), image.Point{}, draw.Src)
+
+		note := tile.Note
+		if note == "" {
+			note = "no image"
+		}
+
+		noteScale := scale * 2 //nolint:mnd // the note is the tile's headline.
+		for noteScale > 1 && textWidth(note, noteScale) > cell.Dx() {
+			noteScale--
+		}
+
+		at := image.Pt(cell.Min.X+(cell.Dx()-textWidth(note, noteScale))/2, //nolint:mnd // centered.
+			cell.Min.Y+(cell.Dy()-glyphHeight*noteScale)/2) //nolint:mnd // centered.
+		drawText(canvas, at, note, noteScale, noteText)
+	} else {
+		scaleInto(canvas, fit(tile.Image.Bounds(), cell), tile.Image)
+	}
+
+	drawLabel(canvas, cell, tile.Label, scale)
+}
+
+// fit is the largest rectangle with src's shape that fits centered in cell.
+func fit(src, cell image.Rectangle) image.Rectangle {
+	if src.Dx() == 0 || src.Dy() == 0 {
+		return cell
+	}
+
+	w, h := cell.Dx(), cell.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = w * src.Dy() / src.Dx()
+	} else {
+		w = h * src.Dx() / src.Dy()
+	}
+
+	x, y := cell.Min.X+(cell.Dx()-w)/2, cell.Min.Y+(cell.Dy()-h)/2 //nolint:mnd // centered.
+
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// scaleInto draws src scaled into dst's rect, averaging the source pixels
+// under each destination pixel (nearest pixel when enlarging).
+func scaleInto(dst *image.RGBA, rect image.Rectangle, src image.Image) {
+	// Copy to RGBA first: draw has fast paths for decoded JPEGs, and the loop
+	// below can then read Pix directly.
+	sb := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+
+	sw, sh, dw, dh := sb.Dx(), sb.Dy(), rect.Dx(), rect.Dy()
+	if sw == 0 || sh == 0 || dw == 0 || dh == 0 {
+		return
+	}
+
+	for dy := range dh {
+		y0, y1 := span(dy, dh, sh)
+
+		for dx := range dw {
+			x0, x1 := span(dx, dw, sw)
+
+			var r, g, b, n uint32
+
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[y*rgba.Stride:]
+				for x := x0; x < x1; x++ {
+					r += uint32(row[x*4])
+					g += uint32(row[x*4+1])
+					b += uint32(row[x*4+2])
+					n++
+				}
+			}
+
+			dst.SetRGBA(rect.Min.X+dx, rect.Min.Y+dy,
+				color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}) //nolint:gosec // averages of bytes.
+		}
+	}
+}
+
+// span is the source range [start, end) under destination pixel i of n.
+func span(i, n, size int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+
+	return start, max(end, start+1)
+}
+
+// drawLabel writes text on a dark bar across the bottom of the cell.
+func drawLabel(canvas *image.RGBA, cell image.Rectangle, text string, scale int) {
+	if text == "" {
+		return
+	}
+
+	pad := 2 * scale //nolint:mnd // breathing room around the text.
+	bar := image.Rect(cell.Min.X, cell.Max.Y-glyphHeight*scale-2*pad, cell.Max.X, cell.Max.Y)
+	draw.Draw(canvas, bar, image.NewUniform(labelBar), image.Point{}, draw.Over)
+
+	// Cut long names so they stay inside the tile.
+	runes := []rune(text)
+	for len(runes) > 1 && textWidth(string(runes), scale) > cell.Dx()-2*pad {
+		runes = runes[:len(runes)-1]
+	}
+
+	drawText(canvas, image.Pt(bar.Min.X+pad, bar.Min.Y+pad), string(runes), scale, labelText)
+}
+
+// textScale sizes labels to the tile: 1x for thumbnails, growing with height.
+func textScale(cellHeight int) int {
+	return max(1, cellHeight/120) //nolint:mnd // about 16 text lines per tile.
+}
@@ -0,0 +1,61 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n          int
+		aspect     float64
+		cols, rows int
+	}{
+		{0, DefaultAspect, 0, 0},
+		{1, DefaultAspect, 1, 1},
+		{2, DefaultAspect, 2, 1},
+		{3, DefaultAspect, 2, 2},
+		{4, DefaultAspect, 2, 2},
+		{6, DefaultAspect, 3, 2},
+		{9, DefaultAspect, 3, 3},
+		{4, 9.0 / 16, 4, 1}, // portrait cameras sit side by side.
+	}
+
+	for _, test := range tests {
+		cols, rows := Layout(test.n, test.aspect)
+		if cols != test.cols || rows != test.rows {
+			t.Errorf("Layout(%d, %.2f): got %dx%d want %dx%d",
+				test.n, test.aspect, cols, rows, test.cols, test.rows)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	t.Parallel()
+
+	red := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	draw.Draw(red, red.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+
+	grid := Compose([]Tile{{Label: "Porch", Image: red}, {Label: "Garage", Note: "offline"}}, 640)
+
+	if got := grid.Bounds(); got.Dx() != 640 || got.Dy() != 180 {
+		t.Fatalf("grid size: got %v want 640x180", got)
+	}
+
+	if got := grid.RGBAAt(160, 40); got.R != 255 || got.G != 0 {
+		t.Errorf("picture tile: got %v at its center, want red", got)
+	}
+
+	if got := grid.RGBAAt(480, 10); got != placeholder {
+		t.Errorf("offline tile: got %v want placeholder %v", got, placeholder)
+	}
+
+	// The label bar darkens the bottom of the picture.
+	if got := grid.RGBAAt(300, 175); got.R == 255 {
+		t.Errorf("label bar: got %v, want a darkened red", got)
+	}
+}
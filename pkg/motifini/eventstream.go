@@ -3,13 +3,18 @@ package motifini
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/davidnewhall/motifini/pkg/archive"
 	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/history"
 	"github.com/davidnewhall/motifini/pkg/messenger"
 	"golift.io/securityspy/v2"
+	"golift.io/subscribe"
 )
 
 const (
@@ -51,11 +56,11 @@ func (m *Motifini) dispatchEvent(event *securityspy.Event) {
 
 		info := m.SSpy.GetInfo()
 		if info == nil || strings.HasPrefix(info.Version, "4") {
-			m.handleCameraMotion(event)
+			m.queueCameraMotion(event)
 		}
 	case securityspy.EventTriggerAction:
 		// v5 action event. (motion detected, actions enabled)
-		m.handleCameraMotion(event)
+		m.queueCameraMotion(event)
 	case securityspy.EventStreamConnect:
 		m.streamLive = true
 		m.Info.Println("SecuritySpy Event Stream Connected!")
@@ -156,6 +161,23 @@ func (m *Motifini) handleConfigChange() {
 	time.Sleep(time.Second)
 }
 
+// queueCameraMotion hands a motion event to the per-camera worker pool so a slow
+// capture or upload never holds up the event stream (or any other camera).
+func (m *Motifini) queueCameraMotion(event *securityspy.Event) {
+	if event.Camera == nil {
+		return
+	}
+
+	if m.motion == nil {
+		m.handleCameraMotion(event)
+		return
+	}
+
+	if !m.motion.enqueue(event) {
+		m.Error.Printf("Motion queue for %s is full; dropped event %d", event.Camera.Name, event.ID)
+	}
+}
+
 func (m *Motifini) handleCameraMotion(event *securityspy.Event) {
 	if event.Camera == nil {
 		return // this wont happen. check anyway.
@@ -167,16 +189,23 @@ func (m *Motifini) handleCameraMotion(event *securityspy.Event) {
 	path := filepath.Join(
 		m.Conf.Global.TempDir, fmt.Sprintf("motifini_camera_motion_%s_%s.mp4", reqID, event.Camera.Name))
 
-	subCount := len(subs)
-	if subCount < 1 {
+	entry := history.Entry{Time: event.Time, Camera: event.Camera.Name, Classes: chat.ClassesFromReasons(event.Reasons)}
+	defer func() { m.addHistory(reqID, &entry) }()
+
+	if len(subs) < 1 || m.Msgs == nil {
 		return // no one to notify of this camera's motion
 	}
 
-	if m.Msgs == nil {
-		return
+	digested := make(map[*subscribe.Subscriber]bool)
+	subs = m.recordMotionDigest(reqID, event, event.Reasons, subs, digested)
+	entry.Digest = len(digested)
+
+	subCount := len(subs)
+	if subCount < 1 {
+		return // everyone gets this one in a digest.
 	}
 
-	settings := chat.GetCameraClipSettings(m.Subs, event.Camera.Name)
+	settings := m.Msgs.Chat.CameraClipSettings(event.Camera.Name)
 	ops := chat.VideoClipOps(event.Camera, settings)
 
 	u, urlErr := event.Camera.RedactedVideoURL(ops)
@@ -184,16 +213,68 @@ func (m *Motifini) handleCameraMotion(event *securityspy.Event) {
 		m.Debug.Printf("[%v] SaveVideo %s URL: %s", reqID, event.Camera.Name, u)
 	}
 
-	err := event.Camera.SaveVideo(ops, settings.Length, int64(settings.Size), path)
+	// Triggers that arrive while the clip records join it instead of queueing.
+	m.motion.begin(event, settings.Coalesce, settings.Extend > settings.Length)
+	defer m.motion.end(event.Camera.Name) // clears the capture when SaveVideo fails.
+
+	started := time.Now()
+
+	err := m.saveVideo(event.Camera, ops, settings.Length, int64(settings.Size), path)
 	if err != nil {
 		m.Error.Printf("[%v] event.Camera.SaveVideo: %v", reqID, err)
+		entry.Failed = subCount
+
 		return
 	}
 
-	m.Msgs.SendFileOrMsg(reqID, chat.EventCaption(event.Camera.Name, event.Reasons), path, subs)
+	length := m.extendClip(reqID, event.Camera, ops, settings, path)
+
+	reasons := event.Reasons
+	if merged, count := m.motion.end(event.Camera.Name); count > 0 {
+		// Later triggers may add classes (and subscribers) to this clip.
+		reasons = merged
+		keys = chat.NotifyKeys(event.Camera.Name, reasons)
+		subs = m.recordMotionDigest(reqID, event, reasons, chat.CollectSubscribers(m.Subs, keys), digested)
+		subCount = len(subs)
+		entry.Classes = chat.ClassesFromReasons(reasons)
+		entry.Digest = len(digested)
+		m.Debug.Printf("[%v] Merged %d more motion event(s) into %s clip", reqID, count, event.Camera.Name)
+	}
+
+	preroll := m.prerollClip(reqID, event, settings, started, path)
+
+	caption := chat.EventCaption(event.Camera.Name, reasons)
+	if length > settings.Length || preroll > 0 {
+		caption = chat.ExtendedCaption(event.Camera.Name, reasons, clipLength(path, length+preroll))
+	}
+
+	snapshot := m.alertSnapshot(reqID, event.Camera, subs)
+	entry.Media = m.archiveMotion(reqID, event, entry.Classes, path, snapshot)
+
+	delivery := m.Msgs.SendEvent(reqID, &messenger.Event{
+		Name:      event.Camera.Name,
+		Camera:    event.Camera.Name,
+		Classes:   entry.Classes,
+		Time:      event.Time,
+		Snapshot:  snapshot,
+		Actions:   true,
+		CameraNum: event.Camera.Number,
+		Alerted:   func(alerted []*subscribe.Subscriber) { m.pauseAlerted(alerted, keys) },
+	}, caption, path, subs)
+	entry.Notified = subNames(subs)
+	entry.Sent, entry.Failed, entry.Spooled = delivery.Sent, len(delivery.Failed), delivery.Spooled
+
+	m.Info.Printf("[%v] Event '%v' triggered subscription messages. Subscribers: %v (%s) keys: %v",
+		reqID, event.Camera.Name, subCount, strings.Join(entry.Notified, ", "), keys)
+}
+
+// pauseAlerted starts the repeat delay of the subscriptions an alert went out
+// on. Later escalation tiers are paused when their turn comes.
+func (m *Motifini) pauseAlerted(subs []*subscribe.Subscriber, keys []string) {
+	mode, _ := chat.HouseMode(m.Subs)
 
 	for _, sub := range subs {
-		for _, key := range chat.ActiveKeysAmong(sub, keys) {
+		for _, key := range chat.ActiveKeysAmong(sub, keys, mode) {
 			delay, ok := sub.Events.RuleGetD(key, "delay")
 			if !ok {
 				delay = DefaultRepeatDelay
@@ -202,8 +283,11 @@ func (m *Motifini) handleCameraMotion(event *securityspy.Event) {
 			_ = sub.Events.Pause(key, delay)
 		}
 	}
+}
 
-	names := make([]string, 0, subCount)
+// subNames lists subscribers as "id:contact" for logs and the event history.
+func subNames(subs []*subscribe.Subscriber) []string {
+	names := make([]string, 0, len(subs))
 	for _, sub := range subs {
 		name := chat.SubContact(sub)
 		if name == "" {
@@ -212,8 +296,99 @@ func (m *Motifini) handleCameraMotion(event *securityspy.Event) {
 		names = append(names, fmt.Sprintf("%d:%s", sub.ID, name))
 	}
 
-	m.Info.Printf("[%v] Event '%v' triggered subscription messages. Subscribers: %v (%s) keys: %v",
-		reqID, event.Camera.Name, subCount, strings.Join(names, ", "), keys)
+	return names
+}
+
+// addHistory records a handled event in the event history.
+func (m *Motifini) addHistory(reqID string, entry *history.Entry) {
+	if _, err := m.History.Add(*entry); err != nil {
+		m.Error.Printf("[%v] Recording event history: %v", reqID, err)
+	}
+}
+
+// recordMotionDigest holds a motion event for the subscribers who get it in a
+// digest, with a snapshot for the digest mosaic, and returns the ones to alert
+// now. digested tracks who has it already, across a merged clip; subscribers
+// whose digest could not take it are alerted now.
+func (m *Motifini) recordMotionDigest(reqID string, event *securityspy.Event, reasons []securityspy.TriggerEvent,
+	subs []*subscribe.Subscriber, digested map[*subscribe.Subscriber]bool,
+) []*subscribe.Subscriber {
+	classes := chat.ClassesFromReasons(reasons)
+	now, later := chat.SplitDigest(subs, event.Camera.Name, classes)
+	later = slices.DeleteFunc(later, func(sub *subscribe.Subscriber) bool { return digested[sub] })
+
+	if len(later) == 0 {
+		return now
+	}
+
+	digest := &messenger.Event{Name: event.Camera.Name, Camera: event.Camera.Name, Classes: classes, Time: event.Time}
+	path := filepath.Join(m.Conf.Global.TempDir,
+		fmt.Sprintf("motifini_camera_digest_%s_%s.jpg", reqID, event.Camera.Name))
+
+	if err := event.Camera.SaveJPEG(&securityspy.VidOps{}, path); err != nil {
+		m.Error.Printf("[%v] cam.SaveJPEG for digest snapshot: %v", reqID, err)
+	} else {
+		digest.Snapshot = path
+		defer os.Remove(path)
+	}
+
+	failed := m.Msgs.RecordDigest(reqID, digest, later)
+
+	for _, sub := range later {
+		digested[sub] = !slices.Contains(failed, sub)
+	}
+
+	return append(now, failed...)
+}
+
+// archiveMotion keeps a motion clip and a snapshot in the clip archive, when
+// there is one, and returns the clip's archive ID. snapshot is the alert's
+// still, or "" to grab one just for the archive.
+func (m *Motifini) archiveMotion(
+	reqID string, event *securityspy.Event, classes []string, video, snapshot string,
+) string {
+	if m.Archive == nil {
+		return ""
+	}
+
+	if snapshot == "" {
+		snapshot = filepath.Join(m.Conf.Global.TempDir,
+			fmt.Sprintf("motifini_camera_archive_%s_%s.jpg", reqID, event.Camera.Name))
+		if err := event.Camera.SaveJPEG(&securityspy.VidOps{}, snapshot); err != nil {
+			m.Debug.Printf("[%v] cam.SaveJPEG for archive: %v", reqID, err)
+			snapshot = ""
+		} else {
+			defer os.Remove(snapshot)
+		}
+	}
+
+	clip, err := m.Archive.Keep(reqID, archive.Clip{Camera: event.Camera.Name, Time: event.Time, Classes: classes},
+		video, snapshot)
+	if err != nil {
+		m.Error.Printf("[%v] Archiving %s clip: %v", reqID, event.Camera.Name, err)
+		return ""
+	}
+
+	return clip.ID
+}
+
+// alertSnapshot grabs a still for backends that show one with the clip: email
+// inlines it, Pushover attaches it instead. Returns "" when no subscriber needs
+// one or the grab fails.
+func (m *Motifini) alertSnapshot(reqID string, cam *securityspy.Camera, subs []*subscribe.Subscriber) string {
+	if !messenger.WantsSnapshot(subs) {
+		return ""
+	}
+
+	path := filepath.Join(m.Conf.Global.TempDir, fmt.Sprintf("motifini_camera_motion_%s_%s.jpg", reqID, cam.Name))
+
+	err := cam.SaveJPEG(&securityspy.VidOps{}, path)
+	if err != nil {
+		m.Error.Printf("[%v] cam.SaveJPEG for alert snapshot: %v", reqID, err)
+		return ""
+	}
+
+	return path
 }
 
 // notifySystemEvent texts subscribers of a built-in non-camera event (no video attachment).
@@ -222,32 +397,39 @@ func (m *Motifini) notifySystemEvent(eventName, msg string) {
 		return // messenger not up yet (event stream can connect during startup)
 	}
 
-	subs := m.Subs.GetSubscribers(eventName)
+	reqID := messenger.ReqID(messenger.IDLength)
+	entry := history.Entry{Time: time.Now(), Event: eventName}
+
+	defer func() { m.addHistory(reqID, &entry) }()
+
+	subs := chat.CollectSubscribers(m.Subs, []string{eventName})
 	if len(subs) < 1 {
 		return
 	}
 
-	reqID := messenger.ReqID(messenger.IDLength)
-	m.Msgs.SendFileOrMsg(reqID, msg, "", subs)
+	delivery := m.Msgs.SendEvent(reqID, &messenger.Event{
+		Name:    eventName,
+		Time:    entry.Time,
+		Alerted: pauseSystemEvent(eventName),
+	}, msg, "", subs)
+	entry.Notified = subNames(subs)
+	entry.Sent, entry.Failed, entry.Spooled = delivery.Sent, len(delivery.Failed), delivery.Spooled
 
-	for _, sub := range subs {
-		delay, ok := sub.Events.RuleGetD(eventName, "delay")
-		if !ok {
-			delay = DefaultRepeatDelay
-		}
+	m.Info.Printf("[%v] System event '%v' notified %d subscriber(s): %s",
+		reqID, eventName, len(subs), strings.Join(entry.Notified, ", "))
+}
 
-		_ = sub.Events.Pause(eventName, delay)
-	}
+// pauseSystemEvent returns the Alerted func of a system event: it starts the
+// repeat delay of each subscriber the event went out to.
+func pauseSystemEvent(eventName string) func([]*subscribe.Subscriber) {
+	return func(subs []*subscribe.Subscriber) {
+		for _, sub := range subs {
+			delay, ok := sub.Events.RuleGetD(eventName, "delay")
+			if !ok {
+				delay = DefaultRepeatDelay
+			}
 
-	names := make([]string, 0, len(subs))
-	for _, sub := range subs {
-		name := chat.SubContact(sub)
-		if name == "" {
-			name = "?"
+			_ = sub.Events.Pause(eventName, delay)
 		}
-		names = append(names, fmt.Sprintf("%d:%s", sub.ID, name))
 	}
-
-	m.Info.Printf("[%v] System event '%v' notified %d subscriber(s): %s",
-		reqID, eventName, len(subs), strings.Join(names, ", "))
 }
@@ -0,0 +1,144 @@
+package motifini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/export"
+	"golift.io/securityspy/v2"
+)
+
+const extendJoinTimeout = time.Minute
+
+// saveClipFunc records length of a camera's live video to path, like Camera.SaveVideo.
+type saveClipFunc func(cam *securityspy.Camera, ops *securityspy.VidOps, length time.Duration,
+	maxSize int64, path string) error
+
+// saveVideo records a live motion clip.
+func (m *Motifini) saveVideo(cam *securityspy.Camera, ops *securityspy.VidOps, length time.Duration,
+	maxSize int64, path string,
+) error {
+	if m.saveClip != nil {
+		return m.saveClip(cam, ops, length, maxSize, path)
+	}
+
+	return cam.SaveVideo(ops, length, maxSize, path) //nolint:wrapcheck // callers log it as cam.SaveVideo.
+}
+
+// extendClip keeps recording a motion clip while more triggers for its camera
+// arrive (extend while active). After each piece it checks whether any joined
+// the capture; if so it records settings.Length more, up to settings.Extend in
+// all and the largest extended clip, then joins the pieces into the clip at path.
+// It returns the clip's length. Without ffmpeg, or when the join fails, the
+// first piece is sent alone.
+func (m *Motifini) extendClip(reqID string, cam *securityspy.Camera, ops *securityspy.VidOps,
+	settings chat.ClipSettings, path string,
+) time.Duration {
+	if settings.Extend <= settings.Length || m.motion.merged(cam.Name) == 0 {
+		return settings.Length
+	}
+
+	ffmpeg, err := chat.LookFFmpeg(m.Conf.Global.FFmpegPath)
+	if err != nil {
+		m.Debug.Printf("[%v] Not extending %s clip: %v", reqID, cam.Name, err)
+		return settings.Length
+	}
+
+	_, maxSize := m.Msgs.Chat.ExtendLimits()
+	pieces := []string{path}
+	length, size := settings.Length, fileSize(path)
+
+	defer func() {
+		for _, piece := range pieces[1:] {
+			_ = os.Remove(piece)
+		}
+	}()
+
+	for seen := 0; length < settings.Extend && size+int64(settings.Size) <= int64(maxSize); {
+		merged := m.motion.merged(cam.Name)
+		if merged == seen {
+			break // motion stopped during the last piece.
+		}
+
+		seen = merged
+		step := min(settings.Length, settings.Extend-length)
+		piece := filepath.Join(m.Conf.Global.TempDir,
+			fmt.Sprintf("motifini_camera_extend_%s_%s_%d.mp4", reqID, cam.Name, len(pieces)))
+
+		if err := m.saveVideo(cam, ops, step, int64(settings.Size), piece); err != nil {
+			m.Error.Printf("[%v] Extending %s clip: cam.SaveVideo: %v", reqID, cam.Name, err)
+			_ = os.Remove(piece)
+
+			break
+		}
+
+		export.Map.MotionExtended.Add(1)
+
+		pieces = append(pieces, piece)
+		length += step
+		size += fileSize(piece)
+	}
+
+	if len(pieces) == 1 {
+		return settings.Length
+	}
+
+	if err := joinClips(ffmpeg, pieces, path); err != nil {
+		m.Error.Printf("[%v] Joining %d pieces of %s clip: %v", reqID, len(pieces), cam.Name, err)
+		return settings.Length
+	}
+
+	m.Debug.Printf("[%v] Extended %s clip to %v in %d pieces", reqID, cam.Name, length, len(pieces))
+
+	return length
+}
+
+// joinClips joins clips recorded with the same settings, without re-encoding,
+// and replaces the first clip with the result.
+func joinClips(ffmpeg string, clips []string, dest string) error {
+	var list strings.Builder
+	for _, clip := range clips {
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(clip, "'", `'\''`))
+	}
+
+	listFile := dest + ".txt"
+	joined := dest + ".joined.mp4"
+
+	defer os.Remove(listFile)
+	defer os.Remove(joined)
+
+	if err := os.WriteFile(listFile, []byte(list.String()), 0o600); err != nil { //nolint:mnd // private temp file.
+		return fmt.Errorf("writing clip list: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), extendJoinTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-loglevel", "error", "-y",
+		"-f", "concat", "-safe", "0", "-i", listFile, "-c", "copy", "-movflags", "+faststart", joined).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, out)
+	}
+
+	if err = os.Rename(joined, dest); err != nil {
+		return fmt.Errorf("replacing clip: %w", err)
+	}
+
+	return nil
+}
+
+// fileSize is a file's size, 0 when it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
@@ -0,0 +1,152 @@
+package motifini
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"golift.io/securityspy/v2"
+)
+
+// fakeCapture records pieces in place of SecuritySpy. While more is above
+// zero, each piece brings one more trigger, so motion goes on.
+type fakeCapture struct {
+	queue   *motionQueue
+	mu      sync.Mutex
+	more    int
+	lengths []time.Duration
+}
+
+func (f *fakeCapture) save(cam *securityspy.Camera, _ *securityspy.VidOps, length time.Duration,
+	_ int64, path string,
+) error {
+	f.mu.Lock()
+	f.lengths = append(f.lengths, length)
+	more := f.more > 0
+	f.more--
+	f.mu.Unlock()
+
+	if more {
+		f.queue.enqueue(motionEvent(cam.Name))
+	}
+
+	return os.WriteFile(path, []byte("piece"), 0o600)
+}
+
+// newExtendTest returns a Motifini recording with capture, and a first piece
+// at path, with one trigger already joined to its capture.
+func newExtendTest(t *testing.T, capture *fakeCapture, ffmpeg string) (*Motifini, string) {
+	t.Helper()
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Motifini{
+		Conf: &Config{}, Msgs: &messenger.Messenger{}, saveClip: capture.save,
+		Info: discard, Debug: discard, Error: discard,
+		motion: newMotionQueue(1, 5, func(*securityspy.Event) {}),
+	}
+	m.Conf.Global.TempDir = t.TempDir()
+	m.Conf.Global.FFmpegPath = ffmpeg
+	capture.queue = m.motion
+
+	m.motion.begin(motionEvent("Porch"), 0, true)
+
+	if !m.motion.enqueue(motionEvent("Porch")) || m.motion.merged("Porch") != 1 {
+		t.Fatal("trigger did not join the capture")
+	}
+
+	path := filepath.Join(t.TempDir(), "live.mp4")
+	if err := os.WriteFile(path, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return m, path
+}
+
+// A clip keeps recording while triggers arrive, then the pieces are joined in
+// order without re-encoding.
+func TestExtendClip(t *testing.T) {
+	t.Parallel()
+
+	ffmpeg, args := fakeFFmpeg(t)
+	capture := &fakeCapture{more: 1}
+	m, path := newExtendTest(t, capture, ffmpeg)
+	settings := chat.ClipSettings{Length: 6 * time.Second, Size: chat.DefaultClipSize, Extend: 30 * time.Second}
+	cam := &securityspy.Camera{Name: "Porch"}
+
+	// One trigger before the first extra piece, one during it, none during the second.
+	if length := m.extendClip("req", cam, &securityspy.VidOps{}, settings, path); length != 18*time.Second {
+		t.Fatalf("length %v, want 18s", length)
+	}
+
+	if clip, _ := os.ReadFile(path); string(clip) != "joined\n" {
+		t.Fatalf("clip not replaced by the join: %q", clip)
+	}
+
+	got := args()
+	if !strings.Contains(got, "-f concat -safe 0 -i ") || !strings.Contains(got, "-c copy") {
+		t.Fatalf("ffmpeg args: %q", got)
+	}
+
+	// The clip list names the live clip first, then each extra piece.
+	list := strings.Split(strings.TrimSpace(got[strings.Index(got, "\n")+1:]), "\n")
+	if len(list) != 3 || list[0] != "file '"+path+"'" ||
+		!strings.HasSuffix(list[1], "_1.mp4'") || !strings.HasSuffix(list[2], "_2.mp4'") {
+		t.Fatalf("clip list: %q", list)
+	}
+
+	for _, piece := range list[1:] {
+		if _, err := os.Stat(strings.Trim(strings.TrimPrefix(piece, "file "), "'")); !os.IsNotExist(err) {
+			t.Fatalf("piece left behind: %s", piece)
+		}
+	}
+}
+
+// Ongoing motion stops extending at the cap; the last piece is only as long
+// as what is left.
+func TestExtendClipCap(t *testing.T) {
+	t.Parallel()
+
+	ffmpeg, _ := fakeFFmpeg(t)
+	capture := &fakeCapture{more: 100}
+	m, path := newExtendTest(t, capture, ffmpeg)
+	settings := chat.ClipSettings{Length: 6 * time.Second, Size: chat.DefaultClipSize, Extend: 45 * time.Second}
+
+	cam := &securityspy.Camera{Name: "Porch"}
+
+	if length := m.extendClip("req", cam, &securityspy.VidOps{}, settings, path); length != 45*time.Second {
+		t.Fatalf("length %v, want 45s", length)
+	}
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+
+	if len(capture.lengths) != 7 || capture.lengths[6] != 3*time.Second {
+		t.Fatalf("pieces recorded: %v", capture.lengths)
+	}
+}
+
+// Without ffmpeg the first piece goes out alone.
+func TestExtendClipNoFFmpeg(t *testing.T) {
+	t.Parallel()
+
+	capture := &fakeCapture{}
+	m, path := newExtendTest(t, capture, filepath.Join(t.TempDir(), "missing-ffmpeg"))
+	settings := chat.ClipSettings{Length: 6 * time.Second, Size: chat.DefaultClipSize, Extend: 30 * time.Second}
+
+	cam := &securityspy.Camera{Name: "Porch"}
+
+	if length := m.extendClip("req", cam, &securityspy.VidOps{}, settings, path); length != 6*time.Second {
+		t.Fatalf("length %v, want 6s", length)
+	}
+
+	if clip, _ := os.ReadFile(path); string(clip) != "first" || len(capture.lengths) != 0 {
+		t.Fatalf("clip %q after %d pieces", clip, len(capture.lengths))
+	}
+}
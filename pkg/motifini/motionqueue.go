@@ -0,0 +1,188 @@
+package motifini
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/export"
+	"golift.io/securityspy/v2"
+)
+
+// Motion pipeline defaults, used when the config leaves them unset.
+const (
+	defaultMotionWorkers = 4
+	defaultMotionQueue   = 5
+)
+
+// motionQueue moves camera motion handling off the event stream goroutine.
+// Each camera gets its own bounded queue drained by one goroutine, so a camera
+// never has two captures in flight, and a shared slot pool caps how many
+// cameras capture and upload at once. A slow camera only delays itself.
+type motionQueue struct {
+	handle   func(*securityspy.Event)
+	slots    chan struct{}
+	depth    int
+	mu       sync.Mutex
+	cameras  map[string]chan *securityspy.Event
+	captures map[string]*motionCapture
+}
+
+// motionCapture is a clip being recorded for a camera. Triggers that arrive
+// within window of its start are folded into it rather than queued. A zero
+// window (extend while active) takes every trigger until the capture ends.
+type motionCapture struct {
+	started time.Time
+	window  time.Duration
+	reasons []securityspy.TriggerEvent
+	merged  int
+}
+
+func newMotionQueue(workers, depth int, handle func(*securityspy.Event)) *motionQueue {
+	return &motionQueue{
+		handle:   handle,
+		slots:    make(chan struct{}, max(1, workers)),
+		depth:    max(1, depth),
+		cameras:  make(map[string]chan *securityspy.Event),
+		captures: make(map[string]*motionCapture),
+	}
+}
+
+// enqueue hands a motion event to its camera's worker. It never blocks: when
+// the camera already has a full queue the event is dropped and false returned.
+// Events merged into a clip that is still recording count as handled.
+func (q *motionQueue) enqueue(event *securityspy.Event) bool {
+	if q.join(event) {
+		export.Map.MotionMerged.Add(1)
+		return true
+	}
+
+	queue := q.cameraQueue(event.Camera.Name)
+
+	select {
+	case queue <- event:
+		export.Map.MotionQueued.Add(1)
+		return true
+	default:
+		export.Map.MotionDropped.Add(1)
+		return false
+	}
+}
+
+// cameraQueue returns the queue for a camera, starting its worker on first use.
+func (q *motionQueue) cameraQueue(name string) chan *securityspy.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.cameras[name]
+	if !ok {
+		queue = make(chan *securityspy.Event, q.depth)
+		q.cameras[name] = queue
+
+		go q.work(queue)
+	}
+
+	return queue
+}
+
+func (q *motionQueue) work(queue chan *securityspy.Event) {
+	for event := range queue {
+		q.slots <- struct{}{}
+		q.handle(event)
+		<-q.slots
+		export.Map.MotionHandled.Add(1)
+	}
+}
+
+// begin marks a clip as recording for the event's camera. A zero window turns
+// merging off, so nothing is tracked, unless the clip extends while motion goes
+// on: then every trigger joins it until end.
+func (q *motionQueue) begin(event *securityspy.Event, window time.Duration, extend bool) {
+	if q == nil || (window <= 0 && !extend) || event.Camera == nil {
+		return
+	}
+
+	if extend {
+		window = 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.captures[event.Camera.Name] = &motionCapture{
+		started: time.Now(),
+		window:  window,
+		reasons: event.Reasons,
+	}
+}
+
+// join folds an event into its camera's recording clip when one started less
+// than the merge window ago.
+func (q *motionQueue) join(event *securityspy.Event) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	capture := q.captures[event.Camera.Name]
+	if capture == nil || (capture.window > 0 && time.Since(capture.started) > capture.window) {
+		return false
+	}
+
+	capture.reasons = chat.MergeReasons(capture.reasons, event.Reasons)
+	capture.merged++
+
+	return true
+}
+
+// merged is how many events have joined a camera's recording clip so far.
+func (q *motionQueue) merged(name string) int {
+	if q == nil {
+		return 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if capture := q.captures[name]; capture != nil {
+		return capture.merged
+	}
+
+	return 0
+}
+
+// end stops merging into a camera's clip and returns the combined trigger
+// reasons and how many extra events were folded in. Safe to call twice.
+func (q *motionQueue) end(name string) ([]securityspy.TriggerEvent, int) {
+	if q == nil {
+		return nil, 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	capture := q.captures[name]
+	if capture == nil {
+		return nil, 0
+	}
+
+	delete(q.captures, name)
+
+	return capture.reasons, capture.merged
+}
+
+// pending is the number of motion events waiting across all camera queues.
+func (q *motionQueue) pending() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var total int64
+	for _, queue := range q.cameras {
+		total += int64(len(queue))
+	}
+
+	return total
+}
+
+// busy is the number of cameras currently capturing or uploading.
+func (q *motionQueue) busy() int64 {
+	return int64(len(q.slots))
+}
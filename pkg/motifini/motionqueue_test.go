@@ -0,0 +1,206 @@
+package motifini
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/export"
+	"golift.io/securityspy/v2"
+)
+
+// TestMain initializes the expvar export map the motion queue counts into.
+func TestMain(m *testing.M) {
+	export.Init("motifini_motifini_test")
+	os.Exit(m.Run())
+}
+
+func motionEvent(camera string) *securityspy.Event {
+	return &securityspy.Event{Camera: &securityspy.Camera{Name: camera}}
+}
+
+// blockingHandler records which cameras are being handled and holds each
+// event until release is closed.
+type blockingHandler struct {
+	started chan string
+	release chan struct{}
+	mu      sync.Mutex
+	active  map[string]int
+	most    map[string]int // most events of one camera handled at once
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+		active:  make(map[string]int),
+		most:    make(map[string]int),
+	}
+}
+
+func (h *blockingHandler) handle(event *securityspy.Event) {
+	h.mu.Lock()
+	h.active[event.Camera.Name]++
+	h.most[event.Camera.Name] = max(h.most[event.Camera.Name], h.active[event.Camera.Name])
+	h.mu.Unlock()
+
+	h.started <- event.Camera.Name
+	<-h.release
+
+	h.mu.Lock()
+	h.active[event.Camera.Name]--
+	h.mu.Unlock()
+}
+
+func (h *blockingHandler) waitStart(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case name := <-h.started:
+		return name
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was handled")
+		return ""
+	}
+}
+
+// A camera never has two captures in flight, even with free slots.
+func TestMotionQueueOneCapturePerCamera(t *testing.T) {
+	t.Parallel()
+
+	handler := newBlockingHandler()
+	queue := newMotionQueue(4, 5, handler.handle)
+
+	for range 3 {
+		if !queue.enqueue(motionEvent("Porch")) {
+			t.Fatal("event dropped with room in the queue")
+		}
+	}
+
+	handler.waitStart(t)
+
+	select {
+	case <-handler.started:
+		t.Fatal("a second Porch capture started while the first was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+	handler.waitStart(t)
+	handler.waitStart(t)
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if handler.most["Porch"] != 1 {
+		t.Fatalf("Porch captures at once: %d", handler.most["Porch"])
+	}
+}
+
+// Different cameras capture at the same time, up to the worker count.
+func TestMotionQueueCamerasInParallel(t *testing.T) {
+	t.Parallel()
+
+	handler := newBlockingHandler()
+	queue := newMotionQueue(2, 5, handler.handle)
+
+	for _, camera := range []string{"Porch", "Garage", "Yard"} {
+		queue.enqueue(motionEvent(camera))
+	}
+
+	handler.waitStart(t)
+	handler.waitStart(t) // both started before either was released.
+
+	if busy := queue.busy(); busy != 2 {
+		t.Fatalf("busy: %d", busy)
+	}
+
+	select {
+	case name := <-handler.started:
+		t.Fatalf("%s started past the worker limit", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+	handler.waitStart(t)
+}
+
+// A camera with a full queue drops new events instead of blocking the stream.
+func TestMotionQueueFullDrops(t *testing.T) {
+	t.Parallel()
+
+	handler := newBlockingHandler()
+	defer close(handler.release)
+
+	queue := newMotionQueue(1, 1, handler.handle)
+
+	if !queue.enqueue(motionEvent("Porch")) {
+		t.Fatal("first event dropped")
+	}
+
+	handler.waitStart(t) // the worker holds it; the queue is empty again.
+
+	if !queue.enqueue(motionEvent("Porch")) {
+		t.Fatal("second event dropped with room in the queue")
+	}
+
+	done := make(chan bool)
+	go func() { done <- queue.enqueue(motionEvent("Porch")) }()
+
+	select {
+	case queued := <-done:
+		if queued {
+			t.Fatal("event queued past the queue depth")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("enqueue blocked on a full queue")
+	}
+
+	if pending := queue.pending(); pending != 1 {
+		t.Fatalf("pending: %d", pending)
+	}
+
+	if !queue.enqueue(motionEvent("Garage")) {
+		t.Fatal("another camera's event dropped")
+	}
+}
+
+// Triggers inside the merge window join the recording clip; after end they
+// queue again.
+func TestMotionQueueMerge(t *testing.T) {
+	t.Parallel()
+
+	var handled atomic.Int32
+
+	queue := newMotionQueue(1, 5, func(*securityspy.Event) { handled.Add(1) })
+	first := motionEvent("Porch")
+	first.Reasons = []securityspy.TriggerEvent{securityspy.TriggerByMotion}
+
+	queue.begin(first, time.Minute, false)
+
+	second := motionEvent("Porch")
+	second.Reasons = []securityspy.TriggerEvent{securityspy.TriggerByHumanDetection}
+
+	if !queue.enqueue(second) || queue.merged("Porch") != 1 || queue.pending() != 0 {
+		t.Fatalf("not merged: merged %d pending %d", queue.merged("Porch"), queue.pending())
+	}
+
+	reasons, merged := queue.end("Porch")
+	if merged != 1 || len(reasons) != 2 {
+		t.Fatalf("end: %v %d", reasons, merged)
+	}
+
+	if _, merged = queue.end("Porch"); merged != 0 {
+		t.Fatal("second end still had a capture")
+	}
+
+	queue.enqueue(motionEvent("Porch"))
+
+	for deadline := time.Now().Add(5 * time.Second); handled.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event after end was not handled")
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package motifini
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// mp4 box header sizes.
+const (
+	boxHeader     = 8
+	boxLargeSize  = 8
+	mvhdVersion1  = 1
+	mvhdV0Fields  = 20 // version+flags, creation, modification, timescale, duration.
+	mvhdV1Fields  = 32
+	mvhdTimescale = 12 // offset of the timescale in a version 0 mvhd.
+)
+
+var (
+	errNoDuration = errors.New("no movie header (still being written?)")
+	errUnfinished = errors.New("still being written")
+)
+
+// mp4Duration reads a finished MP4 or QuickTime file's length from its movie
+// header. Files still being written have no header yet and return an error.
+func mp4Duration(path string) (time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("reading clip length: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("reading clip length: %w", err)
+	}
+
+	start, end, err := findBox(file, 0, info.Size(), "moov")
+	if err != nil {
+		return 0, err
+	}
+
+	start, end, err = findBox(file, start, end, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, min(end-start, mvhdV1Fields))
+	if _, err = file.ReadAt(buf, start); err != nil || len(buf) < mvhdV0Fields {
+		return 0, errNoDuration
+	}
+
+	var scale, length uint64
+
+	if buf[0] == mvhdVersion1 {
+		if len(buf) < mvhdV1Fields {
+			return 0, errNoDuration
+		}
+
+		scale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		length = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		scale = uint64(binary.BigEndian.Uint32(buf[mvhdTimescale:16]))
+		length = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+
+	if scale == 0 {
+		return 0, errNoDuration
+	}
+
+	return time.Duration(float64(length) / float64(scale) * float64(time.Second)), nil
+}
+
+// clipLength is a clip's length from its file, or guess when it can't be read.
+func clipLength(path string, guess time.Duration) time.Duration {
+	if length, err := mp4Duration(path); err == nil && length > 0 {
+		return length
+	}
+
+	return guess
+}
+
+// checkWritten reads the top-level boxes of an MP4 or QuickTime download of
+// length bytes as they arrive, until the movie header. A file still being
+// written ends in an open media box with no header after it; that returns
+// errUnfinished without reading the rest. Anything else is left to mp4Duration.
+func checkWritten(stream io.Reader, length int64) error {
+	head := make([]byte, boxHeader+boxLargeSize)
+
+	for pos := int64(0); ; {
+		if _, err := io.ReadFull(stream, head[:boxHeader]); err != nil {
+			return nil //nolint:nilerr // a short file is mp4Duration's to reject.
+		}
+
+		size, header := int64(binary.BigEndian.Uint32(head[:4])), int64(boxHeader)
+		if size == 1 {
+			if _, err := io.ReadFull(stream, head[boxHeader:]); err != nil {
+				return nil //nolint:nilerr // as above.
+			}
+
+			size, header = int64(binary.BigEndian.Uint64(head[boxHeader:])), boxHeader+boxLargeSize
+		}
+
+		switch {
+		case string(head[4:boxHeader]) == "moov":
+			return nil
+		case size == 0, length > 0 && pos+size >= length:
+			return errUnfinished // runs to the end, with no room for a header after it.
+		case size < header:
+			return errNoDuration
+		}
+
+		if _, err := io.CopyN(io.Discard, stream, size-header); err != nil {
+			return nil //nolint:nilerr // as above.
+		}
+
+		pos += size
+	}
+}
+
+// findBox returns where the payload of the first box of a kind, between start
+// and end, begins and ends.
+func findBox(file io.ReaderAt, start, end int64, kind string) (int64, int64, error) {
+	head := make([]byte, boxHeader+boxLargeSize)
+
+	for pos := start; pos+boxHeader <= end; {
+		if _, err := file.ReadAt(head[:boxHeader], pos); err != nil {
+			return 0, 0, errNoDuration
+		}
+
+		size, header := int64(binary.BigEndian.Uint32(head[:4])), int64(boxHeader)
+
+		switch size {
+		case 0: // the box runs to the end.
+			size = end - pos
+		case 1: // a 64-bit size follows the type.
+			if _, err := file.ReadAt(head[boxHeader:], pos+boxHeader); err != nil {
+				return 0, 0, errNoDuration
+			}
+
+			size, header = int64(binary.BigEndian.Uint64(head[boxHeader:])), boxHeader+boxLargeSize
+		}
+
+		if size < header || pos+size > end {
+			return 0, 0, errNoDuration
+		}
+
+		if string(head[4:boxHeader]) == kind {
+			return pos + header, pos + size, nil
+		}
+
+		pos += size
+	}
+
+	return 0, 0, errNoDuration
+}
@@ -0,0 +1,93 @@
+package motifini
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// box builds an MP4 box.
+func box(kind string, payload ...[]byte) []byte {
+	size := 8
+	for _, part := range payload {
+		size += len(part)
+	}
+
+	out := binary.BigEndian.AppendUint32(nil, uint32(size))
+	out = append(out, kind...)
+
+	for _, part := range payload {
+		out = append(out, part...)
+	}
+
+	return out
+}
+
+// testMP4 writes a file with a version 0 movie header of the given length.
+func testMP4(t *testing.T, length time.Duration) string {
+	t.Helper()
+
+	const scale = 1000
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], scale)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(length/time.Millisecond))
+
+	data := append(box("ftyp", []byte("isom")), box("moov", box("mvhd", mvhd))...)
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestMP4Duration(t *testing.T) {
+	t.Parallel()
+
+	path := testMP4(t, 21500*time.Millisecond)
+	if got, err := mp4Duration(path); err != nil || got != 21500*time.Millisecond {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	// A file still being written has no moov box yet.
+	partial := filepath.Join(t.TempDir(), "partial.mp4")
+	_ = os.WriteFile(partial, append(box("ftyp", []byte("isom")), box("mdat", make([]byte, 64))...), 0o600)
+
+	if _, err := mp4Duration(partial); err == nil {
+		t.Fatal("a file without a movie header has no length")
+	}
+
+	if got := clipLength(partial, 6*time.Second); got != 6*time.Second {
+		t.Fatalf("fallback: got %v", got)
+	}
+}
+
+// Pre-roll is skipped unless the recording runs from its start through the
+// live clip's start; a recording still being written has no length yet.
+func TestCoversPreroll(t *testing.T) {
+	t.Parallel()
+
+	from := time.Now()
+	until := from.Add(5 * time.Second)
+	short := testMP4(t, 3*time.Second)
+
+	if err := coversPreroll(short, from.Add(-time.Second), until); !errors.Is(err, errNoRecording) {
+		t.Fatalf("short recording: got %v, want errNoRecording", err)
+	}
+
+	partial := filepath.Join(t.TempDir(), "partial.m4v")
+	_ = os.WriteFile(partial, box("mdat", make([]byte, 64)), 0o600)
+
+	if err := coversPreroll(partial, from.Add(-time.Second), until); !errors.Is(err, errNoRecording) {
+		t.Fatalf("recording in progress: got %v, want errNoRecording", err)
+	}
+
+	if err := coversPreroll(testMP4(t, 10*time.Second), from.Add(-time.Second), until); err != nil {
+		t.Fatalf("covering recording: %v", err)
+	}
+}
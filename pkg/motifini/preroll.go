@@ -0,0 +1,295 @@
+package motifini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"golift.io/securityspy/v2"
+)
+
+// Pre-roll runs before an alert goes out, so it only asks SecuritySpy for the
+// few seconds it needs and gives up quickly.
+const (
+	// prerollLookback is how long before the pre-roll a recording may have
+	// started and still be used. Older ones are skipped as too big to fetch.
+	prerollLookback = 2 * time.Minute
+	// prerollMaxBytes skips recordings too big to fetch before an alert.
+	prerollMaxBytes  = 32 * megabyte
+	prerollFetchWait = 10 * time.Second
+	prerollTimeout   = 20 * time.Second
+)
+
+var (
+	errNoRecording    = errors.New("no recording covers the pre-roll")
+	errPrerollTimeout = errors.New("download timed out")
+)
+
+// recordingSource lists and downloads a camera's recordings. It is
+// SecuritySpy's, unless a test sets Motifini.recordings.
+type recordingSource interface {
+	list(cam *securityspy.Camera, from, until time.Time) ([]*securityspy.File, error)
+	open(file *securityspy.File) (io.ReadCloser, error)
+}
+
+// sspyRecordings is the recordingSource of a SecuritySpy server: motion and
+// continuous recordings both.
+type sspyRecordings struct {
+	files *securityspy.Files
+}
+
+func (s sspyRecordings) list(cam *securityspy.Camera, from, until time.Time) ([]*securityspy.File, error) {
+	var all []*securityspy.File
+
+	for _, list := range []func([]int, time.Time, time.Time) ([]*securityspy.File, error){
+		s.files.GetCCVideos, s.files.GetVideos,
+	} {
+		files, err := list([]int{cam.Number}, from, until)
+		if err != nil {
+			return nil, fmt.Errorf("listing recordings: %w", err)
+		}
+
+		all = append(all, files...)
+	}
+
+	return all, nil
+}
+
+func (s sspyRecordings) open(file *securityspy.File) (io.ReadCloser, error) {
+	return file.Get() //nolint:wrapcheck // fetchWithin wraps it.
+}
+
+// prerollSource returns where pre-roll footage comes from, or nil without SecuritySpy.
+func (m *Motifini) prerollSource() recordingSource {
+	switch {
+	case m.recordings != nil:
+		return m.recordings
+	case m.SSpy == nil || m.SSpy.Files == nil:
+		return nil
+	default:
+		return sspyRecordings{files: m.SSpy.Files}
+	}
+}
+
+// prerollClip puts settings.PreRoll of SecuritySpy's recorded footage from
+// before the trigger in front of the clip at path, replacing it. started is
+// when the live capture began. It returns how much footage it added. The clip
+// is left alone, and the reason logged, when there is no finished recording to
+// take it from, or ffmpeg is missing or fails.
+func (m *Motifini) prerollClip(
+	reqID string, event *securityspy.Event, settings chat.ClipSettings, started time.Time, path string,
+) time.Duration {
+	source := m.prerollSource()
+	if settings.PreRoll <= 0 || source == nil {
+		return 0
+	}
+
+	when := event.When
+	if when.IsZero() {
+		when = event.Time
+	}
+
+	from := when.Add(-settings.PreRoll)
+	if gap := started.Sub(from); gap <= 0 || gap > settings.PreRoll+settings.Length {
+		// A clock skew, or a capture that waited in the motion queue: joining
+		// would not make one continuous clip.
+		m.Info.Printf("[%v] Pre-roll for %s skipped: live clip began %v after the trigger",
+			reqID, event.Camera.Name, started.Sub(when).Round(time.Second))
+		return 0
+	}
+
+	err := m.joinPreroll(reqID, source, event.Camera, settings, from, started, path)
+	if err != nil {
+		m.Info.Printf("[%v] Pre-roll for %s skipped: %v", reqID, event.Camera.Name, err)
+		return 0
+	}
+
+	m.Debug.Printf("[%v] Added %v of pre-roll to %s clip", reqID, started.Sub(from).Round(time.Second), event.Camera.Name)
+
+	return started.Sub(from)
+}
+
+// joinPreroll cuts from→until out of the newest recording that started before
+// from, and joins it to the start of the clip at path. The clip may have been
+// extended past the clip size, so the result is bounded by the largest extended clip.
+func (m *Motifini) joinPreroll(reqID string, source recordingSource, cam *securityspy.Camera,
+	settings chat.ClipSettings, from, until time.Time, path string,
+) error {
+	ffmpeg, err := chat.LookFFmpeg(m.Conf.Global.FFmpegPath)
+	if err != nil {
+		return err //nolint:wrapcheck // ErrNoFFmpeg says it all.
+	}
+
+	file, err := prerollRecording(source, cam, from, until)
+	if err != nil {
+		return err
+	}
+
+	recording := filepath.Join(m.Conf.Global.TempDir,
+		fmt.Sprintf("motifini_camera_preroll_%s_%s%s", reqID, cam.Name, filepath.Ext(file.Title)))
+	defer os.Remove(recording)
+
+	if err = fetchWithin(source, file, recording, prerollFetchWait); err != nil {
+		return fmt.Errorf("downloading %s: %w", file.Title, err)
+	}
+
+	if err = coversPreroll(recording, file.Updated, until); err != nil {
+		return err
+	}
+
+	joined := filepath.Join(m.Conf.Global.TempDir, fmt.Sprintf("motifini_camera_joined_%s_%s.mp4", reqID, cam.Name))
+	defer os.Remove(joined)
+
+	ops := chat.VideoClipOps(cam, settings)
+	_, maxSize := m.Msgs.Chat.ExtendLimits()
+	args := prerollArgs(recording, path, joined, from.Sub(file.Updated), until.Sub(from), ops, maxSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), prerollTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, ffmpeg, args(true)...).CombinedOutput()
+	if err != nil {
+		// The recording or the live clip may have no audio track; join the video alone.
+		out, err = exec.CommandContext(ctx, ffmpeg, args(false)...).CombinedOutput()
+	}
+
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, out)
+	}
+
+	if err = os.Rename(joined, path); err != nil {
+		return fmt.Errorf("replacing live clip: %w", err)
+	}
+
+	return nil
+}
+
+// prerollRecording finds the newest recording, small enough to fetch, that
+// started between prerollLookback before from and from.
+func prerollRecording(source recordingSource, cam *securityspy.Camera, from, until time.Time,
+) (*securityspy.File, error) {
+	files, err := source.list(cam, from.Add(-prerollLookback), until)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the source says what failed.
+	}
+
+	var newest *securityspy.File
+
+	for _, file := range files {
+		if file == nil || file.Updated.After(from) || file.Updated.Before(from.Add(-prerollLookback)) ||
+			file.Link.Length > prerollMaxBytes {
+			continue
+		}
+
+		if newest == nil || file.Updated.After(newest.Updated) {
+			newest = file
+		}
+	}
+
+	if newest == nil {
+		return nil, errNoRecording
+	}
+
+	return newest, nil
+}
+
+// fetchWithin downloads a recording to path, giving up after wait. It stops
+// early on a recording still being written, which has no usable footage yet.
+func fetchWithin(source recordingSource, file *securityspy.File, path string, wait time.Duration) error {
+	body, err := source.open(file)
+	if err != nil {
+		return fmt.Errorf("requesting: %w", err)
+	}
+	defer body.Close()
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:mnd // private temp file.
+	if err != nil {
+		return fmt.Errorf("creating: %w", err)
+	}
+	defer out.Close()
+
+	timer := time.AfterFunc(wait, func() { body.Close() }) // unblocks the copy.
+
+	download := io.TeeReader(io.LimitReader(body, prerollMaxBytes), out)
+
+	err = checkWritten(download, file.Link.Length)
+	if err == nil {
+		_, err = io.Copy(io.Discard, download)
+	}
+
+	if !timer.Stop() {
+		return errPrerollTimeout
+	}
+
+	if errors.Is(err, errUnfinished) || errors.Is(err, errNoDuration) {
+		return fmt.Errorf("%w: %w", errNoRecording, err)
+	} else if err != nil {
+		return fmt.Errorf("copying: %w", err)
+	}
+
+	return nil
+}
+
+// coversPreroll checks that a downloaded recording that started at start runs
+// through until. One still being written has no length yet, and is skipped.
+func coversPreroll(path string, start, until time.Time) error {
+	length, err := mp4Duration(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNoRecording, err)
+	}
+
+	if start.Add(length).Before(until) {
+		return fmt.Errorf("%w: it ends at %s", errNoRecording, start.Add(length).Format("15:04:05"))
+	}
+
+	return nil
+}
+
+// prerollArgs returns ffmpeg arguments that cut length from the recording at
+// offset, join the live clip after it, and encode both like the live clip
+// (codec and height) into at most maxSize bytes.
+func prerollArgs(recording, live, out string, offset, length time.Duration,
+	ops *securityspy.VidOps, maxSize int,
+) func(audio bool) []string {
+	scale := "setsar=1"
+	if ops.Height > 0 {
+		scale = "scale=-2:" + strconv.Itoa(ops.Height) + ",setsar=1"
+	}
+
+	codec := []string{"-c:v", "libx264"}
+	if ops.VCodec == chat.CodecH265 {
+		codec = []string{"-c:v", "libx265", "-tag:v", "hvc1"} // hvc1 plays on Apple devices.
+	}
+
+	return func(audio bool) []string {
+		filter := "[0:v]" + scale + "[pre];[1:v]" + scale + "[live];[pre][live]concat=n=2:v=1:a=0[v]"
+		maps := []string{"-map", "[v]", "-an"}
+
+		if audio {
+			filter = "[0:v]" + scale + "[pre];[1:v]" + scale + "[live];[pre][0:a][live][1:a]concat=n=2:v=1:a=1[v][a]"
+			maps = []string{"-map", "[v]", "-map", "[a]", "-c:a", "aac"}
+		}
+
+		args := []string{
+			"-hide_banner", "-loglevel", "error", "-y",
+			"-ss", seconds(offset), "-t", seconds(length), "-i", recording,
+			"-i", live, "-filter_complex", filter,
+		}
+		args = append(args, maps...)
+		args = append(args, codec...)
+
+		return append(args, "-preset", "veryfast", "-fs", strconv.Itoa(maxSize), "-movflags", "+faststart", out)
+	}
+}
+
+// seconds formats a duration for ffmpeg.
+func seconds(dur time.Duration) string {
+	return strconv.FormatFloat(dur.Seconds(), 'f', 3, 64) //nolint:mnd // milliseconds.
+}
@@ -0,0 +1,202 @@
+package motifini
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"golift.io/securityspy/v2"
+)
+
+// fakeRecordings is a recordingSource holding one recording in memory. It
+// counts the bytes downloaded.
+type fakeRecordings struct {
+	file *securityspy.File
+	data []byte
+	read atomic.Int64
+}
+
+func (f *fakeRecordings) list(*securityspy.Camera, time.Time, time.Time) ([]*securityspy.File, error) {
+	return []*securityspy.File{f.file}, nil
+}
+
+func (f *fakeRecordings) open(*securityspy.File) (io.ReadCloser, error) {
+	return io.NopCloser(&countingReader{r: bytes.NewReader(f.data), n: &f.read}), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+
+	return n, err
+}
+
+// fakeFFmpeg writes a script that records its arguments, and the contents of
+// any .txt clip list among them, next to itself. It writes "joined" to its
+// last argument, the output file.
+func fakeFFmpeg(t *testing.T) (string, func() string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := `#!/bin/sh
+echo "$@" >> "$0.args"
+for last; do
+	case "$last" in *.txt) cat "$last" >> "$0.args" ;; esac
+done
+echo joined > "$last"
+`
+
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil { //nolint:gosec // the test runs it.
+		t.Fatal(err)
+	}
+
+	return path, func() string {
+		args, _ := os.ReadFile(path + ".args")
+		return string(args)
+	}
+}
+
+// newPrerollTest returns a Motifini taking pre-roll from recordings, with its
+// Info log, and a live clip to put it in front of.
+func newPrerollTest(t *testing.T, recordings *fakeRecordings, ffmpeg string) (*Motifini, *bytes.Buffer, string) {
+	t.Helper()
+
+	var info bytes.Buffer
+
+	discard := log.New(io.Discard, "", 0)
+	m := &Motifini{
+		Conf: &Config{}, Msgs: &messenger.Messenger{}, recordings: recordings,
+		Info: log.New(&info, "", 0), Debug: discard, Error: discard,
+	}
+	m.Conf.Global.TempDir = t.TempDir()
+	m.Conf.Global.FFmpegPath = ffmpeg
+
+	live := filepath.Join(t.TempDir(), "live.mp4")
+	if err := os.WriteFile(live, []byte("live"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return m, &info, live
+}
+
+func prerollEvent(when time.Time) *securityspy.Event {
+	return &securityspy.Event{Camera: &securityspy.Camera{Name: "Porch", Number: 1}, Time: when}
+}
+
+// A finished recording that covers the pre-roll is cut and joined in front
+// of the live clip.
+func TestPrerollClip(t *testing.T) {
+	t.Parallel()
+
+	when := time.Now().Add(-time.Minute)
+	settings := chat.ClipSettings{Length: 10 * time.Second, PreRoll: 5 * time.Second}
+	started := when.Add(time.Second)
+
+	data, err := os.ReadFile(testMP4(t, 30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordings := &fakeRecordings{data: data, file: &securityspy.File{
+		Title: "Porch.mp4", Updated: when.Add(-7 * time.Second), Link: securityspy.FileLink{Length: int64(len(data))},
+	}}
+	ffmpeg, args := fakeFFmpeg(t)
+	m, _, live := newPrerollTest(t, recordings, ffmpeg)
+
+	if added := m.prerollClip("req", prerollEvent(when), settings, started, live); added != 6*time.Second {
+		t.Fatalf("added %v, want 6s", added)
+	}
+
+	if clip, _ := os.ReadFile(live); string(clip) != "joined\n" {
+		t.Fatalf("live clip not replaced: %q", clip)
+	}
+
+	// 2s into the recording (7s before the trigger, 5s of pre-roll), through the live start.
+	if got := args(); !strings.Contains(got, "-ss 2.000 -t 6.000 -i ") || !strings.Contains(got, live) {
+		t.Fatalf("ffmpeg args: %q", got)
+	}
+}
+
+// A recording still being written is given up on after its first boxes, the
+// live clip goes out alone, and the reason is logged at Info.
+func TestPrerollRecordingInProgress(t *testing.T) {
+	t.Parallel()
+
+	when := time.Now().Add(-time.Minute)
+	settings := chat.ClipSettings{Length: 10 * time.Second, PreRoll: 5 * time.Second}
+	open := append(box("ftyp", []byte("isom")), 0, 0, 0, 0, 'm', 'd', 'a', 't') // size 0: open-ended.
+	data := append(open, make([]byte, megabyte)...)
+
+	recordings := &fakeRecordings{data: data, file: &securityspy.File{
+		Title: "Porch.mp4", Updated: when.Add(-7 * time.Second), Link: securityspy.FileLink{Length: int64(len(data))},
+	}}
+	ffmpeg, args := fakeFFmpeg(t)
+	m, info, live := newPrerollTest(t, recordings, ffmpeg)
+
+	if added := m.prerollClip("req", prerollEvent(when), settings, when.Add(time.Second), live); added != 0 {
+		t.Fatalf("added %v from a recording in progress", added)
+	}
+
+	if read := recordings.read.Load(); read >= megabyte/2 {
+		t.Fatalf("downloaded %d bytes of a recording in progress", read)
+	}
+
+	if got := args(); got != "" {
+		t.Fatalf("ffmpeg ran: %q", got)
+	}
+
+	if clip, _ := os.ReadFile(live); string(clip) != "live" {
+		t.Fatalf("live clip changed: %q", clip)
+	}
+
+	if logged := info.String(); !strings.Contains(logged, "Pre-roll for Porch skipped") ||
+		!strings.Contains(logged, "still being written") {
+		t.Fatalf("info log: %q", logged)
+	}
+}
+
+// The stream check stops at an open media box, and passes a finished file
+// with its movie header before or after the media.
+func TestCheckWritten(t *testing.T) {
+	t.Parallel()
+
+	ftyp := box("ftyp", []byte("isom"))
+	moov := box("moov", box("mvhd", make([]byte, 100)))
+	mdat := box("mdat", make([]byte, 64))
+
+	for name, test := range map[string]struct {
+		data   []byte
+		length int64
+		want   error
+	}{
+		"moov first":       {data: slices.Concat(ftyp, moov, mdat), want: nil},
+		"moov last":        {data: slices.Concat(ftyp, mdat, moov), want: nil},
+		"open mdat":        {data: slices.Concat(ftyp, []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2, 3}), want: errUnfinished},
+		"mdat to the end":  {data: slices.Concat(ftyp, mdat), want: errUnfinished},
+		"unknown length":   {data: slices.Concat(ftyp, mdat, moov), length: -1, want: nil},
+		"short is unknown": {data: ftyp[:4], want: nil},
+	} {
+		length := test.length
+		if length == 0 {
+			length = int64(len(test.data))
+		}
+
+		if err := checkWritten(bytes.NewReader(test.data), length); err != test.want { //nolint:errorlint // sentinels.
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
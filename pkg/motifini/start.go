@@ -12,8 +12,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/davidnewhall/motifini/pkg/archive"
 	"github.com/davidnewhall/motifini/pkg/chat"
 	"github.com/davidnewhall/motifini/pkg/export"
+	"github.com/davidnewhall/motifini/pkg/history"
 	"github.com/davidnewhall/motifini/pkg/messenger"
 	"github.com/davidnewhall/motifini/pkg/service"
 	"github.com/davidnewhall/motifini/pkg/webserver"
@@ -39,6 +41,9 @@ const (
 	defaultLogFileMb        = 5
 	defaultLogFiles         = 10
 	defaultSecuritySpyRetry = 5 * time.Second
+	defaultSpoolDir         = "motifini-spool"         // created beside state_file
+	defaultDigestDir        = "motifini-digest"        // created beside state_file
+	defaultHistoryFile      = "motifini-history.jsonl" // created beside state_file
 	megabyte                = 1024 * 1024
 )
 
@@ -53,11 +58,16 @@ type Motifini struct {
 	SSpy          *securityspy.Server
 	Subs          *subscribe.Subscribe
 	Msgs          *messenger.Messenger
+	History       *history.Store
+	Archive       *archive.Archive // nil unless archive_dir is set
 	Info          *log.Logger
 	Error         *log.Logger
 	Debug         *log.Logger
 	Event         *log.Logger // SecuritySpy event stream (optional rotating file)
 	logWriter     io.Writer   // Info/MSGS/HTTP sink (stdout and/or rotating log_file)
+	motion        *motionQueue
+	recordings    recordingSource // pre-roll footage; SecuritySpy's when nil
+	saveClip      saveClipFunc    // records live clips; Camera.SaveVideo when nil
 	appLog        io.Closer
 	eventLog      io.Closer
 	streamLive    bool // true between EventStreamConnect and Disconnect
@@ -86,6 +96,18 @@ type Config struct {
 		LogFiles         int           `toml:"log_files"`          // rotated log file count (default 10)
 		LogFileMb        int           `toml:"log_file_mb"`        // rotated log size in MB (default 5)
 		SecuritySpyRetry cnfg.Duration `toml:"security_spy_retry"` // reconnect interval when SS is down (default 5s)
+		MotionWorkers    int           `toml:"motion_workers"`     // cameras capturing at once (default 4)
+		MotionQueue      int           `toml:"motion_queue"`       // queued motion events per camera (default 5)
+		SpoolDir         string        `toml:"spool_dir"`          // undelivered notifications (default beside state_file)
+		SpoolMaxAge      cnfg.Duration `toml:"spool_max_age"`      // drop undelivered notifications after this (default 24h)
+		DigestDir        string        `toml:"digest_dir"`         // alerts held for digests (default beside state_file)
+		HistoryFile      string        `toml:"history_file"`       // event history (default beside state_file)
+		HistoryMaxAge    cnfg.Duration `toml:"history_max_age"`    // forget events older than this (default 30 days)
+		HistoryMax       int           `toml:"history_max"`        // events kept at most (default 10000)
+		ArchiveDir       string        `toml:"archive_dir"`        // keep motion clips here (default off)
+		ArchiveMaxAge    cnfg.Duration `toml:"archive_max_age"`    // prune archived clips older than this (default 7 days)
+		ArchiveMaxMB     int64         `toml:"archive_max_mb"`     // archive size per camera in MB (default 1024)
+		FFmpegPath       string        `toml:"ffmpeg_path"`        // trims /recordings, joins pre-roll (default from PATH)
 		Debug            bool          `toml:"debug"`
 	} `toml:"motifini"`
 	Webserver struct {
@@ -97,6 +119,11 @@ type Config struct {
 		Enable           bool     `toml:"enable"`
 	} `toml:"webserver"`
 	Telegram    *messenger.TelegramConfig `toml:"telegram"`
+	Matrix      *messenger.MatrixConfig   `toml:"matrix"`
+	Webhook     *messenger.WebhookConfig  `toml:"webhook"`
+	Email       *messenger.EmailConfig    `toml:"email"`
+	Ntfy        *messenger.NtfyConfig     `toml:"ntfy"`
+	Pushover    *messenger.PushoverConfig `toml:"pushover"`
 	SecuritySpy *server.Config            `toml:"security_spy"`
 }
 
@@ -326,6 +353,30 @@ func (c *Config) Validate() {
 	if c.Global.SecuritySpyRetry.Duration <= 0 {
 		c.Global.SecuritySpyRetry.Duration = defaultSecuritySpyRetry
 	}
+
+	if c.Global.MotionWorkers < 1 {
+		c.Global.MotionWorkers = defaultMotionWorkers
+	}
+
+	if c.Global.MotionQueue < 1 {
+		c.Global.MotionQueue = defaultMotionQueue
+	}
+
+	if c.Global.SpoolDir == "" {
+		c.Global.SpoolDir = filepath.Join(filepath.Dir(c.Global.StateFile), defaultSpoolDir)
+	}
+
+	if c.Global.DigestDir == "" {
+		c.Global.DigestDir = filepath.Join(filepath.Dir(c.Global.StateFile), defaultDigestDir)
+	}
+
+	if c.Global.HistoryFile == "" {
+		c.Global.HistoryFile = filepath.Join(filepath.Dir(c.Global.StateFile), defaultHistoryFile)
+	}
+
+	if c.Global.SpoolMaxAge.Duration <= 0 {
+		c.Global.SpoolMaxAge.Duration = messenger.DefaultSpoolMaxAge
+	}
 }
 
 // Run starts the app after all configs are collected.
@@ -341,6 +392,25 @@ func (m *Motifini) Run() error {
 
 	chat.EnsureBuiltInEvents(m.Subs)
 
+	m.Info.Println("Opening Event History:", m.Conf.Global.HistoryFile)
+
+	global := &m.Conf.Global
+	m.History, err = history.Open(global.HistoryFile, global.HistoryMaxAge.Duration, global.HistoryMax)
+	if err != nil {
+		return fmt.Errorf("event history: %w", err)
+	}
+
+	if global.ArchiveDir != "" {
+		m.Info.Println("Opening Clip Archive:", global.ArchiveDir)
+
+		m.Archive, err = archive.New(global.ArchiveDir, global.ArchiveMaxAge.Duration, global.ArchiveMaxMB*megabyte)
+		if err != nil {
+			return fmt.Errorf("clip archive: %w", err)
+		}
+	}
+
+	m.motion = newMotionQueue(m.Conf.Global.MotionWorkers, m.Conf.Global.MotionQueue, m.handleCameraMotion)
+
 	if m.connectSecuritySpy() {
 		m.ProcessEventStream()
 		defer m.SSpy.Events.Stop(true)
@@ -416,21 +486,42 @@ func (m *Motifini) retrySecuritySpy(interval time.Duration) {
 
 // startMessenger builds and connects the chat/messenger stack.
 func (m *Motifini) startMessenger() error {
+	if tg := m.Conf.Telegram; tg != nil && tg.WebhookURL != "" && tg.WebhookListen == "" && !m.Conf.Webserver.Enable {
+		m.Error.Println("telegram.webhook_url needs the web server or telegram.webhook_listen; using long polling")
+		tg.WebhookURL = ""
+	}
+
 	m.Msgs = &messenger.Messenger{
 		Chat: chat.New(&chat.Chat{
 			TempDir: m.Conf.Global.TempDir,
 			Subs:    m.Subs,
 			SSpy:    m.SSpy,
-			Info:    log.New(m.logWriter, "[CHAT] ", m.Info.Flags()),
-			Debug:   m.Debug,
-			Error:   m.Error,
+			History: m.History,
+			Archive: m.Archive,
+			FFmpeg:  m.Conf.Global.FFmpegPath,
+			// Telegram is the only service taking clips past the standard limits.
+			LargeClips: m.Conf.Telegram.LargeFiles(),
+			Info:       log.New(m.logWriter, "[CHAT] ", m.Info.Flags()),
+			Debug:      m.Debug,
+			Error:      m.Error,
+			ModeChanged: func(mode, by string) {
+				m.notifySystemEvent(chat.EventModeChanged, chat.ModeMessage(mode, by))
+			},
 		}),
-		Subs:     m.Subs,
-		Telegram: m.Conf.Telegram,
-		TempDir:  m.Conf.Global.TempDir,
-		Info:     log.New(m.logWriter, "[MSGS] ", m.Info.Flags()),
-		Debug:    m.Debug,
-		Error:    m.Error,
+		Subs:        m.Subs,
+		Telegram:    m.Conf.Telegram,
+		Matrix:      m.Conf.Matrix,
+		Webhook:     m.Conf.Webhook,
+		Email:       m.Conf.Email,
+		Ntfy:        m.Conf.Ntfy,
+		Pushover:    m.Conf.Pushover,
+		TempDir:     m.Conf.Global.TempDir,
+		SpoolDir:    m.Conf.Global.SpoolDir,
+		SpoolMaxAge: m.Conf.Global.SpoolMaxAge.Duration,
+		DigestDir:   m.Conf.Global.DigestDir,
+		Info:        log.New(m.logWriter, "[MSGS] ", m.Info.Flags()),
+		Debug:       m.Debug,
+		Error:       m.Error,
 	}
 
 	err := messenger.New(m.Msgs)
@@ -447,6 +538,8 @@ func (m *Motifini) startWebserver() error {
 		SSpy:             m.SSpy,
 		Subs:             m.Subs,
 		Msgs:             m.Msgs,
+		History:          m.History,
+		Archive:          m.Archive,
 		Info:             log.New(m.logWriter, "[HTTP] ", m.Info.Flags()),
 		Debug:            m.Debug,
 		Error:            m.Error,
@@ -505,6 +598,20 @@ func (m *Motifini) publishDebugStats() {
 
 		return online
 	})
+	export.PublishCount("motion_queue_depth", func() int64 {
+		if m.motion == nil {
+			return 0
+		}
+
+		return m.motion.pending()
+	})
+	export.PublishCount("motion_busy", func() int64 {
+		if m.motion == nil {
+			return 0
+		}
+
+		return m.motion.busy()
+	})
 }
 
 // waitForSignal runs things at an interval and looks for an exit signal
@@ -8,6 +8,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/davidnewhall/motifini/pkg/messenger"
 )
 
 func TestAPIKeyValid(t *testing.T) {
@@ -276,3 +278,20 @@ func getWithKey(t *testing.T, url, key string) int {
 
 	return resp.StatusCode
 }
+
+// Without a messenger there is no Telegram webhook route, and a POST to it
+// falls through to the API routes.
+func TestHandlerWithoutMessenger(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+	cfg.Msgs = nil
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, messenger.TelegramWebhookPath, nil)
+	rec := httptest.NewRecorder()
+	cfg.handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("webhook path without a messenger: got %d want 405", rec.Code)
+	}
+}
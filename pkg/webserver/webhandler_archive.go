@@ -0,0 +1,105 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/davidnewhall/motifini/pkg/archive"
+	"github.com/davidnewhall/motifini/pkg/export"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"github.com/gorilla/mux"
+)
+
+// archivePath is where archived clip files are downloaded from.
+const archivePath = "/api/v1.0/archive/"
+
+// archiveClip is an archived clip in the GET /api/v1.0/archive response, with
+// download paths for its files.
+type archiveClip struct {
+	archive.Clip
+
+	VideoURL    string `json:"video_url,omitempty"`
+	SnapshotURL string `json:"snapshot_url,omitempty"`
+}
+
+// archiveListHandler handles GET /api/v1.0/archive: archived motion clips as
+// JSON, newest first. Filters: camera and limit.
+func (c *Config) archiveListHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+
+	if c.Archive == nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: clip archive is off\n", "archive")
+		return
+	}
+
+	limit, _ := strconv.Atoi(request.FormValue("limit"))
+	clips := c.Archive.List(request.FormValue("camera"), limit)
+	list := make([]archiveClip, 0, len(clips))
+
+	for _, clip := range clips {
+		item := archiveClip{Clip: clip}
+		dir, _, _ := strings.Cut(clip.ID, "/")
+
+		if clip.Video != "" {
+			item.VideoURL = archivePath + dir + "/" + clip.Video
+		}
+
+		if clip.Snapshot != "" {
+			item.SnapshotURL = archivePath + dir + "/" + clip.Snapshot
+		}
+
+		list = append(list, item)
+	}
+
+	reply, err := json.Marshal(list)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "archive")
+		return
+	}
+
+	c.finishReqJSON(writer, request, reqID, http.StatusOK, reply, "archive")
+}
+
+// archiveFileHandler handles GET /api/v1.0/archive/{camera}/{file}: download
+// an archived clip's video or snapshot. Range requests work, so players can seek.
+func (c *Config) archiveFileHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+	vars := mux.Vars(request)
+	name := strings.TrimSuffix(vars["file"], path.Ext(vars["file"]))
+
+	clip, err := c.Archive.Get(vars["camera"] + "/" + name)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: "+err.Error()+"\n", "archive")
+		return
+	}
+
+	filePath, err := c.Archive.Path(clip, vars["file"])
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: "+err.Error()+"\n", "archive")
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: "+archive.ErrNotFound.Error()+"\n", "archive")
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "archive")
+		return
+	}
+
+	export.Map.HTTPVisits.Add(1)
+	c.Info.Printf(`[%v] %v %v "%v %v" %d %d "%v" "%v"`,
+		reqID, request.RemoteAddr, request.Host, request.Method, redactAPIKey(request),
+		http.StatusOK, info.Size(), request.UserAgent(), "archive")
+	writer.Header().Set("Content-Disposition", `attachment; filename="`+vars["file"]+`"`)
+	http.ServeContent(writer, request, vars["file"], info.ModTime(), file)
+}
@@ -0,0 +1,59 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/archive"
+)
+
+func TestArchiveHandlers(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+
+	var err error
+
+	cfg.Archive, err = archive.New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video := filepath.Join(t.TempDir(), "clip.mp4")
+	_ = os.WriteFile(video, []byte("0123456789"), 0o600)
+
+	clip, err := cfg.Archive.Keep("ab12", archive.Clip{Camera: "Back Door", Time: time.Now()}, video, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doRequest(cfg.archiveListHandler, "GET", "/api/v1.0/archive?camera=back+door", "", "", nil)
+
+	var list []archiveClip
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].VideoURL == "" {
+		t.Fatalf("list: code=%d %s", rec.Code, rec.Body.String())
+	}
+
+	parts := strings.Split(strings.TrimPrefix(list[0].VideoURL, archivePath), "/")
+	rec = doRequest(cfg.archiveFileHandler, "GET", list[0].VideoURL, "", "",
+		map[string]string{"camera": parts[0], "file": parts[1]})
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("download %s: code=%d %q", clip.ID, rec.Code, rec.Body.String())
+	}
+
+	for _, vars := range []map[string]string{
+		{"camera": "..", "file": "subscribers.json"},
+		{"camera": parts[0], "file": strings.TrimSuffix(parts[1], ".mp4") + ".json"},
+	} {
+		rec = doRequest(cfg.archiveFileHandler, "GET", archivePath+"x/y", "", "", vars)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%v: code=%d want 404", vars, rec.Code)
+		}
+	}
+}
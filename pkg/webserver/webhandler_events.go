@@ -7,8 +7,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/history"
 	"github.com/davidnewhall/motifini/pkg/messenger"
 	"github.com/gorilla/mux"
 	"golift.io/securityspy/v2"
@@ -50,19 +52,21 @@ func (c *Config) eventsHandler(writer http.ResponseWriter, request *http.Request
 }
 
 // eventUpsertHandler handles PUT /api/v1.0/event/{event}: register or update a
-// catalog event so it appears in the Telegram subscribe menus. Accepts a
-// "description" form field or a JSON body like {"description": "..."}.
+// catalog event so it appears in the Telegram subscribe menus. Accepts
+// "description" and "ack" form fields or a JSON body like
+// {"description": "...", "ack": "5m"}. An ack window makes the event's alerts
+// wait for acknowledgement before escalating to the next tier; "off" clears it.
 func (c *Config) eventUpsertHandler(writer http.ResponseWriter, request *http.Request) {
 	reqID, event := messenger.ReqID(messenger.IDLength), mux.Vars(request)["event"]
 
-	if event == "" || chat.IsCamSettingsKey(event) || len(event) > chat.MaxEventNameLen {
+	if event == "" || chat.IsReservedKey(event) || len(event) > chat.MaxEventNameLen {
 		c.finishReq(writer, request, reqID, http.StatusBadRequest,
 			"ERROR: invalid event name\n", "register")
 
 		return
 	}
 
-	description, err := eventDescription(request)
+	fields, err := parseEventFields(request)
 	if err != nil {
 		c.finishReq(writer, request, reqID, http.StatusBadRequest,
 			"ERROR: "+err.Error()+"\n", "register")
@@ -70,7 +74,7 @@ func (c *Config) eventUpsertHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	created, err := c.upsertEvent(event, description)
+	created, err := c.upsertEvent(event, fields)
 	if err != nil {
 		c.finishReq(writer, request, reqID, http.StatusInternalServerError,
 			"ERROR: "+err.Error()+"\n", "register")
@@ -96,12 +100,16 @@ func (c *Config) eventUpsertHandler(writer http.ResponseWriter, request *http.Re
 // there would make a later notify treat it as registered, skip its own
 // persistence step and answer 200 for an event that only exists until restart.
 // A failed update needs no rollback: the next PUT saves again.
-func (c *Config) upsertEvent(event, description string) (bool, error) {
+func (c *Config) upsertEvent(event string, fields *eventFields) (bool, error) {
 	c.catalog.Lock()
 	defer c.catalog.Unlock()
 
 	created := !c.Subs.Events.Exists(event)
-	c.upsertCatalogEvent(event, description)
+	c.upsertCatalogEvent(event, fields.description)
+
+	if fields.ack != nil {
+		chat.SetAckWindow(c.Subs.Events, event, *fields.ack)
+	}
 
 	err := chat.SaveState(c.Subs)
 	if err != nil {
@@ -115,22 +123,46 @@ func (c *Config) upsertEvent(event, description string) (bool, error) {
 	return created, nil
 }
 
-// eventDescription reads the event description from a form field or a JSON body.
-func eventDescription(request *http.Request) (string, error) {
-	if !strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
-		return request.FormValue("description"), nil
-	}
+// eventFields are the settable parts of a catalog event. A nil ack leaves
+// the event's acknowledgement window alone.
+type eventFields struct {
+	description string
+	ack         *time.Duration
+}
 
+// parseEventFields reads the event description and ack window from form fields or a JSON body.
+func parseEventFields(request *http.Request) (*eventFields, error) {
 	var body struct {
-		Description string `json:"description"`
+		Description string  `json:"description"`
+		Ack         *string `json:"ack"`
+	}
+
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(request.Body).Decode(&body)
+		if err != nil {
+			return nil, fmt.Errorf("decoding JSON body: %w", err)
+		}
+	} else {
+		body.Description = request.FormValue("description")
+		if request.Form.Has("ack") {
+			ack := request.Form.Get("ack")
+			body.Ack = &ack
+		}
 	}
 
-	err := json.NewDecoder(request.Body).Decode(&body)
+	fields := &eventFields{description: body.Description}
+	if body.Ack == nil {
+		return fields, nil
+	}
+
+	window, err := chat.ParseAckWindow(*body.Ack)
 	if err != nil {
-		return "", fmt.Errorf("decoding JSON body: %w", err)
+		return nil, err //nolint:wrapcheck // the message is the API's answer.
 	}
 
-	return body.Description, nil
+	fields.ack = &window
+
+	return fields, nil
 }
 
 // upsertCatalogEvent registers or updates a catalog event from the HTTP API.
@@ -166,11 +198,12 @@ type eventListEntry struct {
 	Event       string `json:"event"`
 	Description string `json:"description"`
 	Source      string `json:"source"`
+	Ack         string `json:"ack,omitempty"`
 	Subscribers int    `json:"subscribers"`
 }
 
 // eventsListHandler handles GET /api/v1.0/events: list the subscribable event
-// catalog as JSON. Reserved camera clip settings keys are excluded.
+// catalog as JSON. Reserved settings keys (camera clips, the mode) are excluded.
 func (c *Config) eventsListHandler(writer http.ResponseWriter, request *http.Request) {
 	reqID, names := messenger.ReqID(messenger.IDLength), chat.CatalogEventNames(c.Subs.Events)
 	events := make([]eventListEntry, 0, len(names))
@@ -179,12 +212,18 @@ func (c *Config) eventsListHandler(writer http.ResponseWriter, request *http.Req
 		description, _ := c.Subs.Events.RuleGetS(name, "description")
 		source, _ := c.Subs.Events.RuleGetS(name, "source")
 
-		events = append(events, eventListEntry{
+		entry := eventListEntry{
 			Event:       name,
 			Description: description,
 			Source:      source,
 			Subscribers: len(c.Subs.GetSubscribers(name)),
-		})
+		}
+
+		if window := chat.AckWindow(c.Subs, name); window > 0 {
+			entry.Ack = window.String()
+		}
+
+		events = append(events, entry)
 	}
 
 	reply, err := json.Marshal(events)
@@ -228,7 +267,7 @@ func (c *Config) notifyHandler(
 	}
 
 	// Register unknown events so they appear in the Telegram subscribe menus.
-	if !chat.IsCamSettingsKey(req.event) {
+	if !chat.IsReservedKey(req.event) {
 		err := c.registerNotifyEvent(req.event, request.FormValue("description"))
 		if err != nil {
 			c.finishReq(writer, request, reqID, http.StatusInternalServerError,
@@ -238,13 +277,91 @@ func (c *Config) notifyHandler(
 		}
 	}
 
-	subs := c.Subs.GetSubscribers(req.event)
-	msg, path, code, reply := c.captureNotifyMedia(reqID, req, len(subs))
+	// Digest subscribers get the event later, with a snapshot when there is one.
+	subs, later := chat.SplitDigest(chat.CollectSubscribers(c.Subs, []string{req.event}), req.event, nil)
+	if len(subs) == 0 && req.media == mediaVideo {
+		req.media = mediaPhoto // nobody watches the clip now; the digest wants a still.
+	}
+
+	if req.media == mediaVideo {
+		// Long clips (local Bot API server) plus delivery can outlast the write timeout.
+		settings := c.clipSettings(req.cam.Name)
+		_ = http.NewResponseController(writer).SetWriteDeadline(time.Now().Add(settings.Length + Timeout))
+	}
+
+	msg, path, code, reply := c.captureNotifyMedia(reqID, req, len(subs)+len(later))
+
+	event := &messenger.Event{Name: req.event, Time: time.Now()}
+	if req.cam != nil && path != "" {
+		event.Camera = req.cam.Name
+	}
+
+	entry := history.Entry{Time: event.Time, Camera: event.Camera, Event: req.event}
 
-	c.Msgs.SendFileOrMsg(reqID, msg, path, subs)
+	if len(later) > 0 {
+		digest := *event
+		if req.media == mediaPhoto {
+			digest.Snapshot = path
+		}
+
+		failed := c.Msgs.RecordDigest(reqID, &digest, later)
+		subs = append(subs, failed...)
+		entry.Digest = len(later) - len(failed)
+		reply = strings.TrimSuffix(reply, "\n") + fmt.Sprintf(" (%d held for digest)\n", entry.Digest)
+	}
+
+	delivery := c.Msgs.SendEvent(reqID, event, msg, path, subs)
+	code, reply = deliveryReply(delivery, code, reply)
+	c.addHistory(reqID, entry, subs, delivery)
 	c.finishReq(writer, request, reqID, code, reply, msg)
 }
 
+// addHistory records a notify in the event history.
+func (c *Config) addHistory(
+	reqID string, entry history.Entry, subs []*subscribe.Subscriber, delivery *messenger.Delivery,
+) {
+	for _, sub := range subs {
+		name := chat.SubContact(sub)
+		if name == "" {
+			name = "?"
+		}
+
+		entry.Notified = append(entry.Notified, fmt.Sprintf("%d:%s", sub.ID, name))
+	}
+
+	if delivery != nil {
+		entry.Sent, entry.Failed, entry.Spooled = delivery.Sent, len(delivery.Failed), delivery.Spooled
+	}
+
+	if _, err := c.History.Add(entry); err != nil {
+		c.Error.Printf("[%v] Recording event history: %v", reqID, err)
+	}
+}
+
+// deliveryReply folds the messenger delivery result into the notify response.
+// Nobody reached is a 502, or a 202 when the spool will retry it. A partial
+// delivery keeps the status and says how far it got.
+func deliveryReply(delivery *messenger.Delivery, code int, reply string) (int, string) {
+	if delivery == nil || len(delivery.Failed) == 0 {
+		return code, reply
+	}
+
+	switch {
+	case delivery.Sent == 0 && delivery.Spooled == 0:
+		return http.StatusBadGateway,
+			fmt.Sprintf("ERROR: delivery failed for all %d subscriber(s)\n", len(delivery.Failed))
+	case delivery.Sent == 0 && code == http.StatusOK:
+		code = http.StatusAccepted
+	}
+
+	note := fmt.Sprintf(" (delivered to %d of %d subscribers", delivery.Sent, delivery.Total())
+	if delivery.Spooled > 0 {
+		note += fmt.Sprintf(", %d queued for retry", delivery.Spooled)
+	}
+
+	return code, strings.TrimSuffix(reply, "\n") + note + ")\n"
+}
+
 // registerNotifyEvent adds an event the catalog has never seen, so the Telegram
 // subscribe menus pick it up. The check, create, save and rollback all run under
 // one lock: a save failure rolls the new event back, and without the lock that
@@ -359,7 +476,7 @@ func (c *Config) captureNotifyMedia(
 
 	var err error
 	if req.media == mediaVideo {
-		settings := chat.GetCameraClipSettings(c.Subs, req.cam.Name)
+		settings := c.clipSettings(req.cam.Name)
 		err = req.cam.SaveVideo(chat.VideoClipOps(req.cam, settings), settings.Length, int64(settings.Size), path)
 	} else {
 		err = req.cam.SaveJPEG(&securityspy.VidOps{}, path)
@@ -388,3 +505,12 @@ func appendNote(msg, note string) string {
 
 	return msg + "\n\n" + note
 }
+
+// clipSettings is a camera's clip settings within the chat's clip limits.
+func (c *Config) clipSettings(camName string) chat.ClipSettings {
+	if c.Msgs == nil || c.Msgs.Chat == nil {
+		return chat.GetCameraClipSettings(c.Subs, camName)
+	}
+
+	return c.Msgs.Chat.CameraClipSettings(camName)
+}
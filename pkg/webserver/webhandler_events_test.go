@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/davidnewhall/motifini/pkg/chat"
 	"github.com/davidnewhall/motifini/pkg/export"
@@ -97,6 +98,42 @@ func TestEventUpsertFormAndJSON(t *testing.T) {
 	}
 }
 
+// An ack window can be set, read back in the list, and cleared.
+func TestEventUpsertAck(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+	vars := map[string]string{"event": "garage_opened"}
+
+	rec := doRequest(cfg.eventUpsertHandler, "PUT", "/api/v1.0/event/garage_opened?ack=5", "", "", vars)
+	if rec.Code != http.StatusOK || chat.AckWindow(cfg.Subs, "garage_opened") != 5*time.Minute {
+		t.Fatalf("set: code=%d ack=%v", rec.Code, chat.AckWindow(cfg.Subs, "garage_opened"))
+	}
+
+	rec = doRequest(cfg.eventsListHandler, "GET", "/api/v1.0/events", "", "", nil)
+	if !strings.Contains(rec.Body.String(), `"ack":"5m0s"`) {
+		t.Fatalf("list: %s", rec.Body.String())
+	}
+
+	// A description-only update leaves the window alone.
+	rec = doRequest(cfg.eventUpsertHandler, "PUT", "/api/v1.0/event/garage_opened",
+		`{"description":"Garage door"}`, "application/json", vars)
+	if rec.Code != http.StatusOK || chat.AckWindow(cfg.Subs, "garage_opened") != 5*time.Minute {
+		t.Fatalf("description: code=%d ack=%v", rec.Code, chat.AckWindow(cfg.Subs, "garage_opened"))
+	}
+
+	rec = doRequest(cfg.eventUpsertHandler, "PUT", "/api/v1.0/event/garage_opened",
+		`{"ack":"off"}`, "application/json", vars)
+	if rec.Code != http.StatusOK || chat.AckWindow(cfg.Subs, "garage_opened") != 0 {
+		t.Fatalf("clear: code=%d ack=%v", rec.Code, chat.AckWindow(cfg.Subs, "garage_opened"))
+	}
+
+	rec = doRequest(cfg.eventUpsertHandler, "PUT", "/api/v1.0/event/garage_opened?ack=soon", "", "", vars)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad ack: code=%d want 400", rec.Code)
+	}
+}
+
 func TestEventUpsertRejects(t *testing.T) {
 	t.Parallel()
 
@@ -403,3 +440,33 @@ func TestEventRemove(t *testing.T) {
 		t.Fatal("state file still contains removed event")
 	}
 }
+
+func TestDeliveryReply(t *testing.T) {
+	t.Parallel()
+
+	ok := "REQ ID: abcd, msg: got notify\n"
+	sub := &subscribe.Subscriber{ID: 1, API: messenger.APITelegram}
+
+	sent := &messenger.Delivery{Sent: 2}
+	if code, reply := deliveryReply(sent, http.StatusOK, ok); code != http.StatusOK || reply != ok {
+		t.Fatalf("all sent: code=%d reply=%q", code, reply)
+	}
+
+	partial := &messenger.Delivery{Sent: 1, Failed: []*subscribe.Subscriber{sub}}
+	if code, reply := deliveryReply(partial, http.StatusOK, ok); code != http.StatusOK ||
+		!strings.Contains(reply, "delivered to 1 of 2") {
+		t.Fatalf("partial: code=%d reply=%q", code, reply)
+	}
+
+	queued := &messenger.Delivery{Failed: []*subscribe.Subscriber{sub}, Spooled: 1}
+	if code, reply := deliveryReply(queued, http.StatusOK, ok); code != http.StatusAccepted ||
+		!strings.Contains(reply, "1 queued for retry") {
+		t.Fatalf("queued: code=%d reply=%q", code, reply)
+	}
+
+	failed := &messenger.Delivery{Failed: []*subscribe.Subscriber{sub}}
+	if code, reply := deliveryReply(failed, http.StatusOK, ok); code != http.StatusBadGateway ||
+		!strings.HasPrefix(reply, "ERROR:") {
+		t.Fatalf("all failed: code=%d reply=%q", code, reply)
+	}
+}
@@ -0,0 +1,46 @@
+package webserver
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/messenger"
+)
+
+// gridWriteTimeout replaces the server's write timeout for a grid request:
+// every camera is captured in turn before the first byte goes out.
+const gridWriteTimeout = 3 * time.Minute
+
+// /api/v1.0/grid handler. Replies with a JPEG of every camera in a labeled grid.
+func (c *Config) gridHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+
+	if !c.securitySpyReady() || c.Msgs.Chat == nil {
+		c.Debug.Printf("[%v] SecuritySpy cameras not loaded yet", reqID)
+		c.finishReq(writer, request, reqID, http.StatusServiceUnavailable,
+			"ERROR: SecuritySpy not ready (cameras not loaded)\n", "grid")
+
+		return
+	}
+
+	_ = http.NewResponseController(writer).SetWriteDeadline(time.Now().Add(gridWriteTimeout))
+
+	path, summary, err := c.Msgs.Chat.GridSnapshot(reqID, nil)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "grid")
+		return
+	}
+	defer os.Remove(path)
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		c.Error.Printf("[%v] reading grid: %v", reqID, err)
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "grid")
+
+		return
+	}
+
+	c.Debug.Printf("[%v] grid: %s", reqID, summary)
+	c.finishReqJPEG(writer, request, reqID, body, "grid")
+}
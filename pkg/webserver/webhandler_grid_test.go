@@ -0,0 +1,17 @@
+package webserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGridHandlerNotReady(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+
+	rec := doRequest(cfg.gridHandler, http.MethodGet, "/api/v1.0/grid", "", "", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("grid without SecuritySpy: got %d want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+}
@@ -0,0 +1,101 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidnewhall/motifini/pkg/history"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+)
+
+// historyReply is the GET /api/v1.0/history response.
+type historyReply struct {
+	Entries []history.Entry `json:"entries"`
+	// More is true when older entries match; ask again with before set to the last ID.
+	More bool `json:"more"`
+}
+
+// historyHandler handles GET /api/v1.0/history: recorded events as JSON,
+// newest first, for dashboards. Filters: camera, class, event, since and until
+// (RFC 3339 times, or a duration back from now like 24h), before and after
+// (entry IDs, for paging) and limit.
+func (c *Config) historyHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+
+	if c.History == nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: event history is off\n", "history")
+		return
+	}
+
+	query, err := parseHistoryQuery(request)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: "+err.Error()+"\n", "history")
+		return
+	}
+
+	entries, more := c.History.Find(query)
+	if entries == nil {
+		entries = []history.Entry{}
+	}
+
+	reply, err := json.Marshal(historyReply{Entries: entries, More: more})
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "history")
+		return
+	}
+
+	c.finishReqJSON(writer, request, reqID, http.StatusOK, reply, "history")
+}
+
+func parseHistoryQuery(request *http.Request) (history.Query, error) {
+	query := history.Query{
+		Camera: request.FormValue("camera"),
+		Class:  request.FormValue("class"),
+		Event:  request.FormValue("event"),
+	}
+
+	var err error
+
+	for name, field := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if *field, err = parseHistoryTime(request.FormValue(name)); err != nil {
+			return query, fmt.Errorf("bad %s: %w", name, err)
+		}
+	}
+
+	for name, field := range map[string]*int64{"before": &query.Before, "after": &query.After} {
+		if value := request.FormValue(name); value != "" {
+			if *field, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return query, fmt.Errorf("bad %s: %w", name, err)
+			}
+		}
+	}
+
+	if value := request.FormValue("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			return query, fmt.Errorf("bad limit: %w", err)
+		}
+	}
+
+	return query, nil
+}
+
+// parseHistoryTime reads an RFC 3339 time, or a duration back from now.
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want an RFC 3339 time or a duration: %w", err)
+	}
+
+	return at, nil
+}
@@ -0,0 +1,61 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidnewhall/motifini/pkg/history"
+)
+
+// Notifies land in the history, and the API pages through them newest first.
+func TestHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+
+	rec := doRequest(cfg.historyHandler, "GET", "/api/v1.0/history", "", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("history off: code=%d want 404", rec.Code)
+	}
+
+	var err error
+
+	cfg.History, err = history.Open(filepath.Join(t.TempDir(), "history.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range []string{"garage_opened", "door_bell", "garage_opened"} {
+		rec = doRequest(cfg.eventsHandler, "POST", "/api/v1.0/event/notify/"+event+"?msg=hi", "", "",
+			map[string]string{"cmd": "notify", "event": event})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("notify %s: code=%d %s", event, rec.Code, rec.Body.String())
+		}
+	}
+
+	var reply historyReply
+
+	rec = doRequest(cfg.historyHandler, "GET", "/api/v1.0/history?event=garage_opened&limit=1&since=1h", "", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("get: code=%d %s", rec.Code, rec.Body.String())
+	}
+
+	if len(reply.Entries) != 1 || !reply.More || reply.Entries[0].ID != 3 {
+		t.Fatalf("first page: %+v", reply)
+	}
+
+	rec = doRequest(cfg.historyHandler, "GET", "/api/v1.0/history?event=garage_opened&before=3", "", "", nil)
+	reply = historyReply{}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil || len(reply.Entries) != 1 || reply.More ||
+		reply.Entries[0].ID != 1 {
+		t.Fatalf("second page: %s", rec.Body.String())
+	}
+
+	rec = doRequest(cfg.historyHandler, "GET", "/api/v1.0/history?since=yesterday", "", "", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad since: code=%d want 400", rec.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"github.com/gorilla/mux"
+)
+
+// defaultModeBy names API mode changes that do not say who made them.
+const defaultModeBy = "the API"
+
+// modeReply is the GET /api/v1.0/mode response.
+type modeReply struct {
+	Mode string `json:"mode"`
+	By   string `json:"by,omitempty"`
+}
+
+// modeHandler handles GET /api/v1.0/mode: the household mode as JSON.
+func (c *Config) modeHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+	mode, by := chat.HouseMode(c.Subs)
+
+	reply, err := json.Marshal(modeReply{Mode: mode, By: by})
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: "+err.Error()+"\n", "mode")
+		return
+	}
+
+	c.finishReqJSON(writer, request, reqID, http.StatusOK, reply, "mode")
+}
+
+// modeSetHandler handles PUT /api/v1.0/mode/{mode}: switch the household to
+// armed, home or disarmed, for presence automations. The optional "by" form
+// field names who did it in the Mode Changed announcement.
+func (c *Config) modeSetHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID := messenger.ReqID(messenger.IDLength)
+
+	if c.Msgs == nil || c.Msgs.Chat == nil {
+		c.finishReq(writer, request, reqID, http.StatusServiceUnavailable, "ERROR: chat is not running\n", "mode")
+		return
+	}
+
+	by := strings.TrimSpace(request.FormValue("by"))
+	if by == "" {
+		by = defaultModeBy
+	}
+
+	// The chat command and this API share one path, and one announcement.
+	c.catalog.Lock()
+	mode, changed, err := c.Msgs.Chat.SetMode(mux.Vars(request)["mode"], by)
+
+	if err != nil {
+		c.catalog.Unlock()
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: "+err.Error()+"\n", "mode")
+
+		return
+	}
+
+	if changed {
+		err = chat.SaveState(c.Subs)
+	}
+	c.catalog.Unlock()
+
+	if err != nil {
+		c.Error.Printf("[%v] saving state after mode change: %v", reqID, err)
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError, "ERROR: save failed: "+err.Error()+"\n", "mode")
+
+		return
+	}
+
+	if !changed {
+		c.finishReq(writer, request, reqID, http.StatusOK, "OK: already "+mode+"\n", "mode")
+		return
+	}
+
+	c.finishReq(writer, request, reqID, http.StatusOK, "OK: mode is now "+mode+"\n", "mode")
+}
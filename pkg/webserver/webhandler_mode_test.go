@@ -0,0 +1,48 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+)
+
+func TestModeHandlers(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+
+	var announced []string
+	cfg.Msgs.Chat = chat.New(&chat.Chat{
+		Subs:        cfg.Subs,
+		ModeChanged: func(mode, by string) { announced = append(announced, mode+"/"+by) },
+	})
+
+	rec := doRequest(cfg.modeSetHandler, "PUT", "/api/v1.0/mode/home?by=Presence", "", "",
+		map[string]string{"mode": "home"})
+	if rec.Code != http.StatusOK || len(announced) != 1 || announced[0] != "home/Presence" {
+		t.Fatalf("set: code=%d announced=%v", rec.Code, announced)
+	}
+
+	rec = doRequest(cfg.modeSetHandler, "PUT", "/api/v1.0/mode/stay", "", "", map[string]string{"mode": "stay"})
+	if rec.Code != http.StatusOK || len(announced) != 1 {
+		t.Fatalf("unchanged: code=%d announced=%v", rec.Code, announced)
+	}
+
+	rec = doRequest(cfg.modeHandler, "GET", "/api/v1.0/mode", "", "", nil)
+	if !strings.Contains(rec.Body.String(), `"mode":"home"`) {
+		t.Fatalf("get: %s", rec.Body.String())
+	}
+
+	rec = doRequest(cfg.modeSetHandler, "PUT", "/api/v1.0/mode/party", "", "", map[string]string{"mode": "party"})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad mode: code=%d want 400", rec.Code)
+	}
+
+	// The mode's catalog entry is not an event.
+	rec = doRequest(cfg.eventsListHandler, "GET", "/api/v1.0/events", "", "", nil)
+	if mode, _ := chat.HouseMode(cfg.Subs); mode != chat.ModeHome || strings.Contains(rec.Body.String(), "__mode") {
+		t.Fatalf("list: mode %s, %s", mode, rec.Body.String())
+	}
+}
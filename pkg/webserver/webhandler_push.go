@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"github.com/gorilla/mux"
+)
+
+// pushAddHandler handles PUT /api/v1.0/push/{api:ntfy|pushover} with form field to.
+//
+// It adds an ntfy topic (name or URL) or a Pushover user key as a subscriber and
+// replies with its subscriber ID. Subscribe it to events with
+// /api/v1.0/sub/subscribe/{api}/{id}/{event}. Adding it again is a no-op.
+func (c *Config) pushAddHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID, api := messenger.ReqID(messenger.IDLength), mux.Vars(request)["api"]
+
+	c.catalog.Lock()
+	defer c.catalog.Unlock()
+
+	sub, created, err := c.Msgs.AddSubscriber(api, request.FormValue("to"))
+
+	switch {
+	case errors.Is(err, messenger.ErrUnknownAPI):
+		c.finishReq(writer, request, reqID, http.StatusNotFound, "ERROR: "+err.Error()+"\n", api)
+		return
+	case err != nil:
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: "+err.Error()+"\n", api)
+		return
+	case !created:
+		c.finishReq(writer, request, reqID, http.StatusOK,
+			fmt.Sprintf("OK: %s subscriber %d already registered\n", api, sub.ID), api)
+
+		return
+	}
+
+	err = chat.SaveState(c.Subs)
+	if err != nil {
+		_ = c.Subs.DeleteSubscriber(sub.ID, api)
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError,
+			"ERROR: save failed: "+err.Error()+"\n", api)
+
+		return
+	}
+
+	c.finishReq(writer, request, reqID, http.StatusOK,
+		fmt.Sprintf("OK: registered %s subscriber %d\n", api, sub.ID), api)
+}
+
+// pushRemoveHandler handles DELETE /api/v1.0/push/{api:ntfy|pushover}/{id}.
+func (c *Config) pushRemoveHandler(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	reqID, api, idStr := messenger.ReqID(messenger.IDLength), vars["api"], vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: invalid subscriber id\n", api)
+		return
+	}
+
+	c.catalog.Lock()
+	defer c.catalog.Unlock()
+
+	err = c.Subs.DeleteSubscriber(id, api)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound,
+			"ERROR: "+api+" subscriber not found: "+idStr+"\n", api)
+
+		return
+	}
+
+	err = chat.SaveState(c.Subs)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError,
+			"ERROR: save failed: "+err.Error()+"\n", api)
+
+		return
+	}
+
+	c.finishReq(writer, request, reqID, http.StatusOK, "OK: removed "+api+" subscriber "+idStr+"\n", api)
+}
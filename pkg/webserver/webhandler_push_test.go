@@ -0,0 +1,32 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The test Messenger has no backends, so push subscribers cannot be added.
+func TestPushAddNotConfigured(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+
+	rec := doRequest(cfg.pushAddHandler, "PUT", "/api/v1.0/push/ntfy",
+		"to=https://ntfy.example.org/porch", "application/x-www-form-urlencoded", map[string]string{"api": "ntfy"})
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "ntfy is not configured") {
+		t.Fatalf("add: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(cfg.pushRemoveHandler, "DELETE", "/api/v1.0/push/pushover/12", "", "",
+		map[string]string{"api": "pushover", "id": "12"})
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("remove missing: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(cfg.pushRemoveHandler, "DELETE", "/api/v1.0/push/pushover/x", "", "",
+		map[string]string{"api": "pushover", "id": "x"})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("remove bad id: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+}
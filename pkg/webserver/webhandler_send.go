@@ -1,6 +1,7 @@
 package webserver
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -55,6 +56,10 @@ func (c *Config) sendVideoHandler(writer http.ResponseWriter, request *http.Requ
 		err := c.processVideoRequest(reqID, cam, recipients, vals, vars)
 		if err != nil {
 			code = http.StatusInternalServerError
+			if errors.Is(err, ErrDeliveryFailed) {
+				code = http.StatusBadGateway
+			}
+
 			reply = "ERROR: " + err.Error()
 		}
 	}
@@ -102,13 +107,30 @@ func (c *Config) processVideoRequest(
 	defer os.Remove(path) // SendTelegram no longer deletes; clean up after all recipients.
 
 	// Input data OK, video grabbed, send an attachment to each recipient.
-	for t := range strings.SplitSeq(recipients, ",") {
-		if vars["app"] == messenger.APITelegram {
-			dest, _ := strconv.ParseInt(t, 10, 64)
-			c.Msgs.SendTelegram(reqID, chat.CameraCaption(cam.Name, chat.CaptionVideo), path, dest, c.telegramContact(dest))
+	return c.sendToRecipients(reqID, chat.CameraCaption(cam.Name, chat.CaptionVideo), path,
+		strings.Split(recipients, ","), vars)
+}
+
+// sendToRecipients delivers a message or file to each Telegram chat ID and
+// reports how many deliveries failed after retries.
+func (c *Config) sendToRecipients(reqID, msg, path string, recipients []string, vars map[string]string) error {
+	if vars["app"] != messenger.APITelegram {
+		return nil
+	}
+
+	failed := 0
+
+	for _, t := range recipients {
+		dest, _ := strconv.ParseInt(t, 10, 64)
+		if c.Msgs.SendTelegram(reqID, msg, path, dest, c.telegramContact(dest)) != nil {
+			failed++
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d recipient(s)", ErrDeliveryFailed, failed, len(recipients))
+	}
+
 	return nil
 }
 
@@ -184,11 +206,9 @@ func (c *Config) sendPictureToRecipients(
 	defer os.Remove(path) // SendTelegram no longer deletes; clean up after all recipients.
 
 	// Input data OK, send a message to each recipient.
-	for _, t := range recipients {
-		if vars["app"] == messenger.APITelegram {
-			dest, _ := strconv.ParseInt(t, 10, 64)
-			c.Msgs.SendTelegram(reqID, chat.CameraCaption(cam.Name, chat.CaptionPhoto), path, dest, c.telegramContact(dest))
-		}
+	err = c.sendToRecipients(reqID, chat.CameraCaption(cam.Name, chat.CaptionPhoto), path, recipients, vars)
+	if err != nil {
+		return http.StatusBadGateway, "ERROR: " + err.Error()
 	}
 
 	return http.StatusOK, "REQ ID: " + reqID + ", msg: OK\n"
@@ -215,14 +235,9 @@ func (c *Config) sendMessageHandler(writer http.ResponseWriter, request *http.Re
 		c.Debug.Printf("[%v] Invalid 'to' provided or 'msg' empty: %v", reqID, msg)
 
 		code, reply = http.StatusInternalServerError, "ERROR: Missing 'to' or 'msg'"
-	} else {
-		// Input data OK, send a message to each recipient.
-		for _, t := range recipients {
-			if vars["app"] == messenger.APITelegram {
-				dest, _ := strconv.ParseInt(t, 10, 64)
-				c.Msgs.SendTelegram(reqID, msg, "", dest, c.telegramContact(dest))
-			}
-		}
+	} else if err := c.sendToRecipients(reqID, msg, "", recipients, vars); err != nil {
+		// Input data OK, but Telegram would not take it for every recipient.
+		code, reply = http.StatusBadGateway, "ERROR: "+err.Error()
 	}
 
 	reply = "REQ ID: " + reqID + ", msg: " + reply + "\n"
@@ -15,8 +15,9 @@ import (
 
 const defaultPauseMinutes = 60
 
-// /api/v1.0/sub/{cmd:subscribe|unsubscribe|pause|unpause}/{api}/{contact}/{event} handler.
-// Optional query: minutes (pause only, default 60).
+// /api/v1.0/sub/{cmd:subscribe|unsubscribe|pause|unpause|tier|modes}/{api}/{contact}/{event} handler.
+// Optional query: minutes (pause only, default 60); tier (tier only, 0 to chat.MaxAckTier);
+// modes (modes only, e.g. armed,home; empty for every mode).
 func (c *Config) subsHandler(writer http.ResponseWriter, request *http.Request) {
 	reqID := messenger.ReqID(messenger.IDLength)
 	vars := mux.Vars(request)
@@ -33,7 +34,16 @@ func (c *Config) subsHandler(writer http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	code, reply := c.applySubCmd(sub, cmd, event, request.FormValue("minutes"))
+	value := request.FormValue("minutes")
+
+	switch cmd {
+	case "tier":
+		value = request.FormValue("tier")
+	case "modes":
+		value = request.FormValue("modes")
+	}
+
+	code, reply := c.applySubCmd(sub, cmd, event, value)
 	if code == http.StatusOK {
 		err := chat.SaveState(c.Subs)
 		if err != nil {
@@ -62,16 +72,21 @@ func (c *Config) lookupSubscriber(api, contact string) (*subscribe.Subscriber, e
 	return sub, nil
 }
 
-func (c *Config) applySubCmd(sub *subscribe.Subscriber, cmd, event, minutesStr string) (int, string) {
+// applySubCmd runs one subscription command. value is the pause minutes, the tier or the modes.
+func (c *Config) applySubCmd(sub *subscribe.Subscriber, cmd, event, value string) (int, string) {
 	switch cmd {
 	case "subscribe":
 		return applySubscribe(sub, event)
 	case "unsubscribe":
 		return applyUnsubscribe(sub, event)
 	case "pause":
-		return applyPause(sub, event, minutesStr)
+		return applyPause(sub, event, value)
 	case "unpause":
 		return applyUnpause(sub, event)
+	case "tier":
+		return applyTier(sub, event, value)
+	case "modes":
+		return applyModes(sub, event, value)
 	default:
 		return http.StatusBadRequest, "ERROR: unknown command\n"
 	}
@@ -138,6 +153,53 @@ func applyUnpause(sub *subscribe.Subscriber, event string) (int, string) {
 	return http.StatusOK, fmt.Sprintf("OK: unpaused %s for %s\n", event, subLabel(sub))
 }
 
+// applyTier sets the escalation tier of a subscription: when alerts that
+// need acknowledgement reach this subscriber.
+func applyTier(sub *subscribe.Subscriber, event, tierStr string) (int, string) {
+	tier, err := strconv.Atoi(tierStr)
+	if err != nil || tier < 0 || tier > chat.MaxAckTier {
+		return http.StatusBadRequest, fmt.Sprintf("ERROR: tier must be 0–%d\n", chat.MaxAckTier)
+	}
+
+	name := sub.Events.Name(event)
+	if name == "" {
+		return http.StatusNotFound, "ERROR: not subscribed to " + event + "\n"
+	}
+
+	chat.SetSubTier(sub, name, tier)
+
+	return http.StatusOK, fmt.Sprintf("OK: %s gets %s alerts at tier %d\n", subLabel(sub), name, tier)
+}
+
+// applyModes sets the household modes a subscription fires in, from a comma
+// list. An empty list means every mode.
+func applyModes(sub *subscribe.Subscriber, event, list string) (int, string) {
+	modes := make([]string, 0, len(chat.Modes()))
+
+	for name := range strings.SplitSeq(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		mode, err := chat.ParseMode(name)
+		if err != nil {
+			return http.StatusBadRequest, "ERROR: " + err.Error() + "\n"
+		}
+
+		modes = append(modes, mode)
+	}
+
+	name := sub.Events.Name(event)
+	if name == "" {
+		return http.StatusNotFound, "ERROR: not subscribed to " + event + "\n"
+	}
+
+	chat.SetSubModes(sub, name, modes)
+
+	return http.StatusOK, fmt.Sprintf("OK: %s gets %s alerts in %s\n",
+		subLabel(sub), name, strings.Join(chat.SubModes(sub, name), ", "))
+}
+
 func subLabel(sub *subscribe.Subscriber) string {
 	if sub == nil {
 		return "?"
@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+	"github.com/gorilla/mux"
+)
+
+// webhookAddHandler handles PUT /api/v1.0/webhook with form field url.
+//
+// It registers the URL as a webhook subscriber (API "webhook") and replies with
+// its subscriber ID. Subscribe it to events with
+// /api/v1.0/sub/subscribe/webhook/{id}/{event}. Registering a URL again is a no-op.
+func (c *Config) webhookAddHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID, hookURL := messenger.ReqID(messenger.IDLength), request.FormValue("url")
+
+	err := messenger.ValidWebhookURL(hookURL)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: "+err.Error()+"\n", "webhook")
+		return
+	}
+
+	id := messenger.WebhookID(hookURL)
+
+	c.catalog.Lock()
+	defer c.catalog.Unlock()
+
+	if _, err := c.Subs.GetSubscriberByID(id, messenger.APIWebhook); err == nil {
+		c.finishReq(writer, request, reqID, http.StatusOK,
+			fmt.Sprintf("OK: webhook %d already registered\n", id), "webhook")
+
+		return
+	}
+
+	sub := c.Subs.CreateSubWithID(id, hookURL, messenger.APIWebhook, false, false)
+	chat.SetSubAuthed(sub, true) // nothing to unlock: only API callers can add webhooks.
+
+	err = chat.SaveState(c.Subs)
+	if err != nil {
+		_ = c.Subs.DeleteSubscriber(id, messenger.APIWebhook)
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError,
+			"ERROR: save failed: "+err.Error()+"\n", "webhook")
+
+		return
+	}
+
+	c.finishReq(writer, request, reqID, http.StatusOK,
+		fmt.Sprintf("OK: registered webhook %d\n", id), "webhook")
+}
+
+// webhookRemoveHandler handles DELETE /api/v1.0/webhook/{id}.
+func (c *Config) webhookRemoveHandler(writer http.ResponseWriter, request *http.Request) {
+	reqID, idStr := messenger.ReqID(messenger.IDLength), mux.Vars(request)["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusBadRequest, "ERROR: invalid webhook id\n", "webhook")
+		return
+	}
+
+	c.catalog.Lock()
+	defer c.catalog.Unlock()
+
+	err = c.Subs.DeleteSubscriber(id, messenger.APIWebhook)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusNotFound,
+			"ERROR: webhook not found: "+idStr+"\n", "webhook")
+
+		return
+	}
+
+	err = chat.SaveState(c.Subs)
+	if err != nil {
+		c.finishReq(writer, request, reqID, http.StatusInternalServerError,
+			"ERROR: save failed: "+err.Error()+"\n", "webhook")
+
+		return
+	}
+
+	c.finishReq(writer, request, reqID, http.StatusOK, "OK: removed webhook "+idStr+"\n", "webhook")
+}
@@ -0,0 +1,54 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/davidnewhall/motifini/pkg/chat"
+	"github.com/davidnewhall/motifini/pkg/messenger"
+)
+
+func TestWebhookAddRemove(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := testConfig(t)
+	hookURL := "http://nodered.local:1880/motifini"
+	idStr := strconv.FormatInt(messenger.WebhookID(hookURL), 10)
+
+	rec := doRequest(cfg.webhookAddHandler, "PUT", "/api/v1.0/webhook",
+		"url="+hookURL, "application/x-www-form-urlencoded", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "registered webhook "+idStr) {
+		t.Fatalf("add: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	sub, err := cfg.Subs.GetSubscriberByID(messenger.WebhookID(hookURL), messenger.APIWebhook)
+	if err != nil || chat.SubContact(sub) != hookURL || !chat.SubAuthed(sub) {
+		t.Fatalf("webhook subscriber not stored as authed with its URL: %v", err)
+	}
+
+	rec = doRequest(cfg.webhookAddHandler, "PUT", "/api/v1.0/webhook",
+		"url="+hookURL, "application/x-www-form-urlencoded", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "already registered") {
+		t.Fatalf("re-add: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(cfg.webhookAddHandler, "PUT", "/api/v1.0/webhook",
+		"url=ftp://example.org/", "application/x-www-form-urlencoded", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("non-http URL: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(cfg.webhookRemoveHandler, "DELETE", "/api/v1.0/webhook/"+idStr, "", "",
+		map[string]string{"id": idStr})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("remove: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(cfg.webhookRemoveHandler, "DELETE", "/api/v1.0/webhook/"+idStr, "", "",
+		map[string]string{"id": idStr})
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("remove twice: code=%d body=%q", rec.Code, rec.Body.String())
+	}
+}
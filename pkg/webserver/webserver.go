@@ -22,8 +22,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/davidnewhall/motifini/pkg/archive"
 	"github.com/davidnewhall/motifini/pkg/chat"
 	"github.com/davidnewhall/motifini/pkg/export"
+	"github.com/davidnewhall/motifini/pkg/history"
 	"github.com/davidnewhall/motifini/pkg/messenger"
 	"github.com/gorilla/mux"
 	"golift.io/securityspy/v2"
@@ -41,6 +43,10 @@ const (
 // a non-localhost address without an api_key.
 var ErrAPIKeyRequired = errors.New("api_key is required when listen_addr is not localhost")
 
+// ErrDeliveryFailed is returned when Telegram refused a send for one or more
+// recipients, even after flood-wait retries.
+var ErrDeliveryFailed = errors.New("delivery failed")
+
 // Config holds HTTP server dependencies and listen settings.
 type Config struct {
 	// catalog serializes the read-modify-save transactions the event API runs
@@ -52,6 +58,8 @@ type Config struct {
 	SSpy             *securityspy.Server
 	Subs             *subscribe.Subscribe
 	Msgs             *messenger.Messenger
+	History          *history.Store   // nil when the event history is off
+	Archive          *archive.Archive // nil unless archive_dir is set
 	Info             *log.Logger
 	Debug            *log.Logger
 	Error            *log.Logger
@@ -110,7 +118,8 @@ func Start(cfg *Config) error {
 }
 
 // handler builds the routed handler stack. When an API key is configured,
-// every route (including /debug/vars) requires it.
+// every route (including /debug/vars) requires it, except Telegram's webhook
+// route, which checks Telegram's secret token instead.
 func (c *Config) handler() http.Handler {
 	router := mux.NewRouter()
 	router.Handle("/debug/vars", http.DefaultServeMux).Methods("GET")
@@ -118,14 +127,31 @@ func (c *Config) handler() http.Handler {
 	router.HandleFunc("/api/v1.0/send/{app:telegram}/picture/{to}/{camera}", c.sendPictureHandler).Methods("GET")
 	router.HandleFunc("/api/v1.0/send/{app:telegram}/msg/{to}", c.sendMessageHandler).
 		Methods("GET").Queries("msg", "{msg}")
+	router.HandleFunc("/api/v1.0/grid", c.gridHandler).Methods("GET")
 	router.HandleFunc("/api/v1.0/events", c.eventsListHandler).Methods("GET")
 	router.HandleFunc("/api/v1.0/event/{event}", c.eventUpsertHandler).Methods("PUT")
 	router.HandleFunc("/api/v1.0/event/{cmd:remove|notify}/{event}", c.eventsHandler).Methods("POST")
-	router.HandleFunc("/api/v1.0/sub/{cmd:subscribe|unsubscribe|pause|unpause}/{api}/{contact}/{event}",
+	router.HandleFunc("/api/v1.0/history", c.historyHandler).Methods("GET")
+	router.HandleFunc("/api/v1.0/archive", c.archiveListHandler).Methods("GET")
+	router.HandleFunc(archivePath+"{camera}/{file}", c.archiveFileHandler).Methods("GET")
+	router.HandleFunc("/api/v1.0/mode", c.modeHandler).Methods("GET")
+	router.HandleFunc("/api/v1.0/mode/{mode}", c.modeSetHandler).Methods("PUT")
+	router.HandleFunc("/api/v1.0/sub/{cmd:subscribe|unsubscribe|pause|unpause|tier|modes}/{api}/{contact}/{event}",
 		c.subsHandler).Methods("GET")
+	router.HandleFunc("/api/v1.0/webhook", c.webhookAddHandler).Methods("PUT")
+	router.HandleFunc("/api/v1.0/webhook/{id}", c.webhookRemoveHandler).Methods("DELETE")
+	router.HandleFunc("/api/v1.0/push/{api:ntfy|pushover}", c.pushAddHandler).Methods("PUT")
+	router.HandleFunc("/api/v1.0/push/{api:ntfy|pushover}/{id}", c.pushRemoveHandler).Methods("DELETE")
 	router.PathPrefix("/").HandlerFunc(c.handleAll)
 
-	return c.requireAPIKey(router)
+	outer := mux.NewRouter()
+	if c.Msgs != nil {
+		outer.HandleFunc(messenger.TelegramWebhookPath, c.Msgs.ServeTelegramWebhook).Methods("POST")
+	}
+
+	outer.PathPrefix("/").Handler(c.requireAPIKey(router))
+
+	return outer
 }
 
 // Start creates the http routers and starts http server
@@ -202,6 +228,24 @@ func (c *Config) finishReqJSON(
 	}
 }
 
+// finishReqJPEG is finishReq for a JPEG image.
+func (c *Config) finishReqJPEG(
+	writer http.ResponseWriter, request *http.Request, reqID string, reply []byte, cmd string,
+) {
+	export.Map.HTTPVisits.Add(1)
+	c.Info.Printf(`[%v] %v %v "%v %v" %d %d "%v" "%v"`,
+		reqID, request.RemoteAddr, request.Host, request.Method, redactAPIKey(request),
+		http.StatusOK, len(reply), request.UserAgent(), cmd)
+	writer.Header().Set("Content-Type", "image/jpeg")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(reply)))
+	writer.WriteHeader(http.StatusOK)
+
+	_, err := writer.Write(reply)
+	if err != nil {
+		c.Error.Printf("[%v] Error Sending Reply: %v", reqID, err)
+	}
+}
+
 // handle any unknown URIs.
 func (c *Config) handleAll(writer http.ResponseWriter, request *http.Request) {
 	export.Map.HTTPVisits.Add(1)